@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 
 	"github.com/apprenda/kismatic/pkg/cli"
@@ -11,6 +12,6 @@ var version string
 var buildDate string
 
 func main() {
-	cmd, _ := cli.NewKismaticCommand(version, buildDate, os.Stdin, os.Stdout)
+	cmd, _ := cli.NewKismaticCommand(context.Background(), version, buildDate, os.Stdin, os.Stdout)
 	doc.GenMarkdownTree(cmd, "./docs/kismatic-cli")
 }
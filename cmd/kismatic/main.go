@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/apprenda/kismatic/pkg/cli"
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/ssh"
 	"github.com/apprenda/kismatic/pkg/util"
 	"time"
 	"math/rand"
@@ -15,13 +20,38 @@ var buildDate string
 
 func main() {
 	rand.Seed(time.Now().UnixNano())
-	cmd, err := cli.NewKismaticCommand(version, buildDate, os.Stdin, os.Stdout)
+	// The version is not set on development builds, in which case upgrades are disabled
+	if err := install.SetVersion(version); err != nil && version != "" {
+		util.PrintColor(os.Stderr, util.Orange, "Warning: %v, upgrades are disabled for this build\n", err)
+	}
+	// Running playbooks are aborted when kismatic is interrupted
+	cmd, err := cli.NewKismaticCommand(interruptContext(), version, buildDate, os.Stdin, os.Stdout)
 	if err != nil {
 		util.PrintColor(os.Stderr, util.Red, "Error initializing command: %v\n", err)
 		os.Exit(1)
 	}
-	if err := cmd.Execute(); err != nil {
+	err = cmd.Execute()
+	// Stop the SSH agent that holds the keys decrypted with a passphrase
+	ssh.StopAgent()
+	if err != nil {
 		util.PrintColor(os.Stderr, util.Red, "%v\n", err)
 		os.Exit(1)
 	}
 }
+
+// returns a context that is canceled when an interrupt or termination signal is received.
+// kismatic exits once the running playbook is aborted, or immediately on the next signal.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		util.PrintColor(os.Stderr, util.Red, "\nInterrupted, aborting... Interrupt again to exit immediately\n")
+		cancel()
+		<-sigs
+		ssh.StopAgent()
+		os.Exit(1)
+	}()
+	return ctx
+}
@@ -154,7 +154,7 @@ func deployDockerRegistry(node NodeDeets, listeningPort int, sshKey string) (str
 		Organization:       "someOrg",
 		OrganizationalUnit: "someOrgUnit",
 	}
-	key, caCert, err := tls.NewCACert("test-resources/ca-csr.json", "someCommonName", subject)
+	key, caCert, err := tls.NewCACert("test-resources/ca-csr.json", "someCommonName", subject, "")
 	if err != nil {
 		return "", fmt.Errorf("error generating CA cert for Docker: %v", err)
 	}
@@ -19,6 +19,7 @@ type ClusterCatalog struct {
 	EnablePackageInstallation bool   `yaml:"allow_package_installation"`
 	KuberangPath              string `yaml:"kuberang_path"`
 	LoadBalancedFQDN          string `yaml:"kubernetes_load_balanced_fqdn"`
+	KismaticVersion           string `yaml:"kismatic_version"`
 
 	EnablePrivateDockerRegistry  bool   `yaml:"use_private_docker_registry"`
 	EnableInternalDockerRegistry bool   `yaml:"setup_internal_docker_registry"`
@@ -35,10 +36,16 @@ type ClusterCatalog struct {
 	ForceCalicoNodeRestart        bool `yaml:"force_calico_node_restart"`
 	ForceDockerRestart            bool `yaml:"force_docker_restart"`
 
+	// ReissueServiceAccountTokens deletes the service account tokens, which are
+	// re-issued by the controller manager with the current service account key
+	ReissueServiceAccountTokens bool `yaml:"reissue_service_account_tokens"`
+
 	EnableConfigureIngress bool `yaml:"configure_ingress"`
 
 	KismaticPreflightCheckerLinux string `yaml:"kismatic_preflight_checker"`
 	KismaticPreflightCheckerLocal string `yaml:"kismatic_preflight_checker_local"`
+	// the arguments of the inspector client for reaching the nodes through an SSH bastion
+	KismaticPreflightCheckerBastionArgs string `yaml:"kismatic_preflight_checker_bastion_args,omitempty"`
 
 	WorkerNode string `yaml:"worker_node"`
 
@@ -54,6 +61,9 @@ type ClusterCatalog struct {
 	VolumeQuotaBytes        int    `yaml:"volume_quota_bytes"`
 	VolumeMount             string `yaml:"volume_mount"`
 	VolumeAllowedIPs        string `yaml:"volume_allow_ips"`
+
+	// backup vars
+	BackupDirectory string `yaml:"backup_directory"`
 }
 
 type NFSVolume struct {
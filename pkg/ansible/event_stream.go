@@ -10,6 +10,13 @@ import (
 // EventStream reads JSON lines from the incoming stream, and convert them
 // into a stream of events.
 func EventStream(in io.Reader) <-chan Event {
+	return RecordedEventStream(in, nil)
+}
+
+// RecordedEventStream is an EventStream that writes the JSON line of each event
+// to the record, if not nil. The record is closed when the playbook ends, or when
+// the incoming stream is done. Failing to write the record does not affect the stream.
+func RecordedEventStream(in io.Reader, record io.WriteCloser) <-chan Event {
 	scanner := bufio.NewScanner(in)
 	out := make(chan Event)
 	go func() {
@@ -20,8 +27,18 @@ func EventStream(in io.Reader) <-chan Event {
 				// handle this error? Maybe have an outErr channel
 				continue
 			}
+			if record != nil {
+				_, err = fmt.Fprintf(record, "%s\n", jl)
+				if _, ok := event.(*PlaybookEndEvent); ok || err != nil {
+					record.Close()
+					record = nil
+				}
+			}
 			out <- event
 		}
+		if record != nil {
+			record.Close()
+		}
 		// Close the channel, as the stream is done
 		close(out)
 	}()
@@ -44,3 +44,49 @@ func TestEventStreamMultipleEvents(t *testing.T) {
 		t.Errorf("invalid number of events received")
 	}
 }
+
+type fakeRecord struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (r *fakeRecord) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestRecordedEventStream(t *testing.T) {
+	in := bytes.NewBufferString(`{"eventType":"PLAYBOOK_START", "eventData": {"name":"somePlaybook"}}
+not an event
+{"eventType":"PLAY_START", "eventData": {"name":"somePlay"}}
+{"eventType":"PLAYBOOK_END", "eventData": {"name":"somePlaybook"}}
+{"eventType":"PLAY_START", "eventData": {"name":"afterTheEnd"}}
+`)
+	record := &fakeRecord{}
+	i := 0
+	for range RecordedEventStream(in, record) {
+		i++
+	}
+	if i != 4 {
+		t.Errorf("expected 4 events, but got %d", i)
+	}
+	expected := `{"eventType":"PLAYBOOK_START", "eventData": {"name":"somePlaybook"}}
+{"eventType":"PLAY_START", "eventData": {"name":"somePlay"}}
+{"eventType":"PLAYBOOK_END", "eventData": {"name":"somePlaybook"}}
+`
+	if record.String() != expected {
+		t.Errorf("expected the events until the end of the playbook to be recorded, but got:\n%s", record.String())
+	}
+	if !record.closed {
+		t.Errorf("expected the record to be closed when the playbook ends")
+	}
+
+	// The recorded events are read back as the same events
+	replayed := 0
+	for range EventStream(bytes.NewBufferString(record.String())) {
+		replayed++
+	}
+	if replayed != 3 {
+		t.Errorf("expected 3 replayed events, but got %d", replayed)
+	}
+}
@@ -3,6 +3,7 @@ package ansible
 import (
 	"bytes"
 	"fmt"
+	"strings"
 )
 
 // Inventory is a collection of Nodes, keyed by role.
@@ -32,6 +33,11 @@ type Node struct {
 	SSHPort int
 	// SSHUser is the SSH user for logging into the node
 	SSHUser string
+	// SSHProxyCommand is the command used for tunneling the SSH connection to the
+	// node through a bastion. The node is accessed directly if empty.
+	SSHProxyCommand string
+	// SSHProxyPrivateKey is the private key used by the proxy command
+	SSHProxyPrivateKey string
 }
 
 // ToINI converts the inventory into INI format
@@ -44,9 +50,18 @@ func (i Inventory) ToINI() []byte {
 			if n.InternalIP != "" {
 				internalIP = n.InternalIP
 			}
-			fmt.Fprintf(w, "%q ansible_host=%q internal_ipv4=%q ansible_ssh_private_key_file=%q ansible_port=%d ansible_user=%q\n", n.Host, n.PublicIP, internalIP, n.SSHPrivateKey, n.SSHPort, n.SSHUser)
+			fmt.Fprintf(w, "%q ansible_host=%q internal_ipv4=%q ansible_ssh_private_key_file=%q ansible_port=%d ansible_user=%q", n.Host, n.PublicIP, internalIP, n.SSHPrivateKey, n.SSHPort, n.SSHUser)
+			if n.SSHProxyCommand != "" {
+				fmt.Fprintf(w, " ansible_ssh_common_args=%q", "-o ProxyCommand="+shellQuote(n.SSHProxyCommand))
+			}
+			fmt.Fprintln(w)
 		}
 	}
 
 	return w.Bytes()
 }
+
+// quotes the argument, as Ansible splits the SSH arguments like a shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
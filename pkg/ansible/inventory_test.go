@@ -70,3 +70,63 @@ func TestInventoryINIGeneration(t *testing.T) {
 	}
 
 }
+
+func TestInventoryINIGenerationWithProxyCommand(t *testing.T) {
+	inv := Inventory{
+		Roles: []Role{
+			{
+				Name: "worker",
+				Nodes: []Node{
+					{
+						Host:            "worker01",
+						PublicIP:        "10.0.0.3",
+						SSHPrivateKey:   "id_rsa",
+						SSHPort:         22,
+						SSHUser:         "alice",
+						SSHProxyCommand: "ssh -i id_rsa -p 22 -W %h:%p alice@bastion",
+					},
+				},
+			},
+		},
+	}
+
+	ini := string(inv.ToINI())
+
+	expected := `[worker]
+"worker01" ansible_host="10.0.0.3" internal_ipv4="10.0.0.3" ansible_ssh_private_key_file="id_rsa" ansible_port=22 ansible_user="alice" ansible_ssh_common_args="-o ProxyCommand='ssh -i id_rsa -p 22 -W %h:%p alice@bastion'"
+`
+
+	if ini != expected {
+		t.Errorf("expected format differs from obtained format. Expected: \n%s\nGot: \n%s\n", expected, ini)
+	}
+}
+
+func TestInventoryINIGenerationWithQuotedProxyCommand(t *testing.T) {
+	inv := Inventory{
+		Roles: []Role{
+			{
+				Name: "worker",
+				Nodes: []Node{
+					{
+						Host:            "worker01",
+						PublicIP:        "10.0.0.3",
+						SSHPrivateKey:   "id_rsa",
+						SSHPort:         22,
+						SSHUser:         "alice",
+						SSHProxyCommand: "ssh -i '/keys/alice'\\''s key' -p 22 -W %h:%p alice@bastion",
+					},
+				},
+			},
+		},
+	}
+
+	ini := string(inv.ToINI())
+
+	expected := `[worker]
+"worker01" ansible_host="10.0.0.3" internal_ipv4="10.0.0.3" ansible_ssh_private_key_file="id_rsa" ansible_port=22 ansible_user="alice" ansible_ssh_common_args="-o ProxyCommand='ssh -i '\\''/keys/alice'\\''\\'\\'''\\''s key'\\'' -p 22 -W %h:%p alice@bastion'"
+`
+
+	if ini != expected {
+		t.Errorf("expected format differs from obtained format. Expected: \n%s\nGot: \n%s\n", expected, ini)
+	}
+}
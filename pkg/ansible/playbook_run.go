@@ -0,0 +1,182 @@
+package ansible
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// playbookRun is an ansible-playbook process that is killed, along with the
+// processes it forked, when the context of the run is canceled or a timeout expires
+type playbookRun struct {
+	cmd       *exec.Cmd
+	namedPipe string
+	timeout   time.Duration
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	sync.Mutex
+	taskTimer   *time.Timer
+	taskTimeout time.Duration
+	// the task that did not complete within the task timeout
+	timedOutTask string
+	// the named pipe of the event stream and the file where the events are recorded
+	streamFiles []io.Closer
+	closeOnce   sync.Once
+}
+
+// watchPlaybook watches the started ansible-playbook process, killing it when the
+// context is canceled or the timeout of the runner expires
+func (r *runner) watchPlaybook(ctx context.Context, cmd *exec.Cmd, namedPipe string) *playbookRun {
+	run := &playbookRun{
+		cmd:       cmd,
+		namedPipe: namedPipe,
+		timeout:   r.options.Timeout,
+		done:      make(chan struct{}),
+	}
+	if run.timeout > 0 {
+		run.ctx, run.cancel = context.WithTimeout(ctx, run.timeout)
+	} else {
+		run.ctx, run.cancel = context.WithCancel(ctx)
+	}
+	go func() {
+		select {
+		case <-run.ctx.Done():
+			// A negative pid signals all the processes in the process group
+			syscall.Kill(-run.cmd.Process.Pid, syscall.SIGKILL)
+		case <-run.done:
+		}
+	}()
+	return run
+}
+
+// wait blocks until the process exits, and removes the named pipe of the run
+func (run *playbookRun) wait() error {
+	execErr := run.cmd.Wait()
+	if execErr != nil {
+		// Report why the process was killed, if it was
+		if abortErr := run.abortError(); abortErr != nil {
+			execErr = abortErr
+			// The playbook did not end, so the event stream is not closed otherwise
+			run.closeStream()
+		}
+	}
+	close(run.done)
+	run.stopTaskTimer()
+	run.cancel()
+	// Process exited, we can clean up named pipe
+	removeErr := os.Remove(run.namedPipe)
+	if removeErr != nil && execErr != nil {
+		return fmt.Errorf("an error occurred running ansible: %v. Removing named pipe at %q failed: %v", execErr, run.namedPipe, removeErr)
+	}
+	if removeErr != nil {
+		return fmt.Errorf("failed to clean up named pipe at %q: %v", run.namedPipe, removeErr)
+	}
+	if execErr != nil {
+		return fmt.Errorf("error running ansible: %v", execErr)
+	}
+	return nil
+}
+
+func (run *playbookRun) abortError() error {
+	run.Lock()
+	defer run.Unlock()
+	if run.timedOutTask != "" {
+		return fmt.Errorf("%s did not complete within the task timeout of %v", run.timedOutTask, run.taskTimeout)
+	}
+	switch run.ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		if run.timeout > 0 {
+			return fmt.Errorf("playbook did not complete within the timeout of %v", run.timeout)
+		}
+	}
+	return fmt.Errorf("playbook was aborted: %v", run.ctx.Err())
+}
+
+// streamEvents returns the stream of the events read from the named pipe, which are
+// recorded to the record. The named pipe is open for writing too, so it never reaches EOF:
+// the pipe and the record are closed when the playbook ends, or when it is aborted.
+func (run *playbookRun) streamEvents(pipe *os.File, record io.WriteCloser) <-chan Event {
+	run.Lock()
+	run.streamFiles = []io.Closer{pipe, record}
+	run.Unlock()
+	in := RecordedEventStream(pipe, record)
+	out := make(chan Event)
+	go func() {
+		for e := range in {
+			out <- e
+			if _, ok := e.(*PlaybookEndEvent); ok {
+				run.closeStream()
+			}
+		}
+		close(out)
+	}()
+	return out
+}
+
+func (run *playbookRun) closeStream() {
+	run.closeOnce.Do(func() {
+		run.Lock()
+		defer run.Unlock()
+		for _, f := range run.streamFiles {
+			f.Close()
+		}
+	})
+}
+
+// watchTasks aborts the run when a task does not complete within the task timeout.
+// A task is complete when the next task or play starts, or when the playbook ends.
+func (run *playbookRun) watchTasks(in <-chan Event, taskTimeout time.Duration) <-chan Event {
+	run.Lock()
+	run.taskTimeout = taskTimeout
+	run.Unlock()
+	out := make(chan Event)
+	go func() {
+		for e := range in {
+			switch event := e.(type) {
+			case *PlayStartEvent:
+				// Facts are gathered when a play starts
+				run.startTaskTimer(fmt.Sprintf("play %q", event.Name), taskTimeout)
+			case *TaskStartEvent:
+				run.startTaskTimer(fmt.Sprintf("task %q", event.Name), taskTimeout)
+			case *HandlerTaskStartEvent:
+				run.startTaskTimer(fmt.Sprintf("handler %q", event.Name), taskTimeout)
+			case *PlaybookEndEvent:
+				run.stopTaskTimer()
+			}
+			out <- e
+		}
+		close(out)
+	}()
+	return out
+}
+
+func (run *playbookRun) startTaskTimer(task string, taskTimeout time.Duration) {
+	run.Lock()
+	defer run.Unlock()
+	if run.taskTimer != nil {
+		run.taskTimer.Stop()
+	}
+	run.taskTimer = time.AfterFunc(taskTimeout, func() {
+		run.Lock()
+		run.timedOutTask = task
+		run.Unlock()
+		run.cancel()
+	})
+}
+
+func (run *playbookRun) stopTaskTimer() {
+	run.Lock()
+	defer run.Unlock()
+	if run.taskTimer != nil {
+		run.taskTimer.Stop()
+	}
+}
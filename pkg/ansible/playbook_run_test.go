@@ -0,0 +1,182 @@
+package ansible
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// starts a long running process in its own process group, along with a named pipe
+func startTestPlaybookRun(t *testing.T, ctx context.Context, options RunnerOptions) *playbookRun {
+	dir, err := ioutil.TempDir("", "playbook-run-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	namedPipe := filepath.Join(dir, "pipe")
+	if err = syscall.Mkfifo(namedPipe, 0644); err != nil {
+		t.Fatalf("error creating named pipe: %v", err)
+	}
+	// The shell forks the sleep process, which must be killed along with it
+	cmd := exec.Command("sh", "-c", "sleep 30; echo done")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = cmd.Start(); err != nil {
+		t.Fatalf("error starting process: %v", err)
+	}
+	r := &runner{options: options}
+	return r.watchPlaybook(ctx, cmd, namedPipe)
+}
+
+func waitWithDeadline(t *testing.T, run *playbookRun) error {
+	errCh := make(chan error)
+	go func() { errCh <- run.wait() }()
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("playbook run was not aborted")
+	}
+	return nil
+}
+
+func assertProcessGroupKilled(t *testing.T, run *playbookRun) {
+	// Killed processes that were forked might not have been reaped yet
+	var err error
+	for i := 0; i < 50; i++ {
+		if err = syscall.Kill(-run.cmd.Process.Pid, 0); err == syscall.ESRCH {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != syscall.ESRCH {
+		t.Errorf("expected process group to be killed, but got %v", err)
+	}
+	if _, err := os.Stat(run.namedPipe); !os.IsNotExist(err) {
+		t.Errorf("expected named pipe to be removed, but got %v", err)
+	}
+}
+
+func TestPlaybookRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := startTestPlaybookRun(t, ctx, RunnerOptions{})
+	cancel()
+	err := waitWithDeadline(t, run)
+	if err == nil || !strings.Contains(err.Error(), "aborted") {
+		t.Errorf("expected playbook to be aborted, but got %v", err)
+	}
+	assertProcessGroupKilled(t, run)
+}
+
+func TestPlaybookRunTimeout(t *testing.T) {
+	run := startTestPlaybookRun(t, context.Background(), RunnerOptions{Timeout: 100 * time.Millisecond})
+	err := waitWithDeadline(t, run)
+	if err == nil || !strings.Contains(err.Error(), "did not complete within the timeout") {
+		t.Errorf("expected playbook to time out, but got %v", err)
+	}
+	assertProcessGroupKilled(t, run)
+}
+
+func TestPlaybookRunTaskTimeout(t *testing.T) {
+	run := startTestPlaybookRun(t, context.Background(), RunnerOptions{})
+	events := make(chan Event)
+	out := run.watchTasks(events, 100*time.Millisecond)
+	go func() {
+		for range out {
+		}
+	}()
+	events <- &TaskStartEvent{namedEvent{Name: "some task"}}
+	err := waitWithDeadline(t, run)
+	if err == nil || !strings.Contains(err.Error(), `task "some task" did not complete within the task timeout`) {
+		t.Errorf("expected task to time out, but got %v", err)
+	}
+	assertProcessGroupKilled(t, run)
+	close(events)
+}
+
+func TestPlaybookRunComplete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook-run-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	namedPipe := filepath.Join(dir, "pipe")
+	if err = syscall.Mkfifo(namedPipe, 0644); err != nil {
+		t.Fatalf("error creating named pipe: %v", err)
+	}
+	cmd := exec.Command("true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = cmd.Start(); err != nil {
+		t.Fatalf("error starting process: %v", err)
+	}
+	r := &runner{options: RunnerOptions{Timeout: time.Minute, TaskTimeout: time.Minute}}
+	run := r.watchPlaybook(context.Background(), cmd, namedPipe)
+	if err := waitWithDeadline(t, run); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(namedPipe); !os.IsNotExist(err) {
+		t.Errorf("expected named pipe to be removed, but got %v", err)
+	}
+}
+
+// opens the named pipe of the run for reading and writing, as the runner does
+func openTestEventStream(t *testing.T, run *playbookRun) (*os.File, *os.File) {
+	pipe, err := os.OpenFile(run.namedPipe, os.O_RDWR, os.ModeNamedPipe)
+	if err != nil {
+		t.Fatalf("error opening named pipe: %v", err)
+	}
+	record, err := ioutil.TempFile("", "events")
+	if err != nil {
+		t.Fatalf("error creating events file: %v", err)
+	}
+	return pipe, record
+}
+
+func assertStreamClosed(t *testing.T, events <-chan Event) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("expected the event stream to be closed")
+		}
+	}
+}
+
+func TestPlaybookRunCanceledClosesEventStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := startTestPlaybookRun(t, ctx, RunnerOptions{})
+	pipe, record := openTestEventStream(t, run)
+	defer os.Remove(record.Name())
+	events := run.streamEvents(pipe, record)
+	cancel()
+	waitWithDeadline(t, run)
+	assertStreamClosed(t, events)
+	if err := record.Close(); err == nil {
+		t.Errorf("expected the events file to be closed")
+	}
+}
+
+func TestPlaybookRunEventStreamClosedWhenPlaybookEnds(t *testing.T) {
+	run := startTestPlaybookRun(t, context.Background(), RunnerOptions{})
+	defer func() {
+		run.cancel()
+		waitWithDeadline(t, run)
+	}()
+	pipe, record := openTestEventStream(t, run)
+	defer os.Remove(record.Name())
+	events := run.streamEvents(pipe, record)
+	if _, err := pipe.WriteString(`{"eventType":"PLAYBOOK_END", "eventData": {"name":"test.yaml"}}` + "\n"); err != nil {
+		t.Fatalf("error writing event: %v", err)
+	}
+	if e := <-events; e.Type() != "Playbook End" {
+		t.Errorf("expected the playbook end event, but got %v", e)
+	}
+	assertStreamClosed(t, events)
+}
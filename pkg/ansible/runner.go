@@ -1,6 +1,7 @@
 package ansible
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -20,21 +21,36 @@ const (
 	JSONLinesFormat = OutputFormat("json_lines")
 )
 
+// EventsFile is the file of the run directory where the events of the run are recorded,
+// as JSON lines
+const EventsFile = "events.jsonl"
+
 // OutputFormat is used for controlling the STDOUT format of the Ansible runner
 type OutputFormat string
 
 // Runner for running Ansible playbooks
 type Runner interface {
 	// StartPlaybook runs the playbook asynchronously with the given inventory and extra vars.
+	// The playbook file is relative to the playbooks directory, unless it is an absolute path.
+	// The playbook is aborted when the context is canceled.
 	// It returns a read-only channel that must be consumed for the playbook execution to proceed.
-	StartPlaybook(playbookFile string, inventory Inventory, cc ClusterCatalog) (<-chan Event, error)
+	StartPlaybook(ctx context.Context, playbookFile string, inventory Inventory, cc ClusterCatalog) (<-chan Event, error)
 	// WaitPlaybook blocks until the execution of the playbook is complete. If an error occurred,
 	// it is returned. Otherwise, returns nil to signal the completion of the playbook.
 	WaitPlaybook() error
 	// StartPlaybookOnNode runs the playbook asynchronously with the given inventory and extra vars
-	// against the specific node.
+	// against the specific node. The playbook is aborted when the context is canceled.
 	// It returns a read-only channel that must be consumed for the playbook execution to proceed.
-	StartPlaybookOnNode(playbookFile string, inventory Inventory, cc ClusterCatalog, node string) (<-chan Event, error)
+	StartPlaybookOnNode(ctx context.Context, playbookFile string, inventory Inventory, cc ClusterCatalog, node string) (<-chan Event, error)
+}
+
+// RunnerOptions are used to configure the runner
+type RunnerOptions struct {
+	// Timeout is the maximum duration of a playbook run. There is no limit if zero.
+	Timeout time.Duration
+	// TaskTimeout is the maximum duration of a single task of a playbook run.
+	// There is no limit if zero.
+	TaskTimeout time.Duration
 }
 
 type runner struct {
@@ -46,12 +62,13 @@ type runner struct {
 	pythonPath   string
 	ansibleDir   string
 	runDir       string
+	options      RunnerOptions
 	waitPlaybook func() error
 	namedPipe    string
 }
 
 // NewRunner returns a new runner for running Ansible playbooks.
-func NewRunner(out, errOut io.Writer, ansibleDir string, runDir string) (Runner, error) {
+func NewRunner(out, errOut io.Writer, ansibleDir string, runDir string, options RunnerOptions) (Runner, error) {
 	// Ansible depends on python 2.7 being installed and on the path as "python".
 	// Validate that it is available
 	if _, err := exec.LookPath("python"); err != nil {
@@ -69,45 +86,40 @@ func NewRunner(out, errOut io.Writer, ansibleDir string, runDir string) (Runner,
 		pythonPath: ppath,
 		ansibleDir: ansibleDir,
 		runDir:     runDir,
+		options:    options,
 	}, nil
 }
 
 // WaitPlaybook blocks until the ansible process running the playbook exits.
-// If the process exits with a non-zero status, it will return an error.
+// If the process exits with a non-zero status, or is aborted, it will return an error.
 func (r *runner) WaitPlaybook() error {
 	if r.waitPlaybook == nil {
 		return fmt.Errorf("wait called, but playbook not started")
 	}
-	execErr := r.waitPlaybook()
-	// Process exited, we can clean up named pipe
-	removeErr := os.Remove(r.namedPipe)
-	if removeErr != nil && execErr != nil {
-		return fmt.Errorf("an error occurred running ansible: %v. Removing named pipe at %q failed: %v", execErr, r.namedPipe, removeErr)
-	}
-	if removeErr != nil {
-		return fmt.Errorf("failed to clean up named pipe at %q: %v", r.namedPipe, removeErr)
-	}
-	if execErr != nil {
-		return fmt.Errorf("error running ansible: %v", execErr)
-	}
-	return nil
+	return r.waitPlaybook()
 }
 
 // RunPlaybook with the given inventory and extra vars
-func (r *runner) StartPlaybook(playbookFile string, inv Inventory, cc ClusterCatalog) (<-chan Event, error) {
-	return r.startPlaybook(playbookFile, inv, cc, "") // Don't set the --limit arg
+func (r *runner) StartPlaybook(ctx context.Context, playbookFile string, inv Inventory, cc ClusterCatalog) (<-chan Event, error) {
+	return r.startPlaybook(ctx, playbookFile, inv, cc, "") // Don't set the --limit arg
 }
 
 // StartPlaybookOnNode runs the playbook asynchronously with the given inventory and extra vars
 // against the specific node.
 // It returns a read-only channel that must be consumed for the playbook execution to proceed.
-func (r *runner) StartPlaybookOnNode(playbookFile string, inv Inventory, cc ClusterCatalog, node string) (<-chan Event, error) {
+func (r *runner) StartPlaybookOnNode(ctx context.Context, playbookFile string, inv Inventory, cc ClusterCatalog, node string) (<-chan Event, error) {
 	limitArg := node // set the --limit arg to the node we want to target
-	return r.startPlaybook(playbookFile, inv, cc, limitArg)
+	return r.startPlaybook(ctx, playbookFile, inv, cc, limitArg)
 }
 
-func (r *runner) startPlaybook(playbookFile string, inv Inventory, cc ClusterCatalog, limitArg string) (<-chan Event, error) {
-	playbook := filepath.Join(r.ansibleDir, "playbooks", playbookFile)
+func (r *runner) startPlaybook(ctx context.Context, playbookFile string, inv Inventory, cc ClusterCatalog, limitArg string) (<-chan Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("playbook %q was not started: %v", playbookFile, err)
+	}
+	playbook := playbookFile
+	if !filepath.IsAbs(playbook) {
+		playbook = filepath.Join(r.ansibleDir, "playbooks", playbookFile)
+	}
 	if _, err := os.Stat(playbook); os.IsNotExist(err) {
 		return nil, fmt.Errorf("playbook %q does not exist", playbook)
 	}
@@ -132,10 +144,19 @@ func (r *runner) startPlaybook(playbookFile string, inv Inventory, cc ClusterCat
 	if err := copyFileContents(inventoryFile, filepath.Join(r.runDir, "inventory.ini")); err != nil {
 		return nil, fmt.Errorf("error copying inventory.ini to %q: %v", r.runDir, err)
 	}
+	// The events are recorded in the run directory, so that the run can be replayed.
+	// The events of all the playbooks run in the directory are recorded.
+	eventsFile, err := os.OpenFile(filepath.Join(r.runDir, EventsFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating events file in %q: %v", r.runDir, err)
+	}
 
 	cmd := exec.Command(filepath.Join(r.ansibleDir, "bin", "ansible-playbook"), "-i", inventoryFile, "-s", playbook, "--extra-vars", "@"+clusterCatalogFile)
 	cmd.Stdout = r.out
 	cmd.Stderr = r.errOut
+	// Run ansible in its own process group, so that the processes
+	// it forks are killed with it when the playbook is aborted
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	log.SetOutput(r.out)
 
@@ -155,6 +176,7 @@ func (r *runner) startPlaybook(playbookFile string, inv Inventory, cc ClusterCat
 	start := time.Now()
 	r.namedPipe = filepath.Join(os.TempDir(), fmt.Sprintf("ansible-pipe-%s", start.Format("2006-01-02-15-04-05.99999")))
 	if err := syscall.Mkfifo(r.namedPipe, 0644); err != nil {
+		eventsFile.Close()
 		return nil, fmt.Errorf("error creating named pipe %q: %v", r.namedPipe, err)
 	}
 	os.Setenv("ANSIBLE_JSON_LINES_PIPE", r.namedPipe)
@@ -171,16 +193,25 @@ func (r *runner) startPlaybook(playbookFile string, inv Inventory, cc ClusterCat
 	// we start reading from the named pipe
 	err = cmd.Start()
 	if err != nil {
+		os.Remove(r.namedPipe)
+		eventsFile.Close()
 		return nil, fmt.Errorf("error running playbook: %v", err)
 	}
-	r.waitPlaybook = cmd.Wait
+	run := r.watchPlaybook(ctx, cmd, r.namedPipe)
 
 	// Create the event stream out of the named pipe
 	eventStreamFile, err := os.OpenFile(r.namedPipe, os.O_RDWR, os.ModeNamedPipe)
 	if err != nil {
+		run.cancel()
+		run.wait()
+		eventsFile.Close()
 		return nil, fmt.Errorf("error openning event stream pipe: %v", err)
 	}
-	eventStream := EventStream(eventStreamFile)
+	r.waitPlaybook = run.wait
+	eventStream := run.streamEvents(eventStreamFile, eventsFile)
+	if r.options.TaskTimeout > 0 {
+		eventStream = run.watchTasks(eventStream, r.options.TaskTimeout)
+	}
 	return eventStream, nil
 }
 
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type addNodeOpts struct {
+	Role                     string
+	GeneratedAssetsDirectory string
+	RestartServices          bool
+	OutputFormat             string
+	Verbose                  bool
+	SkipPreFlight            bool
+	Timeout                  time.Duration
+	TaskTimeout              time.Duration
+}
+
+// NewCmdAddNode returns the command for adding nodes to the cluster
+func NewCmdAddNode(ctx context.Context, out io.Writer, installOpts *installOpts) *cobra.Command {
+	opts := &addNodeOpts{}
+	cmd := &cobra.Command{
+		Use:   "add-node NODE_NAME NODE_IP [NODE_INTERNAL_IP]",
+		Short: "add a node to an existing Kubernetes cluster",
+		Long: `Add a node to an existing Kubernetes cluster.
+
+The role of the new node is set with the --role flag. When adding an etcd node, the node is added
+as a member of the existing etcd clusters, and the API servers are updated to use the new member.
+When adding a master node, the new master must be added to the load balancer of the masters.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 || len(args) > 3 {
+				return cmd.Usage()
+			}
+			newNode := install.Node{
+				Host: args[0],
+				IP:   args[1],
+			}
+			if len(args) == 3 {
+				newNode.InternalIP = args[2]
+			}
+			return doAddNode(ctx, out, installOpts.planFilename, opts, newNode)
+		},
+	}
+	cmd.Flags().StringVar(&opts.Role, "role", "worker", fmt.Sprintf("role of the new node (options \"%s\")", strings.Join(install.AddNodeRoles, "\"|\"")))
+	cmd.Flags().StringVar(&opts.GeneratedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().BoolVar(&opts.RestartServices, "restart-services", false, "force restart clusters services (Use with care)")
+	cmd.Flags().BoolVar(&opts.Verbose, "verbose", false, "enable verbose logging from the installation")
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().BoolVar(&opts.SkipPreFlight, "skip-preflight", false, "skip pre-flight checks, useful when rerunning kismatic")
+	addTimeoutFlags(cmd.Flags(), &opts.Timeout, &opts.TaskTimeout)
+	return cmd
+}
+
+func doAddNode(ctx context.Context, out io.Writer, planFile string, opts *addNodeOpts, newNode install.Node) error {
+	if !util.Subset([]string{opts.Role}, install.AddNodeRoles) {
+		return fmt.Errorf("invalid role %q, valid roles are %v", opts.Role, install.AddNodeRoles)
+	}
+	planner := &install.FilePlanner{File: planFile}
+	if !planner.PlanExists() {
+		return errors.New("add-node can only be used with an existing plan file")
+	}
+	execOpts := install.ExecutorOptions{
+		Context:                  ctx,
+		GeneratedAssetsDirectory: opts.GeneratedAssetsDirectory,
+		RestartServices:          opts.RestartServices,
+		OutputFormat:             opts.OutputFormat,
+		Verbose:                  opts.Verbose,
+		Timeout:                  opts.Timeout,
+		TaskTimeout:              opts.TaskTimeout,
+		SkipCAGeneration:         true,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	if err != nil {
+		return err
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read plan file: %v", err)
+	}
+	if _, errs := install.ValidateNode(&newNode); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("information provided about the new node is invalid")
+	}
+	if _, errs := install.ValidatePlan(plan); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("the plan file failed validation")
+	}
+	nodeSSHConfig := plan.GetRoleSSHConfig(opts.Role, newNode)
+	nodeSSHCon := &install.SSHConnection{
+		SSHConfig: &nodeSSHConfig,
+		Node:      &newNode,
+	}
+	if _, errs := install.ValidateSSHConnection(nodeSSHCon, "New node"); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("could not establish SSH connection to the new node")
+	}
+	if err := ensureNodeIsNewInGroup(nodesWithRole(*plan, opts.Role), newNode, opts.Role); err != nil {
+		return err
+	}
+	if !opts.SkipPreFlight {
+		util.PrintHeader(out, "Running Pre-Flight Checks On New Node", '=')
+		if err := runPreFlightOnNode(executor, *plan, newNode, opts.Role); err != nil {
+			return err
+		}
+	}
+	updatedPlan, err := executor.AddNode(plan, newNode, opts.Role)
+	if err != nil {
+		return err
+	}
+	if err := planner.Write(updatedPlan); err != nil {
+		return fmt.Errorf("error updating plan file to include new node: %v", err)
+	}
+	return nil
+}
+
+func nodesWithRole(plan install.Plan, role string) []install.Node {
+	switch role {
+	case "etcd":
+		return plan.Etcd.Nodes
+	case "master":
+		return plan.Master.Nodes
+	case "worker":
+		return plan.Worker.Nodes
+	case "ingress":
+		return plan.Ingress.Nodes
+	case "storage":
+		return plan.Storage.Nodes
+	}
+	return nil
+}
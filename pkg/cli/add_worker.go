@@ -1,10 +1,13 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/apprenda/kismatic/pkg/install"
 	"github.com/apprenda/kismatic/pkg/util"
@@ -17,10 +20,14 @@ type addWorkerOpts struct {
 	OutputFormat             string
 	Verbose                  bool
 	SkipPreFlight            bool
+	Timeout                  time.Duration
+	TaskTimeout              time.Duration
+	// the run directories created by the executor
+	runDirectories []string
 }
 
 // NewCmdAddWorker returns the command for adding workers to the cluster
-func NewCmdAddWorker(out io.Writer, installOpts *installOpts) *cobra.Command {
+func NewCmdAddWorker(ctx context.Context, out io.Writer, installOpts *installOpts) *cobra.Command {
 	opts := &addWorkerOpts{}
 	cmd := &cobra.Command{
 		Use:   "add-worker WORKER_NAME WORKER_IP [WORKER_INTERNAL_IP]",
@@ -36,51 +43,66 @@ func NewCmdAddWorker(out io.Writer, installOpts *installOpts) *cobra.Command {
 			if len(args) == 3 {
 				newWorker.InternalIP = args[2]
 			}
-			return doAddWorker(out, installOpts.planFilename, opts, newWorker)
+			err := doAddWorker(ctx, out, installOpts.planFilename, opts, newWorker)
+			if opts.OutputFormat == jsonOutput {
+				printSummary(out, "install add-worker", err, opts.runDirectories, newGeneratedAssets(opts.GeneratedAssetsDirectory, false))
+			}
+			return err
 		},
 	}
 	cmd.Flags().StringVar(&opts.GeneratedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	cmd.Flags().BoolVar(&opts.RestartServices, "restart-services", false, "force restart clusters services (Use with care)")
 	cmd.Flags().BoolVar(&opts.Verbose, "verbose", false, "enable verbose logging from the installation")
-	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\"|\"json\")")
 	cmd.Flags().BoolVar(&opts.SkipPreFlight, "skip-preflight", false, "skip pre-flight checks, useful when rerunning kismatic")
+	addTimeoutFlags(cmd.Flags(), &opts.Timeout, &opts.TaskTimeout)
 	return cmd
 }
 
-func doAddWorker(out io.Writer, planFile string, opts *addWorkerOpts, newWorker install.Node) error {
+func doAddWorker(ctx context.Context, out io.Writer, planFile string, opts *addWorkerOpts, newWorker install.Node) error {
 	planner := &install.FilePlanner{File: planFile}
 	if !planner.PlanExists() {
 		return errors.New("add-worker can only be used with an existin plan file")
 	}
+	printer := validationPrinter{out: out, json: opts.OutputFormat == jsonOutput}
+	if printer.json {
+		// Only JSON objects are written to the output
+		out = ioutil.Discard
+	}
 	execOpts := install.ExecutorOptions{
+		Context:                  ctx,
 		GeneratedAssetsDirectory: opts.GeneratedAssetsDirectory,
 		RestartServices:          opts.RestartServices,
 		OutputFormat:             opts.OutputFormat,
 		Verbose:                  opts.Verbose,
+		Timeout:                  opts.Timeout,
+		TaskTimeout:              opts.TaskTimeout,
 		SkipCAGeneration:         true,
 	}
-	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	executor, err := install.NewExecutor(printer.out, os.Stderr, execOpts)
 	if err != nil {
 		return err
 	}
+	defer func() { opts.runDirectories = executor.RunDirectories() }()
 	plan, err := planner.Read()
 	if err != nil {
 		return fmt.Errorf("failed to read plan file: %v", err)
 	}
 	if _, errs := install.ValidateNode(&newWorker); errs != nil {
-		util.PrintValidationErrors(out, errs)
+		printer.errors("Validating new worker node", errs)
 		return errors.New("information provided about the new worker node is invalid")
 	}
 	if _, errs := install.ValidatePlan(plan); errs != nil {
-		util.PrintValidationErrors(out, errs)
+		printer.errors("Validating installation plan file", errs)
 		return errors.New("the plan file failed validation")
 	}
+	workerSSHConfig := plan.GetRoleSSHConfig("worker", newWorker)
 	workerSSHCon := &install.SSHConnection{
-		SSHConfig: &plan.Cluster.SSH,
+		SSHConfig: &workerSSHConfig,
 		Node:      &newWorker,
 	}
 	if _, errs := install.ValidateSSHConnection(workerSSHCon, "New worker node"); errs != nil {
-		util.PrintValidationErrors(out, errs)
+		printer.errors("Validating SSH connectivity to new worker node", errs)
 		return errors.New("could not establish SSH connection to the new node")
 	}
 	if err := ensureNodeIsNew(*plan, newWorker); err != nil {
@@ -105,32 +127,59 @@ func doAddWorker(out io.Writer, planFile string, opts *addWorkerOpts, newWorker
 // returns an error if the plan contains a worker that is "equivalent"
 // to the new worker that is being added
 func ensureNodeIsNew(plan install.Plan, newWorker install.Node) error {
-	for _, n := range plan.Worker.Nodes {
-		if n.Host == newWorker.Host {
-			return fmt.Errorf("according to the plan file, the host name of the new node is already being used by another worker node")
+	return ensureNodeIsNewInGroup(plan.Worker.Nodes, newWorker, "worker")
+}
+
+// returns an error if the node group contains a node that is "equivalent"
+// to the new node that is being added
+func ensureNodeIsNewInGroup(nodes []install.Node, newNode install.Node, role string) error {
+	for _, n := range nodes {
+		if n.Host == newNode.Host {
+			return fmt.Errorf("according to the plan file, the host name of the new node is already being used by another %s node", role)
 		}
-		if n.IP == newWorker.IP {
-			return fmt.Errorf("according to the plan file, the IP of the new node is already being used by another worker node")
+		if n.IP == newNode.IP {
+			return fmt.Errorf("according to the plan file, the IP of the new node is already being used by another %s node", role)
 		}
-		if newWorker.InternalIP != "" && n.InternalIP == newWorker.InternalIP {
-			return fmt.Errorf("according to the plan file, the internal IP of the new node is already being used by another worker node")
+		if newNode.InternalIP != "" && n.InternalIP == newNode.InternalIP {
+			return fmt.Errorf("according to the plan file, the internal IP of the new node is already being used by another %s node", role)
 		}
 	}
 	return nil
 }
 
 func runPreFlightOnWorker(executor install.Executor, plan install.Plan, workerNode install.Node) error {
-	// use the original plan, but only run against the new worker
+	return runPreFlightOnNode(executor, plan, workerNode, "worker")
+}
+
+func runPreFlightOnNode(executor install.Executor, plan install.Plan, node install.Node, role string) error {
+	// use the original plan, but only run against the new node
 	preFlightPlan := plan
 	preFlightPlan.Master.Nodes = []install.Node{}
 	preFlightPlan.Master.ExpectedCount = 0
 	preFlightPlan.Etcd.Nodes = []install.Node{}
 	preFlightPlan.Etcd.ExpectedCount = 0
-	preFlightPlan.Worker.Nodes = []install.Node{workerNode}
-	preFlightPlan.Worker.ExpectedCount = 1
+	preFlightPlan.Worker.Nodes = []install.Node{}
+	preFlightPlan.Worker.ExpectedCount = 0
 	preFlightPlan.Ingress.Nodes = []install.Node{}
 	preFlightPlan.Ingress.ExpectedCount = 0
 	preFlightPlan.Storage.Nodes = []install.Node{}
 	preFlightPlan.Storage.ExpectedCount = 0
+	switch role {
+	case "etcd":
+		preFlightPlan.Etcd.Nodes = []install.Node{node}
+		preFlightPlan.Etcd.ExpectedCount = 1
+	case "master":
+		preFlightPlan.Master.Nodes = []install.Node{node}
+		preFlightPlan.Master.ExpectedCount = 1
+	case "worker":
+		preFlightPlan.Worker.Nodes = []install.Node{node}
+		preFlightPlan.Worker.ExpectedCount = 1
+	case "ingress":
+		preFlightPlan.Ingress.Nodes = []install.Node{node}
+		preFlightPlan.Ingress.ExpectedCount = 1
+	case "storage":
+		preFlightPlan.Storage.Nodes = []install.Node{node}
+		preFlightPlan.Storage.ExpectedCount = 1
+	}
 	return executor.RunPreFlightCheck(&preFlightPlan)
 }
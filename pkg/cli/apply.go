@@ -1,9 +1,13 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/apprenda/kismatic/pkg/install"
 	"github.com/apprenda/kismatic/pkg/util"
@@ -11,6 +15,7 @@ import (
 )
 
 type applyCmd struct {
+	ctx                context.Context
 	out                io.Writer
 	planner            install.Planner
 	executor           install.Executor
@@ -19,6 +24,12 @@ type applyCmd struct {
 	verbose            bool
 	outputFormat       string
 	skipPreFlight      bool
+	resume             bool
+	timeout            time.Duration
+	taskTimeout        time.Duration
+	junitReportDir     string
+	runsDirectory      string
+	allowDestructive   bool
 }
 
 type applyOpts struct {
@@ -27,10 +38,15 @@ type applyOpts struct {
 	verbose            bool
 	outputFormat       string
 	skipPreFlight      bool
+	resume             bool
+	timeout            time.Duration
+	taskTimeout        time.Duration
+	junitReportDir     string
+	allowDestructive   bool
 }
 
 // NewCmdApply creates a cluter using the plan file
-func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
+func NewCmdApply(ctx context.Context, out io.Writer, installOpts *installOpts) *cobra.Command {
 	applyOpts := applyOpts{}
 	cmd := &cobra.Command{
 		Use:   "apply",
@@ -41,10 +57,14 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 			}
 			planner := &install.FilePlanner{File: installOpts.planFilename}
 			executorOpts := install.ExecutorOptions{
+				Context:                  ctx,
 				GeneratedAssetsDirectory: applyOpts.generatedAssetsDir,
 				RestartServices:          applyOpts.restartServices,
 				OutputFormat:             applyOpts.outputFormat,
 				Verbose:                  applyOpts.verbose,
+				Timeout:                  applyOpts.timeout,
+				TaskTimeout:              applyOpts.taskTimeout,
+				JUnitReportDirectory:     applyOpts.junitReportDir,
 			}
 			executor, err := install.NewExecutor(out, os.Stderr, executorOpts)
 			if err != nil {
@@ -52,6 +72,7 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 			}
 
 			applyCmd := &applyCmd{
+				ctx:                ctx,
 				out:                out,
 				planner:            planner,
 				executor:           executor,
@@ -60,6 +81,12 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 				verbose:            applyOpts.verbose,
 				outputFormat:       applyOpts.outputFormat,
 				skipPreFlight:      applyOpts.skipPreFlight,
+				resume:             applyOpts.resume,
+				timeout:            applyOpts.timeout,
+				taskTimeout:        applyOpts.taskTimeout,
+				junitReportDir:     applyOpts.junitReportDir,
+				runsDirectory:      "runs",
+				allowDestructive:   applyOpts.allowDestructive,
 			}
 			return applyCmd.run()
 		},
@@ -69,29 +96,65 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 	cmd.Flags().StringVar(&applyOpts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	cmd.Flags().BoolVar(&applyOpts.restartServices, "restart-services", false, "force restart cluster services (Use with care)")
 	cmd.Flags().BoolVar(&applyOpts.verbose, "verbose", false, "enable verbose logging from the installation")
-	cmd.Flags().StringVarP(&applyOpts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().StringVarP(&applyOpts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\"|\"json\")")
 	cmd.Flags().BoolVar(&applyOpts.skipPreFlight, "skip-preflight", false, "skip pre-flight checks, useful when rerunning kismatic")
+	cmd.Flags().BoolVar(&applyOpts.resume, "resume", false, "resume the last installation from the first play that did not complete, pre-flight checks are skipped")
+	cmd.Flags().StringVar(&applyOpts.junitReportDir, "junit-report-dir", "", "path to the directory where the JUnit XML reports of the pre-flight checks and smoke test will be written")
+	cmd.Flags().BoolVar(&applyOpts.allowDestructive, "allow-destructive-changes", false, "apply the plan even if it has destructive changes since it was last applied, see \"kismatic install diff\"")
+	addTimeoutFlags(cmd.Flags(), &applyOpts.timeout, &applyOpts.taskTimeout)
 
 	return cmd
 }
 
 func (c *applyCmd) run() error {
+	if c.outputFormat != jsonOutput {
+		return c.apply(c.out)
+	}
+	// Only JSON objects are written to the output
+	err := c.apply(ioutil.Discard)
+	kubeconfig := false
+	if _, statErr := os.Stat(filepath.Join(c.generatedAssetsDir, "kubeconfig")); statErr == nil {
+		kubeconfig = true
+	}
+	printSummary(c.out, "install apply", err, c.executor.RunDirectories(), newGeneratedAssets(c.generatedAssetsDir, kubeconfig))
+	return err
+}
+
+func (c *applyCmd) apply(out io.Writer) error {
+	// Changes that would break the installed cluster are refused. A resumed
+	// installation uses the plan of the run it resumes.
+	if !c.resume && !c.allowDestructive {
+		plan, err := c.planner.Read()
+		if err != nil {
+			return fmt.Errorf("error reading plan file: %v", err)
+		}
+		if err = checkPlanChanges(out, plan, c.runsDirectory); err != nil {
+			return err
+		}
+	}
 	// Validate and run pre-flight
 	opts := &validateOpts{
 		planFile:           c.planFile,
 		verbose:            c.verbose,
 		outputFormat:       c.outputFormat,
-		skipPreFlight:      c.skipPreFlight,
+		skipPreFlight:      c.skipPreFlight || c.resume,
 		generatedAssetsDir: c.generatedAssetsDir,
+		timeout:            c.timeout,
+		taskTimeout:        c.taskTimeout,
+		junitReportDir:     c.junitReportDir,
 	}
-	err := doValidate(c.out, c.planner, opts)
+	err := doValidate(c.ctx, c.out, c.planner, opts)
 	if err != nil {
 		return fmt.Errorf("error validating plan: %v", err)
 	}
 	plan, err := c.planner.Read()
 
 	// Perform the installation
-	err = c.executor.Install(plan)
+	if c.resume {
+		err = c.executor.ResumeInstall(plan)
+	} else {
+		err = c.executor.Install(plan)
+	}
 	if err != nil {
 		return fmt.Errorf("error installing: %v", err)
 	}
@@ -99,23 +162,23 @@ func (c *applyCmd) run() error {
 	if err := c.executor.RunSmokeTest(plan); err != nil {
 		return fmt.Errorf("error during smoke test: %v", err)
 	}
-	util.PrintColor(c.out, util.Green, "\nThe cluster was installed successfully\n")
+	util.PrintColor(out, util.Green, "\nThe cluster was installed successfully\n")
 
 	// Generate kubeconfig
-	util.PrintHeader(c.out, "Generating Kubeconfig File", '=')
+	util.PrintHeader(out, "Generating Kubeconfig File", '=')
 	err = install.GenerateKubeconfig(plan, c.generatedAssetsDir)
 	if err != nil {
-		util.PrettyPrintWarn(c.out, "Error generating kubeconfig file: %v\n", err)
+		util.PrettyPrintWarn(out, "Error generating kubeconfig file: %v\n", err)
 	} else {
-		util.PrettyPrintOk(c.out, "Generated kubeconfig file in the %q directory", c.generatedAssetsDir)
-		fmt.Fprintf(c.out, "\n")
+		util.PrettyPrintOk(out, "Generated kubeconfig file in the %q directory", c.generatedAssetsDir)
+		fmt.Fprintf(out, "\n")
 		msg := "To use the generated kubeconfig file with kubectl:" +
 			"\n  * use \"kubectl --kubeconfig %s/kubeconfig\"" +
 			"\n  * or copy the config file \"cp %[1]s/kubeconfig ~/.kube/config\"\n"
-		fmt.Fprintf(c.out, msg, c.generatedAssetsDir)
-		fmt.Fprintf(c.out, "Use \"kismatic dashboard\" command to view the Kubernetes dashboard")
+		fmt.Fprintf(out, msg, c.generatedAssetsDir)
+		fmt.Fprintf(out, "Use \"kismatic dashboard\" command to view the Kubernetes dashboard")
 	}
 
-	fmt.Fprintf(c.out, "\n")
+	fmt.Fprintf(out, "\n")
 	return nil
 }
@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type backupOpts struct {
+	planFilename             string
+	generatedAssetsDirectory string
+	backupsDirectory         string
+	outputFormat             string
+	verbose                  bool
+	timeout                  time.Duration
+	taskTimeout              time.Duration
+}
+
+// NewCmdBackup creates a new backup command
+func NewCmdBackup(ctx context.Context, out io.Writer) *cobra.Command {
+	opts := &backupOpts{}
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "backup and restore the etcd clusters of your Kubernetes cluster",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	// Subcommands
+	cmd.AddCommand(NewCmdBackupCreate(ctx, out, opts))
+	cmd.AddCommand(NewCmdBackupList(out, opts))
+	cmd.AddCommand(NewCmdBackupRestore(ctx, out, opts))
+
+	// PersistentFlags
+	addPlanFileFlag(cmd.PersistentFlags(), &opts.planFilename)
+	cmd.PersistentFlags().StringVar(&opts.generatedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.PersistentFlags().StringVar(&opts.backupsDirectory, "backups-dir", "backups", "path to the directory where backups are stored")
+	addTimeoutFlags(cmd.PersistentFlags(), &opts.timeout, &opts.taskTimeout)
+	return cmd
+}
+
+// NewCmdBackupCreate returns the command for creating a backup
+func NewCmdBackupCreate(ctx context.Context, out io.Writer, opts *backupOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "take a backup of the Kubernetes and networking etcd clusters",
+		Long: `Take a backup of the Kubernetes and networking etcd clusters.
+
+The backup is taken from the first etcd node, and stored in a timestamped directory
+in the backups directory, together with the plan file and the cluster's Certificate Authority.
+The private key of the Certificate Authority is only included when the certificates are not
+signed by Vault.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doBackupCreate(ctx, out, opts)
+		},
+	}
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the backup")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", "backup output format (options \"simple\"|\"raw\")")
+	return cmd
+}
+
+// NewCmdBackupList returns the command for listing backups
+func NewCmdBackupList(out io.Writer, opts *backupOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the backups in the backups directory",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doBackupList(out, opts)
+		},
+	}
+	return cmd
+}
+
+// NewCmdBackupRestore returns the command for restoring a backup
+func NewCmdBackupRestore(ctx context.Context, out io.Writer, opts *backupOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore BACKUP_NAME",
+		Short: "restore the Kubernetes and networking etcd clusters from a backup",
+		Long: `Restore the Kubernetes and networking etcd clusters from a backup.
+
+The cluster is restored using the plan file stored in the backup. The Kubernetes API servers are
+stopped while the etcd clusters are restored. The data of the etcd clusters is not deleted, it is moved
+aside on each etcd node. If the cluster's Certificate Authority is missing from the generated assets
+directory, it is restored from the backup.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			return doBackupRestore(ctx, out, opts, args[0])
+		},
+	}
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the restore")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", "restore output format (options \"simple\"|\"raw\")")
+	return cmd
+}
+
+func doBackupCreate(ctx context.Context, out io.Writer, opts *backupOpts) error {
+	planner := &install.FilePlanner{File: opts.planFilename}
+	if !planner.PlanExists() {
+		return errors.New("backup can only be used with an existing plan file")
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read plan file: %v", err)
+	}
+	if _, errs := install.ValidatePlan(plan); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("the plan file failed validation")
+	}
+	executor, err := newBackupExecutor(ctx, out, opts)
+	if err != nil {
+		return err
+	}
+	backup, err := executor.CreateBackup(plan)
+	if err != nil {
+		return err
+	}
+	util.PrintColor(out, util.Green, "\nBackup %q was created in %q\n\n", backup.Name, backup.Directory)
+	return nil
+}
+
+func doBackupList(out io.Writer, opts *backupOpts) error {
+	backups, err := install.ListBackups(opts.backupsDirectory)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Fprintf(out, "No backups found in %q\n", opts.backupsDirectory)
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 1, 8, 4, ' ', 0)
+	fmt.Fprintf(w, "NAME\tCREATED\tCLUSTER\n")
+	for _, b := range backups {
+		clusterName := "unknown"
+		if p, err := b.Plan(); err == nil {
+			clusterName = p.Cluster.Name
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", b.Name, b.CreatedAt.Format("2006-01-02 15:04:05"), clusterName)
+	}
+	return w.Flush()
+}
+
+func doBackupRestore(ctx context.Context, out io.Writer, opts *backupOpts, name string) error {
+	backup, err := install.ReadBackup(opts.backupsDirectory, name)
+	if err != nil {
+		return err
+	}
+	plan, err := backup.Plan()
+	if err != nil {
+		return fmt.Errorf("failed to read plan file of backup: %v", err)
+	}
+	if _, errs := install.ValidatePlan(plan); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("the plan file of the backup failed validation")
+	}
+	executor, err := newBackupExecutor(ctx, out, opts)
+	if err != nil {
+		return err
+	}
+	if err := executor.RestoreBackup(plan, *backup); err != nil {
+		return err
+	}
+	util.PrintColor(out, util.Green, "\nThe cluster was restored from backup %q\n\n", backup.Name)
+	return nil
+}
+
+func newBackupExecutor(ctx context.Context, out io.Writer, opts *backupOpts) (install.Executor, error) {
+	execOpts := install.ExecutorOptions{
+		Context:                  ctx,
+		GeneratedAssetsDirectory: opts.generatedAssetsDirectory,
+		BackupsDirectory:         opts.backupsDirectory,
+		OutputFormat:             opts.outputFormat,
+		Verbose:                  opts.verbose,
+		Timeout:                  opts.timeout,
+		TaskTimeout:              opts.taskTimeout,
+		SkipCAGeneration:         true,
+	}
+	return install.NewExecutor(out, os.Stderr, execOpts)
+}
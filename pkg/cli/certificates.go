@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type certificatesOpts struct {
+	planFilename             string
+	generatedAssetsDirectory string
+	outputFormat             string
+	verbose                  bool
+	nodes                    []string
+	allNodes                 bool
+	users                    []string
+	serviceAccount           bool
+	timeout                  time.Duration
+	taskTimeout              time.Duration
+	listOutputFormat         string
+	deployed                 bool
+}
+
+// NewCmdCertificates creates a new certificates command
+func NewCmdCertificates(ctx context.Context, out io.Writer) *cobra.Command {
+	opts := &certificatesOpts{}
+	cmd := &cobra.Command{
+		Use:   "certificates",
+		Short: "manage the certificates of your Kubernetes cluster",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	// Subcommands
+	cmd.AddCommand(NewCmdCertificatesRotate(ctx, out, opts))
+	cmd.AddCommand(NewCmdCertificatesList(ctx, out, opts))
+
+	// PersistentFlags
+	addPlanFileFlag(cmd.PersistentFlags(), &opts.planFilename)
+	cmd.PersistentFlags().StringVar(&opts.generatedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	return cmd
+}
+
+// NewCmdCertificatesRotate returns the command for rotating certificates
+func NewCmdCertificatesRotate(ctx context.Context, out io.Writer, opts *certificatesOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "re-issue certificates using the cluster's Certificate Authority",
+		Long: `Re-issue certificates using the cluster's Certificate Authority.
+
+The node certificates are distributed to the nodes, and the components that use them are restarted:
+etcd one member at a time, then the API servers, then the kubelets. User certificates are only
+re-issued in the generated assets directory. The kubeconfig file is regenerated.
+
+When the service account key is re-issued, the API servers keep accepting the tokens signed with the
+previous key, and the service account tokens are re-issued with the new key. Pods use their previous
+token until they are recreated, which must happen before the key is re-issued again. The previous certificates are kept in the "keys/rotated" directory of the generated assets directory.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			planner := &install.FilePlanner{File: opts.planFilename}
+			execOpts := install.ExecutorOptions{
+				Context:                  ctx,
+				GeneratedAssetsDirectory: opts.generatedAssetsDirectory,
+				OutputFormat:             opts.outputFormat,
+				Verbose:                  opts.verbose,
+				Timeout:                  opts.timeout,
+				TaskTimeout:              opts.taskTimeout,
+				SkipCAGeneration:         true,
+			}
+			executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+			if err != nil {
+				return err
+			}
+			return doCertificatesRotate(out, planner, executor, opts)
+		},
+	}
+	cmd.Flags().StringSliceVar(&opts.nodes, "node", []string{}, "comma-separated list of hostnames of the nodes whose certificates are re-issued")
+	cmd.Flags().BoolVar(&opts.allNodes, "all", false, "re-issue the certificates of all nodes")
+	cmd.Flags().StringSliceVar(&opts.users, "user", []string{}, "comma-separated list of users whose certificates are re-issued, e.g. \"admin\"")
+	cmd.Flags().BoolVar(&opts.serviceAccount, "service-account", false, "re-issue the key used for signing service account tokens")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the rotation")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", "rotation output format (options \"simple\"|\"raw\")")
+	addTimeoutFlags(cmd.Flags(), &opts.timeout, &opts.taskTimeout)
+	return cmd
+}
+
+func doCertificatesRotate(out io.Writer, planner install.Planner, executor install.Executor, opts *certificatesOpts) error {
+	if opts.allNodes && len(opts.nodes) > 0 {
+		return errors.New("the --node and --all flags cannot be used together")
+	}
+	if !opts.allNodes && len(opts.nodes) == 0 && len(opts.users) == 0 && !opts.serviceAccount {
+		return errors.New("nothing to rotate, use the --node, --all, --user or --service-account flags")
+	}
+	if !planner.PlanExists() {
+		return errors.New("certificates can only be rotated with an existing plan file")
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read plan file: %v", err)
+	}
+	if _, errs := install.ValidatePlan(plan); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("the plan file failed validation")
+	}
+	rotation := install.CertificateRotation{
+		Users:          opts.users,
+		ServiceAccount: opts.serviceAccount,
+	}
+	if opts.allNodes {
+		rotation.Nodes = uniqueNodes(plan)
+	}
+	for _, host := range opts.nodes {
+		node, err := findNode(plan, host)
+		if err != nil {
+			return err
+		}
+		rotation.Nodes = append(rotation.Nodes, *node)
+	}
+	if err = executor.RotateCertificates(plan, rotation); err != nil {
+		return err
+	}
+	util.PrintHeader(out, "Generating Kubeconfig File", '=')
+	if err = install.GenerateKubeconfig(plan, opts.generatedAssetsDirectory); err != nil {
+		return fmt.Errorf("error generating kubeconfig file: %v", err)
+	}
+	util.PrettyPrintOk(out, "Generated kubeconfig file in the %q directory", opts.generatedAssetsDirectory)
+	util.PrintColor(out, util.Green, "\nThe certificates were rotated successfully\n\n")
+	return nil
+}
+
+// returns the node with the given hostname
+func findNode(plan *install.Plan, host string) (*install.Node, error) {
+	for _, n := range uniqueNodes(plan) {
+		if n.Host == host {
+			return &n, nil
+		}
+	}
+	return nil, fmt.Errorf("node %q was not found in the plan", host)
+}
+
+// returns the nodes of the plan, without duplicates of nodes that have more than one role
+func uniqueNodes(plan *install.Plan) []install.Node {
+	nodes := []install.Node{}
+	seen := map[string]bool{}
+	groups := [][]install.Node{plan.Etcd.Nodes, plan.Master.Nodes, plan.Worker.Nodes, plan.Ingress.Nodes, plan.Storage.Nodes}
+	for _, g := range groups {
+		for _, n := range g {
+			if seen[n.Host] {
+				continue
+			}
+			seen[n.Host] = true
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// NewCmdCertificatesList returns the command for listing certificates
+func NewCmdCertificatesList(ctx context.Context, out io.Writer, opts *certificatesOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the certificates of the cluster and their expiry",
+		Long: `List the certificates in the generated assets directory, with their subject, SANs, issuer and expiry.
+The certificates of the users are included, and each certificate of a bundle is listed.
+
+When --deployed is set, the certificates deployed on each node are read over SSH and compared
+with the certificates in the generated assets directory. The command fails if a deployed
+certificate does not match.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			planner := &install.FilePlanner{File: opts.planFilename}
+			checkDeployed := func(p *install.Plan, certs []install.CertificateInfo) {
+				install.CheckDeployedCertificates(ctx, p, certs)
+			}
+			return doCertificatesList(out, planner, opts, checkDeployed)
+		},
+	}
+	cmd.Flags().BoolVar(&opts.deployed, "deployed", false, "compare with the certificates deployed on the nodes, which are read over SSH")
+	cmd.Flags().StringVarP(&opts.listOutputFormat, "output", "o", "table", "list output format (options \"table\"|\"json\")")
+	return cmd
+}
+
+func doCertificatesList(out io.Writer, planner install.Planner, opts *certificatesOpts, checkDeployed func(*install.Plan, []install.CertificateInfo)) error {
+	if opts.listOutputFormat != "table" && opts.listOutputFormat != jsonOutput {
+		return fmt.Errorf("output format %q is not supported", opts.listOutputFormat)
+	}
+	certs, err := install.ListCertificates(filepath.Join(opts.generatedAssetsDirectory, "keys"), time.Now())
+	if err != nil {
+		return err
+	}
+	if opts.deployed {
+		if !planner.PlanExists() {
+			return errors.New("deployed certificates can only be listed with an existing plan file")
+		}
+		plan, err := planner.Read()
+		if err != nil {
+			return fmt.Errorf("failed to read plan file: %v", err)
+		}
+		checkDeployed(plan, certs)
+	}
+	if opts.listOutputFormat == jsonOutput {
+		printJSON(out, certs)
+	} else if err = printCertificatesTable(out, certs); err != nil {
+		return err
+	}
+	for _, c := range certs {
+		for _, d := range c.Deployed {
+			if !d.Matches {
+				return errors.New("the certificates deployed on the nodes do not match the generated certificates")
+			}
+		}
+	}
+	return nil
+}
+
+func printCertificatesTable(out io.Writer, certs []install.CertificateInfo) error {
+	w := tabwriter.NewWriter(out, 1, 8, 4, ' ', 0)
+	fmt.Fprintf(w, "NAME\tSUBJECT\tSANS\tISSUER\tEXPIRY\tDAYS REMAINING\n")
+	for _, c := range certs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", c.Name, c.Subject, orNone([]string{strings.Join(c.SANs, ",")}), c.Issuer, c.NotAfter.Format("2006-01-02"), c.DaysRemaining)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// Mismatches are reported after the table to keep it readable
+	for _, c := range certs {
+		for _, d := range c.Deployed {
+			switch {
+			case d.Error != "":
+				fmt.Fprintf(out, "%s: %s: %s\n", d.Host, d.Path, d.Error)
+			case !d.Matches:
+				fmt.Fprintf(out, "%s: %s does not match %s.pem\n", d.Host, d.Path, c.Name)
+			}
+		}
+	}
+	return nil
+}
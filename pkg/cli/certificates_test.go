@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+func TestCertificatesRotateInvalidOptions(t *testing.T) {
+	tests := []certificatesOpts{
+		{},
+		{allNodes: true, nodes: []string{"node01"}},
+	}
+	for i, opts := range tests {
+		fp := &fakePlanner{exists: true, plan: &install.Plan{}}
+		fe := &fakeExecutor{}
+		if err := doCertificatesRotate(&bytes.Buffer{}, fp, fe, &opts); err == nil {
+			t.Errorf("test %d: expected an error, but got nil", i)
+		}
+		if fe.rotation != nil {
+			t.Errorf("test %d: expected certificates not to be rotated", i)
+		}
+	}
+}
+
+func TestCertificatesRotatePlanNotFound(t *testing.T) {
+	fp := &fakePlanner{exists: false}
+	fe := &fakeExecutor{}
+	opts := &certificatesOpts{allNodes: true}
+	if err := doCertificatesRotate(&bytes.Buffer{}, fp, fe, opts); err == nil {
+		t.Errorf("expected an error when the plan does not exist")
+	}
+	if fe.rotation != nil {
+		t.Errorf("expected certificates not to be rotated")
+	}
+}
+
+func TestCertificatesListUnsupportedOutputFormat(t *testing.T) {
+	fp := &fakePlanner{exists: true, plan: &install.Plan{}}
+	opts := &certificatesOpts{listOutputFormat: "yaml", generatedAssetsDirectory: "generated"}
+	checkDeployed := func(*install.Plan, []install.CertificateInfo) {}
+	if err := doCertificatesList(&bytes.Buffer{}, fp, opts, checkDeployed); err == nil {
+		t.Errorf("expected an error when the output format is not supported")
+	}
+}
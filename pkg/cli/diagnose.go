@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/spf13/cobra"
+)
+
+type diagnoseOpts struct {
+	planFilename   string
+	runsDirectory  string
+	bundleFilename string
+	parallel       int
+}
+
+// collects the diagnostics of the cluster into the bundle file
+type collectDiagnosticsFunc func(p *install.Plan, runsDir, bundleFile string, parallelism int) (*install.DiagnosticsSummary, error)
+
+// NewCmdDiagnose returns the command for collecting a diagnostics bundle
+func NewCmdDiagnose(ctx context.Context, out io.Writer) *cobra.Command {
+	opts := &diagnoseOpts{}
+	cmd := &cobra.Command{
+		Use:   "diagnose",
+		Short: "collect the logs and state of the nodes into a diagnostics bundle",
+		Long: `Collect the logs and state of the nodes into a diagnostics bundle.
+
+The nodes are accessed over SSH, and the following is collected from each of them:
+- the journal of the docker, kubelet, kube-proxy, calico, etcd and Kubernetes control plane services
+- the Docker containers, iptables rules, OS release, disk and memory usage
+- the results of the Kismatic Inspector checks, if the inspector was installed by the pre-flight checks
+- the metadata of the certificates deployed on the node
+
+The diagnostics are bundled with the most recent run directory into a gzipped tarball.
+The admin password, the values of settings that look like passwords or tokens, and private
+keys are redacted from the bundle. Nodes that cannot be reached are reported in the bundle's summary.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			planner := &install.FilePlanner{File: opts.planFilename}
+			collect := func(p *install.Plan, runsDir, bundleFile string, parallelism int) (*install.DiagnosticsSummary, error) {
+				return install.CollectDiagnostics(ctx, p, runsDir, bundleFile, parallelism)
+			}
+			return doDiagnose(out, planner, opts, collect)
+		},
+	}
+	addPlanFileFlag(cmd.Flags(), &opts.planFilename)
+	cmd.Flags().StringVar(&opts.runsDirectory, "runs-dir", "runs", "path to the directory where the runs of kismatic are stored")
+	cmd.Flags().StringVarP(&opts.bundleFilename, "bundle", "b", "", "path of the diagnostics bundle (default \"diagnostics-<timestamp>.tar.gz\")")
+	cmd.Flags().IntVar(&opts.parallel, "parallel", 10, "maximum number of nodes from which diagnostics are collected at the same time")
+	return cmd
+}
+
+func doDiagnose(out io.Writer, planner install.Planner, opts *diagnoseOpts, collect collectDiagnosticsFunc) error {
+	if opts.parallel < 1 {
+		return fmt.Errorf("--parallel must be greater than 0, got %d", opts.parallel)
+	}
+	if !planner.PlanExists() {
+		return fmt.Errorf("plan does not exist")
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	bundle := opts.bundleFilename
+	if bundle == "" {
+		bundle = fmt.Sprintf("diagnostics-%s.tar.gz", time.Now().Format("2006-01-02-15-04-05"))
+	}
+	fmt.Fprintln(out, "Collecting diagnostics from the nodes")
+	summary, err := collect(plan, opts.runsDirectory, bundle, opts.parallel)
+	if err != nil {
+		return fmt.Errorf("error collecting diagnostics: %v", err)
+	}
+	for _, n := range summary.Nodes {
+		if len(n.Errors) == 0 {
+			fmt.Fprintf(out, "[%s] collected %d files\n", n.Host, len(n.Files))
+			continue
+		}
+		fmt.Fprintf(out, "[%s] collected %d files, %d commands failed:\n", n.Host, len(n.Files), len(n.Errors))
+		for _, e := range n.Errors {
+			fmt.Fprintf(out, "  - %s\n", e)
+		}
+	}
+	if summary.RunDirectory != "" {
+		fmt.Fprintf(out, "Included run directory %s\n", summary.RunDirectory)
+	}
+	fmt.Fprintf(out, "Diagnostics bundle written to %s\n", bundle)
+	return nil
+}
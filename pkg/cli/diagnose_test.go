@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+func TestDiagnose(t *testing.T) {
+	out := &bytes.Buffer{}
+	fp := &fakePlanner{exists: true, plan: testPlan()}
+	var bundle string
+	collect := func(p *install.Plan, runsDir, bundleFile string, parallelism int) (*install.DiagnosticsSummary, error) {
+		bundle = bundleFile
+		return &install.DiagnosticsSummary{
+			RunDirectory: "runs/install/2017-03-01-10-00-00",
+			Nodes: []install.NodeDiagnostics{
+				{Host: "etcd01", Files: []string{"os-release.txt", "disk.txt"}},
+				{Host: "worker01", Files: []string{"os-release.txt"}, Errors: []string{"sudo docker ps -a: exit status 1"}},
+			},
+		}, nil
+	}
+	if err := doDiagnose(out, fp, &diagnoseOpts{runsDirectory: "runs", parallel: 10}, collect); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(bundle, "diagnostics-") || !strings.HasSuffix(bundle, ".tar.gz") {
+		t.Errorf("expected a timestamped bundle file, but got %q", bundle)
+	}
+	for _, s := range []string{"[etcd01] collected 2 files", "[worker01] collected 1 files, 1 commands failed", "sudo docker ps -a: exit status 1", "runs/install/2017-03-01-10-00-00", bundle} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %q in the output, but got:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestDiagnoseError(t *testing.T) {
+	fp := &fakePlanner{exists: true, plan: testPlan()}
+	collect := func(p *install.Plan, runsDir, bundleFile string, parallelism int) (*install.DiagnosticsSummary, error) {
+		return nil, errors.New("permission denied")
+	}
+	opts := &diagnoseOpts{bundleFilename: "bundle.tar.gz", parallel: 10}
+	if err := doDiagnose(&bytes.Buffer{}, fp, opts, collect); err == nil {
+		t.Errorf("expected an error when the bundle cannot be written")
+	}
+	fp = &fakePlanner{exists: false}
+	if err := doDiagnose(&bytes.Buffer{}, fp, opts, collect); err == nil {
+		t.Errorf("expected an error when the plan does not exist")
+	}
+}
+
+func TestDiagnoseBundleFlag(t *testing.T) {
+	cmd := NewCmdDiagnose(context.Background(), &bytes.Buffer{})
+	if err := cmd.ParseFlags([]string{"-b", "bundle.tar.gz"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bundle := cmd.Flags().Lookup("bundle").Value.String(); bundle != "bundle.tar.gz" {
+		t.Errorf("expected the bundle file to be set by -b, but got %q", bundle)
+	}
+	if cmd.Flags().Lookup("output") != nil {
+		t.Errorf("expected no output flag, which sets the output format of the other commands")
+	}
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/spf13/cobra"
+)
+
+type diffOpts struct {
+	planFilename  string
+	runsDirectory string
+	outputFormat  string
+}
+
+// NewCmdDiff returns the command for comparing the plan with the plan that was applied to the cluster
+func NewCmdDiff(out io.Writer, installOpts *installOpts) *cobra.Command {
+	opts := &diffOpts{}
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "compare the plan file with the plan that was last applied to the cluster",
+		Long: `Compare the plan file with the plan that was last applied to the cluster.
+
+The applied plan is the plan recorded by the last installation that completed successfully,
+or by a later add-worker, add-node or remove-node run. The nodes that were added, removed or
+readdressed, and the changes to the cluster, networking, certificate, registry and load
+balancer settings are reported.
+
+Supported changes are applied by "kismatic install apply". Destructive changes would break the
+cluster, or cannot be made by applying the plan, and "kismatic install apply" refuses to apply them.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			opts.planFilename = installOpts.planFilename
+			planner := &install.FilePlanner{File: opts.planFilename}
+			return doDiff(out, planner, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.runsDirectory, "runs-dir", "runs", "path to the directory where the runs of kismatic are stored")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "table", "diff output format (options \"table\"|\"json\")")
+	return cmd
+}
+
+func doDiff(out io.Writer, planner install.Planner, opts *diffOpts) error {
+	if opts.outputFormat != "table" && opts.outputFormat != jsonOutput {
+		return fmt.Errorf("output format %q is not supported", opts.outputFormat)
+	}
+	if !planner.PlanExists() {
+		return fmt.Errorf("plan does not exist")
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	diff, err := install.DiffLastAppliedPlan(plan, opts.runsDirectory)
+	if err != nil {
+		return err
+	}
+	if opts.outputFormat == jsonOutput {
+		printJSON(out, diff)
+		return nil
+	}
+	if diff.RunDirectory == "" {
+		fmt.Fprintln(out, "The plan was never applied to the cluster")
+		return nil
+	}
+	if len(diff.Changes) == 0 {
+		fmt.Fprintf(out, "The plan has not changed since it was applied in %s\n", diff.RunDirectory)
+		return nil
+	}
+	fmt.Fprintf(out, "Changes since the plan was applied in %s:\n\n", diff.RunDirectory)
+	return printPlanChanges(out, diff.Changes)
+}
+
+func printPlanChanges(out io.Writer, changes []install.PlanChange) error {
+	w := tabwriter.NewWriter(out, 1, 8, 4, ' ', 0)
+	fmt.Fprintf(w, "FIELD\tCHANGE\tOLD\tNEW\tIMPACT\tREASON\n")
+	for _, c := range changes {
+		impact := "supported"
+		if c.Destructive {
+			impact = "destructive"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Field, c.Kind, orNone([]string{c.Old}), orNone([]string{c.New}), impact, c.Reason)
+	}
+	return w.Flush()
+}
+
+// returns an error if the plan has destructive changes since it was last applied
+func checkPlanChanges(out io.Writer, p *install.Plan, runsDir string) error {
+	diff, err := install.DiffLastAppliedPlan(p, runsDir)
+	if err != nil {
+		return fmt.Errorf("error comparing the plan with the applied plan: %v", err)
+	}
+	destructive := diff.Destructive()
+	if len(destructive) == 0 {
+		return nil
+	}
+	fmt.Fprintf(out, "The plan has destructive changes since it was applied in %s:\n\n", diff.RunDirectory)
+	if err = printPlanChanges(out, destructive); err != nil {
+		return err
+	}
+	fields := []string{}
+	seen := map[string]bool{}
+	for _, c := range destructive {
+		if !seen[c.Field] {
+			fields = append(fields, c.Field)
+			seen[c.Field] = true
+		}
+	}
+	return fmt.Errorf("refusing to apply destructive changes to %s, use --allow-destructive-changes to apply them anyway", strings.Join(fields, ", "))
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+// returns a runs directory with a successful installation of the plan
+func mustWriteInstallRun(t *testing.T, p *install.Plan) string {
+	runsDir, err := ioutil.TempDir("", "diff-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	runDir := filepath.Join(runsDir, "install", "2017-03-01-10-00-00")
+	if err = os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatalf("error creating run directory: %v", err)
+	}
+	fp := install.FilePlanner{File: filepath.Join(runDir, "kismatic-cluster.yaml")}
+	if err = fp.Write(p); err != nil {
+		t.Fatalf("error writing plan: %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(runDir, "progress.json"), []byte(`{"complete": true}`), 0644); err != nil {
+		t.Fatalf("error writing progress: %v", err)
+	}
+	return runsDir
+}
+
+func TestDiff(t *testing.T) {
+	runsDir := mustWriteInstallRun(t, testPlan())
+	defer os.RemoveAll(runsDir)
+
+	p := testPlan()
+	p.Cluster.Networking.PodCIDRBlock = "172.17.0.0/16"
+	p.Worker.Nodes = append(p.Worker.Nodes, install.Node{Host: "worker02", IP: "10.0.0.4"})
+	out := &bytes.Buffer{}
+	fp := &fakePlanner{exists: true, plan: p}
+	if err := doDiff(out, fp, &diffOpts{runsDirectory: runsDir, outputFormat: "table"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range []string{"cluster.networking.pod_cidr_block", "172.16.0.0/16", "172.17.0.0/16", "destructive", "worker02 (10.0.0.4)", "supported"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %q in the output, but got:\n%s", s, out.String())
+		}
+	}
+
+	out.Reset()
+	fp = &fakePlanner{exists: true, plan: testPlan()}
+	if err := doDiff(out, fp, &diffOpts{runsDirectory: runsDir, outputFormat: "table"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "The plan has not changed") {
+		t.Errorf("expected no changes, but got:\n%s", out.String())
+	}
+}
+
+func TestApplyCmdRefusesDestructiveChanges(t *testing.T) {
+	runsDir := mustWriteInstallRun(t, testPlan())
+	defer os.RemoveAll(runsDir)
+
+	p := testPlan()
+	p.Cluster.Networking.PodCIDRBlock = "172.17.0.0/16"
+	fe := &fakeExecutor{}
+	applyCmd := &applyCmd{
+		out:           &bytes.Buffer{},
+		planner:       &fakePlanner{exists: true, plan: p},
+		executor:      fe,
+		runsDirectory: runsDir,
+	}
+	err := applyCmd.run()
+	if err == nil || !strings.Contains(err.Error(), "cluster.networking.pod_cidr_block") {
+		t.Errorf("expected the destructive change to be refused, but got %v", err)
+	}
+	if fe.installCalled {
+		t.Error("install was called with a destructive change")
+	}
+}
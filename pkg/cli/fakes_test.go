@@ -5,6 +5,19 @@ import (
 	"github.com/apprenda/kismatic/pkg/tls"
 )
 
+// returns a plan with one node per role that tests can modify
+func testPlan() *install.Plan {
+	return &install.Plan{
+		Cluster: install.Cluster{
+			Name:       "kismatic",
+			Networking: install.NetworkConfig{PodCIDRBlock: "172.16.0.0/16", ServiceCIDRBlock: "172.20.0.0/16"},
+		},
+		Etcd:   install.NodeGroup{Nodes: []install.Node{{Host: "etcd01", IP: "10.0.0.1"}}},
+		Master: install.MasterNodeGroup{Nodes: []install.Node{{Host: "master01", IP: "10.0.0.2"}}},
+		Worker: install.NodeGroup{Nodes: []install.Node{{Host: "worker01", IP: "10.0.0.3"}}},
+	}
+}
+
 type fakePlanner struct {
 	exists            bool
 	plan              *install.Plan
@@ -33,8 +46,11 @@ func (fp *fakePlanner) GetDashboardURL(p *install.Plan) (string, error) {
 }
 
 type fakeExecutor struct {
-	installCalled bool
-	err           error
+	installCalled       bool
+	resumeInstallCalled bool
+	rotation            *install.CertificateRotation
+	createdUser         string
+	err                 error
 }
 
 func (fe *fakeExecutor) AddWorker(p *install.Plan, newWorker install.Node) (*install.Plan, error) {
@@ -62,6 +78,49 @@ func (fe *fakeExecutor) AddVolume(*install.Plan, install.StorageVolume) error {
 	return nil
 }
 
+func (fe *fakeExecutor) AddNode(p *install.Plan, node install.Node, role string) (*install.Plan, error) {
+	return nil, nil
+}
+
+func (fe *fakeExecutor) RemoveNode(p *install.Plan, node install.Node) (*install.Plan, error) {
+	return nil, nil
+}
+
+func (fe *fakeExecutor) CreateBackup(*install.Plan) (*install.Backup, error) {
+	return nil, nil
+}
+
+func (fe *fakeExecutor) RestoreBackup(*install.Plan, install.Backup) error {
+	return nil
+}
+
+func (fe *fakeExecutor) Upgrade(*install.Plan) error {
+	return nil
+}
+
+func (fe *fakeExecutor) Reset(*install.Plan, []string) error {
+	return nil
+}
+
+func (fe *fakeExecutor) ResumeInstall(*install.Plan) error {
+	fe.resumeInstallCalled = true
+	return fe.err
+}
+
+func (fe *fakeExecutor) CreateUserCredentials(p *install.Plan, user string, groups []string) (*install.UserIdentity, error) {
+	fe.createdUser = user
+	return &install.UserIdentity{Name: user, Groups: groups}, fe.err
+}
+
+func (fe *fakeExecutor) RotateCertificates(p *install.Plan, r install.CertificateRotation) error {
+	fe.rotation = &r
+	return fe.err
+}
+
+func (fe *fakeExecutor) RunDirectories() []string {
+	return nil
+}
+
 type fakePKI struct {
 	called              bool
 	generateCACalled    bool
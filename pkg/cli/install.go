@@ -1,7 +1,9 @@
 package cli
 
 import (
+	"context"
 	"io"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -12,7 +14,7 @@ type installOpts struct {
 }
 
 // NewCmdInstall creates a new install command
-func NewCmdInstall(in io.Reader, out io.Writer) *cobra.Command {
+func NewCmdInstall(ctx context.Context, in io.Reader, out io.Writer) *cobra.Command {
 	opts := &installOpts{}
 
 	cmd := &cobra.Command{
@@ -25,10 +27,14 @@ func NewCmdInstall(in io.Reader, out io.Writer) *cobra.Command {
 
 	// Subcommands
 	cmd.AddCommand(NewCmdPlan(in, out, opts))
-	cmd.AddCommand(NewCmdValidate(out, opts))
-	cmd.AddCommand(NewCmdApply(out, opts))
-	cmd.AddCommand(NewCmdAddWorker(out, opts))
-	cmd.AddCommand(NewCmdStep(out, opts))
+	cmd.AddCommand(NewCmdValidate(ctx, out, opts))
+	cmd.AddCommand(NewCmdApply(ctx, out, opts))
+	cmd.AddCommand(NewCmdDiff(out, opts))
+	cmd.AddCommand(NewCmdAddWorker(ctx, out, opts))
+	cmd.AddCommand(NewCmdAddNode(ctx, out, opts))
+	cmd.AddCommand(NewCmdRemoveNode(ctx, out, opts))
+	cmd.AddCommand(NewCmdReset(ctx, out, opts))
+	cmd.AddCommand(NewCmdStep(ctx, out, opts))
 
 	// PersistentFlags
 	addPlanFileFlag(cmd.PersistentFlags(), &opts.planFilename)
@@ -39,3 +45,8 @@ func NewCmdInstall(in io.Reader, out io.Writer) *cobra.Command {
 func addPlanFileFlag(flagSet *pflag.FlagSet, p *string) {
 	flagSet.StringVarP(p, "plan-file", "f", "kismatic-cluster.yaml", "path to the installation plan file")
 }
+
+func addTimeoutFlags(flagSet *pflag.FlagSet, timeout *time.Duration, taskTimeout *time.Duration) {
+	flagSet.DurationVar(timeout, "timeout", 0, "abort a playbook run that does not complete within the timeout, e.g. \"2h\" (no timeout if 0)")
+	flagSet.DurationVar(taskTimeout, "task-timeout", 0, "abort a playbook run when a single task does not complete within the timeout, e.g. \"15m\" (no timeout if 0)")
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// jsonOutput is the output format that writes one JSON object per line
+const jsonOutput = "json"
+
+// validationResult is written for each validation check
+type validationResult struct {
+	Type     string   `json:"type"`
+	Check    string   `json:"check"`
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// generatedAssets are the paths to the assets generated by the command
+type generatedAssets struct {
+	Directory    string `json:"directory"`
+	Certificates string `json:"certificates"`
+	Kubeconfig   string `json:"kubeconfig,omitempty"`
+}
+
+// commandSummary is the last object written by a command
+type commandSummary struct {
+	Type            string           `json:"type"`
+	Command         string           `json:"command"`
+	Success         bool             `json:"success"`
+	ExitStatus      int              `json:"exitStatus"`
+	Error           string           `json:"error,omitempty"`
+	RunDirectories  []string         `json:"runDirectories"`
+	GeneratedAssets *generatedAssets `json:"generatedAssets,omitempty"`
+}
+
+func printJSON(out io.Writer, obj interface{}) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(out, "%s\n", b)
+}
+
+func printValidationResult(out io.Writer, check string, errs []error) {
+	r := validationResult{
+		Type:  "validation",
+		Check: check,
+		Valid: len(errs) == 0,
+	}
+	for _, err := range errs {
+		r.Errors = append(r.Errors, err.Error())
+	}
+	printJSON(out, r)
+}
+
+// printValidationWarning writes the result of a check that passed with warnings
+func printValidationWarning(out io.Writer, check string, warns []error) {
+	r := validationResult{
+		Type:  "validation",
+		Check: check,
+		Valid: true,
+	}
+	for _, w := range warns {
+		r.Warnings = append(r.Warnings, w.Error())
+	}
+	printJSON(out, r)
+}
+
+// printSummary writes the summary of the command, given the error
+// returned by the command
+func printSummary(out io.Writer, command string, err error, runDirectories []string, assets *generatedAssets) {
+	s := commandSummary{
+		Type:            "summary",
+		Command:         command,
+		Success:         err == nil,
+		RunDirectories:  runDirectories,
+		GeneratedAssets: assets,
+	}
+	if s.RunDirectories == nil {
+		s.RunDirectories = []string{}
+	}
+	if err != nil {
+		s.ExitStatus = 1
+		s.Error = err.Error()
+	}
+	printJSON(out, s)
+}
+
+func newGeneratedAssets(generatedAssetsDir string, kubeconfig bool) *generatedAssets {
+	assets := &generatedAssets{
+		Directory:    generatedAssetsDir,
+		Certificates: filepath.Join(generatedAssetsDir, "keys"),
+	}
+	if kubeconfig {
+		assets.Kubeconfig = filepath.Join(generatedAssetsDir, "kubeconfig")
+	}
+	return assets
+}
@@ -1,13 +1,15 @@
 package cli
 
 import (
+	"context"
 	"io"
 
 	"github.com/spf13/cobra"
 )
 
-// NewKismaticCommand creates the kismatic command
-func NewKismaticCommand(version string, buildDate string, in io.Reader, out io.Writer) (*cobra.Command, error) {
+// NewKismaticCommand creates the kismatic command. The playbooks and the commands
+// run on the nodes are aborted when the context is canceled.
+func NewKismaticCommand(ctx context.Context, version string, buildDate string, in io.Reader, out io.Writer) (*cobra.Command, error) {
 	cmd := &cobra.Command{
 		Use:   "kismatic",
 		Short: "kismatic is the main tool for managing your Kubernetes cluster",
@@ -21,11 +23,19 @@ more documentation is availble at https://github.com/apprenda/kismatic`,
 	}
 
 	cmd.AddCommand(NewCmdVersion(version, buildDate, out))
-	cmd.AddCommand(NewCmdInstall(in, out))
-	cmd.AddCommand(NewCmdVolume(out))
+	cmd.AddCommand(NewCmdInstall(ctx, in, out))
+	cmd.AddCommand(NewCmdVolume(ctx, out))
 	cmd.AddCommand(NewCmdIP(out))
 	cmd.AddCommand(NewCmdDashboard(out))
-	cmd.AddCommand(NewCmdSSH(out))
+	cmd.AddCommand(NewCmdStatus(ctx, out))
+	cmd.AddCommand(NewCmdSSH(ctx, out))
+	cmd.AddCommand(NewCmdSCP(ctx, out))
+	cmd.AddCommand(NewCmdDiagnose(ctx, out))
+	cmd.AddCommand(NewCmdRuns(out))
+	cmd.AddCommand(NewCmdUpgrade(ctx, out))
+	cmd.AddCommand(NewCmdBackup(ctx, out))
+	cmd.AddCommand(NewCmdCertificates(ctx, out))
+	cmd.AddCommand(NewCmdKubeconfig(ctx, out))
 
 	return cmd, nil
 }
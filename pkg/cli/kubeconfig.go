@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type kubeconfigOpts struct {
+	planFilename             string
+	generatedAssetsDirectory string
+	groups                   []string
+	outputFormat             string
+}
+
+// NewCmdKubeconfig creates a new kubeconfig command
+func NewCmdKubeconfig(ctx context.Context, out io.Writer) *cobra.Command {
+	opts := &kubeconfigOpts{}
+	cmd := &cobra.Command{
+		Use:   "kubeconfig",
+		Short: "manage the credentials of the users of your Kubernetes cluster",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	// Subcommands
+	cmd.AddCommand(NewCmdKubeconfigCreate(ctx, out, opts))
+	cmd.AddCommand(NewCmdKubeconfigList(out, opts))
+	cmd.AddCommand(NewCmdKubeconfigDiscard(out, opts))
+
+	// PersistentFlags
+	addPlanFileFlag(cmd.PersistentFlags(), &opts.planFilename)
+	cmd.PersistentFlags().StringVar(&opts.generatedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	return cmd
+}
+
+// NewCmdKubeconfigCreate returns the command for creating the credentials of a user
+func NewCmdKubeconfigCreate(ctx context.Context, out io.Writer, opts *kubeconfigOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create USERNAME",
+		Short: "issue a client certificate for a user and write a kubeconfig file for it",
+		Long: `Issue a client certificate for a user, signed by the cluster's Certificate Authority, and write a
+kubeconfig file for it in the "kubeconfigs" directory of the generated assets directory.
+
+The groups of the user are set as the organizations of the certificate's subject. Groups can't be
+set when the certificates are issued by a Vault signer, which drops the organizations. The issued
+identities are recorded, and can be listed with "kismatic kubeconfig list".`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			planner := &install.FilePlanner{File: opts.planFilename}
+			execOpts := install.ExecutorOptions{
+				Context:                  ctx,
+				GeneratedAssetsDirectory: opts.generatedAssetsDirectory,
+				OutputFormat:             "simple",
+			}
+			executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+			if err != nil {
+				return err
+			}
+			return doKubeconfigCreate(out, planner, executor, args[0], opts)
+		},
+	}
+	cmd.Flags().StringSliceVar(&opts.groups, "group", []string{}, "comma-separated list of groups of the user")
+	return cmd
+}
+
+func doKubeconfigCreate(out io.Writer, planner install.Planner, executor install.Executor, user string, opts *kubeconfigOpts) error {
+	if !planner.PlanExists() {
+		return errors.New("user credentials can only be created with an existing plan file")
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read plan file: %v", err)
+	}
+	id, err := executor.CreateUserCredentials(plan, user, opts.groups)
+	if err != nil {
+		return err
+	}
+	util.PrettyPrintOk(out, "Issued certificate for user %q", id.Name)
+	util.PrettyPrintOk(out, "Generated kubeconfig file %q", id.Kubeconfig)
+	return nil
+}
+
+// NewCmdKubeconfigList returns the command for listing the users
+func NewCmdKubeconfigList(out io.Writer, opts *kubeconfigOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the users for whom credentials were issued",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doKubeconfigList(out, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "table", "list output format (options \"table\"|\"json\")")
+	return cmd
+}
+
+func doKubeconfigList(out io.Writer, opts *kubeconfigOpts) error {
+	if opts.outputFormat != "table" && opts.outputFormat != jsonOutput {
+		return fmt.Errorf("output format %q is not supported", opts.outputFormat)
+	}
+	identities, err := install.ListUserIdentities(opts.generatedAssetsDirectory)
+	if err != nil {
+		return err
+	}
+	if opts.outputFormat == jsonOutput {
+		printJSON(out, identities)
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 1, 8, 4, ' ', 0)
+	fmt.Fprintf(w, "USER\tGROUPS\tSERIAL\tISSUED\tEXPIRY\tDISCARDED\n")
+	for _, id := range identities {
+		discarded := "-"
+		if id.Discarded != nil {
+			discarded = id.Discarded.Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", id.Name, orNone([]string{strings.Join(id.Groups, ",")}), id.Serial, id.Issued.Format("2006-01-02"), id.NotAfter.Format("2006-01-02"), discarded)
+	}
+	return w.Flush()
+}
+
+// NewCmdKubeconfigDiscard returns the command for discarding the local credentials of a user
+func NewCmdKubeconfigDiscard(out io.Writer, opts *kubeconfigOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "discard USERNAME",
+		Short: "discard the local credentials of a user, without revoking its certificate",
+		Long: `Discard the local credentials of a user. The user's certificate, key and kubeconfig file are removed
+from the generated assets directory, and the identity is recorded as discarded, so that new credentials
+can be created for the user.
+
+This does NOT revoke the user's certificate. The Kubernetes API server does not check whether
+certificates are revoked: anyone holding a copy of the certificate and key can still use them
+until the certificate expires, or until the cluster's Certificate Authority is replaced. Remove
+the authorization policies of the user to deny its access to the cluster.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			id, err := install.DiscardUserCredentials(opts.generatedAssetsDirectory, args[0])
+			if err != nil {
+				return err
+			}
+			util.PrettyPrintOk(out, "Discarded the local credentials of user %q", id.Name)
+			util.PrettyPrintWarn(out, "The certificate with serial %s was not revoked, it remains valid until %s", id.Serial, id.NotAfter.Format("2006-01-02"))
+			return nil
+		},
+	}
+	return cmd
+}
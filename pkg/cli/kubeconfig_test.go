@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+func TestKubeconfigCreate(t *testing.T) {
+	fp := &fakePlanner{exists: true, plan: &install.Plan{}}
+	fe := &fakeExecutor{}
+	if err := doKubeconfigCreate(&bytes.Buffer{}, fp, fe, "alice", &kubeconfigOpts{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if fe.createdUser != "alice" {
+		t.Errorf("expected credentials to be created for alice, but got %q", fe.createdUser)
+	}
+}
+
+func TestKubeconfigCreatePlanNotFound(t *testing.T) {
+	fp := &fakePlanner{exists: false}
+	fe := &fakeExecutor{}
+	if err := doKubeconfigCreate(&bytes.Buffer{}, fp, fe, "alice", &kubeconfigOpts{}); err == nil {
+		t.Errorf("expected an error when the plan does not exist")
+	}
+	if fe.createdUser != "" {
+		t.Errorf("expected credentials not to be created")
+	}
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type removeNodeOpts struct {
+	GeneratedAssetsDirectory string
+	OutputFormat             string
+	Verbose                  bool
+	Timeout                  time.Duration
+	TaskTimeout              time.Duration
+}
+
+// NewCmdRemoveNode returns the command for removing nodes from the cluster
+func NewCmdRemoveNode(ctx context.Context, out io.Writer, installOpts *installOpts) *cobra.Command {
+	opts := &removeNodeOpts{}
+	cmd := &cobra.Command{
+		Use:   "remove-node NODE_NAME",
+		Short: "remove a Worker, Ingress or Storage node from an existing Kubernetes cluster",
+		Long: `Remove a Worker, Ingress or Storage node from an existing Kubernetes cluster.
+
+The node is drained and deleted from the cluster, and the Kubernetes services running on it are stopped.
+The node's certificate is removed from the generated assets directory, and the plan file is updated.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			return doRemoveNode(ctx, out, installOpts.planFilename, opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.GeneratedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().BoolVar(&opts.Verbose, "verbose", false, "enable verbose logging from the installation")
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	addTimeoutFlags(cmd.Flags(), &opts.Timeout, &opts.TaskTimeout)
+	return cmd
+}
+
+func doRemoveNode(ctx context.Context, out io.Writer, planFile string, opts *removeNodeOpts, nodeName string) error {
+	planner := &install.FilePlanner{File: planFile}
+	if !planner.PlanExists() {
+		return errors.New("remove-node can only be used with an existing plan file")
+	}
+	execOpts := install.ExecutorOptions{
+		Context:                  ctx,
+		GeneratedAssetsDirectory: opts.GeneratedAssetsDirectory,
+		OutputFormat:             opts.OutputFormat,
+		Verbose:                  opts.Verbose,
+		Timeout:                  opts.Timeout,
+		TaskTimeout:              opts.TaskTimeout,
+		SkipCAGeneration:         true,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	if err != nil {
+		return err
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read plan file: %v", err)
+	}
+	if _, errs := install.ValidatePlan(plan); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("the plan file failed validation")
+	}
+	node, err := findNodeInPlan(*plan, nodeName)
+	if err != nil {
+		return err
+	}
+	updatedPlan, err := executor.RemoveNode(plan, *node)
+	if err != nil {
+		return err
+	}
+	if err := planner.Write(updatedPlan); err != nil {
+		return fmt.Errorf("error updating plan file to remove node: %v", err)
+	}
+	return nil
+}
+
+// returns the worker, ingress or storage node with the given host name
+func findNodeInPlan(plan install.Plan, host string) (*install.Node, error) {
+	for _, nodes := range [][]install.Node{plan.Worker.Nodes, plan.Ingress.Nodes, plan.Storage.Nodes} {
+		for _, n := range nodes {
+			if n.Host == host {
+				return &n, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("according to the plan file, %q is not a worker, ingress or storage node", host)
+}
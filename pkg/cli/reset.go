@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type resetOpts struct {
+	GeneratedAssetsDirectory string
+	OutputFormat             string
+	Verbose                  bool
+	Limit                    []string
+	Force                    bool
+	Timeout                  time.Duration
+	TaskTimeout              time.Duration
+}
+
+// NewCmdReset returns the command for resetting the nodes of the cluster
+func NewCmdReset(ctx context.Context, out io.Writer, installOpts *installOpts) *cobra.Command {
+	opts := &resetOpts{}
+	cmd := &cobra.Command{
+		Use:   "reset",
+		Short: "remove everything that was installed by kismatic from the nodes of the cluster",
+		Long: `Remove everything that was installed by kismatic from the nodes of the cluster.
+
+All Kubernetes, etcd, Calico and Docker services are stopped and disabled. The containers started by
+kismatic, the data of the etcd clusters, the Calico state, the certificates and the images of the internal
+Docker registry are deleted, and the iptables chains created by kube-proxy, Calico and Docker are removed.
+Other containers, iptables rules and policies are left untouched. The packages installed by kismatic are removed if the plan
+allows package installation. This operation cannot be undone, and must be confirmed with the --force flag.
+
+Use the --limit flag to only reset some of the nodes.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doReset(ctx, out, installOpts.planFilename, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.GeneratedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().BoolVar(&opts.Verbose, "verbose", false, "enable verbose logging from the reset")
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "reset output format (options \"simple\"|\"raw\")")
+	cmd.Flags().StringSliceVar(&opts.Limit, "limit", []string{}, "comma-separated list of hostnames of the nodes to reset")
+	cmd.Flags().BoolVar(&opts.Force, "force", false, "confirm that the nodes should be reset (required)")
+	addTimeoutFlags(cmd.Flags(), &opts.Timeout, &opts.TaskTimeout)
+	return cmd
+}
+
+func doReset(ctx context.Context, out io.Writer, planFile string, opts *resetOpts) error {
+	if !opts.Force {
+		return errors.New("reset deletes all cluster data from the nodes, use the --force flag to confirm")
+	}
+	planner := &install.FilePlanner{File: planFile}
+	if !planner.PlanExists() {
+		return errors.New("reset can only be used with an existing plan file")
+	}
+	execOpts := install.ExecutorOptions{
+		Context:                  ctx,
+		GeneratedAssetsDirectory: opts.GeneratedAssetsDirectory,
+		OutputFormat:             opts.OutputFormat,
+		Verbose:                  opts.Verbose,
+		Timeout:                  opts.Timeout,
+		TaskTimeout:              opts.TaskTimeout,
+		SkipCAGeneration:         true,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	if err != nil {
+		return err
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read plan file: %v", err)
+	}
+	if _, errs := install.ValidatePlan(plan); errs != nil {
+		util.PrintValidationErrors(out, errs)
+		return errors.New("the plan file failed validation")
+	}
+	if err := executor.Reset(plan, opts.Limit); err != nil {
+		return err
+	}
+	util.PrintColor(out, util.Green, "\nThe nodes were reset successfully\n\n")
+	return nil
+}
@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type runsOpts struct {
+	runsDirectory    string
+	listOutputFormat string
+	olderThan        time.Duration
+	keep             int
+	dryRun           bool
+	replayOutput     string
+	verbose          bool
+}
+
+// NewCmdRuns creates a new runs command
+func NewCmdRuns(out io.Writer) *cobra.Command {
+	opts := &runsOpts{}
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "browse and prune the history of the runs of kismatic",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	// Subcommands
+	cmd.AddCommand(NewCmdRunsList(out, opts))
+	cmd.AddCommand(NewCmdRunsShow(out, opts))
+	cmd.AddCommand(NewCmdRunsReplay(out, opts))
+	cmd.AddCommand(NewCmdRunsPrune(out, opts))
+
+	// PersistentFlags
+	cmd.PersistentFlags().StringVar(&opts.runsDirectory, "runs-dir", "runs", "path to the directory where the runs of kismatic are stored")
+	return cmd
+}
+
+// NewCmdRunsList returns the command for listing the runs
+func NewCmdRunsList(out io.Writer, opts *runsOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the runs with their outcome",
+		Long: `List the runs, from the oldest to the most recent, with their operation, start and end time,
+duration, outcome and failing task.
+
+The outcome and failing task are derived from the progress recorded by installation runs,
+and from the ansible log and recorded events of the other runs. A run is incomplete when
+it was interrupted, or is still running.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doRunsList(out, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.listOutputFormat, "output", "o", "table", "list output format (options \"table\"|\"json\")")
+	return cmd
+}
+
+func doRunsList(out io.Writer, opts *runsOpts) error {
+	if opts.listOutputFormat != "table" && opts.listOutputFormat != jsonOutput {
+		return fmt.Errorf("output format %q is not supported", opts.listOutputFormat)
+	}
+	runs, err := install.ListRuns(opts.runsDirectory)
+	if err != nil {
+		return err
+	}
+	if opts.listOutputFormat == jsonOutput {
+		printJSON(out, runs)
+		return nil
+	}
+	return printRunsTable(out, runs)
+}
+
+func printRunsTable(out io.Writer, runs []install.Run) error {
+	w := tabwriter.NewWriter(out, 1, 8, 4, ' ', 0)
+	fmt.Fprintf(w, "RUN\tOPERATION\tSTART\tEND\tDURATION\tOUTCOME\tFAILED TASK\n")
+	for _, r := range runs {
+		end, duration := "-", "-"
+		if r.End != nil {
+			end = r.End.Local().Format("2006-01-02 15:04:05")
+			duration = r.Duration().String()
+		}
+		failed := r.FailedTask
+		if len(r.FailedHosts) > 0 {
+			failed = fmt.Sprintf("%s (%s)", r.FailedTask, strings.Join(r.FailedHosts, ","))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.ID, r.Operation, r.Start.Format("2006-01-02 15:04:05"), end, duration, r.Outcome, orNone([]string{failed}))
+	}
+	return w.Flush()
+}
+
+// NewCmdRunsShow returns the command for showing a run
+func NewCmdRunsShow(out io.Writer, opts *runsOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show [RUN]",
+		Short: "show the outcome, plan, inventory and cluster catalog of a run",
+		Long: `Show the outcome of a run, and the plan, inventory and cluster catalog it used.
+
+RUN is the ID of the run, as listed by "kismatic runs list", or the path to its directory.
+The most recent run is shown if RUN is omitted. The values of settings that look like
+passwords or tokens are redacted.`,
+		Example: `  kismatic runs show install/2017-03-01-10-00-00`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("Unexpected args: %v", args[1:])
+			}
+			id := ""
+			if len(args) == 1 {
+				id = args[0]
+			}
+			return doRunsShow(out, opts, id)
+		},
+	}
+	return cmd
+}
+
+func doRunsShow(out io.Writer, opts *runsOpts, id string) error {
+	r, err := install.FindRun(opts.runsDirectory, id)
+	if err != nil {
+		return err
+	}
+	if err = printRunsTable(out, []install.Run{*r}); err != nil {
+		return err
+	}
+	for _, name := range install.RunRecordedFiles {
+		b, err := install.ReadRunFile(r.Directory, name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s of run %q: %v", name, r.ID, err)
+		}
+		util.PrintHeader(out, name, '=')
+		fmt.Fprintf(out, "%s\n", strings.TrimRight(string(b), "\n"))
+	}
+	return nil
+}
+
+// NewCmdRunsReplay returns the command for replaying the events of a run
+func NewCmdRunsReplay(out io.Writer, opts *runsOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay [RUN]",
+		Short: "replay the ansible events recorded by a run",
+		Long: `Replay the ansible events recorded by a run, explaining them in the given output format.
+
+RUN is the ID of the run, as listed by "kismatic runs list", or the path to its directory.
+The most recent run is replayed if RUN is omitted. The durations of the plays and tasks in
+the JSON output are those of the replay, as the events are not timestamped.`,
+		Example: `  kismatic runs replay install/2017-03-01-10-00-00 --verbose
+  kismatic runs replay preflight/2017-03-01-09-58-00 -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("Unexpected args: %v", args[1:])
+			}
+			id := ""
+			if len(args) == 1 {
+				id = args[0]
+			}
+			return doRunsReplay(out, opts, id)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.replayOutput, "output", "o", "simple", "replay output format (options \"simple\"|\"json\")")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "explain every task of the run, as with the --verbose flag of the operation")
+	return cmd
+}
+
+func doRunsReplay(out io.Writer, opts *runsOpts, id string) error {
+	if opts.replayOutput != "simple" && opts.replayOutput != jsonOutput {
+		return fmt.Errorf("output format %q is not supported", opts.replayOutput)
+	}
+	r, err := install.FindRun(opts.runsDirectory, id)
+	if err != nil {
+		return err
+	}
+	// The events are explained as they were when the run was performed
+	var eventExplainer explain.AnsibleEventExplainer = &explain.DefaultEventExplainer{}
+	switch {
+	case opts.replayOutput == jsonOutput:
+		eventExplainer = &explain.JSONEventExplainer{}
+	case r.Operation == "preflight":
+		eventExplainer = &explain.PreflightEventExplainer{DefaultExplainer: &explain.DefaultEventExplainer{}}
+	}
+	explainer := &explain.AnsibleEventStreamExplainer{
+		Out:            out,
+		Verbose:        opts.verbose,
+		EventExplainer: eventExplainer,
+	}
+	return install.ReplayRun(r.Directory, explainer)
+}
+
+// NewCmdRunsPrune returns the command for pruning the runs
+func NewCmdRunsPrune(out io.Writer, opts *runsOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "remove the old runs",
+		Long: `Remove the runs that started before --older-than, or that are not among the --keep most recent runs.
+
+The last successful installation, the last installation, which may be resumed, and the run
+that recorded the plan that was last applied to the cluster are always kept.`,
+		Example: `  kismatic runs prune --older-than 720h
+  kismatic runs prune --keep 20 --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doRunsPrune(out, opts, time.Now())
+		},
+	}
+	cmd.Flags().DurationVar(&opts.olderThan, "older-than", 0, "remove the runs that started before this duration ago, e.g. \"720h\"")
+	cmd.Flags().IntVar(&opts.keep, "keep", 0, "remove the runs that are not among this number of most recent runs")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "list the runs that would be removed, without removing them")
+	return cmd
+}
+
+func doRunsPrune(out io.Writer, opts *runsOpts, now time.Time) error {
+	if opts.olderThan < 0 || opts.keep < 0 {
+		return fmt.Errorf("--older-than and --keep cannot be negative")
+	}
+	if opts.olderThan == 0 && opts.keep == 0 {
+		return fmt.Errorf("the runs to remove must be selected with --older-than or --keep")
+	}
+	pruneOpts := install.PruneRunsOptions{
+		OlderThan: opts.olderThan,
+		Keep:      opts.keep,
+		DryRun:    opts.dryRun,
+	}
+	pruned, err := install.PruneRuns(opts.runsDirectory, pruneOpts, now)
+	verb := "Removed"
+	if opts.dryRun {
+		verb = "Would remove"
+	}
+	for _, r := range pruned {
+		fmt.Fprintf(out, "%s run %s\n", verb, r.ID)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s %d runs\n", verb, len(pruned))
+	return nil
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestRunsListAndShow(t *testing.T) {
+	p := testPlan()
+	p.Cluster.AdminPassword = "s3cr3t"
+	runsDir := mustWriteInstallRun(t, p)
+	defer os.RemoveAll(runsDir)
+	failedRun := filepath.Join(runsDir, "upgrade", "2017-04-01-10-00-00")
+	if err := os.MkdirAll(failedRun, 0755); err != nil {
+		t.Fatalf("error creating run directory: %v", err)
+	}
+	log := "2017-04-01 10:00:01.000+0000 - TASK [drain node] ****\n2017-04-01 10:00:02.000+0000 - fatal: [worker01]: FAILED! => {}\n"
+	if err := ioutil.WriteFile(filepath.Join(failedRun, "ansible.log"), []byte(log), 0644); err != nil {
+		t.Fatalf("error writing ansible log: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	if err := doRunsList(out, &runsOpts{runsDirectory: runsDir, listOutputFormat: "table"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "install/2017-03-01-10-00-00") || !strings.Contains(lines[1], "succeeded") {
+		t.Errorf("expected the successful installation run, but got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[2], "upgrade/2017-04-01-10-00-00") || !strings.Contains(lines[2], "drain node (worker01)") {
+		t.Errorf("expected the failing task of the upgrade run, but got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := doRunsShow(out, &runsOpts{runsDirectory: runsDir}, "install/2017-03-01-10-00-00"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "kismatic-cluster.yaml") || !strings.Contains(out.String(), "pod_cidr_block: 172.16.0.0/16") {
+		t.Errorf("expected the plan of the run, but got:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("expected the admin password to be redacted, but got:\n%s", out.String())
+	}
+	if err := doRunsShow(out, &runsOpts{runsDirectory: runsDir}, "install/2017-09-01-10-00-00"); err == nil {
+		t.Errorf("expected an error showing a run that does not exist")
+	}
+}
+
+func TestRunsPrune(t *testing.T) {
+	runsDir := mustWriteInstallRun(t, testPlan())
+	defer os.RemoveAll(runsDir)
+	oldRun := filepath.Join(runsDir, "preflight", "2017-01-01-10-00-00")
+	if err := os.MkdirAll(oldRun, 0755); err != nil {
+		t.Fatalf("error creating run directory: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	now := time.Date(2017, 6, 1, 0, 0, 0, 0, time.Local)
+	if err := doRunsPrune(out, &runsOpts{runsDirectory: runsDir, olderThan: 24 * time.Hour}, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Removed run preflight/2017-01-01-10-00-00") || !strings.Contains(out.String(), "Removed 1 runs") {
+		t.Errorf("expected the preflight run to be removed, but got:\n%s", out.String())
+	}
+	if _, err := os.Stat(oldRun); !os.IsNotExist(err) {
+		t.Errorf("expected the run directory to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(runsDir, "install", "2017-03-01-10-00-00")); err != nil {
+		t.Errorf("expected the successful installation run to be kept: %v", err)
+	}
+	if err := doRunsPrune(out, &runsOpts{runsDirectory: runsDir}, now); err == nil {
+		t.Errorf("expected an error when no runs are selected")
+	}
+}
+
+func TestRunsReplay(t *testing.T) {
+	runsDir := mustWriteInstallRun(t, testPlan())
+	defer os.RemoveAll(runsDir)
+	events := `{"eventType":"PLAYBOOK_START", "eventData": {"name":"kubernetes.yaml", "count": 1}}
+{"eventType":"PLAY_START", "eventData": {"name":"Start etcd"}}
+{"eventType":"TASK_START", "eventData": {"name":"start etcd"}}
+{"eventType":"RUNNER_FAILED", "eventData": {"host":"etcd01", "result": {"msg":"etcd did not start"}}}
+{"eventType":"PLAYBOOK_END", "eventData": {"name":"kubernetes.yaml"}}
+`
+	eventsFile := filepath.Join(runsDir, "install", "2017-03-01-10-00-00", ansible.EventsFile)
+	if err := ioutil.WriteFile(eventsFile, []byte(events), 0644); err != nil {
+		t.Fatalf("error writing events: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	if err := doRunsReplay(out, &runsOpts{runsDirectory: runsDir, replayOutput: jsonOutput}, "install/2017-03-01-10-00-00"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), `"host":"etcd01","status":"failed","message":"etcd did not start"`) {
+		t.Errorf("expected the failure of the task in the replayed output, but got:\n%s", out.String())
+	}
+	if err := doRunsReplay(out, &runsOpts{runsDirectory: runsDir, replayOutput: "yaml"}, ""); err == nil {
+		t.Errorf("expected an error with an unsupported output format")
+	}
+}
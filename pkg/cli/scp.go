@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/spf13/cobra"
+)
+
+type scpOpts struct {
+	planFilename string
+	source       string
+	destination  string
+	recursive    bool
+	all          bool
+	parallel     int
+}
+
+// copies the files between the local path and the remote path on the nodes
+type copyOnNodesFunc func(p *install.Plan, nodes []install.Node, from, to string, recursive bool, parallelism int) []install.NodeCopyResult
+
+// NewCmdSCP returns the command for copying files to and from the nodes
+func NewCmdSCP(ctx context.Context, out io.Writer) *cobra.Command {
+	opts := &scpOpts{}
+	cmd := &cobra.Command{
+		Use:   "scp SOURCE DESTINATION",
+		Short: "copy files between the local machine and nodes in the cluster",
+		Long: `Copy files between the local machine and nodes in the cluster.
+
+One of SOURCE and DESTINATION must be a remote path, HOST:PATH, where HOST is one of the following:
+- A hostname defined in the plan file
+- An alias: master, etcd, worker, ingress or storage. This will copy to or from the first defined node of that type.
+
+With --all, files are copied to or from all the nodes of the alias, with at most --parallel
+nodes at a time. The files copied from multiple nodes are placed in a directory named after
+each node, which is created in DESTINATION.
+
+Files are copied with the SCP protocol, which requires scp to be installed on the nodes.
+The permissions and modification times of the files are preserved.`,
+		Example: `  kismatic scp ./kubelet.conf master01:/tmp/kubelet.conf
+  kismatic scp -r --all ./hotfix worker:/tmp
+  kismatic scp -r --all etcd:/var/log/etcd ./logs`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return cmd.Usage()
+			}
+			opts.source = args[0]
+			opts.destination = args[1]
+			planner := &install.FilePlanner{File: opts.planFilename}
+			copyTo := func(p *install.Plan, nodes []install.Node, from, to string, recursive bool, parallelism int) []install.NodeCopyResult {
+				return install.CopyToNodes(ctx, p, nodes, from, to, recursive, parallelism)
+			}
+			copyFrom := func(p *install.Plan, nodes []install.Node, from, to string, recursive bool, parallelism int) []install.NodeCopyResult {
+				return install.CopyFromNodes(ctx, p, nodes, from, to, recursive, parallelism)
+			}
+			return doSCP(out, planner, opts, copyTo, copyFrom)
+		},
+	}
+	addPlanFileFlag(cmd.PersistentFlags(), &opts.planFilename)
+	cmd.Flags().BoolVarP(&opts.recursive, "recursive", "r", false, "copy directories recursively")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "copy to or from all the nodes of the alias, instead of the first one")
+	cmd.Flags().IntVar(&opts.parallel, "parallel", 10, "maximum number of nodes to or from which files are copied at the same time")
+	return cmd
+}
+
+func doSCP(out io.Writer, planner install.Planner, opts *scpOpts, copyTo, copyFrom copyOnNodesFunc) error {
+	if opts.parallel < 1 {
+		return fmt.Errorf("--parallel must be greater than 0, got %d", opts.parallel)
+	}
+	srcHost, srcPath, srcRemote := parseRemotePath(opts.source)
+	destHost, destPath, destRemote := parseRemotePath(opts.destination)
+	if srcRemote == destRemote {
+		return errors.New("exactly one of SOURCE and DESTINATION must be a remote path, HOST:PATH")
+	}
+	host := srcHost
+	if destRemote {
+		host = destHost
+	}
+	if !planner.PlanExists() {
+		return fmt.Errorf("plan does not exist")
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	nodes, err := scpNodes(plan, host, opts.all)
+	if err != nil {
+		return err
+	}
+
+	var results []install.NodeCopyResult
+	if destRemote {
+		results = copyTo(plan, nodes, srcPath, destPath, opts.recursive, opts.parallel)
+	} else {
+		results = copyFrom(plan, nodes, srcPath, destPath, opts.recursive, opts.parallel)
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+			fmt.Fprintf(out, "[%s] error copying %s to %s: %s\n", r.Host, r.Source, r.Destination, r.Error)
+			continue
+		}
+		fmt.Fprintf(out, "[%s] copied %s to %s\n", r.Host, r.Source, r.Destination)
+	}
+	if failed > 0 {
+		return fmt.Errorf("the copy failed on %d of %d nodes", failed, len(results))
+	}
+	return nil
+}
+
+// returns the nodes to or from which files are copied. All the nodes of the role
+// are returned if all is true, and the host is a role alias.
+func scpNodes(plan *install.Plan, host string, all bool) ([]install.Node, error) {
+	switch host {
+	case "etcd", "master", "worker", "ingress", "storage":
+		if all {
+			return plan.SelectNodes([]string{host}, nil)
+		}
+	}
+	con, err := plan.GetSSHConnection(host)
+	if err != nil {
+		return nil, err
+	}
+	return []install.Node{*con.Node}, nil
+}
+
+// splits the HOST:PATH remote path. Paths without a colon before the
+// first slash are local paths.
+func parseRemotePath(arg string) (host, path string, remote bool) {
+	i := strings.Index(arg, ":")
+	if i <= 0 || strings.Contains(arg[:i], "/") {
+		return "", arg, false
+	}
+	path = arg[i+1:]
+	if path == "" {
+		path = "."
+	}
+	return arg[:i], path, true
+}
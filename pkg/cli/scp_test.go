@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+// fakeCopier records the copies, and fails on the failing hosts
+type fakeCopier struct {
+	direction string
+	hosts     []string
+	from, to  string
+	failing   string
+}
+
+func (fc *fakeCopier) copyFunc(direction string) copyOnNodesFunc {
+	return func(p *install.Plan, nodes []install.Node, from, to string, recursive bool, parallelism int) []install.NodeCopyResult {
+		fc.direction, fc.from, fc.to = direction, from, to
+		results := []install.NodeCopyResult{}
+		for _, n := range nodes {
+			fc.hosts = append(fc.hosts, n.Host)
+			r := install.NodeCopyResult{Host: n.Host, Source: from, Destination: to}
+			if n.Host == fc.failing {
+				r.Error = "permission denied"
+			}
+			results = append(results, r)
+		}
+		return results
+	}
+}
+
+func TestSCP(t *testing.T) {
+	tests := []struct {
+		source, destination string
+		all                 bool
+		direction           string
+		hosts               string
+		from, to            string
+	}{
+		{source: "./kubelet.conf", destination: "master01:/tmp/kubelet.conf", direction: "to", hosts: "master01", from: "./kubelet.conf", to: "/tmp/kubelet.conf"},
+		{source: "worker:/var/log/syslog", destination: "/tmp", direction: "from", hosts: "worker01", from: "/var/log/syslog", to: "/tmp"},
+		{source: "hotfix", destination: "worker:", all: true, direction: "to", hosts: "worker01,worker02", from: "hotfix", to: "."},
+		{source: "etcd:/var/log/etcd", destination: "logs", all: true, direction: "from", hosts: "etcd01", from: "/var/log/etcd", to: "logs"},
+		// --all has no effect with a hostname
+		{source: "worker02:/etc/hosts", destination: "hosts", all: true, direction: "from", hosts: "worker02", from: "/etc/hosts", to: "hosts"},
+	}
+	p := testPlan()
+	p.Worker.Nodes = append(p.Worker.Nodes, install.Node{Host: "worker02", IP: "10.0.0.4"})
+	for _, test := range tests {
+		fc := &fakeCopier{}
+		fp := &fakePlanner{exists: true, plan: p}
+		opts := &scpOpts{source: test.source, destination: test.destination, all: test.all, parallel: 10}
+		if err := doSCP(&bytes.Buffer{}, fp, opts, fc.copyFunc("to"), fc.copyFunc("from")); err != nil {
+			t.Errorf("%s %s: unexpected error: %v", test.source, test.destination, err)
+			continue
+		}
+		if fc.direction != test.direction || strings.Join(fc.hosts, ",") != test.hosts || fc.from != test.from || fc.to != test.to {
+			t.Errorf("%s %s: expected copy %s %s from %q to %q, but got %+v", test.source, test.destination, test.direction, test.hosts, test.from, test.to, fc)
+		}
+	}
+}
+
+func TestSCPFailure(t *testing.T) {
+	out := &bytes.Buffer{}
+	fc := &fakeCopier{failing: "worker02"}
+	p := testPlan()
+	p.Worker.Nodes = append(p.Worker.Nodes, install.Node{Host: "worker02", IP: "10.0.0.4"})
+	fp := &fakePlanner{exists: true, plan: p}
+	opts := &scpOpts{source: "hotfix", destination: "worker:/tmp", all: true, parallel: 10}
+	err := doSCP(out, fp, opts, fc.copyFunc("to"), fc.copyFunc("from"))
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("expected the copy to fail on 1 of 2 nodes, but got %v", err)
+	}
+	if !strings.Contains(out.String(), "[worker02] error copying hotfix to /tmp: permission denied") {
+		t.Errorf("expected the error of worker02 in the output, but got:\n%s", out.String())
+	}
+}
+
+func TestSCPInvalidArguments(t *testing.T) {
+	tests := []*scpOpts{
+		{source: "a", destination: "b", parallel: 10},
+		{source: "master01:a", destination: "worker01:b", parallel: 10},
+		{source: "./a:b", destination: "/tmp", parallel: 10},
+		{source: "a", destination: "foo:/tmp", parallel: 10},
+		{source: "a", destination: "worker:/tmp", parallel: 0},
+	}
+	for _, opts := range tests {
+		fc := &fakeCopier{}
+		fp := &fakePlanner{exists: true, plan: testPlan()}
+		if err := doSCP(&bytes.Buffer{}, fp, opts, fc.copyFunc("to"), fc.copyFunc("from")); err == nil {
+			t.Errorf("%s %s: expected an error, but got none", opts.source, opts.destination)
+		}
+		if len(fc.hosts) != 0 {
+			t.Errorf("%s %s: expected no copy, but copied on %v", opts.source, opts.destination, fc.hosts)
+		}
+	}
+}
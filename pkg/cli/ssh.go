@@ -1,6 +1,8 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -16,10 +18,15 @@ type sshOpts struct {
 	planFilename string
 	host         string
 	arguments    []string
+	roles        []string
+	hosts        []string
+	all          bool
+	parallel     int
+	outputFormat string
 }
 
 // NewCmdSSH returns an ssh shell
-func NewCmdSSH(out io.Writer) *cobra.Command {
+func NewCmdSSH(ctx context.Context, out io.Writer) *cobra.Command {
 	opts := &sshOpts{}
 
 	cmd := &cobra.Command{
@@ -29,8 +36,28 @@ func NewCmdSSH(out io.Writer) *cobra.Command {
 
 HOST must be one of the following:
 - A hostname defined in the plan filepath
-- An alias: master, etcd, worker, ingress or storage. This will ssh into the first defined node of that type.`,
+- An alias: master, etcd, worker, ingress or storage. This will ssh into the first defined node of that type.
+
+When --role, --hosts or --all is used, HOST is omitted and the command is run on all the
+selected nodes, with at most --parallel nodes at a time. The output of the nodes is printed
+in the order of the nodes, once the command has completed on all of them. The command fails
+if it fails on any of the nodes.`,
+		Example: `  kismatic ssh master01 uptime
+  kismatic ssh --role worker -- df -h /var/lib/docker
+  kismatic ssh --hosts etcd01,etcd02 -o json systemctl is-active etcd_k8s
+  kismatic ssh --all --parallel 5 uptime`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.all || len(opts.roles) > 0 || len(opts.hosts) > 0 {
+				if len(args) < 1 {
+					return cmd.Usage()
+				}
+				opts.arguments = args
+				planner := &install.FilePlanner{File: opts.planFilename}
+				runCommand := func(p *install.Plan, nodes []install.Node, command string, parallelism int) []install.NodeCommandResult {
+					return install.RunCommandOnNodes(ctx, p, nodes, command, parallelism)
+				}
+				return doSSHOnNodes(out, planner, opts, runCommand)
+			}
 			if len(args) < 1 {
 				return cmd.Usage()
 			}
@@ -54,6 +81,11 @@ HOST must be one of the following:
 
 	// PersistentFlags
 	cmd.PersistentFlags().StringVarP(&opts.planFilename, "plan-file", "f", "kismatic-cluster.yaml", "path to the installation plan file")
+	cmd.Flags().StringSliceVar(&opts.roles, "role", []string{}, "comma-separated list of roles whose nodes run the command: etcd, master, worker, ingress or storage")
+	cmd.Flags().StringSliceVar(&opts.hosts, "hosts", []string{}, "comma-separated list of hostnames of the nodes that run the command")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "run the command on all the nodes of the cluster")
+	cmd.Flags().IntVar(&opts.parallel, "parallel", 10, "maximum number of nodes on which the command runs at the same time")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "text", "output format when running on multiple nodes (options \"text\"|\"json\")")
 
 	return cmd
 }
@@ -81,10 +113,72 @@ func doSSH(out io.Writer, planner install.Planner, opts *sshOpts) error {
 		return fmt.Errorf("cannot validate SSH connection to node %q", opts.host)
 	}
 
-	client, err := ssh.OpenConnection(con.Node.IP, con.SSHConfig.Port, con.SSHConfig.User, con.SSHConfig.Key)
+	client, err := ssh.OpenConnection(con.Node.IP, con.SSHConfig.Port, con.SSHConfig.User, con.SSHConfig.Key, con.SSHConfig.GetBastion())
 	if err != nil {
 		return fmt.Errorf("error creating SSH client: %v", err)
 	}
+	defer client.Close()
 
 	return client.Shell(strings.Join(opts.arguments, " "))
 }
+
+// runs the command on the nodes selected by the options, and reports the result of each node
+func doSSHOnNodes(out io.Writer, planner install.Planner, opts *sshOpts, runCommand func(*install.Plan, []install.Node, string, int) []install.NodeCommandResult) error {
+	if opts.outputFormat != "text" && opts.outputFormat != jsonOutput {
+		return fmt.Errorf("output format %q is not supported", opts.outputFormat)
+	}
+	if opts.all && (len(opts.roles) > 0 || len(opts.hosts) > 0) {
+		return errors.New("--all cannot be used with --role or --hosts")
+	}
+	if opts.parallel < 1 {
+		return fmt.Errorf("--parallel must be greater than 0, got %d", opts.parallel)
+	}
+	command := strings.TrimSpace(strings.Join(opts.arguments, " "))
+	if command == "" {
+		return errors.New("a command is required when running on multiple nodes")
+	}
+	if !planner.PlanExists() {
+		return fmt.Errorf("plan does not exist")
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	nodes, err := plan.SelectNodes(opts.roles, opts.hosts)
+	if err != nil {
+		return err
+	}
+
+	results := runCommand(plan, nodes, command, opts.parallel)
+	failed := 0
+	for _, r := range results {
+		if !r.Succeeded() {
+			failed++
+		}
+		if opts.outputFormat == jsonOutput {
+			printJSON(out, r)
+			continue
+		}
+		printNodeCommandResult(out, r)
+	}
+	if failed > 0 {
+		return fmt.Errorf("the command failed on %d of %d nodes", failed, len(results))
+	}
+	return nil
+}
+
+// prints the output of the command, with each line prefixed by the hostname
+func printNodeCommandResult(out io.Writer, r install.NodeCommandResult) {
+	output := strings.TrimRight(r.Output, "\n")
+	if output != "" {
+		for _, line := range strings.Split(output, "\n") {
+			fmt.Fprintf(out, "[%s] %s\n", r.Host, line)
+		}
+	}
+	switch {
+	case r.Error != "":
+		fmt.Fprintf(out, "[%s] error: %s\n", r.Host, r.Error)
+	case r.ExitStatus != 0:
+		fmt.Fprintf(out, "[%s] exited with status %d\n", r.Host, r.ExitStatus)
+	}
+}
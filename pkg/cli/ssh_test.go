@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+// returns a command runner that fails on the failing hosts, and records the nodes it ran on
+func fakeRunCommandOnNodes(ran *[]string, failing ...string) func(*install.Plan, []install.Node, string, int) []install.NodeCommandResult {
+	return func(p *install.Plan, nodes []install.Node, command string, parallelism int) []install.NodeCommandResult {
+		results := []install.NodeCommandResult{}
+		for _, n := range nodes {
+			*ran = append(*ran, n.Host)
+			r := install.NodeCommandResult{Host: n.Host, Output: "ran " + command + "\n"}
+			for _, f := range failing {
+				if f == n.Host {
+					r.ExitStatus = 1
+				}
+			}
+			results = append(results, r)
+		}
+		return results
+	}
+}
+
+func TestSSHOnNodesRole(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := testPlan()
+	p.Worker.Nodes = append(p.Worker.Nodes, install.Node{Host: "worker02", IP: "10.0.0.4"})
+	fp := &fakePlanner{exists: true, plan: p}
+	ran := []string{}
+	opts := &sshOpts{roles: []string{"worker"}, arguments: []string{"uptime"}, parallel: 10, outputFormat: "text"}
+	if err := doSSHOnNodes(out, fp, opts, fakeRunCommandOnNodes(&ran)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if strings.Join(ran, ",") != "worker01,worker02" {
+		t.Errorf("expected the command to run on the workers, but ran on %v", ran)
+	}
+	expected := "[worker01] ran uptime\n[worker02] ran uptime\n"
+	if out.String() != expected {
+		t.Errorf("expected output:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
+
+func TestSSHOnNodesFailure(t *testing.T) {
+	out := &bytes.Buffer{}
+	fp := &fakePlanner{exists: true, plan: testPlan()}
+	ran := []string{}
+	opts := &sshOpts{all: true, arguments: []string{"uptime"}, parallel: 10, outputFormat: jsonOutput}
+	err := doSSHOnNodes(out, fp, opts, fakeRunCommandOnNodes(&ran, "master01"))
+	if err == nil || !strings.Contains(err.Error(), "1 of 3") {
+		t.Errorf("expected the command to fail on 1 of 3 nodes, but got %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected one JSON object per node, but got:\n%s", out.String())
+	}
+	r := install.NodeCommandResult{}
+	if err := json.Unmarshal([]byte(lines[1]), &r); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if r.Host != "master01" || r.ExitStatus != 1 {
+		t.Errorf("unexpected result %+v", r)
+	}
+}
+
+func TestSSHOnNodesInvalidOptions(t *testing.T) {
+	fp := &fakePlanner{exists: true, plan: testPlan()}
+	tests := []*sshOpts{
+		{all: true, roles: []string{"worker"}, arguments: []string{"uptime"}, parallel: 10, outputFormat: "text"},
+		{hosts: []string{"foo"}, arguments: []string{"uptime"}, parallel: 10, outputFormat: "text"},
+		{all: true, parallel: 10, outputFormat: "text"},
+		{all: true, arguments: []string{"uptime"}, parallel: 0, outputFormat: "text"},
+		{all: true, arguments: []string{"uptime"}, parallel: 10, outputFormat: "yaml"},
+	}
+	for i, opts := range tests {
+		ran := []string{}
+		if err := doSSHOnNodes(&bytes.Buffer{}, fp, opts, fakeRunCommandOnNodes(&ran)); err == nil {
+			t.Errorf("test %d: expected an error, but got none", i)
+		}
+		if len(ran) != 0 {
+			t.Errorf("test %d: expected the command not to run, but ran on %v", i, ran)
+		}
+	}
+}
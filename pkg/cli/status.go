@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/spf13/cobra"
+)
+
+type statusOpts struct {
+	planFilename       string
+	generatedAssetsDir string
+	outputFormat       string
+}
+
+// NewCmdStatus returns the command for reporting the status of the cluster
+func NewCmdStatus(ctx context.Context, out io.Writer) *cobra.Command {
+	opts := &statusOpts{}
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "report the health of the cluster and its nodes",
+		Long: `Report the health of the cluster and its nodes.
+
+For each node, the SSH reachability, the state of the cluster services, the health of the etcd
+members, the Ready condition of the Kubernetes node and the expiry of the node certificate are reported.
+The health of the Kubernetes components is reported by the API server, which is accessed
+using the admin certificate in the generated assets directory.
+
+The command fails if the cluster is not healthy.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			planner := &install.FilePlanner{File: opts.planFilename}
+			getStatus := func(p *install.Plan, generatedAssetsDir string) *install.ClusterStatus {
+				return install.GetClusterStatus(ctx, p, generatedAssetsDir)
+			}
+			return doStatus(out, planner, opts, getStatus)
+		},
+	}
+	addPlanFileFlag(cmd.Flags(), &opts.planFilename)
+	cmd.Flags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process were stored")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "table", "status output format (options \"table\"|\"json\")")
+	return cmd
+}
+
+func doStatus(out io.Writer, planner install.Planner, opts *statusOpts, getStatus func(*install.Plan, string) *install.ClusterStatus) error {
+	if opts.outputFormat != "table" && opts.outputFormat != jsonOutput {
+		return fmt.Errorf("output format %q is not supported", opts.outputFormat)
+	}
+	if !planner.PlanExists() {
+		return fmt.Errorf("plan does not exist")
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	status := getStatus(plan, opts.generatedAssetsDir)
+	if opts.outputFormat == jsonOutput {
+		printJSON(out, status)
+	} else if err = printStatusTable(out, status); err != nil {
+		return err
+	}
+	if !status.Healthy {
+		return errors.New("the cluster is not healthy")
+	}
+	return nil
+}
+
+func printStatusTable(out io.Writer, status *install.ClusterStatus) error {
+	w := tabwriter.NewWriter(out, 1, 8, 4, ' ', 0)
+	fmt.Fprintf(w, "HOST\tROLES\tSSH\tSERVICES\tETCD\tREADY\tCERTIFICATE EXPIRY\n")
+	for _, n := range status.Nodes {
+		ssh := "ok"
+		if !n.SSHReachable {
+			ssh = "unreachable"
+		}
+		services := []string{}
+		for _, s := range n.Services {
+			services = append(services, fmt.Sprintf("%s:%s", s.Name, s.State))
+		}
+		etcd := []string{}
+		for _, e := range n.Etcd {
+			health := "healthy"
+			if !e.Healthy {
+				health = "unhealthy"
+			}
+			etcd = append(etcd, fmt.Sprintf("%s:%s", e.Cluster, health))
+		}
+		expiry := "unknown"
+		if n.CertificateExpiry != nil {
+			expiry = n.CertificateExpiry.Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", n.Host, strings.Join(n.Roles, ","), ssh, orNone(services), orNone(etcd), orNone([]string{n.Ready}), expiry)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	if status.APIError != "" {
+		fmt.Fprintf(out, "Could not get the status of the cluster from the API server: %s\n", status.APIError)
+	} else {
+		w = tabwriter.NewWriter(out, 1, 8, 4, ' ', 0)
+		fmt.Fprintf(w, "COMPONENT\tHEALTHY\tMESSAGE\n")
+		for _, c := range status.ComponentStatuses {
+			fmt.Fprintf(w, "%s\t%t\t%s\n", c.Name, c.Healthy, c.Message)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	// Errors are reported after the tables to keep them readable
+	for _, n := range status.Nodes {
+		if n.SSHError != "" {
+			fmt.Fprintf(out, "%s: SSH error: %s\n", n.Host, n.SSHError)
+		}
+		for _, e := range n.Etcd {
+			if e.Error != "" {
+				fmt.Fprintf(out, "%s: etcd %s cluster: %s\n", n.Host, e.Cluster, e.Error)
+			}
+		}
+		if n.CertificateError != "" {
+			fmt.Fprintf(out, "%s: %s\n", n.Host, n.CertificateError)
+		}
+	}
+	return nil
+}
+
+func orNone(values []string) string {
+	s := strings.Join(values, " ")
+	if s == "" {
+		return "-"
+	}
+	return s
+}
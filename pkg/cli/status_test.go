@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+func fakeClusterStatus(healthy bool) func(*install.Plan, string) *install.ClusterStatus {
+	return func(p *install.Plan, generatedAssetsDir string) *install.ClusterStatus {
+		return &install.ClusterStatus{
+			Cluster: "test",
+			Healthy: healthy,
+			Nodes: []install.NodeStatus{
+				{Host: "node01", Roles: []string{"master", "worker"}, SSHReachable: true, Ready: "True"},
+			},
+		}
+	}
+}
+
+func TestStatusCmdTableOutput(t *testing.T) {
+	out := &bytes.Buffer{}
+	fp := &fakePlanner{exists: true, plan: &install.Plan{}}
+	if err := doStatus(out, fp, &statusOpts{outputFormat: "table"}, fakeClusterStatus(true)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "master,worker") {
+		t.Errorf("expected node roles in table, but got:\n%s", out.String())
+	}
+}
+
+func TestStatusCmdUnhealthyJSONOutput(t *testing.T) {
+	out := &bytes.Buffer{}
+	fp := &fakePlanner{exists: true, plan: &install.Plan{}}
+	if err := doStatus(out, fp, &statusOpts{outputFormat: jsonOutput}, fakeClusterStatus(false)); err == nil {
+		t.Errorf("expected an error when the cluster is not healthy")
+	}
+	status := install.ClusterStatus{}
+	if err := json.Unmarshal(out.Bytes(), &status); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if status.Cluster != "test" || len(status.Nodes) != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestStatusCmdPlanNotFound(t *testing.T) {
+	fp := &fakePlanner{exists: false}
+	if err := doStatus(&bytes.Buffer{}, fp, &statusOpts{outputFormat: "table"}, fakeClusterStatus(true)); err == nil {
+		t.Errorf("expected an error when the plan does not exist")
+	}
+}
@@ -1,8 +1,10 @@
 package cli
 
 import (
+	"context"
 	"io"
 	"os"
+	"time"
 
 	"github.com/apprenda/kismatic/pkg/install"
 	"github.com/apprenda/kismatic/pkg/util"
@@ -10,6 +12,7 @@ import (
 )
 
 type stepCmd struct {
+	ctx      context.Context
 	out      io.Writer
 	planFile string
 	task     string
@@ -21,11 +24,14 @@ type stepCmd struct {
 	restartServices    bool
 	verbose            bool
 	outputFormat       string
+	timeout            time.Duration
+	taskTimeout        time.Duration
 }
 
 // NewCmdStep returns the step command
-func NewCmdStep(out io.Writer, opts *installOpts) *cobra.Command {
+func NewCmdStep(ctx context.Context, out io.Writer, opts *installOpts) *cobra.Command {
 	stepCmd := &stepCmd{
+		ctx:      ctx,
 		out:      out,
 		planFile: opts.planFilename,
 	}
@@ -37,10 +43,13 @@ func NewCmdStep(out io.Writer, opts *installOpts) *cobra.Command {
 				return cmd.Usage()
 			}
 			execOpts := install.ExecutorOptions{
+				Context:                  ctx,
 				GeneratedAssetsDirectory: stepCmd.generatedAssetsDir,
 				RestartServices:          stepCmd.restartServices,
 				OutputFormat:             stepCmd.outputFormat,
 				Verbose:                  stepCmd.verbose,
+				Timeout:                  stepCmd.timeout,
+				TaskTimeout:              stepCmd.taskTimeout,
 			}
 			executor, err := install.NewExecutor(out, os.Stderr, execOpts)
 			if err != nil {
@@ -57,6 +66,7 @@ func NewCmdStep(out io.Writer, opts *installOpts) *cobra.Command {
 	cmd.Flags().BoolVar(&stepCmd.restartServices, "restart-services", false, "force restart cluster services (Use with care)")
 	cmd.Flags().BoolVar(&stepCmd.verbose, "verbose", false, "enable verbose logging from the installation")
 	cmd.Flags().StringVarP(&stepCmd.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	addTimeoutFlags(cmd.Flags(), &stepCmd.timeout, &stepCmd.taskTimeout)
 	return cmd
 }
 
@@ -68,7 +78,7 @@ func (c stepCmd) run() error {
 		skipPreFlight:      true,
 		generatedAssetsDir: c.generatedAssetsDir,
 	}
-	if err := doValidate(c.out, c.planner, valOpts); err != nil {
+	if err := doValidate(c.ctx, c.out, c.planner, valOpts); err != nil {
 		return err
 	}
 	plan, err := c.planner.Read()
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type upgradeOpts struct {
+	planFilename       string
+	generatedAssetsDir string
+	verbose            bool
+	outputFormat       string
+	timeout            time.Duration
+	taskTimeout        time.Duration
+}
+
+// NewCmdUpgrade returns the command for upgrading the cluster
+func NewCmdUpgrade(ctx context.Context, out io.Writer) *cobra.Command {
+	opts := &upgradeOpts{}
+	cmd := &cobra.Command{
+		Use:   "upgrade",
+		Short: "upgrade your Kubernetes cluster to the version of this Kismatic CLI",
+		Long: `Upgrade your Kubernetes cluster to the version of this Kismatic CLI.
+
+Nodes are upgraded one at a time, in the following order: etcd, master, worker, ingress and storage.
+Worker nodes are drained before being upgraded. The upgrade stops on the first node that fails to upgrade.
+Running the upgrade again will resume from the node that failed.
+Nodes running a newer version than this Kismatic CLI can't be downgraded.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doUpgrade(ctx, out, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the upgrade")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", "upgrade output format (options \"simple\"|\"raw\")")
+	addTimeoutFlags(cmd.Flags(), &opts.timeout, &opts.taskTimeout)
+	addPlanFileFlag(cmd.PersistentFlags(), &opts.planFilename)
+	return cmd
+}
+
+func doUpgrade(ctx context.Context, out io.Writer, opts *upgradeOpts) error {
+	planner := &install.FilePlanner{File: opts.planFilename}
+	valOpts := &validateOpts{
+		planFile:           opts.planFilename,
+		verbose:            opts.verbose,
+		outputFormat:       opts.outputFormat,
+		skipPreFlight:      true,
+		generatedAssetsDir: opts.generatedAssetsDir,
+	}
+	if err := doValidate(ctx, out, planner, valOpts); err != nil {
+		return err
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	execOpts := install.ExecutorOptions{
+		Context:                  ctx,
+		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		OutputFormat:             opts.outputFormat,
+		Verbose:                  opts.verbose,
+		Timeout:                  opts.timeout,
+		TaskTimeout:              opts.taskTimeout,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	if err != nil {
+		return err
+	}
+	if err := executor.Upgrade(plan); err != nil {
+		return err
+	}
+	util.PrintColor(out, util.Green, "\nThe cluster was upgraded successfully\n\n")
+	return nil
+}
@@ -1,9 +1,13 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"path/filepath"
+	"time"
 
 	"os"
 
@@ -18,10 +22,16 @@ type validateOpts struct {
 	verbose            bool
 	outputFormat       string
 	skipPreFlight      bool
+	timeout            time.Duration
+	taskTimeout        time.Duration
+	junitReportDir     string
+	expiryWarning      time.Duration
+	// the run directories of the pre-flight checks, once they ran
+	runDirectories []string
 }
 
 // NewCmdValidate creates a new install validate command
-func NewCmdValidate(out io.Writer, installOpts *installOpts) *cobra.Command {
+func NewCmdValidate(ctx context.Context, out io.Writer, installOpts *installOpts) *cobra.Command {
 	opts := &validateOpts{}
 	cmd := &cobra.Command{
 		Use:   "validate",
@@ -32,48 +42,66 @@ func NewCmdValidate(out io.Writer, installOpts *installOpts) *cobra.Command {
 			}
 			planner := &install.FilePlanner{File: installOpts.planFilename}
 			opts.planFile = installOpts.planFilename
-			return doValidate(out, planner, opts)
+			err := doValidate(ctx, out, planner, opts)
+			if opts.outputFormat == jsonOutput {
+				printSummary(out, "install validate", err, opts.runDirectories, nil)
+			}
+			return err
 		},
 	}
 	cmd.Flags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the installation")
-	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", "installation output format (options simple|raw)")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", "installation output format (options simple|raw|json)")
 	cmd.Flags().BoolVar(&opts.skipPreFlight, "skip-preflight", false, "skip pre-flight checks")
+	cmd.Flags().StringVar(&opts.junitReportDir, "junit-report-dir", "", "path to the directory where the JUnit XML report of the pre-flight checks will be written")
+	cmd.Flags().DurationVar(&opts.expiryWarning, "certificate-expiry-warning", 30*24*time.Hour, "warn about certificates that expire within this duration, set to 0 to disable")
+	addTimeoutFlags(cmd.Flags(), &opts.timeout, &opts.taskTimeout)
 	return cmd
 }
 
-func doValidate(out io.Writer, planner install.Planner, opts *validateOpts) error {
+func doValidate(ctx context.Context, out io.Writer, planner install.Planner, opts *validateOpts) error {
+	printer := validationPrinter{out: out, json: opts.outputFormat == jsonOutput}
+	if printer.json {
+		// Only JSON objects are written to the output
+		out = ioutil.Discard
+	}
 	util.PrintHeader(out, "Validating", '=')
 	// Check if plan file exists
 	if !planner.PlanExists() {
-		util.PrettyPrintErr(out, "Reading installation plan file [ERROR]")
+		printer.failed("Reading installation plan file [ERROR]", nil)
 		fmt.Fprintln(out, "Run \"kismatic install plan\" to generate it")
 		return fmt.Errorf("plan does not exist")
 	}
 	plan, err := planner.Read()
 	if err != nil {
-		util.PrettyPrintErr(out, "Reading installation plan file %q", opts.planFile)
+		printer.failed(fmt.Sprintf("Reading installation plan file %q", opts.planFile), []error{err})
 		return fmt.Errorf("error reading plan file: %v", err)
 	}
-	util.PrettyPrintOk(out, "Reading installation plan file %q", opts.planFile)
+	printer.ok(fmt.Sprintf("Reading installation plan file %q", opts.planFile))
 
 	// Validate plan file
 	ok, errs := install.ValidatePlan(plan)
 	if !ok {
-		util.PrettyPrintErr(out, "Validating installation plan file")
-		util.PrintValidationErrors(out, errs)
+		printer.failed("Validating installation plan file", errs)
 		return fmt.Errorf("Plan file validation error prevents installation from proceeding")
 	}
-	util.PrettyPrintOk(out, "Validating installation plan file")
+	printer.ok("Validating installation plan file")
+
+	// Prepare SSH authentication, prompting for the passphrase of an encrypted key if needed
+	mechanisms, err := install.PrepareSSHAuth(plan)
+	if err != nil {
+		printer.failed("Preparing SSH authentication", []error{err})
+		return fmt.Errorf("SSH authentication error prevents installation from proceeding")
+	}
+	printer.ok(fmt.Sprintf("Preparing SSH authentication using %s", mechanisms))
 
 	// Validate SSH connections
 	ok, errs = install.ValidatePlanSSHConnections(plan)
 	if !ok {
-		util.PrettyPrintErr(out, "Validating SSH connectivity to nodes")
-		util.PrintValidationErrors(out, errs)
+		printer.failed("Validating SSH connectivity to nodes", errs)
 		return fmt.Errorf("SSH connectivity validation error prevents installation from proceeding")
 	}
-	util.PrettyPrintOk(out, "Validating SSH connectivity to nodes")
+	printer.ok("Validating SSH connectivity to nodes")
 
 	// get a new pki
 	pki, err := newPKI(out, opts)
@@ -83,29 +111,89 @@ func doValidate(out io.Writer, planner install.Planner, opts *validateOpts) erro
 	// Validate Certificates
 	ok, errs = install.ValidateCertificates(plan, pki)
 	if !ok {
-		util.PrettyPrintErr(out, "Validating cluster certificates")
-		util.PrintValidationErrors(out, errs)
+		printer.failed("Validating cluster certificates", errs)
 		return fmt.Errorf("Cluster certificates validation error prevents installation from proceeding")
 	}
+	if printer.json {
+		printValidationResult(printer.out, "Validating cluster certificates", nil)
+	}
+	// Certificates that expire soon do not prevent the installation
+	if opts.expiryWarning > 0 {
+		if ok, warns := install.ValidateCertificateExpiry(pki.GeneratedCertsDirectory, opts.expiryWarning); !ok {
+			printer.warned("Validating certificate expiry", warns)
+		}
+	}
 
 	if opts.skipPreFlight {
 		return nil
 	}
 	// Run pre-flight
 	options := install.ExecutorOptions{
-		OutputFormat: opts.outputFormat,
-		Verbose:      opts.verbose,
+		Context:              ctx,
+		OutputFormat:         opts.outputFormat,
+		Verbose:              opts.verbose,
+		Timeout:              opts.timeout,
+		TaskTimeout:          opts.taskTimeout,
+		JUnitReportDirectory: opts.junitReportDir,
 	}
-	e, err := install.NewPreFlightExecutor(out, os.Stderr, options)
+	e, err := install.NewPreFlightExecutor(printer.out, os.Stderr, options)
 	if err != nil {
 		return err
 	}
+	defer func() { opts.runDirectories = e.RunDirectories() }()
 	if err = e.RunPreFlightCheck(plan); err != nil {
 		return err
 	}
 	return nil
 }
 
+// validationPrinter prints the result of the validation checks,
+// either as text or as JSON objects
+type validationPrinter struct {
+	out  io.Writer
+	json bool
+}
+
+func (p validationPrinter) ok(check string) {
+	if p.json {
+		printValidationResult(p.out, check, nil)
+		return
+	}
+	util.PrettyPrintOk(p.out, "%s", check)
+}
+
+func (p validationPrinter) failed(check string, errs []error) {
+	if p.json {
+		if errs == nil {
+			errs = []error{errors.New("check failed")}
+		}
+		printValidationResult(p.out, check, errs)
+		return
+	}
+	util.PrettyPrintErr(p.out, "%s", check)
+	if errs != nil {
+		util.PrintValidationErrors(p.out, errs)
+	}
+}
+
+func (p validationPrinter) warned(check string, warns []error) {
+	if p.json {
+		printValidationWarning(p.out, check, warns)
+		return
+	}
+	util.PrettyPrintWarn(p.out, "%s", check)
+	util.PrintValidationErrors(p.out, warns)
+}
+
+// errors prints the validation errors of a check that failed
+func (p validationPrinter) errors(check string, errs []error) {
+	if p.json {
+		printValidationResult(p.out, check, errs)
+		return
+	}
+	util.PrintValidationErrors(p.out, errs)
+}
+
 // TODO this should really not be here
 func newPKI(stdout io.Writer, options *validateOpts) (*install.LocalPKI, error) {
 	ansibleDir := "ansible"
@@ -2,6 +2,9 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/apprenda/kismatic/pkg/install"
@@ -17,7 +20,7 @@ func TestValidateCmdPlanNotFound(t *testing.T) {
 		verbose:      false,
 		outputFormat: "table",
 	}
-	err := doValidate(out, fp, opts)
+	err := doValidate(context.Background(), out, fp, opts)
 	if err == nil {
 		t.Errorf("validate did not return an error when the plan does not exist")
 	}
@@ -38,7 +41,7 @@ func TestValidateCmdPlanInvalid(t *testing.T) {
 		verbose:      false,
 		outputFormat: "table",
 	}
-	err := doValidate(out, fp, opts)
+	err := doValidate(context.Background(), out, fp, opts)
 	if err == nil {
 		t.Errorf("did not return an error with an invalid plan")
 	}
@@ -47,3 +50,36 @@ func TestValidateCmdPlanInvalid(t *testing.T) {
 		t.Errorf("did not read the plan file")
 	}
 }
+
+func TestValidateCmdPlanInvalidJSONOutput(t *testing.T) {
+	out := &bytes.Buffer{}
+	fp := &fakePlanner{
+		exists: true,
+		plan:   &install.Plan{},
+	}
+	opts := &validateOpts{
+		planFile:     "planFile",
+		outputFormat: jsonOutput,
+	}
+	if err := doValidate(context.Background(), out, fp, opts); err == nil {
+		t.Errorf("did not return an error with an invalid plan")
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 JSON objects, but got %d:\n%s", len(lines), out.String())
+	}
+	results := []validationResult{}
+	for _, l := range lines {
+		r := validationResult{}
+		if err := json.Unmarshal([]byte(l), &r); err != nil {
+			t.Fatalf("output is not JSON: %v", err)
+		}
+		results = append(results, r)
+	}
+	if !results[0].Valid {
+		t.Errorf("expected reading the plan file to be valid, but got %+v", results[0])
+	}
+	if results[1].Valid || len(results[1].Errors) == 0 {
+		t.Errorf("expected plan validation to fail with errors, but got %+v", results[1])
+	}
+}
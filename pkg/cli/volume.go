@@ -1,18 +1,20 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"strconv"
+	"time"
 
 	"github.com/apprenda/kismatic/pkg/install"
 	"github.com/spf13/cobra"
 )
 
 // NewCmdVolume returns the storage command
-func NewCmdVolume(out io.Writer) *cobra.Command {
+func NewCmdVolume(ctx context.Context, out io.Writer) *cobra.Command {
 	var planFile string
 	cmd := &cobra.Command{
 		Use:   "volume",
@@ -22,7 +24,7 @@ func NewCmdVolume(out io.Writer) *cobra.Command {
 		},
 	}
 	addPlanFileFlag(cmd.PersistentFlags(), &planFile)
-	cmd.AddCommand(NewCmdVolumeAdd(out, &planFile))
+	cmd.AddCommand(NewCmdVolumeAdd(ctx, out, &planFile))
 	return cmd
 }
 
@@ -33,10 +35,12 @@ type volumeAddOptions struct {
 	verbose            bool
 	outputFormat       string
 	generatedAssetsDir string
+	timeout            time.Duration
+	taskTimeout        time.Duration
 }
 
 // NewCmdVolumeAdd returns the command for adding storage volumes
-func NewCmdVolumeAdd(out io.Writer, planFile *string) *cobra.Command {
+func NewCmdVolumeAdd(ctx context.Context, out io.Writer, planFile *string) *cobra.Command {
 	opts := volumeAddOptions{}
 	cmd := &cobra.Command{
 		Use:   "add size_in_gigabytes [volume name]",
@@ -45,7 +49,7 @@ func NewCmdVolumeAdd(out io.Writer, planFile *string) *cobra.Command {
 
 This function requires a target cluster that has storage nodes.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return doVolumeAdd(out, opts, *planFile, args)
+			return doVolumeAdd(ctx, out, opts, *planFile, args)
 		},
 		Example: `  Create a distributed, replicated volume,
   named "storage01" with a 10 GB quota,
@@ -59,10 +63,11 @@ This function requires a target cluster that has storage nodes.`,
 	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging")
 	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", `output format (options "simple"|"raw")`)
 	cmd.Flags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	addTimeoutFlags(cmd.Flags(), &opts.timeout, &opts.taskTimeout)
 	return cmd
 }
 
-func doVolumeAdd(out io.Writer, opts volumeAddOptions, planFile string, args []string) error {
+func doVolumeAdd(ctx context.Context, out io.Writer, opts volumeAddOptions, planFile string, args []string) error {
 	var volumeName string
 	var volumeSizeStrGB string
 	switch len(args) {
@@ -87,8 +92,11 @@ func doVolumeAdd(out io.Writer, opts volumeAddOptions, planFile string, args []s
 		return fmt.Errorf("Plan file not found at %q", planFile)
 	}
 	execOpts := install.ExecutorOptions{
+		Context:      ctx,
 		OutputFormat: opts.outputFormat,
 		Verbose:      opts.verbose,
+		Timeout:      opts.timeout,
+		TaskTimeout:  opts.taskTimeout,
 		// Need to refactor executor code... this will do for now as we don't need the generated assets dir in this command
 		GeneratedAssetsDirectory: opts.generatedAssetsDir,
 	}
@@ -109,7 +117,7 @@ func doVolumeAdd(out io.Writer, opts volumeAddOptions, planFile string, args []s
 		skipPreFlight:      true,
 		generatedAssetsDir: opts.generatedAssetsDir,
 	}
-	if err := doValidate(out, planner, vopts); err != nil {
+	if err := doValidate(ctx, out, planner, vopts); err != nil {
 		return err
 	}
 
@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -21,6 +22,9 @@ type TCPPortClientCheck struct {
 	// Timeout is the maximum amount of time the check will
 	// wait when connecting to the server before bailing out
 	Timeout time.Duration
+	// Dial opens the connection to the remote node, e.g. through a bastion.
+	// The connection is opened directly if nil.
+	Dial func(network, address string) (net.Conn, error)
 }
 
 // Check returns true if the TCP connection is established and the server
@@ -30,7 +34,14 @@ func (c *TCPPortClientCheck) Check() (bool, error) {
 	if timeout == 0 {
 		timeout = 5 * time.Second
 	}
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", c.IPAddress, c.PortNumber), timeout)
+	address := net.JoinHostPort(c.IPAddress, strconv.Itoa(c.PortNumber))
+	var conn net.Conn
+	var err error
+	if c.Dial != nil {
+		conn, err = dialTimeout(c.Dial, address, timeout)
+	} else {
+		conn, err = net.DialTimeout("tcp", address, timeout)
+	}
 	if err != nil {
 		return false, fmt.Errorf("Port %d on host %q is unreachable. Error was: %v", c.PortNumber, c.IPAddress, err)
 	}
@@ -50,6 +61,32 @@ func (c *TCPPortClientCheck) Check() (bool, error) {
 	return true, nil
 }
 
+// dialTimeout opens the connection using dial, and gives up once the timeout
+// has elapsed, as dial has no deadline of its own
+func dialTimeout(dial func(network, address string) (net.Conn, error), address string, timeout time.Duration) (net.Conn, error) {
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan dialResult, 1)
+	go func() {
+		conn, err := dial("tcp", address)
+		done <- dialResult{conn, err}
+	}()
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-time.After(timeout):
+		// close the connection if it is opened after giving up
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("timed out connecting to %s after %v", address, timeout)
+	}
+}
+
 // TCPPortServerCheck ensures that the given port is free, and stands up a TCP server that can be used to
 // check TCP connectivity to the host using TCPPortClientCheck
 type TCPPortServerCheck struct {
@@ -0,0 +1,37 @@
+package check
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTCPPortClientCheckDialTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	c := TCPPortClientCheck{
+		IPAddress:  "10.0.0.1",
+		PortNumber: 6443,
+		Timeout:    10 * time.Millisecond,
+		// Never connects, like a bastion that can't reach the node
+		Dial: func(network, address string) (net.Conn, error) {
+			<-unblock
+			return nil, nil
+		},
+	}
+	done := make(chan struct{})
+	var ok bool
+	var err error
+	go func() {
+		ok, err = c.Check()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("check did not time out")
+	}
+	if ok || err == nil {
+		t.Errorf("expected the check to fail with an error, but got ok=%v and error %v", ok, err)
+	}
+}
@@ -17,10 +17,13 @@ type Client struct {
 	// TargetNodeRole is the role of the node we are inspecting
 	TargetNodeFacts []string
 	engine          *rule.Engine
+	httpClient      *http.Client
 }
 
 // NewClient returns an inspector client for running checks against remote nodes.
-func NewClient(targetNode string, targetNodeFacts []string) (*Client, error) {
+// The connections to the remote node are opened with dial, e.g. through a bastion,
+// or directly if dial is nil.
+func NewClient(targetNode string, targetNodeFacts []string, dial func(network, addr string) (net.Conn, error)) (*Client, error) {
 	host, _, err := net.SplitHostPort(targetNode)
 	if err != nil {
 		return nil, err
@@ -29,12 +32,18 @@ func NewClient(targetNode string, targetNodeFacts []string) (*Client, error) {
 		RuleCheckMapper: rule.DefaultCheckMapper{
 			PackageManager: nil, // Use a no-op pkg manager here instead
 			TargetNodeIP:   host,
+			Dial:           dial,
 		},
 	}
+	httpClient := http.DefaultClient
+	if dial != nil {
+		httpClient = &http.Client{Transport: &http.Transport{Dial: dial}}
+	}
 	return &Client{
 		TargetNode:      targetNode,
 		TargetNodeFacts: targetNodeFacts,
 		engine:          engine,
+		httpClient:      httpClient,
 	}, nil
 }
 
@@ -45,7 +54,7 @@ func (c Client) ExecuteRules(rules []rule.Rule) ([]rule.Result, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling check request: %v", err)
 	}
-	resp, err := http.Post(fmt.Sprintf("http://%s%s", c.TargetNode, executeEndpoint), "application/json", bytes.NewReader(d))
+	resp, err := c.httpClient.Post(fmt.Sprintf("http://%s%s", c.TargetNode, executeEndpoint), "application/json", bytes.NewReader(d))
 	if err != nil {
 		return nil, fmt.Errorf("error posting request to server: %v", err)
 	}
@@ -78,7 +87,7 @@ func (c Client) ExecuteRules(rules []rule.Rule) ([]rule.Result, error) {
 	results = append(results, remoteResults...)
 
 	endpoint := fmt.Sprintf("http://%s%s", c.TargetNode, closeEndpoint)
-	resp, err = http.Get(endpoint)
+	resp, err = c.httpClient.Get(endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("GET request to %q failed. You might have to restart the inspector server. Error was: %v", endpoint, err)
 	}
@@ -4,16 +4,22 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"strconv"
 
 	"github.com/apprenda/kismatic/pkg/inspector"
+	"github.com/apprenda/kismatic/pkg/ssh"
 	"github.com/spf13/cobra"
 )
 
 type clientOpts struct {
-	outputType string
-	nodeRoles  string
-	rulesFile  string
-	targetNode string
+	outputType  string
+	nodeRoles   string
+	rulesFile   string
+	targetNode  string
+	bastion     string
+	bastionUser string
+	bastionKey  string
 }
 
 var clientExample = `# Run the inspector against an etcd node
@@ -23,7 +29,10 @@ kismatic-inspector client 10.0.1.24:9090 --node-roles etcd
 kismatic-inspector client 10.0.1.24:9090 --node-roles etcd -o json
 
 # Run the inspector against a remote node using a custom rules file
-kismatic-inspector client 10.0.1.24:9090 -f inspector-rules.yaml --node-roles etcd`
+kismatic-inspector client 10.0.1.24:9090 -f inspector-rules.yaml --node-roles etcd
+
+# Run the inspector against a remote node that is reachable through a bastion
+kismatic-inspector client 10.0.1.24:9090 --node-roles etcd --ssh-bastion 52.1.2.3:22 --ssh-bastion-user ubuntu --ssh-bastion-key /home/ubuntu/.ssh/id_rsa`
 
 // NewCmdClient returns the "client" command
 func NewCmdClient(out io.Writer) *cobra.Command {
@@ -44,6 +53,9 @@ func NewCmdClient(out io.Writer) *cobra.Command {
 	cmd.Flags().StringVarP(&opts.outputType, "output", "o", "table", "set the result output type. Options are 'json', 'table'")
 	cmd.Flags().StringVar(&opts.nodeRoles, "node-roles", "", "comma-separated list of the node's roles. Valid roles are 'etcd', 'master', 'worker'")
 	cmd.Flags().StringVarP(&opts.rulesFile, "file", "f", "", "the path to an inspector rules file. If blank, the inspector uses the default rules")
+	cmd.Flags().StringVar(&opts.bastion, "ssh-bastion", "", "the HOST:PORT of an SSH bastion through which the remote node is reached. If blank, the node is reached directly")
+	cmd.Flags().StringVar(&opts.bastionUser, "ssh-bastion-user", "", "the user for logging into the SSH bastion")
+	cmd.Flags().StringVar(&opts.bastionKey, "ssh-bastion-key", "", "the path to the private key for logging into the SSH bastion")
 	return cmd
 }
 
@@ -58,7 +70,16 @@ func runClient(out io.Writer, opts clientOpts) error {
 	if err != nil {
 		return err
 	}
-	c, err := inspector.NewClient(opts.targetNode, roles)
+	var dial func(network, addr string) (net.Conn, error)
+	if opts.bastion != "" {
+		d, err := bastionDialer(opts)
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+		dial = d.Dial
+	}
+	c, err := inspector.NewClient(opts.targetNode, roles, dial)
 	if err != nil {
 		return fmt.Errorf("error creating inspector client: %v", err)
 	}
@@ -81,3 +102,19 @@ func runClient(out io.Writer, opts clientOpts) error {
 	}
 	return nil
 }
+
+func bastionDialer(opts clientOpts) (*ssh.Dialer, error) {
+	host, portStr, err := net.SplitHostPort(opts.bastion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH bastion %q: %v", opts.bastion, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH bastion port %q", portStr)
+	}
+	if opts.bastionUser == "" || opts.bastionKey == "" {
+		return nil, errors.New("--ssh-bastion-user and --ssh-bastion-key are required when using an SSH bastion")
+	}
+	b := ssh.Bastion{Address: host, Port: port, User: opts.bastionUser, Key: opts.bastionKey}
+	return ssh.NewDialer(b)
+}
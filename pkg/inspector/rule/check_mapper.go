@@ -2,6 +2,7 @@ package rule
 
 import (
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/apprenda/kismatic/pkg/inspector/check"
@@ -19,6 +20,9 @@ type DefaultCheckMapper struct {
 	PackageManager check.PackageManager
 	// IP of the remote node that is being inspected when in client mode
 	TargetNodeIP string
+	// Dial opens connections to the remote node when in client mode.
+	// The connections are opened directly if nil.
+	Dial func(network, address string) (net.Conn, error)
 }
 
 // GetCheckForRule returns the check for the given rule. If the rule
@@ -42,7 +46,7 @@ func (m DefaultCheckMapper) GetCheckForRule(rule Rule) (check.Check, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid value %q provided for the timeout field of the TCPPortAccessible rule: %v", r.Timeout, err)
 		}
-		c = &check.TCPPortClientCheck{PortNumber: r.Port, IPAddress: m.TargetNodeIP, Timeout: timeout}
+		c = &check.TCPPortClientCheck{PortNumber: r.Port, IPAddress: m.TargetNodeIP, Timeout: timeout, Dial: m.Dial}
 	case Python2Version:
 		c = &check.Python2Check{SupportedVersions: r.SupportedVersions}
 	}
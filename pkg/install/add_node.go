@@ -0,0 +1,148 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/install/explain"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// The roles a node can be added to
+const (
+	etcdRole    = "etcd"
+	masterRole  = "master"
+	workerRole  = "worker"
+	ingressRole = "ingress"
+	storageRole = "storage"
+)
+
+// AddNodeRoles are the roles that can be given to a node added to an existing cluster
+var AddNodeRoles = []string{etcdRole, masterRole, workerRole, ingressRole, storageRole}
+
+// AddNode adds a node with the given role to the original cluster described
+// in the plan. If successful, the updated plan is returned.
+func (ae *ansibleExecutor) AddNode(originalPlan *Plan, newNode Node, role string) (*Plan, error) {
+	if role == workerRole {
+		return ae.AddWorker(originalPlan, newNode)
+	}
+	if !util.Subset([]string{role}, AddNodeRoles) {
+		return nil, fmt.Errorf("cannot add node with role %q, valid roles are %v", role, AddNodeRoles)
+	}
+	pki, err := ae.planPKI(originalPlan)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkAddWorkerPrereqs(pki, newNode); err != nil {
+		return nil, err
+	}
+	runDirectory, err := ae.createRunDirectory("add-node")
+	if err != nil {
+		return nil, fmt.Errorf("error creating working directory for add-node: %v", err)
+	}
+	updatedPlan := addNodeToPlan(*originalPlan, newNode, role)
+	fp := FilePlanner{
+		File: filepath.Join(runDirectory, "kismatic-cluster.yaml"),
+	}
+	if err = fp.Write(&updatedPlan); err != nil {
+		return nil, fmt.Errorf("error recording plan file to %s: %v", fp.File, err)
+	}
+	// Generate node certificates. The updated plan is used so that
+	// a new master gets the SANs of the load balanced master endpoint.
+	util.PrintHeader(ae.stdout, "Generating Certificate For New Node", '=')
+	ca, err := pki.GetClusterCA()
+	if err != nil {
+		return nil, err
+	}
+	if err := pki.GenerateNodeCertificate(&updatedPlan, newNode, ca); err != nil {
+		return nil, fmt.Errorf("error generating certificate for new node: %v", err)
+	}
+	// Build the ansible inventory
+	inventory := buildInventoryFromPlan(&updatedPlan)
+	cc, err := ae.buildInstallExtraVars(&updatedPlan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	ansibleLogFilename := filepath.Join(runDirectory, "ansible.log")
+	ansibleLogFile, err := os.Create(ansibleLogFilename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ansible log file %q: %v", ansibleLogFilename, err)
+	}
+	// Run the playbook for adding the node
+	util.PrintHeader(ae.stdout, fmt.Sprintf("Adding %s Node to Cluster", strings.Title(role)), '=')
+	playbook := "kubernetes-node.yaml"
+	if role == etcdRole {
+		playbook = "add-etcd-node.yaml"
+	}
+	eventExplainer := &explain.DefaultEventExplainer{}
+	runner, explainer, err := ae.getAnsibleRunnerAndExplainer(eventExplainer, ansibleLogFile, runDirectory)
+	if err != nil {
+		return nil, err
+	}
+	eventStream, err := runner.StartPlaybookOnNode(ae.runContext(), playbook, inventory, *cc, newNode.Host)
+	if err != nil {
+		return nil, fmt.Errorf("error running ansible playbook: %v", err)
+	}
+	go explainer.Explain(eventStream)
+	// Wait until ansible exits
+	if err = runner.WaitPlaybook(); err != nil {
+		return nil, fmt.Errorf("error running playbook: %v", err)
+	}
+
+	// The rest of the cluster needs to learn about the new node
+	type clusterPlaybook struct {
+		header   string
+		playbook string
+	}
+	clusterPlaybooks := []clusterPlaybook{}
+	if updatedPlan.Cluster.Networking.UpdateHostsFiles {
+		clusterPlaybooks = append(clusterPlaybooks, clusterPlaybook{"Updating Hosts Files On All Nodes", "_hosts.yaml"})
+	}
+	switch role {
+	case etcdRole:
+		// The API servers and calico are configured with the etcd endpoints
+		clusterPlaybooks = append(clusterPlaybooks, clusterPlaybook{"Updating API Server On All Masters", "_apiserver-rolling.yaml"})
+		clusterPlaybooks = append(clusterPlaybooks, clusterPlaybook{"Updating Calico On All Nodes", "_calico-etcd-endpoints.yaml"})
+	case masterRole:
+		// The API servers are configured with the number of masters
+		clusterPlaybooks = append(clusterPlaybooks, clusterPlaybook{"Updating API Server On All Masters", "_apiserver-rolling.yaml"})
+	case ingressRole:
+		clusterPlaybooks = append(clusterPlaybooks, clusterPlaybook{"Configuring Ingress On All Ingress Nodes", "_addon-kubernetes-ingress.yaml"})
+	case storageRole:
+		clusterPlaybooks = append(clusterPlaybooks, clusterPlaybook{"Adding New Node To Storage Cluster", "_storage.yaml"})
+	}
+	for _, cp := range clusterPlaybooks {
+		util.PrintHeader(ae.stdout, cp.header, '=')
+		eventExplainer := &explain.DefaultEventExplainer{}
+		if err := ae.runPlaybookWithExplainer(cp.playbook, eventExplainer, inventory, *cc, ansibleLogFile, runDirectory); err != nil {
+			return nil, fmt.Errorf("error running playbook %q: %v", cp.playbook, err)
+		}
+	}
+
+	if role == masterRole {
+		util.PrettyPrintWarn(ae.stdout, "Add the new master %q to the load balancer serving %q", newNode.Host, updatedPlan.Master.LoadBalancedFQDN)
+	}
+	return &updatedPlan, nil
+}
+
+func addNodeToPlan(plan Plan, node Node, role string) Plan {
+	switch role {
+	case etcdRole:
+		plan.Etcd.ExpectedCount++
+		plan.Etcd.Nodes = append(plan.Etcd.Nodes, node)
+	case masterRole:
+		plan.Master.ExpectedCount++
+		plan.Master.Nodes = append(plan.Master.Nodes, node)
+	case workerRole:
+		return addWorkerToPlan(plan, node)
+	case ingressRole:
+		plan.Ingress.ExpectedCount++
+		plan.Ingress.Nodes = append(plan.Ingress.Nodes, node)
+	case storageRole:
+		plan.Storage.ExpectedCount++
+		plan.Storage.Nodes = append(plan.Storage.Nodes, node)
+	}
+	return plan
+}
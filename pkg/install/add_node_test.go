@@ -0,0 +1,141 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestAddNodeToPlan(t *testing.T) {
+	newNode := Node{Host: "new"}
+	tests := []struct {
+		role  string
+		group func(Plan) ([]Node, int)
+	}{
+		{"etcd", func(p Plan) ([]Node, int) { return p.Etcd.Nodes, p.Etcd.ExpectedCount }},
+		{"master", func(p Plan) ([]Node, int) { return p.Master.Nodes, p.Master.ExpectedCount }},
+		{"worker", func(p Plan) ([]Node, int) { return p.Worker.Nodes, p.Worker.ExpectedCount }},
+		{"ingress", func(p Plan) ([]Node, int) { return p.Ingress.Nodes, p.Ingress.ExpectedCount }},
+		{"storage", func(p Plan) ([]Node, int) { return p.Storage.Nodes, p.Storage.ExpectedCount }},
+	}
+	for _, test := range tests {
+		original := testPlan()
+		originalNodes, originalCount := test.group(*original)
+		updated := addNodeToPlan(*original, newNode, test.role)
+		nodes, count := test.group(updated)
+		if count != originalCount+1 {
+			t.Errorf("%s: expected count to be %d, but got %d", test.role, originalCount+1, count)
+		}
+		if len(nodes) != len(originalNodes)+1 || nodes[len(nodes)-1] != newNode {
+			t.Errorf("%s: expected new node to be added to the group, but got %v", test.role, nodes)
+		}
+	}
+}
+
+func TestAddNodeClusterPlaybooks(t *testing.T) {
+	tests := []struct {
+		role             string
+		updateHostsFiles bool
+		nodePlaybook     string
+		clusterPlaybooks []string
+	}{
+		{
+			role:             "etcd",
+			nodePlaybook:     "add-etcd-node.yaml",
+			clusterPlaybooks: []string{"_apiserver-rolling.yaml", "_calico-etcd-endpoints.yaml"},
+		},
+		{
+			role:             "master",
+			updateHostsFiles: true,
+			nodePlaybook:     "kubernetes-node.yaml",
+			clusterPlaybooks: []string{"_hosts.yaml", "_apiserver-rolling.yaml"},
+		},
+		{
+			role:             "ingress",
+			nodePlaybook:     "kubernetes-node.yaml",
+			clusterPlaybooks: []string{"_addon-kubernetes-ingress.yaml"},
+		},
+		{
+			role:             "storage",
+			nodePlaybook:     "kubernetes-node.yaml",
+			clusterPlaybooks: []string{"_storage.yaml"},
+		},
+	}
+	for _, test := range tests {
+		runner := &fakeRunner{}
+		pki := &fakePKI{caExists: true}
+		e := ansibleExecutor{
+			certsDir:               mustGetTempDir(t),
+			options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+			stdout:                 ioutil.Discard,
+			consoleOutputFormat:    ansible.RawFormat,
+			pki:                    pki,
+			runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+		}
+		p := testPlan()
+		p.Cluster.Networking.UpdateHostsFiles = test.updateHostsFiles
+		updated, err := e.AddNode(p, Node{Host: "new"}, test.role)
+		if err != nil {
+			t.Errorf("%s: unexpected error adding node: %v", test.role, err)
+			continue
+		}
+		if updated == nil {
+			t.Errorf("%s: expected an updated plan, but got nil", test.role)
+		}
+		if !pki.generateNodeCertCalled {
+			t.Errorf("%s: expected certificate to be generated for the new node", test.role)
+		}
+		if !reflect.DeepEqual(runner.nodes, []string{"new"}) {
+			t.Errorf("%s: expected node playbook to run on the new node only, but ran on %v", test.role, runner.nodes)
+		}
+		if !reflect.DeepEqual(runner.nodePlaybooks, []string{test.nodePlaybook}) {
+			t.Errorf("%s: expected playbook %q to run on the new node, but got %v", test.role, test.nodePlaybook, runner.nodePlaybooks)
+		}
+		if !reflect.DeepEqual(runner.allNodesPlaybooks, test.clusterPlaybooks) {
+			t.Errorf("%s: expected playbooks %v to run on the cluster, but got %v", test.role, test.clusterPlaybooks, runner.allNodesPlaybooks)
+		}
+	}
+}
+
+func TestAddNodeInvalidRole(t *testing.T) {
+	e := ansibleExecutor{
+		options:             ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:              ioutil.Discard,
+		consoleOutputFormat: ansible.RawFormat,
+		pki:                 &fakePKI{caExists: true},
+		certsDir:            mustGetTempDir(t),
+	}
+	if _, err := e.AddNode(testPlan(), Node{Host: "new"}, "foo"); err == nil {
+		t.Error("expected an error adding a node with an invalid role, but didn't get one")
+	}
+}
+
+func TestAddNodeCAMissing(t *testing.T) {
+	e := ansibleExecutor{
+		options:             ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:              ioutil.Discard,
+		consoleOutputFormat: ansible.RawFormat,
+		pki:                 &fakePKI{},
+		certsDir:            mustGetTempDir(t),
+	}
+	if _, err := e.AddNode(testPlan(), Node{Host: "new"}, "master"); err != errMissingClusterCA {
+		t.Errorf("expected error %v, but got %v", errMissingClusterCA, err)
+	}
+}
+
+func TestAddNodePlaybookFailure(t *testing.T) {
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		pki:                    &fakePKI{caExists: true},
+		certsDir:               mustGetTempDir(t),
+		runnerExplainerFactory: fakeRunnerExplainer(errors.New("exec error")),
+	}
+	if _, err := e.AddNode(testPlan(), Node{Host: "new"}, "etcd"); err == nil {
+		t.Error("expected an error, but didn't get one")
+	}
+}
@@ -16,7 +16,11 @@ var errMissingClusterCA = errors.New("The Certificate Authority's private key an
 // AddWorker adds a worker node to the original cluster described in the plan.
 // If successful, the updated plan is returned.
 func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan, error) {
-	if err := checkAddWorkerPrereqs(ae.pki, newWorker); err != nil {
+	pki, err := ae.planPKI(originalPlan)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkAddWorkerPrereqs(pki, newWorker); err != nil {
 		return nil, err
 	}
 	runDirectory, err := ae.createRunDirectory("add-worker")
@@ -32,11 +36,11 @@ func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan,
 	}
 	// Generate node certificates
 	util.PrintHeader(ae.stdout, "Generating Certificate For Worker Node", '=')
-	ca, err := ae.pki.GetClusterCA()
+	ca, err := pki.GetClusterCA()
 	if err != nil {
 		return nil, err
 	}
-	if err := ae.pki.GenerateNodeCertificate(originalPlan, newWorker, ca); err != nil {
+	if err := pki.GenerateNodeCertificate(originalPlan, newWorker, ca); err != nil {
 		return nil, fmt.Errorf("error generating certificate for new worker: %v", err)
 	}
 	// Build the ansible inventory
@@ -58,7 +62,7 @@ func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan,
 	if err != nil {
 		return nil, err
 	}
-	eventStream, err := runner.StartPlaybookOnNode(playbook, inventory, *cc, newWorker.Host)
+	eventStream, err := runner.StartPlaybookOnNode(ae.runContext(), playbook, inventory, *cc, newWorker.Host)
 	if err != nil {
 		return nil, fmt.Errorf("error running ansible playbook: %v", err)
 	}
@@ -76,7 +80,7 @@ func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan,
 		if err != nil {
 			return nil, err
 		}
-		eventStream, err := runner.StartPlaybook(playbook, inventory, *cc)
+		eventStream, err := runner.StartPlaybook(ae.runContext(), playbook, inventory, *cc)
 		if err != nil {
 			return nil, fmt.Errorf("error running playbook to update hosts files on all nodes: %v", err)
 		}
@@ -96,7 +100,7 @@ func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan,
 	if err != nil {
 		return nil, err
 	}
-	eventStream, err = runner.StartPlaybook(playbook, inventory, *cc)
+	eventStream, err = runner.StartPlaybook(ae.runContext(), playbook, inventory, *cc)
 	if err != nil {
 		return nil, fmt.Errorf("error running new worker smoke test: %v", err)
 	}
@@ -114,7 +118,7 @@ func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan,
 		if err != nil {
 			return nil, err
 		}
-		eventStream, err = runner.StartPlaybook(playbook, inventory, *cc)
+		eventStream, err = runner.StartPlaybook(ae.runContext(), playbook, inventory, *cc)
 		if err != nil {
 			return nil, fmt.Errorf("error adding new worker to volume allow list: %v", err)
 		}
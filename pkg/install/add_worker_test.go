@@ -1,10 +1,14 @@
 package install
 
 import (
+	"context"
+	"crypto/x509"
 	"errors"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/apprenda/kismatic/pkg/ansible"
 	"github.com/apprenda/kismatic/pkg/install/explain"
@@ -288,6 +292,10 @@ type fakePKI struct {
 	err                    error
 	generateCACalled       bool
 	generateNodeCertCalled bool
+	removeNodeCertCalled   bool
+	rotatedCerts           []string
+	issuedUsers            []string
+	issuedGroups           [][]string
 }
 
 func (f *fakePKI) CertificateAuthorityExists() (bool, error)     { return f.caExists, f.err }
@@ -296,27 +304,63 @@ func (f *fakePKI) GenerateNodeCertificate(plan *Plan, node Node, ca *tls.CA) err
 	f.generateNodeCertCalled = true
 	return f.err
 }
+func (f *fakePKI) RemoveNodeCertificate(node Node) error {
+	f.removeNodeCertCalled = true
+	return f.err
+}
 func (f *fakePKI) GetClusterCA() (*tls.CA, error) { return nil, f.err }
 func (f *fakePKI) GenerateClusterCA(p *Plan) (*tls.CA, error) {
 	f.generateCACalled = true
 	return nil, f.err
 }
 func (f *fakePKI) GenerateClusterCertificates(p *Plan, ca *tls.CA, users []string) error { return f.err }
+func (f *fakePKI) RotateNodeCertificate(plan *Plan, node Node, ca *tls.CA) error {
+	f.rotatedCerts = append(f.rotatedCerts, node.Host)
+	return f.err
+}
+func (f *fakePKI) RotateUserCertificate(plan *Plan, user string, ca *tls.CA) error {
+	f.rotatedCerts = append(f.rotatedCerts, user)
+	return f.err
+}
+func (f *fakePKI) RotateServiceAccountCertificate(plan *Plan, ca *tls.CA) error {
+	f.rotatedCerts = append(f.rotatedCerts, "service-account")
+	return f.err
+}
+func (f *fakePKI) IssueUserCertificate(plan *Plan, user string, groups []string, ca *tls.CA, dir string) (*x509.Certificate, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.issuedUsers = append(f.issuedUsers, user)
+	f.issuedGroups = append(f.issuedGroups, groups)
+	if err := tls.WriteCert([]byte("key"), []byte("cert"), user, dir); err != nil {
+		return nil, err
+	}
+	return &x509.Certificate{SerialNumber: big.NewInt(int64(len(f.issuedUsers))), NotAfter: time.Now().Add(time.Hour)}, nil
+}
 
 type fakeRunner struct {
 	eventChan         chan ansible.Event
 	err               error
 	incomingCatalog   ansible.ClusterCatalog
 	allNodesPlaybooks []string
+	nodes             []string
+	nodePlaybooks     []string
+	// called when a playbook is started on all nodes
+	onStartPlaybook func(playbookFile string, cc ansible.ClusterCatalog)
 }
 
-func (f *fakeRunner) StartPlaybook(playbookFile string, inventory ansible.Inventory, cc ansible.ClusterCatalog) (<-chan ansible.Event, error) {
+func (f *fakeRunner) StartPlaybook(ctx context.Context, playbookFile string, inventory ansible.Inventory, cc ansible.ClusterCatalog) (<-chan ansible.Event, error) {
 	f.allNodesPlaybooks = append(f.allNodesPlaybooks, playbookFile)
+	if f.onStartPlaybook != nil {
+		f.onStartPlaybook(playbookFile, cc)
+	}
 	return f.eventChan, f.err
 }
 func (f *fakeRunner) WaitPlaybook() error { return f.err }
-func (f *fakeRunner) StartPlaybookOnNode(playbookFile string, inventory ansible.Inventory, cc ansible.ClusterCatalog, node string) (<-chan ansible.Event, error) {
+func (f *fakeRunner) StartPlaybookOnNode(ctx context.Context, playbookFile string, inventory ansible.Inventory, cc ansible.ClusterCatalog, node string) (<-chan ansible.Event, error) {
 	f.incomingCatalog = cc
+	f.nodes = append(f.nodes, node)
+	f.nodePlaybooks = append(f.nodePlaybooks, playbookFile)
 	return f.eventChan, f.err
 }
 
@@ -325,3 +369,9 @@ func fakeRunnerExplainer(execError error) func(explain.AnsibleEventExplainer, io
 		return &fakeRunner{err: execError}, &explain.AnsibleEventStreamExplainer{}, nil
 	}
 }
+
+func fakeRunnerExplainerWithRunner(runner *fakeRunner) func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
+	return func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
+		return runner, &explain.AnsibleEventStreamExplainer{}, nil
+	}
+}
@@ -0,0 +1,215 @@
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install/explain"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+const (
+	backupTimeFormat = "2006-01-02-15-04-05"
+	backupPlanFile   = "kismatic-cluster.yaml"
+	// archives downloaded from the first etcd node, as named in the etcd group_vars
+	etcdK8sBackupArchive        = "etcd_k8s-backup.tar.gz"
+	etcdNetworkingBackupArchive = "etcd_networking-backup.tar.gz"
+	caCertFile                  = "ca.pem"
+	caKeyFile                   = "ca-key.pem"
+)
+
+// Backup is a snapshot of the Kubernetes and networking etcd clusters,
+// along with the plan and Certificate Authority of the cluster
+type Backup struct {
+	Name      string
+	Directory string
+	CreatedAt time.Time
+}
+
+// Plan returns the plan of the cluster at the time of the backup
+func (b Backup) Plan() (*Plan, error) {
+	fp := FilePlanner{File: filepath.Join(b.Directory, backupPlanFile)}
+	return fp.Read()
+}
+
+// ReadBackup returns the backup with the given name. An error is returned
+// if the backup does not exist or is incomplete.
+func ReadBackup(backupsDir, name string) (*Backup, error) {
+	dir := filepath.Join(backupsDir, name)
+	for _, f := range []string{backupPlanFile, etcdK8sBackupArchive, etcdNetworkingBackupArchive} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			return nil, fmt.Errorf("backup %q is invalid: %v", name, err)
+		}
+	}
+	created, err := time.ParseInLocation(backupTimeFormat, name, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("backup %q is invalid: name is not a timestamp", name)
+	}
+	return &Backup{Name: name, Directory: dir, CreatedAt: created}, nil
+}
+
+// ListBackups returns the valid backups found in the backups directory,
+// from oldest to newest
+func ListBackups(backupsDir string) ([]Backup, error) {
+	// Backups are named after their timestamp, and ReadDir sorts them by name
+	files, err := ioutil.ReadDir(backupsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Backup{}, nil
+		}
+		return nil, fmt.Errorf("error reading backups directory: %v", err)
+	}
+	backups := []Backup{}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		b, err := ReadBackup(backupsDir, f.Name())
+		if err != nil {
+			continue
+		}
+		backups = append(backups, *b)
+	}
+	return backups, nil
+}
+
+// CreateBackup takes a backup of the Kubernetes and networking etcd clusters
+// from the first etcd node. The backup is stored in a timestamped directory
+// in the backups directory, together with the plan and the cluster CA.
+func (ae *ansibleExecutor) CreateBackup(p *Plan) (*Backup, error) {
+	runDirectory, err := ae.createRunDirectory("backup")
+	if err != nil {
+		return nil, fmt.Errorf("error creating working directory for backup: %v", err)
+	}
+	if err = os.MkdirAll(ae.options.BackupsDirectory, 0700); err != nil {
+		return nil, fmt.Errorf("error creating backups directory: %v", err)
+	}
+	name := time.Now().Format(backupTimeFormat)
+	backupDir := filepath.Join(ae.options.BackupsDirectory, name)
+	// Backups are named after the second at which they are taken, an existing backup
+	// must not be overwritten, nor removed if this backup fails
+	if err = os.Mkdir(backupDir, 0700); err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("backup %q already exists, try again in a second", name)
+		}
+		return nil, fmt.Errorf("error creating backup directory: %v", err)
+	}
+	backup, err := ae.createBackup(p, backupDir, runDirectory)
+	if err != nil {
+		// Don't leave incomplete backups around
+		os.RemoveAll(backupDir)
+		return nil, err
+	}
+	return backup, nil
+}
+
+func (ae *ansibleExecutor) createBackup(p *Plan, backupDir, runDirectory string) (*Backup, error) {
+	absBackupDir, err := filepath.Abs(backupDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine absolute path to %s: %v", backupDir, err)
+	}
+	inventory := buildInventoryFromPlan(p)
+	cc, err := ae.buildInstallExtraVars(p)
+	if err != nil {
+		return nil, err
+	}
+	cc.BackupDirectory = absBackupDir
+	ansibleLogFilename := filepath.Join(runDirectory, "ansible.log")
+	ansibleLogFile, err := os.Create(ansibleLogFilename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ansible log file %q: %v", ansibleLogFilename, err)
+	}
+	util.PrintHeader(ae.stdout, "Backing Up Etcd Clusters", '=')
+	playbook := "backup-etcd.yaml"
+	eventExplainer := &explain.DefaultEventExplainer{}
+	if err = ae.runPlaybookWithExplainer(playbook, eventExplainer, inventory, *cc, ansibleLogFile, runDirectory); err != nil {
+		return nil, fmt.Errorf("error backing up etcd clusters: %v", err)
+	}
+	// The plan and CA are required for restoring the cluster
+	fp := FilePlanner{File: filepath.Join(backupDir, backupPlanFile)}
+	if err = fp.Write(p); err != nil {
+		return nil, fmt.Errorf("error recording plan file to %s: %v", fp.File, err)
+	}
+	if err = copyClusterCA(ae.certsDir, backupDir); err != nil {
+		return nil, fmt.Errorf("error copying cluster CA to backup: %v", err)
+	}
+	return ReadBackup(filepath.Dir(backupDir), filepath.Base(backupDir))
+}
+
+// RestoreBackup restores the Kubernetes and networking etcd clusters from the
+// backup. The API servers are stopped while the etcd clusters are restored.
+// The cluster CA is restored to the generated assets directory if it is missing.
+func (ae *ansibleExecutor) RestoreBackup(p *Plan, b Backup) error {
+	_, err := os.Stat(filepath.Join(ae.certsDir, caCertFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error checking if cluster CA exists: %v", err)
+	}
+	if os.IsNotExist(err) {
+		if err = copyClusterCA(b.Directory, ae.certsDir); err != nil {
+			return fmt.Errorf("error restoring cluster CA from backup: %v", err)
+		}
+		util.PrettyPrintOk(ae.stdout, "Restored cluster CA to %q", ae.certsDir)
+	}
+	absBackupDir, err := filepath.Abs(b.Directory)
+	if err != nil {
+		return fmt.Errorf("failed to determine absolute path to %s: %v", b.Directory, err)
+	}
+	runDirectory, err := ae.createRunDirectory("restore")
+	if err != nil {
+		return fmt.Errorf("error creating working directory for restore: %v", err)
+	}
+	fp := FilePlanner{
+		File: filepath.Join(runDirectory, "kismatic-cluster.yaml"),
+	}
+	if err = fp.Write(p); err != nil {
+		return fmt.Errorf("error recording plan file to %s: %v", fp.File, err)
+	}
+	inventory := buildInventoryFromPlan(p)
+	cc, err := ae.buildInstallExtraVars(p)
+	if err != nil {
+		return err
+	}
+	cc.BackupDirectory = absBackupDir
+	// The API servers are stopped during the restore
+	cc.ForceAPIServerRestart = true
+	ansibleLogFilename := filepath.Join(runDirectory, "ansible.log")
+	ansibleLogFile, err := os.Create(ansibleLogFilename)
+	if err != nil {
+		return fmt.Errorf("error creating ansible log file %q: %v", ansibleLogFilename, err)
+	}
+	util.PrintHeader(ae.stdout, fmt.Sprintf("Restoring Etcd Clusters From Backup %q", b.Name), '=')
+	playbook := "restore-etcd.yaml"
+	eventExplainer := &explain.DefaultEventExplainer{}
+	if err = ae.runPlaybookWithExplainer(playbook, eventExplainer, inventory, *cc, ansibleLogFile, runDirectory); err != nil {
+		return fmt.Errorf("error restoring etcd clusters: %v", err)
+	}
+	return nil
+}
+
+// copies the certificate of the cluster CA, and its private key if there is one.
+// There is no private key when the certificates are signed by Vault.
+func copyClusterCA(fromDir, toDir string) error {
+	cert, err := ioutil.ReadFile(filepath.Join(fromDir, caCertFile))
+	if err != nil {
+		return fmt.Errorf("error reading CA certificate: %v", err)
+	}
+	key, err := ioutil.ReadFile(filepath.Join(fromDir, caKeyFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading CA private key: %v", err)
+	}
+	if err = os.MkdirAll(toDir, 0700); err != nil {
+		return fmt.Errorf("error creating directory: %v", err)
+	}
+	if key != nil {
+		if err = ioutil.WriteFile(filepath.Join(toDir, caKeyFile), key, 0600); err != nil {
+			return fmt.Errorf("error writing CA private key: %v", err)
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(toDir, caCertFile), cert, 0644); err != nil {
+		return fmt.Errorf("error writing CA certificate: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/tls"
+)
+
+// writes the files that are downloaded from the etcd node by the backup playbook
+func fakeEtcdBackupArchives(t *testing.T) func(string, ansible.ClusterCatalog) {
+	return func(playbook string, cc ansible.ClusterCatalog) {
+		for _, f := range []string{etcdK8sBackupArchive, etcdNetworkingBackupArchive} {
+			if err := ioutil.WriteFile(filepath.Join(cc.BackupDirectory, f), []byte("backup"), 0600); err != nil {
+				t.Fatalf("error writing fake backup archive: %v", err)
+			}
+		}
+	}
+}
+
+func mustWriteCA(t *testing.T, dir string) {
+	if err := tls.WriteCert([]byte("key"), []byte("cert"), "ca", dir); err != nil {
+		t.Fatalf("error writing CA: %v", err)
+	}
+}
+
+func TestCreateBackup(t *testing.T) {
+	runner := &fakeRunner{onStartPlaybook: fakeEtcdBackupArchives(t)}
+	e := ansibleExecutor{
+		certsDir:               mustGetTempDir(t),
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t), BackupsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+	}
+	mustWriteCA(t, e.certsDir)
+	plan := testPlan()
+	plan.Cluster.Name = "test-cluster"
+	backup, err := e.CreateBackup(plan)
+	if err != nil {
+		t.Fatalf("unexpected error creating backup: %v", err)
+	}
+	if !reflect.DeepEqual(runner.allNodesPlaybooks, []string{"backup-etcd.yaml"}) {
+		t.Errorf("expected backup playbook to run, but ran %v", runner.allNodesPlaybooks)
+	}
+	p, err := backup.Plan()
+	if err != nil {
+		t.Fatalf("error reading plan from backup: %v", err)
+	}
+	if p.Cluster.Name != "test-cluster" {
+		t.Errorf("expected plan of cluster %q in backup, but got %q", "test-cluster", p.Cluster.Name)
+	}
+	if exists, _ := tls.CertKeyPairExists("ca", backup.Directory); !exists {
+		t.Errorf("expected CA to be included in the backup")
+	}
+	backups, err := ListBackups(e.options.BackupsDirectory)
+	if err != nil {
+		t.Fatalf("unexpected error listing backups: %v", err)
+	}
+	if len(backups) != 1 || backups[0].Name != backup.Name {
+		t.Errorf("expected backup %q to be listed, but got %v", backup.Name, backups)
+	}
+}
+
+func TestCreateBackupVaultSigner(t *testing.T) {
+	runner := &fakeRunner{onStartPlaybook: fakeEtcdBackupArchives(t)}
+	e := ansibleExecutor{
+		certsDir:               mustGetTempDir(t),
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t), BackupsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+	}
+	// The private key of the CA is held by Vault
+	mustWriteFile(t, filepath.Join(e.certsDir, "ca.pem"), "cert")
+	backup, err := e.CreateBackup(testPlan())
+	if err != nil {
+		t.Fatalf("unexpected error creating backup: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backup.Directory, "ca.pem")); err != nil {
+		t.Errorf("expected CA certificate to be included in the backup: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backup.Directory, "ca-key.pem")); !os.IsNotExist(err) {
+		t.Errorf("expected no CA private key in the backup, but got %v", err)
+	}
+}
+
+func TestCreateBackupFailureRemovesBackup(t *testing.T) {
+	e := ansibleExecutor{
+		certsDir:               mustGetTempDir(t),
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t), BackupsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(errors.New("exec error")),
+	}
+	mustWriteCA(t, e.certsDir)
+	if _, err := e.CreateBackup(testPlan()); err == nil {
+		t.Fatal("expected an error, but didn't get one")
+	}
+	files, err := ioutil.ReadDir(e.options.BackupsDirectory)
+	if err != nil {
+		t.Fatalf("error reading backups directory: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected incomplete backup to be removed, but found %d files", len(files))
+	}
+}
+
+func TestCreateBackupKeepsExistingBackup(t *testing.T) {
+	e := ansibleExecutor{
+		certsDir:               mustGetTempDir(t),
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t), BackupsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(errors.New("exec error")),
+	}
+	mustWriteCA(t, e.certsDir)
+	// Backups taken during the same second as the backup being created
+	now := time.Now()
+	existing := []string{}
+	for i := 0; i < 3; i++ {
+		dir := filepath.Join(e.options.BackupsDirectory, now.Add(time.Duration(i)*time.Second).Format(backupTimeFormat))
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatalf("error creating backup directory: %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, etcdK8sBackupArchive), []byte("backup"), 0600); err != nil {
+			t.Fatalf("error writing backup archive: %v", err)
+		}
+		existing = append(existing, dir)
+	}
+	if _, err := e.CreateBackup(testPlan()); err == nil {
+		t.Fatal("expected an error, but didn't get one")
+	}
+	for _, dir := range existing {
+		if _, err := os.Stat(filepath.Join(dir, etcdK8sBackupArchive)); err != nil {
+			t.Errorf("expected existing backup %q to be kept: %v", dir, err)
+		}
+	}
+}
+
+func TestListBackupsIgnoresInvalidBackups(t *testing.T) {
+	dir := mustGetTempDir(t)
+	// complete backup
+	valid := filepath.Join(dir, "2017-01-02-15-04-05")
+	// backup missing the etcd archives
+	incomplete := filepath.Join(dir, "2017-01-03-15-04-05")
+	// not a timestamp
+	notBackup := filepath.Join(dir, "foo")
+	for _, d := range []string{valid, incomplete, notBackup} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatalf("error creating dir: %v", err)
+		}
+		fp := FilePlanner{File: filepath.Join(d, backupPlanFile)}
+		if err := fp.Write(testPlan()); err != nil {
+			t.Fatalf("error writing plan: %v", err)
+		}
+	}
+	for _, d := range []string{valid, notBackup} {
+		fakeEtcdBackupArchives(t)("", ansible.ClusterCatalog{BackupDirectory: d})
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		t.Fatalf("unexpected error listing backups: %v", err)
+	}
+	if len(backups) != 1 || backups[0].Name != "2017-01-02-15-04-05" {
+		t.Errorf("expected only the valid backup to be listed, but got %v", backups)
+	}
+}
+
+func TestListBackupsMissingDirectory(t *testing.T) {
+	backups, err := ListBackups(filepath.Join(mustGetTempDir(t), "missing"))
+	if err != nil {
+		t.Errorf("unexpected error listing backups: %v", err)
+	}
+	if len(backups) != 0 {
+		t.Errorf("expected no backups, but got %v", backups)
+	}
+}
+
+func TestRestoreBackupRestoresMissingCA(t *testing.T) {
+	backupsDir := mustGetTempDir(t)
+	backupDir := filepath.Join(backupsDir, "2017-01-02-15-04-05")
+	if err := os.MkdirAll(backupDir, 0700); err != nil {
+		t.Fatalf("error creating dir: %v", err)
+	}
+	mustWriteCA(t, backupDir)
+
+	runner := &fakeRunner{}
+	e := ansibleExecutor{
+		certsDir:               mustGetTempDir(t),
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+	}
+	b := Backup{Name: "2017-01-02-15-04-05", Directory: backupDir}
+	if err := e.RestoreBackup(testPlan(), b); err != nil {
+		t.Fatalf("unexpected error restoring backup: %v", err)
+	}
+	if exists, _ := tls.CertKeyPairExists("ca", e.certsDir); !exists {
+		t.Errorf("expected CA to be restored from the backup")
+	}
+	if !reflect.DeepEqual(runner.allNodesPlaybooks, []string{"restore-etcd.yaml"}) {
+		t.Errorf("expected restore playbook to run, but ran %v", runner.allNodesPlaybooks)
+	}
+}
@@ -0,0 +1,203 @@
+package install
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// CertificateInfo describes a certificate in the generated assets directory
+type CertificateInfo struct {
+	// Name is the path of the certificate file relative to the certificates directory,
+	// without its extension. The certificates that follow the first one in a file are
+	// numbered, e.g. "service-account-trusted#2".
+	Name          string    `json:"name"`
+	Subject       string    `json:"subject"`
+	SANs          []string  `json:"sans"`
+	Issuer        string    `json:"issuer"`
+	NotAfter      time.Time `json:"notAfter"`
+	DaysRemaining int       `json:"daysRemaining"`
+	// Deployed are the copies of the certificate found on the nodes
+	Deployed []DeployedCertificate `json:"deployed,omitempty"`
+	raw      []byte
+}
+
+// DeployedCertificate is a copy of a certificate that is deployed on a node
+type DeployedCertificate struct {
+	Host string `json:"host"`
+	Path string `json:"path"`
+	// Matches is true if the deployed certificate is the same as the local certificate
+	Matches bool   `json:"matches"`
+	Error   string `json:"error,omitempty"`
+}
+
+// the location of a certificate on a node
+type certificateLocation struct {
+	node Node
+	path string
+}
+
+// ListCertificates returns the certificates found in the certificates directory and its
+// subdirectories, sorted by name. The days remaining until expiry are calculated relative to now.
+func ListCertificates(certsDir string, now time.Time) ([]CertificateInfo, error) {
+	certs := []CertificateInfo{}
+	err := filepath.Walk(certsDir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error reading certificates directory: %v", err)
+		}
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".pem") || strings.HasSuffix(f.Name(), "-key.pem") {
+			return nil
+		}
+		rel, err := filepath.Rel(certsDir, path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), ".pem")
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading certificate %s: %v", name, err)
+		}
+		parsed, err := helpers.ParseCertificatesPEM(b)
+		if err != nil {
+			return fmt.Errorf("error parsing certificate %s: %v", name, err)
+		}
+		if len(parsed) == 0 {
+			return fmt.Errorf("error parsing certificate %s: no certificates found", name)
+		}
+		for i, cert := range parsed {
+			n := name
+			if i > 0 {
+				n = fmt.Sprintf("%s#%d", name, i+1)
+			}
+			certs = append(certs, certificateInfo(n, cert, now))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(certificatesByName(certs))
+	return certs, nil
+}
+
+type certificatesByName []CertificateInfo
+
+func (c certificatesByName) Len() int           { return len(c) }
+func (c certificatesByName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c certificatesByName) Less(i, j int) bool { return c[i].Name < c[j].Name }
+
+func certificateInfo(name string, cert *x509.Certificate, now time.Time) CertificateInfo {
+	sans := []string{}
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return CertificateInfo{
+		Name:          name,
+		Subject:       cert.Subject.CommonName,
+		SANs:          sans,
+		Issuer:        cert.Issuer.CommonName,
+		NotAfter:      cert.NotAfter,
+		DaysRemaining: int(cert.NotAfter.Sub(now).Hours() / 24),
+		raw:           cert.Raw,
+	}
+}
+
+// ValidateCertificateExpiry returns an error for each certificate in the
+// certificates directory that expires within the window. It is not an error if
+// the certificates have not been generated yet.
+func ValidateCertificateExpiry(certsDir string, window time.Duration) (bool, []error) {
+	if _, err := os.Stat(certsDir); os.IsNotExist(err) {
+		return true, nil
+	}
+	now := time.Now()
+	certs, err := ListCertificates(certsDir, now)
+	if err != nil {
+		return false, []error{err}
+	}
+	v := newValidator()
+	for _, c := range certs {
+		if c.NotAfter.Before(now) {
+			v.addError(fmt.Errorf("Certificate %q expired on %s", c.Name, c.NotAfter.Format(time.RFC3339)))
+			continue
+		}
+		if c.NotAfter.Before(now.Add(window)) {
+			v.addError(fmt.Errorf("Certificate %q expires in %d days, on %s", c.Name, c.DaysRemaining, c.NotAfter.Format(time.RFC3339)))
+		}
+	}
+	return v.valid()
+}
+
+// CheckDeployedCertificates compares the certificates with the copies deployed on the
+// nodes of the cluster, which are read over SSH until the context is canceled
+func CheckDeployedCertificates(ctx context.Context, p *Plan, certs []CertificateInfo) {
+	clients := newSSHClients(ctx, p)
+	defer clients.close()
+	checkDeployedCertificates(p, certs, clients.output)
+}
+
+func checkDeployedCertificates(p *Plan, certs []CertificateInfo, runCommand func(node Node, command string) (string, error)) {
+	locations := deployedCertificateLocations(p)
+	var wg sync.WaitGroup
+	for i := range certs {
+		c := &certs[i]
+		c.Deployed = make([]DeployedCertificate, len(locations[c.Name]))
+		for j, l := range locations[c.Name] {
+			wg.Add(1)
+			go func(d *DeployedCertificate, l certificateLocation) {
+				defer wg.Done()
+				d.Host = l.node.Host
+				d.Path = l.path
+				out, err := runCommand(l.node, fmt.Sprintf("sudo cat %s", l.path))
+				if err != nil {
+					d.Error = err.Error()
+					return
+				}
+				deployed, err := helpers.ParseCertificatePEM([]byte(out))
+				if err != nil {
+					d.Error = fmt.Sprintf("error parsing certificate: %v", err)
+					return
+				}
+				d.Matches = bytes.Equal(deployed.Raw, c.raw)
+			}(&c.Deployed[j], l)
+		}
+	}
+	wg.Wait()
+}
+
+// returns the locations on the nodes where the certificates are deployed, by certificate name
+func deployedCertificateLocations(p *Plan) map[string][]certificateLocation {
+	locations := map[string][]certificateLocation{}
+	add := func(name string, node Node, path string) {
+		locations[name] = append(locations[name], certificateLocation{node: node, path: path})
+	}
+	for _, ns := range statusNodes(p) {
+		node := Node{Host: ns.Host, IP: ns.IP}
+		if hasRole(ns.Roles, "etcd") {
+			for _, c := range statusEtcdClusters {
+				add("ca", node, filepath.Join(c.installDir, "ca.pem"))
+				add(node.Host, node, filepath.Join(c.installDir, "etcd.pem"))
+			}
+		}
+		if isKubernetesNode(ns.Roles) {
+			add("ca", node, "/etc/kubernetes/ca.pem")
+			add(node.Host, node, "/etc/kubernetes/kubenode.pem")
+			add("service-account", node, "/etc/kubernetes/service-account.pem")
+		}
+	}
+	// The docker registry is deployed on the first master
+	if p.DockerRegistry.SetupInternal && len(p.Master.Nodes) > 0 {
+		add("docker", p.Master.Nodes[0], "/etc/docker/docker.pem")
+	}
+	return locations
+}
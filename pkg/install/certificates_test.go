@@ -0,0 +1,161 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// generates the CA and the certificates of the test plan, which expire in a year
+func mustGenerateTestCertificates(t *testing.T) (LocalPKI, *Plan) {
+	pki := getPKI(t)
+	p := getPlan()
+	ca, err := pki.GenerateClusterCA(p)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	if err = pki.GenerateClusterCertificates(p, ca, []string{"admin"}); err != nil {
+		t.Fatalf("error generating certificates: %v", err)
+	}
+	return pki, p
+}
+
+func TestListCertificates(t *testing.T) {
+	pki, _ := mustGenerateTestCertificates(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	certs, err := ListCertificates(pki.GeneratedCertsDirectory, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"admin", "ca", "etcd", "master", "service-account", "worker"}
+	if len(certs) != len(expected) {
+		t.Fatalf("expected certificates %v, but got %+v", expected, certs)
+	}
+	for i, c := range certs {
+		if c.Name != expected[i] {
+			t.Errorf("expected certificate %q, but got %q", expected[i], c.Name)
+		}
+	}
+	if certs[3].Subject != "master" || certs[3].Issuer != certs[1].Subject {
+		t.Errorf("unexpected subject or issuer of master certificate: %+v", certs[3])
+	}
+	if certs[3].DaysRemaining != 364 {
+		t.Errorf("expected master certificate to expire in 364 days, but got %d days remaining", certs[3].DaysRemaining)
+	}
+}
+
+func TestListCertificatesUsersAndBundles(t *testing.T) {
+	pki, p := mustGenerateTestCertificates(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	ca, err := pki.GetClusterCA()
+	if err != nil {
+		t.Fatalf("error reading CA: %v", err)
+	}
+	if _, err = pki.IssueUserCertificate(p, "alice", nil, ca, filepath.Join(pki.GeneratedCertsDirectory, "users")); err != nil {
+		t.Fatalf("error issuing user certificate: %v", err)
+	}
+	// The trusted service account certificates are a bundle
+	var bundle []byte
+	for _, f := range []string{"service-account.pem", "admin.pem"} {
+		b, err := ioutil.ReadFile(filepath.Join(pki.GeneratedCertsDirectory, f))
+		if err != nil {
+			t.Fatalf("error reading certificate: %v", err)
+		}
+		bundle = append(bundle, b...)
+	}
+	if err = ioutil.WriteFile(filepath.Join(pki.GeneratedCertsDirectory, "service-account-trusted.pem"), bundle, 0644); err != nil {
+		t.Fatalf("error writing bundle: %v", err)
+	}
+
+	certs, err := ListCertificates(pki.GeneratedCertsDirectory, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"admin", "ca", "etcd", "master", "service-account", "service-account-trusted", "service-account-trusted#2", "users/alice", "worker"}
+	if len(certs) != len(expected) {
+		t.Fatalf("expected certificates %v, but got %+v", expected, certs)
+	}
+	for i, c := range certs {
+		if c.Name != expected[i] {
+			t.Errorf("expected certificate %q, but got %q", expected[i], c.Name)
+		}
+	}
+	if certs[6].Subject != "admin" || certs[7].Subject != "alice" {
+		t.Errorf("unexpected subjects of the bundled and user certificates: %+v %+v", certs[6], certs[7])
+	}
+}
+
+func TestValidateCertificateExpiry(t *testing.T) {
+	pki, _ := mustGenerateTestCertificates(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	if ok, errs := ValidateCertificateExpiry(pki.GeneratedCertsDirectory, 30*24*time.Hour); !ok {
+		t.Errorf("expected no warnings, but got %v", errs)
+	}
+	ok, errs := ValidateCertificateExpiry(pki.GeneratedCertsDirectory, 400*24*time.Hour)
+	if ok || len(errs) != 6 {
+		t.Errorf("expected a warning for each of the 6 certificates, but got %v", errs)
+	}
+}
+
+func TestValidateCertificateExpiryNoCertificates(t *testing.T) {
+	if ok, errs := ValidateCertificateExpiry(filepath.Join(mustGetTempDir(t), "keys"), time.Hour); !ok {
+		t.Errorf("expected no warnings when certificates have not been generated, but got %v", errs)
+	}
+}
+
+func TestCheckDeployedCertificates(t *testing.T) {
+	pki, p := mustGenerateTestCertificates(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	certs, err := ListCertificates(pki.GeneratedCertsDirectory, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(filepath.Join(pki.GeneratedCertsDirectory, name))
+		if err != nil {
+			t.Fatalf("error reading certificate: %v", err)
+		}
+		return string(b)
+	}
+	// The worker has a stale node certificate, and the etcd node is unreachable
+	checkDeployedCertificates(p, certs, func(node Node, command string) (string, error) {
+		switch {
+		case node.Host == "etcd":
+			return "", errors.New("unreachable")
+		case command == "sudo cat /etc/kubernetes/kubenode.pem":
+			return read("master.pem"), nil
+		case command == "sudo cat /etc/kubernetes/ca.pem":
+			return read("ca.pem"), nil
+		}
+		return read("service-account.pem"), nil
+	})
+	expected := map[string][]DeployedCertificate{
+		"admin": {},
+		"ca": {
+			{Host: "etcd", Path: "/etc/etcd_k8s/ca.pem", Error: "unreachable"},
+			{Host: "etcd", Path: "/etc/etcd_networking/ca.pem", Error: "unreachable"},
+			{Host: "master", Path: "/etc/kubernetes/ca.pem", Matches: true},
+			{Host: "worker", Path: "/etc/kubernetes/ca.pem", Matches: true},
+		},
+		"master":          {{Host: "master", Path: "/etc/kubernetes/kubenode.pem", Matches: true}},
+		"worker":          {{Host: "worker", Path: "/etc/kubernetes/kubenode.pem", Matches: false}},
+		"service-account": {{Host: "master", Path: "/etc/kubernetes/service-account.pem", Matches: true}, {Host: "worker", Path: "/etc/kubernetes/service-account.pem", Matches: true}},
+	}
+	for _, c := range certs {
+		e, ok := expected[c.Name]
+		if !ok {
+			continue
+		}
+		if len(c.Deployed) != len(e) {
+			t.Errorf("%s: expected deployed certificates %+v, but got %+v", c.Name, e, c.Deployed)
+			continue
+		}
+		for i := range e {
+			if c.Deployed[i] != e[i] {
+				t.Errorf("%s: expected deployed certificate %+v, but got %+v", c.Name, e[i], c.Deployed[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package install
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+const (
+	// the directory at the root of the diagnostics bundle
+	diagnosticsBundleDir = "diagnostics"
+	// the number of lines of the journal of each service that are collected
+	diagnosticsJournalLines = 2000
+	diagnosticsRedacted     = "[REDACTED]"
+)
+
+// DiagnosticsSummary describes the contents of a diagnostics bundle
+type DiagnosticsSummary struct {
+	Cluster     string    `json:"cluster"`
+	CollectedAt time.Time `json:"collectedAt"`
+	// RunDirectory is the run directory included in the bundle, if any
+	RunDirectory string            `json:"runDirectory,omitempty"`
+	Nodes        []NodeDiagnostics `json:"nodes"`
+}
+
+// NodeDiagnostics describes the diagnostics collected from a node
+type NodeDiagnostics struct {
+	Host  string   `json:"host"`
+	IP    string   `json:"ip"`
+	Roles []string `json:"roles"`
+	// Files are the files collected from the node, relative to the node's directory in the bundle
+	Files []string `json:"files"`
+	// Errors are the errors of the commands that failed on the node
+	Errors []string `json:"errors,omitempty"`
+}
+
+// a command run on the nodes that satisfy the condition, whose output is written to the file
+type diagnosticsCommand struct {
+	file    string
+	command string
+	when    func(roles []string) bool
+}
+
+func allNodes([]string) bool { return true }
+
+func etcdNode(roles []string) bool { return hasRole(roles, "etcd") }
+
+func masterNode(roles []string) bool { return hasRole(roles, "master") }
+
+func journalCommand(service string, when func([]string) bool) diagnosticsCommand {
+	return diagnosticsCommand{
+		file:    fmt.Sprintf("journal-%s.log", service),
+		command: fmt.Sprintf("sudo journalctl -u %s.service --no-pager -n %d", service, diagnosticsJournalLines),
+		when:    when,
+	}
+}
+
+var diagnosticsCommands = []diagnosticsCommand{
+	{file: "os-release.txt", command: "cat /etc/os-release", when: allNodes},
+	{file: "disk.txt", command: "df -h", when: allNodes},
+	{file: "memory.txt", command: "free -m", when: allNodes},
+	{file: "docker-ps.txt", command: "sudo docker ps -a", when: isKubernetesNode},
+	{file: "iptables.txt", command: "sudo iptables-save", when: allNodes},
+	journalCommand("docker", isKubernetesNode),
+	journalCommand("kubelet", isKubernetesNode),
+	journalCommand("kube-proxy", isKubernetesNode),
+	journalCommand("calico-node", isKubernetesNode),
+	journalCommand("etcd_k8s", etcdNode),
+	journalCommand("etcd_networking", etcdNode),
+	journalCommand("kube-apiserver", masterNode),
+	journalCommand("kube-controller-manager", masterNode),
+	journalCommand("kube-scheduler", masterNode),
+}
+
+var (
+	// values of settings whose name suggests a secret, e.g. "admin_password: secret"
+	secretSettingPattern = regexp.MustCompile(`(?i)([\w-]*(?:password|passwd|secret|token)[\w-]*["']?\s*[:=]\s*)["']?[^\s"',}]+["']?`)
+	privateKeyPattern    = regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+)
+
+// diagnosticsCollector collects the diagnostics of the cluster
+type diagnosticsCollector struct {
+	// the collection is interrupted when the context is canceled
+	ctx         context.Context
+	plan        *Plan
+	parallelism int
+	// runs the command on the node, and returns its output
+	runCommand func(node Node, command string) (string, error)
+}
+
+// a file of the diagnostics bundle
+type diagnosticsFile struct {
+	name string
+	data []byte
+}
+
+// CollectDiagnostics collects the logs, state and deployed certificates of the nodes over SSH,
+// on at most parallelism nodes at a time, and writes them to the bundle file, a gzipped tarball,
+// together with the most recent run directory found in the runs directory. Secrets, such as the
+// admin password and private keys, are redacted from the bundle. Errors collecting the
+// diagnostics of a node are reported in the summary, and do not fail the collection.
+// No bundle is written if the context is canceled.
+func CollectDiagnostics(ctx context.Context, p *Plan, runsDir, bundleFile string, parallelism int) (*DiagnosticsSummary, error) {
+	clients := newSSHClients(ctx, p)
+	defer clients.close()
+	c := diagnosticsCollector{
+		ctx:         ctx,
+		plan:        p,
+		parallelism: parallelism,
+		runCommand:  clients.output,
+	}
+	return c.collect(runsDir, bundleFile, time.Now())
+}
+
+func (c diagnosticsCollector) collect(runsDir, bundleFile string, now time.Time) (*DiagnosticsSummary, error) {
+	summary := &DiagnosticsSummary{
+		Cluster:     c.plan.Cluster.Name,
+		CollectedAt: now,
+	}
+	files := []diagnosticsFile{}
+
+	runDir, err := latestRunDirectory(runsDir)
+	if err != nil {
+		return nil, err
+	}
+	if runDir != "" {
+		summary.RunDirectory = runDir
+		runFiles, err := readRunDirectory(runDir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, runFiles...)
+	}
+
+	statuses := statusNodes(c.plan)
+	nodes := make([]Node, len(statuses))
+	for i, ns := range statuses {
+		nodes[i] = Node{Host: ns.Host, IP: ns.IP}
+	}
+	summary.Nodes = make([]NodeDiagnostics, len(nodes))
+	nodeFiles := make([][]diagnosticsFile, len(nodes))
+	onNodes(nodes, c.parallelism, func(i int, n Node) {
+		summary.Nodes[i], nodeFiles[i] = c.collectNode(n, statuses[i].Roles, now)
+	})
+	if err := c.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("the collection was interrupted: %v", err)
+	}
+	for _, nf := range nodeFiles {
+		files = append(files, nf...)
+	}
+
+	summaryData, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error writing diagnostics summary: %v", err)
+	}
+	files = append(files, diagnosticsFile{name: "summary.json", data: summaryData})
+	if err = writeDiagnosticsBundle(bundleFile, files, c.secrets(), now); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// collects the output of the diagnostics commands and the deployed certificates of the node
+func (c diagnosticsCollector) collectNode(n Node, roles []string, now time.Time) (NodeDiagnostics, []diagnosticsFile) {
+	nd := NodeDiagnostics{Host: n.Host, IP: n.IP, Roles: roles, Files: []string{}}
+	files := []diagnosticsFile{}
+	add := func(name string, data []byte) {
+		nd.Files = append(nd.Files, name)
+		files = append(files, diagnosticsFile{name: filepath.Join("nodes", n.Host, name), data: data})
+	}
+	commands := append([]diagnosticsCommand{}, diagnosticsCommands...)
+	// The inspector is installed on the nodes by the pre-flight checks
+	commands = append(commands, diagnosticsCommand{
+		file:    "inspector.json",
+		command: fmt.Sprintf("sudo /usr/bin/kismatic-inspector local -o json --node-roles %s", strings.Join(roles, ",")),
+		when:    allNodes,
+	})
+	for _, cmd := range commands {
+		if !cmd.when(roles) {
+			continue
+		}
+		out, err := c.runCommand(n, cmd.command+" 2>&1")
+		if err != nil {
+			nd.Errors = append(nd.Errors, fmt.Sprintf("%s: %v", cmd.command, err))
+		}
+		add(cmd.file, []byte(out))
+	}
+
+	certs, errs := c.deployedCertificates(n, now)
+	nd.Errors = append(nd.Errors, errs...)
+	data, err := json.MarshalIndent(certs, "", "  ")
+	if err != nil {
+		nd.Errors = append(nd.Errors, fmt.Sprintf("error writing certificates: %v", err))
+	} else {
+		add("certificates.json", data)
+	}
+	return nd, files
+}
+
+// deployedCertificateMetadata is the metadata of a certificate deployed on a node
+type deployedCertificateMetadata struct {
+	Path string `json:"path"`
+	CertificateInfo
+	Error string `json:"error,omitempty"`
+}
+
+// returns the metadata of the certificates deployed on the node, sorted by certificate name
+func (c diagnosticsCollector) deployedCertificates(n Node, now time.Time) ([]deployedCertificateMetadata, []string) {
+	certs := []deployedCertificateMetadata{}
+	errs := []string{}
+	locations := deployedCertificateLocations(c.plan)
+	names := []string{}
+	for name := range locations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, l := range locations[name] {
+			if l.node.Host != n.Host {
+				continue
+			}
+			m := deployedCertificateMetadata{Path: l.path, CertificateInfo: CertificateInfo{Name: name}}
+			cert, err := c.readCertificate(n, l.path)
+			if err != nil {
+				m.Error = err.Error()
+				errs = append(errs, fmt.Sprintf("certificate %s: %v", l.path, err))
+			} else {
+				m.CertificateInfo = certificateInfo(name, cert, now)
+			}
+			certs = append(certs, m)
+		}
+	}
+	return certs, errs
+}
+
+func (c diagnosticsCollector) readCertificate(n Node, path string) (*x509.Certificate, error) {
+	out, err := c.runCommand(n, fmt.Sprintf("sudo cat %s", path))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := helpers.ParseCertificatePEM([]byte(out))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate: %v", err)
+	}
+	return cert, nil
+}
+
+// returns the secrets that are redacted wherever they appear in the bundle
+func (c diagnosticsCollector) secrets() []string {
+	secrets := []string{}
+	for _, s := range []string{c.plan.Cluster.AdminPassword, os.Getenv("VAULT_TOKEN")} {
+		if s != "" {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets
+}
+
+// returns the most recent run directory in the runs directory, whose runs are
+// grouped by operation, or an empty string if there are no runs
+func latestRunDirectory(runsDir string) (string, error) {
+	ops, err := ioutil.ReadDir(runsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("error reading runs directory: %v", err)
+	}
+	latest := ""
+	for _, op := range ops {
+		if !op.IsDir() {
+			continue
+		}
+		dir, err := lastRunDirectory(filepath.Join(runsDir, op.Name()))
+		if err != nil {
+			continue
+		}
+		// Runs are named after their timestamp
+		if latest == "" || filepath.Base(dir) > filepath.Base(latest) {
+			latest = dir
+		}
+	}
+	return latest, nil
+}
+
+// returns the files of the run directory. Private keys are not included.
+func readRunDirectory(runDir string) ([]diagnosticsFile, error) {
+	files := []diagnosticsFile{}
+	err := filepath.Walk(runDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || strings.HasSuffix(info.Name(), "-key.pem") || strings.HasSuffix(info.Name(), ".key") {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(runDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, diagnosticsFile{name: filepath.Join("run", rel), data: data})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading run directory %q: %v", runDir, err)
+	}
+	return files, nil
+}
+
+// redacts the secrets, the values of settings that look like secrets, and the private keys
+func redactSecrets(data []byte, secrets []string) []byte {
+	s := string(data)
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, diagnosticsRedacted, -1)
+	}
+	s = secretSettingPattern.ReplaceAllString(s, "${1}"+diagnosticsRedacted)
+	s = privateKeyPattern.ReplaceAllString(s, diagnosticsRedacted)
+	return []byte(s)
+}
+
+// writes the files, with the secrets redacted, to the gzipped tarball
+func writeDiagnosticsBundle(bundleFile string, files []diagnosticsFile, secrets []string, now time.Time) error {
+	f, err := os.OpenFile(bundleFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating diagnostics bundle: %v", err)
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, file := range files {
+		data := redactSecrets(file.data, secrets)
+		hdr := &tar.Header{
+			Name:    filepath.ToSlash(filepath.Join(diagnosticsBundleDir, file.name)),
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("error writing diagnostics bundle: %v", err)
+		}
+		if _, err = tw.Write(data); err != nil {
+			return fmt.Errorf("error writing diagnostics bundle: %v", err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return fmt.Errorf("error writing diagnostics bundle: %v", err)
+	}
+	if err = gw.Close(); err != nil {
+		return fmt.Errorf("error writing diagnostics bundle: %v", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,257 @@
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The kinds of changes made to the plan
+const (
+	PlanChangeAdded   = "added"
+	PlanChangeRemoved = "removed"
+	PlanChangeChanged = "changed"
+)
+
+// PlanChange is a difference between the plan that was applied to the cluster
+// and the current plan
+type PlanChange struct {
+	// Field is the setting that changed, e.g. "cluster.networking.pod_cidr_block",
+	// or the node group of a node that was added or removed, e.g. "worker.nodes"
+	Field string `json:"field"`
+	// Kind is added or removed for nodes, and changed for settings and readdressed nodes
+	Kind string `json:"kind"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+	// Destructive is true when applying the change would break the cluster,
+	// or cannot be done by applying the plan
+	Destructive bool `json:"destructive"`
+	// Reason explains how the change is applied, or why it is destructive
+	Reason string `json:"reason"`
+}
+
+// PlanDiff is the difference between the plan that was last applied to the
+// cluster and the current plan
+type PlanDiff struct {
+	// RunDirectory is the run that recorded the applied plan. It is empty when
+	// the plan was never applied.
+	RunDirectory string       `json:"runDirectory"`
+	Changes      []PlanChange `json:"changes"`
+}
+
+// Destructive returns the changes that cannot be safely applied
+func (d PlanDiff) Destructive() []PlanChange {
+	changes := []PlanChange{}
+	for _, c := range d.Changes {
+		if c.Destructive {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// the runs that record the plan that was applied to the cluster. The plan of an
+// installation run is only applied if the run completed successfully.
+var appliedPlanRuns = []string{"install", "add-worker", "add-node", "remove-node"}
+
+// LastAppliedPlan returns the plan that was last applied to the cluster, and the run
+// that recorded it. This is the plan of the last installation, or addition or removal
+// of nodes, that completed successfully. The plan is recorded before the run starts,
+// so the runs that failed, or whose outcome is unknown, are ignored. A nil plan is
+// returned when the plan was never applied.
+func LastAppliedPlan(runsDir string) (*Plan, string, error) {
+	// Runs are named after their timestamp, and are sorted by timestamp and operation
+	runs := []string{}
+	for _, op := range appliedPlanRuns {
+		files, err := ioutil.ReadDir(filepath.Join(runsDir, op))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, "", fmt.Errorf("error reading runs directory: %v", err)
+		}
+		for _, f := range files {
+			if f.IsDir() {
+				runs = append(runs, f.Name()+" "+op)
+			}
+		}
+	}
+	sort.Strings(runs)
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := strings.SplitN(runs[i], " ", 2)
+		timestamp, op := run[0], run[1]
+		dir := filepath.Join(runsDir, op, timestamp)
+		r, err := ReadRun(dir)
+		if err != nil {
+			// Directories that are not named after a timestamp are not runs
+			continue
+		}
+		if r.Outcome != RunSucceeded {
+			continue
+		}
+		fp := FilePlanner{File: filepath.Join(dir, "kismatic-cluster.yaml")}
+		if !fp.PlanExists() {
+			continue
+		}
+		p, err := fp.Read()
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading plan file of run %q: %v", dir, err)
+		}
+		return p, dir, nil
+	}
+	return nil, "", nil
+}
+
+// DiffLastAppliedPlan returns the changes made to the plan since it was last
+// applied to the cluster. There are no changes if the plan was never applied.
+func DiffLastAppliedPlan(p *Plan, runsDir string) (*PlanDiff, error) {
+	applied, runDir, err := LastAppliedPlan(runsDir)
+	if err != nil {
+		return nil, err
+	}
+	if applied == nil {
+		return &PlanDiff{Changes: []PlanChange{}}, nil
+	}
+	return &PlanDiff{RunDirectory: runDir, Changes: DiffPlans(applied, p)}, nil
+}
+
+const appliedByInstall = "applied by \"kismatic install apply\""
+
+// a setting of the plan that is compared
+type planSetting struct {
+	field string
+	value func(p *Plan) string
+	// the reason a change of the setting is destructive, empty if it is supported
+	destructive string
+	// the values of secret settings are not reported
+	secret bool
+}
+
+const caChanged = "the certificates of the cluster are issued by a different CA, and must all be reissued with \"kismatic certificates rotate\""
+
+var planSettings = []planSetting{
+	{field: "cluster.name", value: func(p *Plan) string { return p.Cluster.Name },
+		destructive: "the name of the cluster is part of its configuration and certificates"},
+	{field: "cluster.admin_password", value: func(p *Plan) string { return p.Cluster.AdminPassword }, secret: true},
+	{field: "cluster.allow_package_installation", value: func(p *Plan) string { return strconv.FormatBool(p.Cluster.AllowPackageInstallation) }},
+	{field: "cluster.networking.type", value: func(p *Plan) string { return p.Cluster.Networking.Type },
+		destructive: "the pod network cannot be reconfigured on a running cluster"},
+	{field: "cluster.networking.pod_cidr_block", value: func(p *Plan) string { return p.Cluster.Networking.PodCIDRBlock },
+		destructive: "the pods running on the cluster would lose connectivity, the pod network cannot be reconfigured on a running cluster"},
+	{field: "cluster.networking.service_cidr_block", value: func(p *Plan) string { return p.Cluster.Networking.ServiceCIDRBlock },
+		destructive: "the existing services, the cluster DNS and the API server certificates use addresses of the service network"},
+	{field: "cluster.networking.policy_enabled", value: func(p *Plan) string { return strconv.FormatBool(p.Cluster.Networking.PolicyEnabled) }},
+	{field: "cluster.networking.update_hosts_files", value: func(p *Plan) string { return strconv.FormatBool(p.Cluster.Networking.UpdateHostsFiles) }},
+	{field: "cluster.certificates.expiry", value: func(p *Plan) string { return p.Cluster.Certificates.Expiry }},
+	{field: "cluster.certificates.ca_cert", value: func(p *Plan) string { return p.Cluster.Certificates.CACert }, destructive: caChanged},
+	{field: "cluster.certificates.ca_key", value: func(p *Plan) string { return p.Cluster.Certificates.CAKey }, destructive: caChanged},
+	{field: "cluster.certificates.ca_chain", value: func(p *Plan) string { return p.Cluster.Certificates.CAChain }},
+	{field: "cluster.certificates.subject", value: func(p *Plan) string { return fmt.Sprintf("%+v", p.Cluster.Certificates.Subject) }},
+	{field: "cluster.certificates.ca_key_algorithm", value: func(p *Plan) string { return p.Cluster.Certificates.CAKeyAlgorithm }},
+	{field: "cluster.certificates.key_algorithm", value: func(p *Plan) string { return p.Cluster.Certificates.KeyAlgorithm }},
+	{field: "cluster.certificates.signer.type", value: func(p *Plan) string { return p.Cluster.Certificates.Signer.Type }, destructive: caChanged},
+	{field: "cluster.certificates.signer.address", value: func(p *Plan) string { return p.Cluster.Certificates.Signer.Address }},
+	{field: "cluster.certificates.signer.mount", value: func(p *Plan) string { return p.Cluster.Certificates.Signer.Mount }, destructive: caChanged},
+	{field: "cluster.certificates.signer.role", value: func(p *Plan) string { return p.Cluster.Certificates.Signer.Role }},
+	{field: "cluster.certificates.signer.tls_ca_file", value: func(p *Plan) string { return p.Cluster.Certificates.Signer.TLSCAFile }},
+	{field: "docker_registry.setup_internal", value: func(p *Plan) string { return strconv.FormatBool(p.DockerRegistry.SetupInternal) }},
+	{field: "docker_registry.address", value: func(p *Plan) string { return p.DockerRegistry.Address }},
+	{field: "docker_registry.port", value: func(p *Plan) string { return strconv.Itoa(p.DockerRegistry.Port) }},
+	{field: "docker_registry.CA", value: func(p *Plan) string { return p.DockerRegistry.CAPath }},
+	{field: "master.load_balanced_fqdn", value: func(p *Plan) string { return p.Master.LoadBalancedFQDN },
+		destructive: "the API server certificates and the generated kubeconfig files reference the load balanced endpoint"},
+	{field: "master.load_balanced_short_name", value: func(p *Plan) string { return p.Master.LoadBalancedShortName },
+		destructive: "the API server certificates reference the load balanced endpoint"},
+}
+
+// DiffPlans returns the changes made to the applied plan in the current plan.
+// The SSH settings are not compared, as they do not change the cluster.
+func DiffPlans(applied, current *Plan) []PlanChange {
+	changes := []PlanChange{}
+	for _, s := range planSettings {
+		was, is := s.value(applied), s.value(current)
+		if was == is {
+			continue
+		}
+		c := PlanChange{Field: s.field, Kind: PlanChangeChanged, Old: was, New: is, Reason: appliedByInstall}
+		if s.destructive != "" {
+			c.Destructive = true
+			c.Reason = s.destructive
+		}
+		if s.secret {
+			c.Old, c.New = "", ""
+		}
+		changes = append(changes, c)
+	}
+	groups := []struct {
+		role             string
+		applied, current []Node
+	}{
+		{etcdRole, applied.Etcd.Nodes, current.Etcd.Nodes},
+		{masterRole, applied.Master.Nodes, current.Master.Nodes},
+		{workerRole, applied.Worker.Nodes, current.Worker.Nodes},
+		{ingressRole, applied.Ingress.Nodes, current.Ingress.Nodes},
+		{storageRole, applied.Storage.Nodes, current.Storage.Nodes},
+	}
+	for _, g := range groups {
+		changes = append(changes, diffNodes(g.role, g.applied, g.current)...)
+	}
+	return changes
+}
+
+// returns the nodes of the group that were added, removed or readdressed
+func diffNodes(role string, applied, current []Node) []PlanChange {
+	field := role + ".nodes"
+	changes := []PlanChange{}
+	appliedNodes := map[string]Node{}
+	for _, n := range applied {
+		appliedNodes[n.Host] = n
+	}
+	currentNodes := map[string]bool{}
+	for _, n := range current {
+		currentNodes[n.Host] = true
+		old, ok := appliedNodes[n.Host]
+		if !ok {
+			c := PlanChange{Field: field, Kind: PlanChangeAdded, New: nodeDescription(n), Reason: appliedByInstall}
+			if role == etcdRole {
+				c.Destructive = true
+				c.Reason = "the node would not join the existing etcd clusters, add it with \"kismatic install add-node --role etcd\""
+			}
+			changes = append(changes, c)
+			continue
+		}
+		if old.IP != n.IP || old.InternalIP != n.InternalIP {
+			changes = append(changes, PlanChange{
+				Field:       field,
+				Kind:        PlanChangeChanged,
+				Old:         nodeDescription(old),
+				New:         nodeDescription(n),
+				Destructive: true,
+				Reason:      "the certificates and configuration of the cluster reference the addresses of the node",
+			})
+		}
+	}
+	for _, n := range applied {
+		if !currentNodes[n.Host] {
+			changes = append(changes, PlanChange{
+				Field:       field,
+				Kind:        PlanChangeRemoved,
+				Old:         nodeDescription(n),
+				Destructive: true,
+				Reason:      "applying the plan does not remove the node from the cluster, remove it with \"kismatic install remove-node\"",
+			})
+		}
+	}
+	return changes
+}
+
+func nodeDescription(n Node) string {
+	if n.InternalIP != "" && n.InternalIP != n.IP {
+		return fmt.Sprintf("%s (%s, %s)", n.Host, n.IP, n.InternalIP)
+	}
+	return fmt.Sprintf("%s (%s)", n.Host, n.IP)
+}
@@ -0,0 +1,132 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// records the plan and progress of a run in the runs directory
+func mustWriteRun(t *testing.T, runsDir, op, timestamp string, p *Plan, progress *RunProgress) {
+	runDir := filepath.Join(runsDir, op, timestamp)
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatalf("error creating run directory: %v", err)
+	}
+	fp := FilePlanner{File: filepath.Join(runDir, "kismatic-cluster.yaml")}
+	if err := fp.Write(p); err != nil {
+		t.Fatalf("error writing plan: %v", err)
+	}
+	if progress != nil {
+		if err := newProgressTracker(runDir, *progress).write(); err != nil {
+			t.Fatalf("error writing progress: %v", err)
+		}
+	}
+}
+
+// records the ansible log of a run, with the play recap of a successful or failed run
+func mustWriteRunLog(t *testing.T, runsDir, op, timestamp string, failed bool) {
+	recap := "worker                     : ok=10   changed=2    unreachable=0    failed=0"
+	if failed {
+		recap = "etcd03                     : ok=3    changed=0    unreachable=0    failed=1"
+	}
+	log := "2017-01-01 10:00:01.000+0000 - PLAY RECAP *********\n2017-01-01 10:00:02.000+0000 - " + recap + "\n"
+	mustWriteFile(t, filepath.Join(runsDir, op, timestamp, "ansible.log"), log)
+}
+
+func TestLastAppliedPlan(t *testing.T) {
+	runsDir := mustGetTempDir(t)
+	defer os.RemoveAll(runsDir)
+
+	p, runDir, err := LastAppliedPlan(runsDir)
+	if err != nil || p != nil || runDir != "" {
+		t.Fatalf("expected no applied plan without runs, but got %v %q %v", p, runDir, err)
+	}
+
+	installed := getPlan()
+	installed.Cluster.Name = "installed"
+	mustWriteRun(t, runsDir, "install", "2017-01-01-10-00-00", installed, &RunProgress{Complete: true})
+	withWorker := getPlan()
+	withWorker.Cluster.Name = "with-worker"
+	mustWriteRun(t, runsDir, "add-worker", "2017-02-01-10-00-00", withWorker, nil)
+	mustWriteRunLog(t, runsDir, "add-worker", "2017-02-01-10-00-00", false)
+	// The failed installation and the installation without progress were not applied
+	failed := getPlan()
+	failed.Cluster.Name = "failed"
+	mustWriteRun(t, runsDir, "install", "2017-03-01-10-00-00", failed, &RunProgress{CompletedPlays: 2})
+	mustWriteRun(t, runsDir, "install", "2017-04-01-10-00-00", failed, nil)
+	// Other runs do not record the applied plan
+	mustWriteRun(t, runsDir, "upgrade", "2017-05-01-10-00-00", failed, nil)
+	// The plan of a failed or interrupted addition of a node was not applied
+	mustWriteRun(t, runsDir, "add-node", "2017-06-01-10-00-00", failed, nil)
+	mustWriteRunLog(t, runsDir, "add-node", "2017-06-01-10-00-00", true)
+	mustWriteRun(t, runsDir, "add-node", "2017-07-01-10-00-00", failed, nil)
+
+	p, runDir, err = LastAppliedPlan(runsDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p == nil || p.Cluster.Name != "with-worker" {
+		t.Errorf("expected the plan of the add-worker run, but got %+v", p)
+	}
+	if expected := filepath.Join(runsDir, "add-worker", "2017-02-01-10-00-00"); runDir != expected {
+		t.Errorf("expected run directory %q, but got %q", expected, runDir)
+	}
+}
+
+func TestDiffPlans(t *testing.T) {
+	applied := getPlan()
+	applied.Cluster.AdminPassword = "secret"
+	applied.Cluster.Networking.PodCIDRBlock = "172.16.0.0/16"
+
+	current := getPlan()
+	current.Cluster.AdminPassword = "changed"
+	current.Cluster.Networking.PodCIDRBlock = "172.17.0.0/16"
+	current.DockerRegistry.Address = "registry.example.com"
+	current.Worker.Nodes = []Node{{Host: "worker2", IP: "10.0.0.2"}}
+	current.Etcd.Nodes = append(current.Etcd.Nodes, Node{Host: "etcd2", IP: "10.0.0.3"})
+	current.Master.Nodes[0].InternalIP = "10.0.0.4"
+
+	changes := DiffPlans(applied, current)
+	expected := []PlanChange{
+		{Field: "cluster.admin_password", Kind: PlanChangeChanged},
+		{Field: "cluster.networking.pod_cidr_block", Kind: PlanChangeChanged, Old: "172.16.0.0/16", New: "172.17.0.0/16", Destructive: true},
+		{Field: "docker_registry.address", Kind: PlanChangeChanged, New: "registry.example.com"},
+		{Field: "etcd.nodes", Kind: PlanChangeAdded, New: "etcd2 (10.0.0.3)", Destructive: true},
+		{Field: "master.nodes", Kind: PlanChangeChanged, Old: "master (99.99.99.99, 88.88.88.88)", New: "master (99.99.99.99, 10.0.0.4)", Destructive: true},
+		{Field: "worker.nodes", Kind: PlanChangeAdded, New: "worker2 (10.0.0.2)"},
+		{Field: "worker.nodes", Kind: PlanChangeRemoved, Old: "worker (99.99.99.99, 88.88.88.88)", Destructive: true},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, but got %+v", len(expected), changes)
+	}
+	for i, e := range expected {
+		c := changes[i]
+		if c.Field != e.Field || c.Kind != e.Kind || c.Old != e.Old || c.New != e.New || c.Destructive != e.Destructive {
+			t.Errorf("expected change %+v, but got %+v", e, c)
+		}
+		if c.Reason == "" {
+			t.Errorf("expected a reason for the change of %s", c.Field)
+		}
+	}
+	if d := (PlanDiff{Changes: changes}).Destructive(); len(d) != 4 {
+		t.Errorf("expected 4 destructive changes, but got %+v", d)
+	}
+	if changes := DiffPlans(applied, applied); len(changes) != 0 {
+		t.Errorf("expected no changes to the same plan, but got %+v", changes)
+	}
+}
+
+func TestDiffLastAppliedPlanNeverApplied(t *testing.T) {
+	runsDir := mustGetTempDir(t)
+	defer os.RemoveAll(runsDir)
+	mustWriteRun(t, runsDir, "install", "2017-01-01-10-00-00", getPlan(), &RunProgress{CompletedPlays: 1})
+	p := getPlan()
+	p.Cluster.Networking.PodCIDRBlock = "172.17.0.0/16"
+	diff, err := DiffLastAppliedPlan(p, runsDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff.RunDirectory != "" || len(diff.Changes) != 0 {
+		t.Errorf("expected no changes when the plan was never applied, but got %+v", diff)
+	}
+}
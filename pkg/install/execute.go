@@ -2,9 +2,11 @@ package install
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -22,6 +24,8 @@ import (
 // environment defined in the plan file
 type PreFlightExecutor interface {
 	RunPreFlightCheck(*Plan) error
+	// RunDirectories returns the directories of the runs performed by the executor
+	RunDirectories() []string
 }
 
 // The Executor will carry out the installation plan
@@ -30,8 +34,17 @@ type Executor interface {
 	Install(p *Plan) error
 	RunSmokeTest(*Plan) error
 	AddWorker(*Plan, Node) (*Plan, error)
+	AddNode(p *Plan, node Node, role string) (*Plan, error)
+	RemoveNode(*Plan, Node) (*Plan, error)
 	RunTask(string, *Plan) error
 	AddVolume(*Plan, StorageVolume) error
+	CreateBackup(*Plan) (*Backup, error)
+	RestoreBackup(*Plan, Backup) error
+	Upgrade(*Plan) error
+	Reset(p *Plan, limit []string) error
+	ResumeInstall(*Plan) error
+	RotateCertificates(*Plan, CertificateRotation) error
+	CreateUserCredentials(p *Plan, user string, groups []string) (*UserIdentity, error)
 }
 
 // ExecutorOptions are used to configure the executor
@@ -45,12 +58,26 @@ type ExecutorOptions struct {
 	// RestartServices determines whether the cluster services should be
 	// restarted during the installation.
 	RestartServices bool
-	// OutputFormat sets the format of the executor
+	// OutputFormat sets the format of the executor. Options are "simple" and "raw"
+	// for human-readable output, and "json" for one JSON object per line.
 	OutputFormat string
 	// Verbose output from the executor
 	Verbose bool
 	// RunsDirectory is where information about installation runs is kept
 	RunsDirectory string
+	// BackupsDirectory is where backups of the etcd clusters are kept
+	BackupsDirectory string
+	// Timeout is the maximum duration of a playbook run. There is no limit if zero.
+	Timeout time.Duration
+	// TaskTimeout is the maximum duration of a single task of a playbook run.
+	// There is no limit if zero.
+	TaskTimeout time.Duration
+	// JUnitReportDirectory is where the JUnit XML reports of the pre-flight checks
+	// and smoke test are written. No reports are written if empty.
+	JUnitReportDirectory string
+	// Context of the playbook runs. Running playbooks are aborted when
+	// the context is canceled. The runs can't be canceled if nil.
+	Context context.Context
 }
 
 // NewExecutor returns an executor for performing installations according to the installation plan.
@@ -63,16 +90,17 @@ func NewExecutor(stdout io.Writer, errOut io.Writer, options ExecutorOptions) (E
 	if options.RunsDirectory == "" {
 		options.RunsDirectory = "./runs"
 	}
+	if options.BackupsDirectory == "" {
+		options.BackupsDirectory = "./backups"
+	}
 
 	// Setup the console output format
-	var outFormat ansible.OutputFormat
-	switch options.OutputFormat {
-	case "raw":
-		outFormat = ansible.RawFormat
-	case "simple":
-		outFormat = ansible.JSONLinesFormat
-	default:
-		return nil, fmt.Errorf("Output format %q is not supported", options.OutputFormat)
+	outFormat, jsonOut, err := consoleOutput(options.OutputFormat, stdout)
+	if err != nil {
+		return nil, err
+	}
+	if jsonOut != nil {
+		stdout = ioutil.Discard
 	}
 	certsDir := filepath.Join(options.GeneratedAssetsDirectory, "keys")
 	pki := &LocalPKI{
@@ -80,11 +108,12 @@ func NewExecutor(stdout io.Writer, errOut io.Writer, options ExecutorOptions) (E
 		CAConfigFile:            filepath.Join(ansibleDir, "playbooks", "tls", "ca-config.json"),
 		CASigningProfile:        "kubernetes",
 		GeneratedCertsDirectory: certsDir,
-		Log: stdout,
+		Log:                     stdout,
 	}
 	return &ansibleExecutor{
 		options:             options,
 		stdout:              stdout,
+		jsonOut:             jsonOut,
 		consoleOutputFormat: outFormat,
 		ansibleDir:          ansibleDir,
 		certsDir:            certsDir,
@@ -99,24 +128,39 @@ func NewPreFlightExecutor(stdout io.Writer, errOut io.Writer, options ExecutorOp
 		options.RunsDirectory = "./runs"
 	}
 	// Setup the console output format
-	var outFormat ansible.OutputFormat
-	switch options.OutputFormat {
-	case "raw":
-		outFormat = ansible.RawFormat
-	case "simple":
-		outFormat = ansible.JSONLinesFormat
-	default:
-		return nil, fmt.Errorf("Output format %q is not supported", options.OutputFormat)
+	outFormat, jsonOut, err := consoleOutput(options.OutputFormat, stdout)
+	if err != nil {
+		return nil, err
+	}
+	if jsonOut != nil {
+		stdout = ioutil.Discard
 	}
 
 	return &ansibleExecutor{
 		options:             options,
 		stdout:              stdout,
+		jsonOut:             jsonOut,
 		consoleOutputFormat: outFormat,
 		ansibleDir:          ansibleDir,
 	}, nil
 }
 
+// returns the format of the ansible output for the given output format. When the
+// output format is JSON, the returned writer is where the JSON objects are written.
+func consoleOutput(outputFormat string, stdout io.Writer) (ansible.OutputFormat, io.Writer, error) {
+	switch outputFormat {
+	case "raw":
+		return ansible.RawFormat, nil, nil
+	case "simple":
+		return ansible.JSONLinesFormat, nil, nil
+	case "json":
+		// The ansible output is only written to the log file
+		return ansible.JSONLinesFormat, stdout, nil
+	default:
+		return "", nil, fmt.Errorf("Output format %q is not supported", outputFormat)
+	}
+}
+
 type ansibleExecutor struct {
 	options             ExecutorOptions
 	stdout              io.Writer
@@ -125,8 +169,16 @@ type ansibleExecutor struct {
 	certsDir            string
 	pki                 PKI
 
+	// jsonOut is where the JSON objects are written when the output format is JSON.
+	// Human-readable output is discarded in this case.
+	jsonOut io.Writer
+
 	// Hook for testing purposes.. default implementation is used at runtime
 	runnerExplainerFactory func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error)
+	// Hook for testing purposes.. default implementation is used at runtime
+	versionLister func(*Plan) ([]NodeVersion, error)
+	// the run directories created by the executor, in order
+	runDirectories []string
 }
 
 // Install the cluster according to the installation plan
@@ -162,7 +214,9 @@ func (ae *ansibleExecutor) Install(p *Plan) error {
 	util.PrintHeader(ae.stdout, "Installing Cluster", '=')
 	playbook := "kubernetes.yaml"
 	eventExplainer := &explain.DefaultEventExplainer{}
-	if err = ae.runPlaybookWithExplainer(playbook, eventExplainer, inventory, *cc, ansibleLogFile, runDirectory); err != nil {
+	// Progress is recorded so that a failed installation can be resumed
+	tracker := newProgressTracker(runDirectory, RunProgress{Playbook: playbook})
+	if err = ae.runPlaybookWithProgress(playbook, tracker, eventExplainer, inventory, *cc, ansibleLogFile, runDirectory); err != nil {
 		return err
 	}
 	return nil
@@ -192,6 +246,7 @@ func (ae *ansibleExecutor) buildInstallExtraVars(p *Plan) (*ansible.ClusterCatal
 		EnableCalicoPolicy:        p.Cluster.Networking.PolicyEnabled,
 		EnablePackageInstallation: p.Cluster.AllowPackageInstallation,
 		KuberangPath:              filepath.Join("kuberang", "linux", "amd64", "kuberang"),
+		KismaticVersion:           kismaticVersion.String(),
 	}
 
 	// Setup FQDN or default to first master
@@ -263,7 +318,8 @@ func (ae *ansibleExecutor) RunSmokeTest(p *Plan) error {
 	explainer := &explain.PreflightEventExplainer{
 		DefaultExplainer: &explain.DefaultEventExplainer{},
 	}
-	if err = ae.runPlaybookWithExplainer(playbook, explainer, inventory, *cc, ansibleLogFile, runDirectory); err != nil {
+	recorder := newJUnitRecorder("smoketest", true)
+	if err = ae.runPlaybookWithReport(playbook, recorder, ae.junitReportFile("smoketest.xml"), explainer, inventory, *cc, ansibleLogFile, runDirectory); err != nil {
 		return fmt.Errorf("error running smoketest: %v", err)
 	}
 	return nil
@@ -302,13 +358,17 @@ func (ae *ansibleExecutor) RunPreFlightCheck(p *Plan) error {
 	cc.KismaticPreflightCheckerLinux = filepath.Join("inspector", "linux", "amd64", "kismatic-inspector")
 	cc.KismaticPreflightCheckerLocal = filepath.Join(pwd, "ansible", "playbooks", "inspector", runtime.GOOS, runtime.GOARCH, "kismatic-inspector")
 	cc.EnablePackageInstallation = p.Cluster.AllowPackageInstallation
+	if bastion := p.Cluster.SSH.GetBastion(); bastion != nil {
+		cc.KismaticPreflightCheckerBastionArgs = fmt.Sprintf("--ssh-bastion %s --ssh-bastion-user %q --ssh-bastion-key %q", net.JoinHostPort(bastion.Address, strconv.Itoa(bastion.Port)), bastion.User, bastion.Key)
+	}
 
 	// run the pre-flight playbook with pre-flight explainer
 	playbook := "preflight.yaml"
 	explainer := &explain.PreflightEventExplainer{
 		DefaultExplainer: &explain.DefaultEventExplainer{},
 	}
-	if err = ae.runPlaybookWithExplainer(playbook, explainer, inventory, *cc, ansibleLogFile, runDirectory); err != nil {
+	recorder := newJUnitRecorder("preflight", false)
+	if err = ae.runPlaybookWithReport(playbook, recorder, ae.junitReportFile("preflight.xml"), explainer, inventory, *cc, ansibleLogFile, runDirectory); err != nil {
 		return fmt.Errorf("error running preflight: %v", err)
 	}
 	return nil
@@ -412,9 +472,15 @@ func (ae *ansibleExecutor) createRunDirectory(runName string) (string, error) {
 	if err := os.MkdirAll(runDirectory, 0777); err != nil {
 		return "", fmt.Errorf("error creating directory: %v", err)
 	}
+	ae.runDirectories = append(ae.runDirectories, runDirectory)
 	return runDirectory, nil
 }
 
+// RunDirectories returns the directories of the runs performed by the executor, in order
+func (ae *ansibleExecutor) RunDirectories() []string {
+	return ae.runDirectories
+}
+
 func (ae *ansibleExecutor) generateTLSAssets(p *Plan) error {
 	if err := os.MkdirAll(ae.certsDir, 0777); err != nil {
 		return fmt.Errorf("error creating directory %s for storing TLS assets: %v", ae.certsDir, err)
@@ -422,13 +488,17 @@ func (ae *ansibleExecutor) generateTLSAssets(p *Plan) error {
 
 	// Generate cluster Certificate Authority
 	util.PrintHeader(ae.stdout, "Configuring Certificates", '=')
-	ca, err := ae.pki.GenerateClusterCA(p)
+	pki, err := ae.planPKI(p)
+	if err != nil {
+		return err
+	}
+	ca, err := pki.GenerateClusterCA(p)
 	if err != nil {
 		return fmt.Errorf("error generating CA for the cluster: %v", err)
 	}
 
 	// Generate node and user certificates
-	err = ae.pki.GenerateClusterCertificates(p, ca, []string{"admin"})
+	err = pki.GenerateClusterCertificates(p, ca, []string{"admin"})
 	if err != nil {
 		return fmt.Errorf("error generating certificates for the cluster: %v", err)
 	}
@@ -436,6 +506,23 @@ func (ae *ansibleExecutor) generateTLSAssets(p *Plan) error {
 	return nil
 }
 
+// returns the PKI that issues the certificates of the cluster, which is
+// the local PKI unless the plan configures an external signer
+func (ae *ansibleExecutor) planPKI(p *Plan) (PKI, error) {
+	if p.Cluster.Certificates.Signer.Type != "vault" {
+		return ae.pki, nil
+	}
+	return NewVaultPKI(p.Cluster.Certificates.Signer, p.Cluster.Certificates.Expiry, os.Getenv("VAULT_TOKEN"), ae.certsDir, ae.stdout)
+}
+
+// returns the context of the playbook runs
+func (ae *ansibleExecutor) runContext() context.Context {
+	if ae.options.Context == nil {
+		return context.Background()
+	}
+	return ae.options.Context
+}
+
 func (ae *ansibleExecutor) runPlaybookWithExplainer(playbook string, eventExplainer explain.AnsibleEventExplainer, inv ansible.Inventory, cc ansible.ClusterCatalog, ansibleLog io.Writer, runDirectory string) error {
 	// Setup sinks for explainer and ansible stdout
 	runner, explainer, err := ae.getAnsibleRunnerAndExplainer(eventExplainer, ansibleLog, runDirectory)
@@ -444,7 +531,7 @@ func (ae *ansibleExecutor) runPlaybookWithExplainer(playbook string, eventExplai
 	}
 
 	// Start running ansible with the given playbook
-	eventStream, err := runner.StartPlaybook(playbook, inv, cc)
+	eventStream, err := runner.StartPlaybook(ae.runContext(), playbook, inv, cc)
 	if err != nil {
 		return fmt.Errorf("error running ansible playbook: %v", err)
 	}
@@ -476,43 +563,53 @@ func (ae *ansibleExecutor) getAnsibleRunnerAndExplainer(explainer explain.Ansibl
 	}
 
 	// Send stdout and stderr to ansibleOut
-	runner, err := ansible.NewRunner(ansibleOut, ansibleOut, ae.ansibleDir, runDirectory)
+	runnerOpts := ansible.RunnerOptions{
+		Timeout:     ae.options.Timeout,
+		TaskTimeout: ae.options.TaskTimeout,
+	}
+	runner, err := ansible.NewRunner(ansibleOut, ansibleOut, ae.ansibleDir, runDirectory, runnerOpts)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error creating ansible runner: %v", err)
 	}
 
+	if ae.jsonOut != nil {
+		// The events are written as JSON objects instead of being explained
+		explainerOut = ae.jsonOut
+		explainer = &explain.JSONEventExplainer{}
+	}
+
 	streamExplainer := &explain.AnsibleEventStreamExplainer{
 		Out:            explainerOut,
 		Verbose:        ae.options.Verbose,
 		EventExplainer: explainer,
 	}
 
-	return runner, streamExplainer, nil
+	return sshAuthRunner{runner}, streamExplainer, nil
 }
 
 func buildInventoryFromPlan(p *Plan) ansible.Inventory {
 	etcdNodes := []ansible.Node{}
 	for _, n := range p.Etcd.Nodes {
-		etcdNodes = append(etcdNodes, installNodeToAnsibleNode(&n, &p.Cluster.SSH))
+		etcdNodes = append(etcdNodes, installNodeToAnsibleNode(&n, p.GetNodeSSHConfig(n)))
 	}
 	masterNodes := []ansible.Node{}
 	for _, n := range p.Master.Nodes {
-		masterNodes = append(masterNodes, installNodeToAnsibleNode(&n, &p.Cluster.SSH))
+		masterNodes = append(masterNodes, installNodeToAnsibleNode(&n, p.GetNodeSSHConfig(n)))
 	}
 	workerNodes := []ansible.Node{}
 	for _, n := range p.Worker.Nodes {
-		workerNodes = append(workerNodes, installNodeToAnsibleNode(&n, &p.Cluster.SSH))
+		workerNodes = append(workerNodes, installNodeToAnsibleNode(&n, p.GetNodeSSHConfig(n)))
 	}
 	ingressNodes := []ansible.Node{}
 	if p.Ingress.Nodes != nil {
 		for _, n := range p.Ingress.Nodes {
-			ingressNodes = append(ingressNodes, installNodeToAnsibleNode(&n, &p.Cluster.SSH))
+			ingressNodes = append(ingressNodes, installNodeToAnsibleNode(&n, p.GetNodeSSHConfig(n)))
 		}
 	}
 	storageNodes := []ansible.Node{}
 	if p.Storage.Nodes != nil {
 		for _, n := range p.Storage.Nodes {
-			storageNodes = append(storageNodes, installNodeToAnsibleNode(&n, &p.Cluster.SSH))
+			storageNodes = append(storageNodes, installNodeToAnsibleNode(&n, p.GetNodeSSHConfig(n)))
 		}
 	}
 
@@ -545,8 +642,8 @@ func buildInventoryFromPlan(p *Plan) ansible.Inventory {
 }
 
 // Converts plan node to ansible node
-func installNodeToAnsibleNode(n *Node, s *SSHConfig) ansible.Node {
-	return ansible.Node{
+func installNodeToAnsibleNode(n *Node, s SSHConfig) ansible.Node {
+	node := ansible.Node{
 		Host:          n.Host,
 		PublicIP:      n.IP,
 		InternalIP:    n.InternalIP,
@@ -554,6 +651,11 @@ func installNodeToAnsibleNode(n *Node, s *SSHConfig) ansible.Node {
 		SSHUser:       s.User,
 		SSHPort:       s.Port,
 	}
+	if bastion := s.GetBastion(); bastion != nil {
+		node.SSHProxyCommand = bastion.ProxyCommand()
+		node.SSHProxyPrivateKey = bastion.Key
+	}
+	return node
 }
 
 // Prepend each line of the incoming stream with a timestamp
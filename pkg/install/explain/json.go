@@ -0,0 +1,185 @@
+package explain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+// The status of plays, tasks and host results in the JSON output
+const (
+	jsonStatusOK          = "ok"
+	jsonStatusFailed      = "failed"
+	jsonStatusIgnored     = "ignored"
+	jsonStatusSkipped     = "skipped"
+	jsonStatusUnreachable = "unreachable"
+)
+
+// JSONPlay is written when a play ends
+type JSONPlay struct {
+	Type            string  `json:"type"`
+	Name            string  `json:"name"`
+	Status          string  `json:"status"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// JSONTask is written when a task ends
+type JSONTask struct {
+	Type            string  `json:"type"`
+	Play            string  `json:"play"`
+	Name            string  `json:"name"`
+	Status          string  `json:"status"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// JSONResult is written for the result of a task on a host
+type JSONResult struct {
+	Type    string `json:"type"`
+	Play    string `json:"play"`
+	Task    string `json:"task"`
+	Host    string `json:"host"`
+	Status  string `json:"status"`
+	Item    string `json:"item,omitempty"`
+	Message string `json:"message,omitempty"`
+	Stdout  string `json:"stdout,omitempty"`
+	Stderr  string `json:"stderr,omitempty"`
+}
+
+// JSONEventExplainer explains the ansible events as JSON objects, one per line.
+// An object is written for the result of each task on each host, and for each
+// task and play when they end.
+type JSONEventExplainer struct {
+	play       string
+	playStart  time.Time
+	playFailed bool
+	task       string
+	taskStart  time.Time
+	taskFailed bool
+
+	// Hook for testing purposes.. default implementation is used at runtime
+	now func() time.Time
+}
+
+// ExplainEvent returns the JSON objects for the given event. Verbose output
+// has no effect, the results of all hosts are always returned.
+func (explainer *JSONEventExplainer) ExplainEvent(e ansible.Event, verbose bool) string {
+	objs := []interface{}{}
+	switch event := e.(type) {
+	case *ansible.PlayStartEvent:
+		// On a play start the previous play ends
+		objs = append(objs, explainer.endPlay()...)
+		explainer.play = event.Name
+		explainer.playStart = explainer.currentTime()
+		explainer.playFailed = false
+	case *ansible.TaskStartEvent:
+		objs = append(objs, explainer.endTask()...)
+		explainer.startTask(event.Name)
+	case *ansible.HandlerTaskStartEvent:
+		objs = append(objs, explainer.endTask()...)
+		explainer.startTask(event.Name)
+	case *ansible.PlaybookEndEvent:
+		objs = append(objs, explainer.endPlay()...)
+	case *ansible.RunnerOKEvent:
+		objs = append(objs, explainer.result(event.Host, jsonStatusOK, "", "", "", ""))
+	case *ansible.RunnerItemOKEvent:
+		objs = append(objs, explainer.result(event.Host, jsonStatusOK, event.Result.Item, "", "", ""))
+	case *ansible.RunnerSkippedEvent:
+		objs = append(objs, explainer.result(event.Host, jsonStatusSkipped, "", "", "", ""))
+	case *ansible.RunnerUnreachableEvent:
+		explainer.fail()
+		objs = append(objs, explainer.result(event.Host, jsonStatusUnreachable, "", event.Result.Message, "", ""))
+	case *ansible.RunnerFailedEvent:
+		status := jsonStatusIgnored
+		if !event.IgnoreErrors {
+			status = jsonStatusFailed
+			explainer.fail()
+		}
+		objs = append(objs, explainer.result(event.Host, status, "", event.Result.Message, event.Result.Stdout, event.Result.Stderr))
+	case *ansible.RunnerItemFailedEvent:
+		status := jsonStatusIgnored
+		if !event.IgnoreErrors {
+			status = jsonStatusFailed
+			explainer.fail()
+		}
+		objs = append(objs, explainer.result(event.Host, status, event.Result.Item, event.Result.Message, event.Result.Stdout, event.Result.Stderr))
+	}
+	out := ""
+	for _, o := range objs {
+		b, err := json.Marshal(o)
+		if err != nil {
+			continue
+		}
+		out = out + string(b) + "\n"
+	}
+	return out
+}
+
+func (explainer *JSONEventExplainer) currentTime() time.Time {
+	if explainer.now != nil {
+		return explainer.now()
+	}
+	return time.Now()
+}
+
+func (explainer *JSONEventExplainer) fail() {
+	explainer.playFailed = true
+	explainer.taskFailed = true
+}
+
+func (explainer *JSONEventExplainer) startTask(name string) {
+	explainer.task = name
+	explainer.taskStart = explainer.currentTime()
+	explainer.taskFailed = false
+}
+
+func (explainer *JSONEventExplainer) endTask() []interface{} {
+	if explainer.task == "" {
+		return nil
+	}
+	t := JSONTask{
+		Type:            "task",
+		Play:            explainer.play,
+		Name:            explainer.task,
+		Status:          status(explainer.taskFailed),
+		DurationSeconds: explainer.currentTime().Sub(explainer.taskStart).Seconds(),
+	}
+	explainer.task = ""
+	return []interface{}{t}
+}
+
+func (explainer *JSONEventExplainer) endPlay() []interface{} {
+	if explainer.play == "" {
+		return nil
+	}
+	objs := explainer.endTask()
+	p := JSONPlay{
+		Type:            "play",
+		Name:            explainer.play,
+		Status:          status(explainer.playFailed),
+		DurationSeconds: explainer.currentTime().Sub(explainer.playStart).Seconds(),
+	}
+	explainer.play = ""
+	return append(objs, p)
+}
+
+func (explainer *JSONEventExplainer) result(host, status, item, message, stdout, stderr string) JSONResult {
+	return JSONResult{
+		Type:    "result",
+		Play:    explainer.play,
+		Task:    explainer.task,
+		Host:    host,
+		Status:  status,
+		Item:    item,
+		Message: message,
+		Stdout:  stdout,
+		Stderr:  stderr,
+	}
+}
+
+func status(failed bool) string {
+	if failed {
+		return jsonStatusFailed
+	}
+	return jsonStatusOK
+}
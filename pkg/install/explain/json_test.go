@@ -0,0 +1,128 @@
+package explain
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func playStart(name string) ansible.Event {
+	e := &ansible.PlayStartEvent{}
+	e.Name = name
+	return e
+}
+
+func taskStart(name string) ansible.Event {
+	e := &ansible.TaskStartEvent{}
+	e.Name = name
+	return e
+}
+
+func handlerTaskStart(name string) ansible.Event {
+	e := &ansible.HandlerTaskStartEvent{}
+	e.Name = name
+	return e
+}
+
+func TestJSONEventExplainer(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	elapsed := 0
+	explainer := &JSONEventExplainer{
+		now: func() time.Time { return start.Add(time.Duration(elapsed) * time.Second) },
+	}
+
+	ok := &ansible.RunnerOKEvent{}
+	ok.Host = "etcd01"
+	itemFailed := &ansible.RunnerItemFailedEvent{}
+	itemFailed.Host = "etcd02"
+	itemFailed.Result.Item = "etcd"
+	itemFailed.Result.Message = "package not found"
+	itemFailed.Result.Stdout = "out"
+	itemFailed.Result.Stderr = "err"
+	skipped := &ansible.RunnerSkippedEvent{}
+	skipped.Host = "etcd01"
+	ignored := &ansible.RunnerFailedEvent{}
+	ignored.Host = "etcd02"
+	ignored.IgnoreErrors = true
+	ignored.Result.Message = "ignored failure"
+	unreachable := &ansible.RunnerUnreachableEvent{}
+	unreachable.Host = "master01"
+	unreachable.Result.Message = "connection refused"
+
+	events := []struct {
+		elapsed int
+		event   ansible.Event
+		out     []interface{}
+	}{
+		{0, playStart("etcd"), nil},
+		{0, taskStart("install"), nil},
+		{5, ok, []interface{}{
+			JSONResult{Type: "result", Play: "etcd", Task: "install", Host: "etcd01", Status: "ok"},
+		}},
+		{5, itemFailed, []interface{}{
+			JSONResult{Type: "result", Play: "etcd", Task: "install", Host: "etcd02", Status: "failed", Item: "etcd", Message: "package not found", Stdout: "out", Stderr: "err"},
+		}},
+		{10, taskStart("start"), []interface{}{
+			JSONTask{Type: "task", Play: "etcd", Name: "install", Status: "failed", DurationSeconds: 10},
+		}},
+		{12, skipped, []interface{}{
+			JSONResult{Type: "result", Play: "etcd", Task: "start", Host: "etcd01", Status: "skipped"},
+		}},
+		{12, ignored, []interface{}{
+			JSONResult{Type: "result", Play: "etcd", Task: "start", Host: "etcd02", Status: "ignored", Message: "ignored failure"},
+		}},
+		// A new play ends the current task and play
+		{15, playStart("master"), []interface{}{
+			JSONTask{Type: "task", Play: "etcd", Name: "start", Status: "ok", DurationSeconds: 5},
+			JSONPlay{Type: "play", Name: "etcd", Status: "failed", DurationSeconds: 15},
+		}},
+		{15, handlerTaskStart("restart"), nil},
+		{20, unreachable, []interface{}{
+			JSONResult{Type: "result", Play: "master", Task: "restart", Host: "master01", Status: "unreachable", Message: "connection refused"},
+		}},
+		{30, &ansible.PlaybookEndEvent{}, []interface{}{
+			JSONTask{Type: "task", Play: "master", Name: "restart", Status: "failed", DurationSeconds: 15},
+			JSONPlay{Type: "play", Name: "master", Status: "failed", DurationSeconds: 15},
+		}},
+	}
+	for i, e := range events {
+		elapsed = e.elapsed
+		expected := ""
+		for _, o := range e.out {
+			b, err := json.Marshal(o)
+			if err != nil {
+				t.Fatalf("error marshaling expected object: %v", err)
+			}
+			expected = expected + string(b) + "\n"
+		}
+		out := explainer.ExplainEvent(e.event, false)
+		if out != expected {
+			t.Errorf("event %d (%s): expected\n%s\nbut got\n%s", i, e.event.Type(), expected, out)
+		}
+	}
+}
+
+func TestJSONEventExplainerPlayWithoutTasks(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	elapsed := 0
+	explainer := &JSONEventExplainer{
+		now: func() time.Time { return start.Add(time.Duration(elapsed) * time.Second) },
+	}
+	explainer.ExplainEvent(playStart("etcd"), false)
+	elapsed = 2
+	out := explainer.ExplainEvent(&ansible.PlaybookEndEvent{}, false)
+	play := JSONPlay{}
+	if err := json.Unmarshal([]byte(out), &play); err != nil {
+		t.Fatalf("error decoding %q: %v", out, err)
+	}
+	expected := JSONPlay{Type: "play", Name: "etcd", Status: "ok", DurationSeconds: 2}
+	if play != expected {
+		t.Errorf("expected %+v, but got %+v", expected, play)
+	}
+	// The playbook end does not end the play twice
+	if out = explainer.ExplainEvent(&ansible.PlaybookEndEvent{}, false); out != "" {
+		t.Errorf("expected no output, but got %q", out)
+	}
+}
@@ -0,0 +1,239 @@
+package install
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/inspector/rule"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+)
+
+// how long to wait for the remaining events of a playbook run to be
+// recorded, once the playbook has exited
+const junitRecordTimeout = 5 * time.Second
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// junitRecorder records the results of a playbook run as a JUnit report,
+// with a test suite per host. The results of the inspector rules are recorded
+// as test cases. The results of other tasks are recorded when they fail, or
+// always if recordTasks is true.
+type junitRecorder struct {
+	sync.Mutex
+	className   string
+	recordTasks bool
+	hosts       []string
+	suites      map[string]*junitTestSuite
+	done        chan struct{}
+	doneOnce    sync.Once
+}
+
+func newJUnitRecorder(className string, recordTasks bool) *junitRecorder {
+	return &junitRecorder{
+		className:   className,
+		recordTasks: recordTasks,
+		suites:      map[string]*junitTestSuite{},
+		done:        make(chan struct{}),
+	}
+}
+
+// record returns a stream with the incoming events, after they have been
+// recorded in the report. Recording is done when the playbook ends, as the
+// incoming stream may not be closed until the run is cleaned up.
+func (jr *junitRecorder) record(in <-chan ansible.Event) <-chan ansible.Event {
+	out := make(chan ansible.Event)
+	go func() {
+		currentTask := ""
+		for e := range in {
+			switch event := e.(type) {
+			case *ansible.TaskStartEvent:
+				currentTask = event.Name
+			case *ansible.HandlerTaskStartEvent:
+				currentTask = event.Name
+			case *ansible.RunnerOKEvent:
+				if results, ok := ruleResults(event.Result.Stdout); ok {
+					jr.addRuleResults(event.Host, results)
+				} else if jr.recordTasks {
+					jr.addTestCase(event.Host, currentTask, nil)
+				}
+			case *ansible.RunnerItemOKEvent:
+				if jr.recordTasks {
+					jr.addTestCase(event.Host, fmt.Sprintf("%s (%s)", currentTask, event.Result.Item), nil)
+				}
+			case *ansible.RunnerFailedEvent:
+				if results, ok := ruleResults(event.Result.Stdout); ok {
+					jr.addRuleResults(event.Host, results)
+				} else if !event.IgnoreErrors {
+					jr.addTestCase(event.Host, currentTask, taskFailure(event.Result.Message, event.Result.Stdout, event.Result.Stderr))
+				}
+			case *ansible.RunnerItemFailedEvent:
+				if !event.IgnoreErrors {
+					name := fmt.Sprintf("%s (%s)", currentTask, event.Result.Item)
+					jr.addTestCase(event.Host, name, taskFailure(event.Result.Message, event.Result.Stdout, event.Result.Stderr))
+				}
+			case *ansible.RunnerUnreachableEvent:
+				jr.addTestCase(event.Host, currentTask, taskFailure(event.Result.Message, event.Result.Stdout, event.Result.Stderr))
+			case *ansible.PlaybookEndEvent:
+				jr.finish()
+			}
+			out <- e
+		}
+		close(out)
+		jr.finish()
+	}()
+	return out
+}
+
+func (jr *junitRecorder) finish() {
+	jr.doneOnce.Do(func() { close(jr.done) })
+}
+
+// wait until all the events have been recorded, or the timeout expires
+func (jr *junitRecorder) wait(timeout time.Duration) {
+	select {
+	case <-jr.done:
+	case <-time.After(timeout):
+	}
+}
+
+func (jr *junitRecorder) addRuleResults(host string, results []rule.Result) {
+	for _, r := range results {
+		var failure *junitFailure
+		if !r.Success {
+			failure = &junitFailure{Message: r.Error, Contents: r.Remediation}
+			if failure.Message == "" {
+				failure.Message = "check failed"
+			}
+		}
+		jr.addTestCase(host, r.Name, failure)
+	}
+}
+
+func (jr *junitRecorder) addTestCase(host, name string, failure *junitFailure) {
+	jr.Lock()
+	defer jr.Unlock()
+	suite, ok := jr.suites[host]
+	if !ok {
+		suite = &junitTestSuite{Name: host}
+		jr.suites[host] = suite
+		jr.hosts = append(jr.hosts, host)
+	}
+	suite.Tests++
+	if failure != nil {
+		suite.Failures++
+	}
+	suite.TestCases = append(suite.TestCases, junitTestCase{
+		Name:      name,
+		ClassName: fmt.Sprintf("%s.%s", jr.className, host),
+		Failure:   failure,
+	})
+}
+
+// write the JUnit XML report to the file
+func (jr *junitRecorder) write(file string) error {
+	jr.Lock()
+	defer jr.Unlock()
+	report := junitTestSuites{Suites: []junitTestSuite{}}
+	for _, h := range jr.hosts {
+		report.Suites = append(report.Suites, *jr.suites[h])
+	}
+	b, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling JUnit report: %v", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("error creating directory for JUnit report: %v", err)
+	}
+	if err = ioutil.WriteFile(file, append([]byte(xml.Header), b...), 0644); err != nil {
+		return fmt.Errorf("error writing JUnit report to %q: %v", file, err)
+	}
+	return nil
+}
+
+// runPlaybookWithReport runs the playbook, and writes the JUnit report of the run
+// to the report file, even if the playbook fails. No report is written if the
+// report file is empty.
+func (ae *ansibleExecutor) runPlaybookWithReport(playbook string, recorder *junitRecorder, reportFile string, eventExplainer explain.AnsibleEventExplainer, inv ansible.Inventory, cc ansible.ClusterCatalog, ansibleLog io.Writer, runDirectory string) error {
+	if reportFile == "" {
+		return ae.runPlaybookWithExplainer(playbook, eventExplainer, inv, cc, ansibleLog, runDirectory)
+	}
+	runner, explainer, err := ae.getAnsibleRunnerAndExplainer(eventExplainer, ansibleLog, runDirectory)
+	if err != nil {
+		return err
+	}
+	eventStream, err := runner.StartPlaybook(ae.runContext(), playbook, inv, cc)
+	if err != nil {
+		return fmt.Errorf("error running ansible playbook: %v", err)
+	}
+	go explainer.Explain(recorder.record(eventStream))
+	runErr := runner.WaitPlaybook()
+	recorder.wait(junitRecordTimeout)
+	if err = recorder.write(reportFile); err != nil && runErr == nil {
+		return err
+	}
+	if runErr != nil {
+		return fmt.Errorf("error running playbook: %v", runErr)
+	}
+	return nil
+}
+
+// returns the path to the JUnit report with the given name, or an empty
+// string if JUnit reports are disabled
+func (ae *ansibleExecutor) junitReportFile(name string) string {
+	if ae.options.JUnitReportDirectory == "" {
+		return ""
+	}
+	return filepath.Join(ae.options.JUnitReportDirectory, name)
+}
+
+// returns the inspector rule results contained in the output of a task
+func ruleResults(stdout string) ([]rule.Result, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(stdout), "[") {
+		return nil, false
+	}
+	results := []rule.Result{}
+	if err := json.Unmarshal([]byte(stdout), &results); err != nil || len(results) == 0 {
+		return nil, false
+	}
+	return results, true
+}
+
+func taskFailure(message, stdout, stderr string) *junitFailure {
+	if message == "" {
+		message = "task failed"
+	}
+	return &junitFailure{
+		Message:  message,
+		Contents: strings.TrimSpace(strings.Join([]string{stdout, stderr}, "\n")),
+	}
+}
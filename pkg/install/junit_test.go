@@ -0,0 +1,143 @@
+package install
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+)
+
+const junitTestEvents = `{"eventType":"PLAYBOOK_START", "eventData": {"name":"preflight.yaml", "count": 1}}
+{"eventType":"PLAY_START", "eventData": {"name":"Run pre-flight checks"}}
+{"eventType":"TASK_START", "eventData": {"name":"copy Kismatic Inspector to node"}}
+{"eventType":"RUNNER_OK", "eventData": {"host":"node1"}}
+{"eventType":"RUNNER_UNREACHABLE", "eventData": {"host":"node2", "result": {"msg": "SSH error"}}}
+{"eventType":"TASK_START", "eventData": {"name":"run pre-flight checks using Kismatic Inspector"}}
+{"eventType":"RUNNER_FAILED", "eventData": {"host":"node1", "result": {"stdout": "[{\"Name\":\"Port 80 is available\",\"Success\":true},{\"Name\":\"Docker is installed\",\"Success\":false,\"Error\":\"docker not found\"}]"}}}
+{"eventType":"PLAYBOOK_END", "eventData": {"name":"preflight.yaml"}}
+`
+
+func readJUnitReport(t *testing.T, file string) junitTestSuites {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("error reading JUnit report: %v", err)
+	}
+	report := junitTestSuites{}
+	if err = xml.Unmarshal(b, &report); err != nil {
+		t.Fatalf("error unmarshalling JUnit report: %v", err)
+	}
+	return report
+}
+
+func TestJUnitRecorderRuleResults(t *testing.T) {
+	recorder := newJUnitRecorder("preflight", false)
+	for range recorder.record(ansible.EventStream(bytes.NewBufferString(junitTestEvents))) {
+	}
+	file := filepath.Join(mustGetTempDir(t), "reports", "preflight.xml")
+	if err := recorder.write(file); err != nil {
+		t.Fatalf("unexpected error writing report: %v", err)
+	}
+	report := readJUnitReport(t, file)
+	if len(report.Suites) != 2 {
+		t.Fatalf("expected a test suite per host, but got %+v", report.Suites)
+	}
+	// Test suites are in the order in which the hosts reported results
+	node1 := report.Suites[1]
+	if node1.Name != "node1" || node1.Tests != 2 || node1.Failures != 1 {
+		t.Errorf("expected 2 rule tests with 1 failure for node1, but got %+v", node1)
+	}
+	if node1.TestCases[0].Failure != nil {
+		t.Errorf("expected successful rule to pass, but got %+v", node1.TestCases[0])
+	}
+	failure := node1.TestCases[1].Failure
+	if failure == nil || failure.Message != "docker not found" {
+		t.Errorf("expected rule failure with the rule error, but got %+v", node1.TestCases[1])
+	}
+	node2 := report.Suites[0]
+	if node2.Name != "node2" || node2.Failures != 1 || node2.TestCases[0].Failure.Message != "SSH error" {
+		t.Errorf("expected unreachable failure for node2, but got %+v", node2)
+	}
+}
+
+func TestJUnitRecorderRecordTasks(t *testing.T) {
+	recorder := newJUnitRecorder("smoketest", true)
+	for range recorder.record(ansible.EventStream(bytes.NewBufferString(junitTestEvents))) {
+	}
+	file := filepath.Join(mustGetTempDir(t), "smoketest.xml")
+	if err := recorder.write(file); err != nil {
+		t.Fatalf("unexpected error writing report: %v", err)
+	}
+	report := readJUnitReport(t, file)
+	node1 := report.Suites[0]
+	if node1.Tests != 3 || node1.TestCases[0].Name != "copy Kismatic Inspector to node" {
+		t.Errorf("expected successful task to be recorded, but got %+v", node1)
+	}
+}
+
+// runner that fails once the playbook has started
+type failedPlaybookRunner struct {
+	*fakeRunner
+}
+
+func (r failedPlaybookRunner) WaitPlaybook() error { return errors.New("playbook failed") }
+
+func TestRunPlaybookWithReportWritesReportOnFailure(t *testing.T) {
+	events := make(chan ansible.Event)
+	go func() {
+		for e := range ansible.EventStream(bytes.NewBufferString(junitTestEvents)) {
+			events <- e
+		}
+		close(events)
+	}()
+	runner := failedPlaybookRunner{&fakeRunner{eventChan: events}}
+	ae := ansibleExecutor{
+		stdout: ioutil.Discard,
+		runnerExplainerFactory: func(explainer explain.AnsibleEventExplainer, _ io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
+			return runner, &explain.AnsibleEventStreamExplainer{Out: ioutil.Discard, EventExplainer: explainer}, nil
+		},
+	}
+	file := filepath.Join(mustGetTempDir(t), "preflight.xml")
+	err := ae.runPlaybookWithReport("preflight.yaml", newJUnitRecorder("preflight", false), file, &explain.DefaultEventExplainer{}, ansible.Inventory{}, ansible.ClusterCatalog{}, ioutil.Discard, "")
+	if err == nil {
+		t.Error("expected an error when the playbook fails, but didn't get one")
+	}
+	report := readJUnitReport(t, file)
+	if len(report.Suites) != 2 {
+		t.Errorf("expected the report to be written, but got %+v", report)
+	}
+}
+
+func TestRunPlaybookWithReportStreamNotClosed(t *testing.T) {
+	// The events FIFO is not closed when the playbook ends
+	events := make(chan ansible.Event)
+	go func() {
+		for e := range ansible.EventStream(bytes.NewBufferString(junitTestEvents)) {
+			events <- e
+		}
+	}()
+	runner := &fakeRunner{eventChan: events}
+	ae := ansibleExecutor{
+		stdout: ioutil.Discard,
+		runnerExplainerFactory: func(explainer explain.AnsibleEventExplainer, _ io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
+			return runner, &explain.AnsibleEventStreamExplainer{Out: ioutil.Discard, EventExplainer: explainer}, nil
+		},
+	}
+	file := filepath.Join(mustGetTempDir(t), "preflight.xml")
+	start := time.Now()
+	if err := ae.runPlaybookWithReport("preflight.yaml", newJUnitRecorder("preflight", false), file, &explain.DefaultEventExplainer{}, ansible.Inventory{}, ansible.ClusterCatalog{}, ioutil.Discard, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= junitRecordTimeout {
+		t.Errorf("expected the report to be written when the playbook ended, but waited %v", elapsed)
+	}
+	if report := readJUnitReport(t, file); len(report.Suites) != 2 {
+		t.Errorf("expected the report to be written, but got %+v", report)
+	}
+}
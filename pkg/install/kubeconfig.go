@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"html/template"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 
 	"github.com/apprenda/kismatic/pkg/util"
@@ -44,25 +45,28 @@ users:
 
 // GenerateKubeconfig generate a kubeconfig file for a specific user
 func GenerateKubeconfig(p *Plan, generatedAssetsDir string) error {
-	user := "admin"
+	certsDir := filepath.Join(generatedAssetsDir, "keys")
+	return writeKubeconfig(p, certsDir, certsDir, "admin", filepath.Join(generatedAssetsDir, "kubeconfig"), 0644)
+}
+
+// writes a kubeconfig file for the user, whose certificate and key are in the user certs directory
+func writeKubeconfig(p *Plan, certsDir, userCertsDir, user, kubeconfigFile string, perm os.FileMode) error {
 	server := "https://" + p.Master.LoadBalancedFQDN + ":6443"
 	cluster := p.Cluster.Name
 	context := p.Cluster.Name + "-" + user
 
-	certsDir := filepath.Join(generatedAssetsDir, "keys")
-
 	// Base64 encoded ca
 	caEncoded, err := util.Base64String(filepath.Join(certsDir, "ca.pem"))
 	if err != nil {
 		return fmt.Errorf("error reading ca file for kubeconfig: %v", err)
 	}
 	// Base64 encoded cert
-	certEncoded, err := util.Base64String(filepath.Join(certsDir, user+".pem"))
+	certEncoded, err := util.Base64String(filepath.Join(userCertsDir, user+".pem"))
 	if err != nil {
 		return fmt.Errorf("error reading certificate file for kubeconfig: %v", err)
 	}
 	// Base64 encoded key
-	keyEncoded, err := util.Base64String(filepath.Join(certsDir, user+"-key.pem"))
+	keyEncoded, err := util.Base64String(filepath.Join(userCertsDir, user+"-key.pem"))
 	if err != nil {
 		return fmt.Errorf("error reading certificate key file for kubeconfig: %v", err)
 	}
@@ -79,8 +83,7 @@ func GenerateKubeconfig(p *Plan, generatedAssetsDir string) error {
 		return fmt.Errorf("error processing config template: %v", err)
 	}
 	// Write config file
-	kubeconfigFile := filepath.Join(generatedAssetsDir, "kubeconfig")
-	err = ioutil.WriteFile(kubeconfigFile, kubeconfig.Bytes(), 0644)
+	err = ioutil.WriteFile(kubeconfigFile, kubeconfig.Bytes(), perm)
 	if err != nil {
 		return fmt.Errorf("error writing kubeconfig file: %v", err)
 	}
@@ -1,9 +1,14 @@
 package install
 
 import (
+	"crypto/x509"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/apprenda/kismatic/pkg/tls"
 	"github.com/apprenda/kismatic/pkg/util"
@@ -18,14 +23,23 @@ const (
 	certLocality     = "Troy"
 )
 
+// The certificates that the API servers use for verifying service account tokens:
+// the current service account certificate, followed by the one it replaced
+const serviceAccountTrustedCertsFile = "service-account-trusted.pem"
+
 // The PKI provides a way for generating certificates for the cluster described by the Plan
 type PKI interface {
 	CertificateAuthorityExists() (bool, error)
 	NodeCertificateExists(node Node) (bool, error)
 	GenerateNodeCertificate(plan *Plan, node Node, ca *tls.CA) error
+	RemoveNodeCertificate(node Node) error
 	GetClusterCA() (*tls.CA, error)
 	GenerateClusterCA(p *Plan) (*tls.CA, error)
 	GenerateClusterCertificates(p *Plan, ca *tls.CA, users []string) error
+	RotateNodeCertificate(plan *Plan, node Node, ca *tls.CA) error
+	RotateUserCertificate(plan *Plan, user string, ca *tls.CA) error
+	RotateServiceAccountCertificate(plan *Plan, ca *tls.CA) error
+	IssueUserCertificate(plan *Plan, user string, groups []string, ca *tls.CA, dir string) (*x509.Certificate, error)
 }
 
 // LocalPKI is a file-based PKI
@@ -35,6 +49,13 @@ type LocalPKI struct {
 	CASigningProfile        string
 	GeneratedCertsDirectory string
 	Log                     io.Writer
+	// signs the certificates instead of the CA, if set
+	signer certificateSigner
+}
+
+// certificateSigner issues certificates without a local CA
+type certificateSigner interface {
+	Sign(req csr.CertificateRequest) (key, cert []byte, err error)
 }
 
 // CertificateAuthorityExists returns true if the CA for the cluster exists
@@ -76,18 +97,21 @@ func (lp *LocalPKI) GenerateClusterCA(p *Plan) (*tls.CA, error) {
 		return lp.GetClusterCA()
 	}
 
-	util.PrettyPrintOk(lp.Log, "Generating cluster Certificate Authority")
-	// It doesn't exist, generate one
-	caSubject := tls.Subject{
-		Organization:       certOrganization,
-		OrganizationalUnit: certOrgUnit,
-		Country:            certCountry,
-		State:              certState,
-		Locality:           certLocality,
-	}
-	key, cert, err := tls.NewCACert(lp.CACsr, p.Cluster.Name, caSubject)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create CA Cert: %v", err)
+	var key, cert []byte
+	if c := p.Cluster.Certificates; c.CACert != "" {
+		// Use the CA provided in the plan, bundled with its chain
+		util.PrettyPrintOk(lp.Log, "Using Certificate Authority %q", c.CACert)
+		key, cert, err = tls.ReadExistingCACert(c.CACert, c.CAKey, c.CAChain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA Cert: %v", err)
+		}
+	} else {
+		util.PrettyPrintOk(lp.Log, "Generating cluster Certificate Authority")
+		// It doesn't exist, generate one
+		key, cert, err = tls.NewCACert(lp.CACsr, p.Cluster.Name, certSubject(p), p.Cluster.Certificates.CAKeyAlgorithm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CA Cert: %v", err)
+		}
 	}
 	if err = tls.WriteCert(key, cert, "ca", lp.GeneratedCertsDirectory); err != nil {
 		return nil, fmt.Errorf("error writing CA files: %v", err)
@@ -191,9 +215,47 @@ func (lp *LocalPKI) ValidateClusterCertificates(p *Plan, users []string) (warn [
 			err = append(err, userErr)
 		}
 	}
+	// Flag certificates whose key algorithm no longer matches the plan
+	names := []string{}
+	for n := range seenNodes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	if p.DockerRegistry.SetupInternal {
+		names = append(names, "docker")
+	}
+	names = append(names, "service-account")
+	names = append(names, users...)
+	for _, name := range names {
+		warn = append(warn, lp.validateKeyAlgorithm(name, p.Cluster.Certificates.KeyAlgorithm)...)
+	}
+	// The algorithm of a CA that was not generated is not set in the plan
+	if p.Cluster.Certificates.CACert == "" && p.Cluster.Certificates.Signer.Type != "vault" {
+		warn = append(warn, lp.validateKeyAlgorithm("ca", p.Cluster.Certificates.CAKeyAlgorithm)...)
+	}
 	return warn, err
 }
 
+// returns a warning if the key algorithm of the certificate does not match the expected
+// algorithm, or the default algorithm if empty. Certificates that do not exist are ignored.
+func (lp *LocalPKI) validateKeyAlgorithm(name, expected string) []error {
+	if expected == "" {
+		expected = tls.DefaultKeyAlgorithm
+	}
+	exists, err := tls.CertKeyPairExists(name, lp.GeneratedCertsDirectory)
+	if err != nil || !exists {
+		return nil
+	}
+	cert, err := tls.ReadCert(name, lp.GeneratedCertsDirectory)
+	if err != nil {
+		return []error{err}
+	}
+	if actual := tls.KeyAlgorithm(cert); actual != expected {
+		return []error{fmt.Errorf("Certificate \"%s.pem\": key algorithm validation failed\n    expected %q, instead got %q", name, expected, actual)}
+	}
+	return nil
+}
+
 // GenerateNodeCertificate creates a private key and certificate for the given node
 func (lp *LocalPKI) GenerateNodeCertificate(plan *Plan, node Node, ca *tls.CA) error {
 	CN := node.Host
@@ -229,7 +291,7 @@ func (lp *LocalPKI) GenerateNodeCertificate(plan *Plan, node Node, ca *tls.CA) e
 
 	util.PrettyPrintOk(lp.Log, "Generating certificates for host %q", node.Host)
 
-	key, cert, err := generateCert(CN, plan, nodeSANs, ca)
+	key, cert, err := lp.generateCert(CN, plan, nodeSANs, ca)
 	if err != nil {
 		return fmt.Errorf("error during cluster cert generation: %v", err)
 	}
@@ -240,6 +302,84 @@ func (lp *LocalPKI) GenerateNodeCertificate(plan *Plan, node Node, ca *tls.CA) e
 	return nil
 }
 
+// RemoveNodeCertificate deletes the node's key and certificate
+func (lp *LocalPKI) RemoveNodeCertificate(node Node) error {
+	return tls.DeleteCert(node.Host, lp.GeneratedCertsDirectory)
+}
+
+// RotateNodeCertificate re-issues the node's key and certificate using the CA.
+// The previous key and certificate are kept in the rotated certificates directory.
+func (lp *LocalPKI) RotateNodeCertificate(plan *Plan, node Node, ca *tls.CA) error {
+	return lp.rotateCert(node.Host, func() error { return lp.GenerateNodeCertificate(plan, node, ca) })
+}
+
+// RotateUserCertificate re-issues the user's key and certificate using the CA.
+// The previous key and certificate are kept in the rotated certificates directory.
+func (lp *LocalPKI) RotateUserCertificate(plan *Plan, user string, ca *tls.CA) error {
+	return lp.rotateCert(user, func() error { return lp.generateUserCert(plan, user, ca) })
+}
+
+// RotateServiceAccountCertificate re-issues the key and certificate used for signing
+// service account tokens. The previous key and certificate are kept in the rotated
+// certificates directory, and the previous certificate is added to the certificates
+// trusted by the API servers, so that the existing tokens are still accepted until
+// they are re-issued.
+func (lp *LocalPKI) RotateServiceAccountCertificate(plan *Plan, ca *tls.CA) error {
+	certFile := filepath.Join(lp.GeneratedCertsDirectory, "service-account.pem")
+	previous, err := ioutil.ReadFile(certFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading service account certificate: %v", err)
+	}
+	if err = lp.rotateCert("service-account", func() error { return lp.generateServiceAccountCert(plan, ca) }); err != nil {
+		return err
+	}
+	current, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return fmt.Errorf("error reading service account certificate: %v", err)
+	}
+	trusted := append(current, previous...)
+	if err = ioutil.WriteFile(filepath.Join(lp.GeneratedCertsDirectory, serviceAccountTrustedCertsFile), trusted, 0644); err != nil {
+		return fmt.Errorf("error writing trusted service account certificates: %v", err)
+	}
+	return nil
+}
+
+// rotateCert moves the key and certificate with the given name to the rotated
+// certificates directory, and generates new ones. The previous key and certificate
+// are restored if the generation fails.
+func (lp *LocalPKI) rotateCert(name string, generate func() error) error {
+	if lp.Log == nil {
+		lp.Log = ioutil.Discard
+	}
+	rotatedDir := filepath.Join(lp.GeneratedCertsDirectory, "rotated", time.Now().Format("2006-01-02-15-04-05"))
+	if err := os.MkdirAll(rotatedDir, 0700); err != nil {
+		return fmt.Errorf("error creating directory for rotated certificates: %v", err)
+	}
+	files := []string{name + ".pem", name + "-key.pem"}
+	moved := []string{}
+	restore := func() {
+		for _, f := range moved {
+			os.Rename(filepath.Join(rotatedDir, f), filepath.Join(lp.GeneratedCertsDirectory, f))
+		}
+	}
+	for _, f := range files {
+		err := os.Rename(filepath.Join(lp.GeneratedCertsDirectory, f), filepath.Join(rotatedDir, f))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			restore()
+			return fmt.Errorf("error moving %q to the rotated certificates directory: %v", f, err)
+		}
+		moved = append(moved, f)
+	}
+	if err := generate(); err != nil {
+		restore()
+		return err
+	}
+	return nil
+}
+
 func (lp *LocalPKI) validateNodeCertificate(p *Plan, node Node) (valid bool, warn []error, err error) {
 	CN := node.Host
 	// Build list of SANs
@@ -283,7 +423,7 @@ func (lp *LocalPKI) generateDockerRegistryCert(p *Plan, ca *tls.CA) error {
 
 	util.PrettyPrintOk(lp.Log, "Generating certificates for docker registry")
 
-	dockerKey, dockerCert, err := generateCert(CN, p, SANs, ca)
+	dockerKey, dockerCert, err := lp.generateCert(CN, p, SANs, ca)
 	if err != nil {
 		return fmt.Errorf("error during user cert generation: %v", err)
 	}
@@ -324,8 +464,12 @@ func (lp *LocalPKI) generateServiceAccountCert(p *Plan, ca *tls.CA) error {
 	}
 
 	util.PrettyPrintOk(lp.Log, "Generating certificates for service accounts")
+	// The certificates trusted after a previous rotation do not include the new one
+	if err = os.Remove(filepath.Join(lp.GeneratedCertsDirectory, serviceAccountTrustedCertsFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing trusted service account certificates: %v", err)
+	}
 
-	key, cert, err := generateCert(CN, p, SANs, ca)
+	key, cert, err := lp.generateCert(CN, p, SANs, ca)
 	if err != nil {
 		return fmt.Errorf("error generating service account certs: %v", err)
 	}
@@ -363,7 +507,7 @@ func (lp *LocalPKI) generateUserCert(p *Plan, user string, ca *tls.CA) error {
 
 	util.PrettyPrintOk(lp.Log, "Generating certificates for user %q", user)
 
-	adminKey, adminCert, err := generateCert(user, p, SANs, ca)
+	adminKey, adminCert, err := lp.generateCert(user, p, SANs, ca)
 	if err != nil {
 		return fmt.Errorf("error during user cert generation: %v", err)
 	}
@@ -380,31 +524,98 @@ func (lp *LocalPKI) validateUserCert(user string) (valid bool, warn []error, err
 	return tls.CertExistsAndValid(user, SANs, user, lp.GeneratedCertsDirectory)
 }
 
-func generateCert(cnName string, p *Plan, hostList []string, ca *tls.CA) (key, cert []byte, err error) {
+// IssueUserCertificate creates a private key and client certificate for the user, which is a
+// member of the groups, and writes them to the directory. The groups are the organizations of
+// the certificate's subject.
+func (lp *LocalPKI) IssueUserCertificate(p *Plan, user string, groups []string, ca *tls.CA, dir string) (*x509.Certificate, error) {
+	subject := certSubject(p)
+	keyRequest, err := tls.NewKeyRequest(p.Cluster.Certificates.KeyAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	name := csr.Name{
+		OU: subject.OrganizationalUnit,
+		C:  subject.Country,
+		ST: subject.State,
+		L:  subject.Locality,
+	}
+	names := []csr.Name{name}
+	for i, g := range groups {
+		if i == 0 {
+			names[0].O = g
+			continue
+		}
+		names = append(names, csr.Name{O: g})
+	}
+	req := csr.CertificateRequest{
+		CN:         user,
+		KeyRequest: keyRequest,
+		Names:      names,
+	}
+	key, cert, err := lp.sign(req, ca)
+	if err != nil {
+		return nil, fmt.Errorf("error generating certificate for user %q: %v", user, err)
+	}
+	if err = tls.WriteCert(key, cert, user, dir); err != nil {
+		return nil, fmt.Errorf("error writing cert files for user %q: %v", user, err)
+	}
+	return tls.ReadCert(user, dir)
+}
+
+// signs the request with the external signer if set, or with the CA otherwise
+func (lp *LocalPKI) sign(req csr.CertificateRequest, ca *tls.CA) (key, cert []byte, err error) {
+	if lp.signer != nil {
+		return lp.signer.Sign(req)
+	}
+	return tls.NewCert(ca, req)
+}
+
+func (lp *LocalPKI) generateCert(cnName string, p *Plan, hostList []string, ca *tls.CA) (key, cert []byte, err error) {
+	subject := certSubject(p)
+	keyRequest, err := tls.NewKeyRequest(p.Cluster.Certificates.KeyAlgorithm)
+	if err != nil {
+		return nil, nil, err
+	}
 	req := csr.CertificateRequest{
-		CN: cnName,
-		KeyRequest: &csr.BasicKeyRequest{
-			A: "rsa",
-			S: 2048,
-		},
-		Hosts: hostList,
+		CN:         cnName,
+		KeyRequest: keyRequest,
+		Hosts:      hostList,
 		Names: []csr.Name{
 			{
-				O:  certOrganization,
-				OU: certOrgUnit,
-				C:  certCountry,
-				ST: certState,
-				L:  certLocality,
+				O:  subject.Organization,
+				OU: subject.OrganizationalUnit,
+				C:  subject.Country,
+				ST: subject.State,
+				L:  subject.Locality,
 			},
 		},
 	}
-	key, cert, err = tls.NewCert(ca, req)
+	key, cert, err = lp.sign(req, ca)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error generating certs for %q: %v", cnName, err)
 	}
 	return key, cert, err
 }
 
+// returns the subject of the certificates issued for the cluster, using the
+// default value of the fields that are not set in the plan
+func certSubject(p *Plan) tls.Subject {
+	s := p.Cluster.Certificates.Subject
+	orDefault := func(value, def string) string {
+		if value == "" {
+			return def
+		}
+		return value
+	}
+	return tls.Subject{
+		Organization:       orDefault(s.Organization, certOrganization),
+		OrganizationalUnit: orDefault(s.OrganizationalUnit, certOrgUnit),
+		Country:            orDefault(s.Country, certCountry),
+		State:              orDefault(s.State, certState),
+		Locality:           orDefault(s.Locality, certLocality),
+	}
+}
+
 func clusterCertsSubjectAlternateNames(plan *Plan) ([]string, error) {
 	kubeServiceIP, err := getKubernetesServiceIP(plan)
 	if err != nil {
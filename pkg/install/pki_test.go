@@ -655,3 +655,83 @@ func TestBadDockerCertificate(t *testing.T) {
 		t.Fatalf("expected an error, got nil")
 	}
 }
+
+func TestGenerateClusterCertificatesCustomSubject(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	p := getPlan()
+	p.Cluster.Certificates.Subject = CertSubject{Organization: "someOrg", Locality: "someLocality"}
+	ca, err := pki.GenerateClusterCA(p)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	if err = pki.GenerateClusterCertificates(p, ca, []string{"admin"}); err != nil {
+		t.Fatalf("error generating certificates: %v", err)
+	}
+	for _, name := range []string{"ca", "master", "admin"} {
+		cert := mustReadCertFile(filepath.Join(pki.GeneratedCertsDirectory, name+".pem"), t)
+		if cert.Subject.Organization[0] != "someOrg" || cert.Subject.Locality[0] != "someLocality" {
+			t.Errorf("%s: expected subject from the plan, but got %v", name, cert.Subject)
+		}
+		// fields that are not set in the plan use the default
+		if cert.Subject.Country[0] != certCountry {
+			t.Errorf("%s: expected default country %q, but got %q", name, certCountry, cert.Subject.Country[0])
+		}
+	}
+}
+
+func TestGenerateClusterCAExistingCA(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	// Generate a CA in another directory, which is provided in the plan
+	external := getPKI(t)
+	defer cleanup(external.GeneratedCertsDirectory, t)
+	p := getPlan()
+	p.Cluster.Name = "corporate"
+	if _, err := external.GenerateClusterCA(p); err != nil {
+		t.Fatalf("error generating external CA: %v", err)
+	}
+	p = getPlan()
+	p.Cluster.Certificates.CACert = filepath.Join(external.GeneratedCertsDirectory, "ca.pem")
+	p.Cluster.Certificates.CAKey = filepath.Join(external.GeneratedCertsDirectory, "ca-key.pem")
+
+	ca, err := pki.GenerateClusterCA(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = pki.GenerateNodeCertificate(p, p.Worker.Nodes[0], ca); err != nil {
+		t.Fatalf("error generating node certificate: %v", err)
+	}
+	caCert := mustReadCertFile(filepath.Join(pki.GeneratedCertsDirectory, "ca.pem"), t)
+	if caCert.Subject.CommonName != "corporate" {
+		t.Errorf("expected the CA from the plan to be used, but got %q", caCert.Subject.CommonName)
+	}
+	nodeCert := mustReadCertFile(filepath.Join(pki.GeneratedCertsDirectory, "worker.pem"), t)
+	if nodeCert.Issuer.CommonName != "corporate" {
+		t.Errorf("expected node certificate to be issued by the CA from the plan, but got %q", nodeCert.Issuer.CommonName)
+	}
+}
+
+func TestValidateClusterCertificatesKeyAlgorithmChanged(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	p := getPlan()
+	p.Cluster.Certificates.CAKeyAlgorithm = "ecdsa-p384"
+	p.Cluster.Certificates.KeyAlgorithm = "ecdsa-p256"
+	ca, err := pki.GenerateClusterCA(p)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	if err = pki.GenerateClusterCertificates(p, ca, []string{"admin"}); err != nil {
+		t.Fatalf("error generating certificates: %v", err)
+	}
+	if warn, errs := pki.ValidateClusterCertificates(p, []string{"admin"}); len(warn) != 0 || len(errs) != 0 {
+		t.Fatalf("expected certificates to be valid, but got warnings %v and errors %v", warn, errs)
+	}
+	// The leaf certificates no longer match the plan, the CA does
+	p.Cluster.Certificates.KeyAlgorithm = "rsa-2048"
+	warn, _ := pki.ValidateClusterCertificates(p, []string{"admin"})
+	if len(warn) != 5 {
+		t.Errorf("expected a warning for each of the 5 leaf certificates, but got %v", warn)
+	}
+}
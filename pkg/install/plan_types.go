@@ -1,6 +1,10 @@
 package install
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
 
 // NetworkConfig describes the cluster's networking configuration
 type NetworkConfig struct {
@@ -14,6 +18,47 @@ type NetworkConfig struct {
 // CertsConfig describes the cluster's trust and certificate configuration
 type CertsConfig struct {
 	Expiry string
+	// CACert and CAKey are the paths to an existing CA certificate and private key
+	// used to sign the cluster's certificates, instead of a generated self-signed CA
+	CACert string `yaml:"ca_cert,omitempty"`
+	CAKey  string `yaml:"ca_key,omitempty"`
+	// CAChain is the path to the certificates that chain an intermediate CA
+	// to the root CA. The chain is bundled with the CA certificate.
+	CAChain string      `yaml:"ca_chain,omitempty"`
+	Subject CertSubject `yaml:"subject,omitempty"`
+	// CAKeyAlgorithm and KeyAlgorithm are the algorithms of the private keys generated
+	// for the CA and the other certificates, e.g. "rsa-4096" or "ecdsa-p256".
+	// The default is "rsa-2048".
+	CAKeyAlgorithm string `yaml:"ca_key_algorithm,omitempty"`
+	KeyAlgorithm   string `yaml:"key_algorithm,omitempty"`
+	// Signer is the external signer that issues the cluster's certificates,
+	// instead of a CA whose private key is stored locally
+	Signer SignerConfig `yaml:"signer,omitempty"`
+}
+
+// SignerConfig describes an external signer that implements the API of
+// the HashiCorp Vault PKI secrets engine. The token used to authenticate
+// with the signer is read from the VAULT_TOKEN environment variable.
+type SignerConfig struct {
+	// Type is "local" or "vault". The local CA is used if empty.
+	Type    string `yaml:"type,omitempty"`
+	Address string `yaml:"address,omitempty"`
+	// Mount is the path where the PKI secrets engine is mounted
+	Mount string `yaml:"mount,omitempty"`
+	// Role is the role used for signing the certificates
+	Role string `yaml:"role,omitempty"`
+	// TLSCAFile is the path to the CA certificate used to verify the signer's certificate
+	TLSCAFile string `yaml:"tls_ca_file,omitempty"`
+}
+
+// CertSubject describes the subject fields of the certificates issued for the
+// cluster. Fields that are not set default to the Kismatic subject.
+type CertSubject struct {
+	Organization       string `yaml:"organization,omitempty"`
+	OrganizationalUnit string `yaml:"organizational_unit,omitempty"`
+	Country            string `yaml:"country,omitempty"`
+	State              string `yaml:"state,omitempty"`
+	Locality           string `yaml:"locality,omitempty"`
 }
 
 // SSHConfig describes the cluster's SSH configuration for accessing nodes
@@ -21,6 +66,68 @@ type SSHConfig struct {
 	User string
 	Key  string `yaml:"ssh_key"`
 	Port int    `yaml:"ssh_port"`
+	// Bastion is the host through which the nodes are accessed,
+	// when they are not directly reachable
+	Bastion SSHBastion `yaml:"bastion,omitempty"`
+}
+
+// SSHBastion describes a jump host through which the SSH connections to the nodes
+// are tunneled. The cluster's SSH user and key are used if User and Key are empty.
+type SSHBastion struct {
+	Address string `yaml:"address,omitempty"`
+	Port    int    `yaml:"ssh_port,omitempty"`
+	User    string `yaml:"user,omitempty"`
+	Key     string `yaml:"ssh_key,omitempty"`
+}
+
+// GetBastion returns the bastion used for accessing the nodes, or nil if the nodes
+// are directly reachable
+func (s SSHConfig) GetBastion() *ssh.Bastion {
+	if s.Bastion.Address == "" {
+		return nil
+	}
+	b := &ssh.Bastion{
+		Address: s.Bastion.Address,
+		Port:    s.Bastion.Port,
+		User:    s.Bastion.User,
+		Key:     s.Bastion.Key,
+	}
+	if b.Port == 0 {
+		b.Port = 22
+	}
+	if b.User == "" {
+		b.User = s.User
+	}
+	if b.Key == "" {
+		b.Key = s.Key
+	}
+	return b
+}
+
+// NodeSSHConfig overrides the cluster's SSH configuration for a node or a node group.
+// Fields that are not set default to the group's, and then to the cluster's configuration.
+type NodeSSHConfig struct {
+	User string `yaml:"user,omitempty"`
+	Key  string `yaml:"ssh_key,omitempty"`
+	Port int    `yaml:"ssh_port,omitempty"`
+}
+
+// returns the configuration with the fields that are set in the override.
+// The bastion keeps the defaults of the configuration it is overridden from.
+func (s SSHConfig) override(o NodeSSHConfig) SSHConfig {
+	if b := s.GetBastion(); b != nil {
+		s.Bastion = SSHBastion{Address: b.Address, Port: b.Port, User: b.User, Key: b.Key}
+	}
+	if o.User != "" {
+		s.User = o.User
+	}
+	if o.Key != "" {
+		s.Key = o.Key
+	}
+	if o.Port != 0 {
+		s.Port = o.Port
+	}
+	return s
 }
 
 // Cluster describes a Kubernetes cluster
@@ -38,12 +145,16 @@ type Node struct {
 	Host       string
 	IP         string
 	InternalIP string
+	// SSH overrides the SSH configuration of the node group for this node
+	SSH NodeSSHConfig `yaml:"ssh,omitempty"`
 }
 
 // A NodeGroup is a collection of nodes
 type NodeGroup struct {
 	ExpectedCount int `yaml:"expected_count"`
-	Nodes         []Node
+	// SSH overrides the cluster's SSH configuration for the nodes of the group
+	SSH   NodeSSHConfig `yaml:"ssh,omitempty"`
+	Nodes []Node
 }
 
 // An OptionalNodeGroup is a collection of nodes that can be empty
@@ -63,7 +174,9 @@ type MasterNodeGroup struct {
 	ExpectedCount         int    `yaml:"expected_count"`
 	LoadBalancedFQDN      string `yaml:"load_balanced_fqdn"`
 	LoadBalancedShortName string `yaml:"load_balanced_short_name"`
-	Nodes                 []Node
+	// SSH overrides the cluster's SSH configuration for the master nodes
+	SSH   NodeSSHConfig `yaml:"ssh,omitempty"`
+	Nodes []Node
 }
 
 // DockerRegistry details for docker registry, either confgiured by the cli or customer provided
@@ -169,7 +282,53 @@ func (p *Plan) GetSSHConnection(host string) (*SSHConnection, error) {
 		return nil, fmt.Errorf("node %q not found in the plan", host)
 	}
 
-	return &SSHConnection{&p.Cluster.SSH, foundNode}, nil
+	s := p.GetNodeSSHConfig(*foundNode)
+	return &SSHConnection{&s, foundNode}, nil
+}
+
+// GetRoleSSHConfig returns the SSH configuration used for accessing the node in the
+// group of the role. The node's SSH settings take precedence over the group's, which
+// take precedence over the cluster's.
+func (p *Plan) GetRoleSSHConfig(role string, n Node) SSHConfig {
+	var group NodeSSHConfig
+	switch role {
+	case "etcd":
+		group = p.Etcd.SSH
+	case "master":
+		group = p.Master.SSH
+	case "worker":
+		group = p.Worker.SSH
+	case "ingress":
+		group = p.Ingress.SSH
+	case "storage":
+		group = p.Storage.SSH
+	}
+	return p.Cluster.SSH.override(group).override(n.SSH)
+}
+
+// GetNodeSSHConfig returns the SSH configuration used for accessing the node. When the
+// host is in multiple groups, the settings of the first group that contains it are used,
+// in the order etcd, master, worker, ingress and storage, so that a host is always
+// accessed in the same way. Nodes that are not in the plan use the cluster's settings.
+func (p *Plan) GetNodeSSHConfig(n Node) SSHConfig {
+	groups := []struct {
+		role  string
+		nodes []Node
+	}{
+		{"etcd", p.Etcd.Nodes},
+		{"master", p.Master.Nodes},
+		{"worker", p.Worker.Nodes},
+		{"ingress", p.Ingress.Nodes},
+		{"storage", p.Storage.Nodes},
+	}
+	for _, g := range groups {
+		for _, gn := range g.nodes {
+			if gn.Host == n.Host {
+				return p.GetRoleSSHConfig(g.role, gn)
+			}
+		}
+	}
+	return p.Cluster.SSH.override(n.SSH)
 }
 
 func firstIfItExists(nodes []Node) *Node {
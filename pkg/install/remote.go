@@ -0,0 +1,220 @@
+package install
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
+
+// NodeCommandResult is the result of running a command on a node
+type NodeCommandResult struct {
+	Host   string `json:"host"`
+	IP     string `json:"ip"`
+	Output string `json:"output"`
+	// ExitStatus is the exit status of the command, only meaningful when Error is empty
+	ExitStatus int `json:"exitStatus"`
+	// Error is set when the command could not be run to completion on the node
+	Error string `json:"error,omitempty"`
+}
+
+// Succeeded returns true if the command ran on the node and exited with status 0
+func (r NodeCommandResult) Succeeded() bool {
+	return r.Error == "" && r.ExitStatus == 0
+}
+
+// SelectNodes returns the unique nodes of the plan that play one of the roles, or whose
+// hostname is one of the hosts, in the order in which they are defined in the plan.
+// All the nodes are returned if no roles and hosts are given. An error is returned if a
+// role has no nodes, or if a host is not in the plan.
+func (p *Plan) SelectNodes(roles []string, hosts []string) ([]Node, error) {
+	groups := []struct {
+		role  string
+		nodes []Node
+	}{
+		{"etcd", p.Etcd.Nodes},
+		{"master", p.Master.Nodes},
+		{"worker", p.Worker.Nodes},
+		{"ingress", p.Ingress.Nodes},
+		{"storage", p.Storage.Nodes},
+	}
+	all := len(roles) == 0 && len(hosts) == 0
+	selectedRoles := map[string]bool{}
+	for _, r := range roles {
+		selectedRoles[r] = false
+	}
+	selectedHosts := map[string]bool{}
+	for _, h := range hosts {
+		selectedHosts[h] = false
+	}
+	nodes := []Node{}
+	seen := map[string]bool{}
+	for _, g := range groups {
+		for _, n := range g.nodes {
+			_, hasRole := selectedRoles[g.role]
+			_, isHost := selectedHosts[n.Host]
+			if hasRole {
+				selectedRoles[g.role] = true
+			}
+			if isHost {
+				selectedHosts[n.Host] = true
+			}
+			if (all || hasRole || isHost) && !seen[n.Host] {
+				seen[n.Host] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	for _, r := range roles {
+		if !selectedRoles[r] {
+			return nil, fmt.Errorf("no nodes with role %q were found in the plan", r)
+		}
+	}
+	for _, h := range hosts {
+		if !selectedHosts[h] {
+			return nil, fmt.Errorf("node %q not found in the plan", h)
+		}
+	}
+	return nodes, nil
+}
+
+// RunCommandOnNodes runs the command on the nodes over SSH, on at most parallelism
+// nodes at a time. The results are returned in the order of the nodes. The commands
+// are aborted when the context is canceled.
+func RunCommandOnNodes(ctx context.Context, p *Plan, nodes []Node, command string, parallelism int) []NodeCommandResult {
+	return runCommandOnNodes(ctx, nodes, command, parallelism, func(node Node, command string) (string, error) {
+		s := p.GetNodeSSHConfig(node)
+		client, err := ssh.OpenConnection(node.IP, s.Port, s.User, s.Key, s.GetBastion())
+		if err != nil {
+			return "", err
+		}
+		defer client.Close()
+		defer onCancel(ctx, func() { client.Close() })()
+		return client.Output(command)
+	})
+}
+
+func runCommandOnNodes(ctx context.Context, nodes []Node, command string, parallelism int, runCommand func(node Node, command string) (string, error)) []NodeCommandResult {
+	results := make([]NodeCommandResult, len(nodes))
+	onNodes(nodes, parallelism, func(i int, n Node) {
+		// The command is not run on the nodes that are left when the context is canceled
+		out, err := "", ctx.Err()
+		if err == nil {
+			out, err = runCommand(n, command)
+		}
+		r := NodeCommandResult{Host: n.Host, IP: n.IP, Output: out}
+		if status, ok := ssh.ExitStatus(err); ok {
+			r.ExitStatus = status
+		} else {
+			r.Error = err.Error()
+		}
+		results[i] = r
+	})
+	return results
+}
+
+// NodeCopyResult is the result of copying files to or from a node
+type NodeCopyResult struct {
+	Host        string `json:"host"`
+	IP          string `json:"ip"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Error       string `json:"error,omitempty"`
+}
+
+// CopyToNodes copies the local file or directory to the remote path on the nodes, on at
+// most parallelism nodes at a time. The results are returned in the order of the nodes.
+// The copies are aborted when the context is canceled.
+func CopyToNodes(ctx context.Context, p *Plan, nodes []Node, localPath, remotePath string, recursive bool, parallelism int) []NodeCopyResult {
+	return copyOnNodes(ctx, nodes, parallelism, func(n Node) (string, string, error) {
+		ft, err := openFileTransfer(p, n)
+		if err != nil {
+			return localPath, remotePath, err
+		}
+		defer ft.Close()
+		defer onCancel(ctx, func() { ft.Close() })()
+		return localPath, remotePath, ft.Upload(localPath, remotePath, recursive)
+	})
+}
+
+// CopyFromNodes copies the remote file or directory on the nodes to the local path, on at
+// most parallelism nodes at a time. When there is more than one node, the files of each
+// node are copied into a directory named after the node, which is created in the local path.
+// The results are returned in the order of the nodes. The copies are aborted when the
+// context is canceled.
+func CopyFromNodes(ctx context.Context, p *Plan, nodes []Node, remotePath, localPath string, recursive bool, parallelism int) []NodeCopyResult {
+	return copyOnNodes(ctx, nodes, parallelism, func(n Node) (string, string, error) {
+		dest := localPath
+		if len(nodes) > 1 {
+			dest = filepath.Join(localPath, n.Host)
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return remotePath, dest, fmt.Errorf("error creating directory %q: %v", dest, err)
+			}
+		}
+		ft, err := openFileTransfer(p, n)
+		if err != nil {
+			return remotePath, dest, err
+		}
+		defer ft.Close()
+		defer onCancel(ctx, func() { ft.Close() })()
+		return remotePath, dest, ft.Download(remotePath, dest, recursive)
+	})
+}
+
+func openFileTransfer(p *Plan, n Node) (ssh.FileTransfer, error) {
+	s := p.GetNodeSSHConfig(n)
+	return ssh.OpenFileTransfer(n.IP, s.Port, s.User, s.Key, s.GetBastion())
+}
+
+// copies files on each node with copyFiles, which returns the source and destination of the copy
+func copyOnNodes(ctx context.Context, nodes []Node, parallelism int, copyFiles func(n Node) (string, string, error)) []NodeCopyResult {
+	results := make([]NodeCopyResult, len(nodes))
+	onNodes(nodes, parallelism, func(i int, n Node) {
+		if err := ctx.Err(); err != nil {
+			results[i] = NodeCopyResult{Host: n.Host, IP: n.IP, Error: err.Error()}
+			return
+		}
+		src, dest, err := copyFiles(n)
+		r := NodeCopyResult{Host: n.Host, IP: n.IP, Source: src, Destination: dest}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		results[i] = r
+	})
+	return results
+}
+
+// calls f for each node, on at most parallelism nodes at a time, and waits for all the calls to return
+func onNodes(nodes []Node, parallelism int, f func(i int, n Node)) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func(i int, n Node) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			f(i, n)
+		}(i, n)
+	}
+	wg.Wait()
+}
+
+// calls f when the context is canceled, until the returned function is called
+func onCancel(ctx context.Context, f func()) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			f()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
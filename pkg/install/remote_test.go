@@ -0,0 +1,120 @@
+package install
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSelectNodes(t *testing.T) {
+	p := Plan{
+		Etcd:    NodeGroup{Nodes: []Node{{Host: "etcd01"}}},
+		Master:  MasterNodeGroup{Nodes: []Node{{Host: "master01"}}},
+		Worker:  NodeGroup{Nodes: []Node{{Host: "worker01"}, {Host: "worker02"}}},
+		Ingress: OptionalNodeGroup{Nodes: []Node{{Host: "worker01"}}},
+	}
+	tests := []struct {
+		roles    []string
+		hosts    []string
+		expected []string
+		err      bool
+	}{
+		{expected: []string{"etcd01", "master01", "worker01", "worker02"}},
+		{roles: []string{"worker"}, expected: []string{"worker01", "worker02"}},
+		{roles: []string{"ingress", "etcd"}, expected: []string{"etcd01", "worker01"}},
+		{roles: []string{"ingress"}, hosts: []string{"master01"}, expected: []string{"master01", "worker01"}},
+		{hosts: []string{"worker02", "etcd01"}, expected: []string{"etcd01", "worker02"}},
+		{roles: []string{"storage"}, err: true},
+		{hosts: []string{"foo"}, err: true},
+	}
+	for i, test := range tests {
+		nodes, err := p.SelectNodes(test.roles, test.hosts)
+		if test.err {
+			if err == nil {
+				t.Errorf("test %d: expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		hosts := []string{}
+		for _, n := range nodes {
+			hosts = append(hosts, n.Host)
+		}
+		if !reflect.DeepEqual(hosts, test.expected) {
+			t.Errorf("test %d: expected %v, but got %v", i, test.expected, hosts)
+		}
+	}
+}
+
+func TestRunCommandOnNodes(t *testing.T) {
+	nodes := []Node{{Host: "node01"}, {Host: "node02"}, {Host: "node03"}, {Host: "node04"}, {Host: "node05"}}
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	runCommand := func(node Node, command string) (string, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		switch node.Host {
+		case "node02":
+			return "failed", exec.Command("sh", "-c", "exit 2").Run()
+		case "node03":
+			return "", errors.New("connection refused")
+		}
+		return "ran " + command, nil
+	}
+
+	results := runCommandOnNodes(context.Background(), nodes, "uptime", 2, runCommand)
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 commands to run at a time, but %d ran", maxRunning)
+	}
+	if len(results) != len(nodes) {
+		t.Fatalf("expected %d results, but got %d", len(nodes), len(results))
+	}
+	for i, r := range results {
+		if r.Host != nodes[i].Host {
+			t.Errorf("expected result %d to be for %q, but got %q", i, nodes[i].Host, r.Host)
+		}
+	}
+	if !results[0].Succeeded() || results[0].Output != "ran uptime" {
+		t.Errorf("unexpected result %+v", results[0])
+	}
+	if results[1].Succeeded() || results[1].ExitStatus != 2 || results[1].Error != "" {
+		t.Errorf("expected exit status 2, but got %+v", results[1])
+	}
+	if results[2].Succeeded() || results[2].Error == "" {
+		t.Errorf("expected a connection error, but got %+v", results[2])
+	}
+}
+
+func TestRunCommandOnNodesCanceled(t *testing.T) {
+	nodes := []Node{{Host: "node01"}, {Host: "node02"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ran := false
+	results := runCommandOnNodes(ctx, nodes, "uptime", 1, func(node Node, command string) (string, error) {
+		ran = true
+		return "", nil
+	})
+	if ran {
+		t.Errorf("expected no command to run once the context is canceled")
+	}
+	for _, r := range results {
+		if r.Succeeded() || r.Error == "" {
+			t.Errorf("expected an error for %q, but got %+v", r.Host, r)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apprenda/kismatic/pkg/install/explain"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// RemoveNode removes a worker, ingress or storage node from the cluster
+// described in the plan. The node is drained and deleted from Kubernetes,
+// and the Kubernetes services running on it are stopped.
+// If successful, the updated plan is returned.
+func (ae *ansibleExecutor) RemoveNode(originalPlan *Plan, node Node) (*Plan, error) {
+	if err := checkRemoveNodePrereqs(*originalPlan, node); err != nil {
+		return nil, err
+	}
+	runDirectory, err := ae.createRunDirectory("remove-node")
+	if err != nil {
+		return nil, fmt.Errorf("error creating working directory for remove-node: %v", err)
+	}
+	updatedPlan := removeNodeFromPlan(*originalPlan, node)
+	fp := FilePlanner{
+		File: filepath.Join(runDirectory, "kismatic-cluster.yaml"),
+	}
+	if err = fp.Write(&updatedPlan); err != nil {
+		return nil, fmt.Errorf("error recording plan file to %s: %v", fp.File, err)
+	}
+	// The node must be part of the inventory for removing it
+	inventory := buildInventoryFromPlan(originalPlan)
+	cc, err := ae.buildInstallExtraVars(originalPlan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ansible vars: %v", err)
+	}
+	ansibleLogFilename := filepath.Join(runDirectory, "ansible.log")
+	ansibleLogFile, err := os.Create(ansibleLogFilename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ansible log file %q: %v", ansibleLogFilename, err)
+	}
+	// Run the playbook for removing the node
+	util.PrintHeader(ae.stdout, "Removing Node From Cluster", '=')
+	playbook := "remove-node.yaml"
+	eventExplainer := &explain.DefaultEventExplainer{}
+	runner, explainer, err := ae.getAnsibleRunnerAndExplainer(eventExplainer, ansibleLogFile, runDirectory)
+	if err != nil {
+		return nil, err
+	}
+	eventStream, err := runner.StartPlaybookOnNode(ae.runContext(), playbook, inventory, *cc, node.Host)
+	if err != nil {
+		return nil, fmt.Errorf("error running ansible playbook: %v", err)
+	}
+	go explainer.Explain(eventStream)
+	// Wait until ansible exits
+	if err = runner.WaitPlaybook(); err != nil {
+		return nil, fmt.Errorf("error running playbook: %v", err)
+	}
+	if updatedPlan.Cluster.Networking.UpdateHostsFiles {
+		// Run ansible against the remaining hosts to remove the node from their hosts files
+		util.PrintHeader(ae.stdout, "Updating Hosts Files On All Nodes", '=')
+		inventory := buildInventoryFromPlan(&updatedPlan)
+		cc, err := ae.buildInstallExtraVars(&updatedPlan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ansible vars: %v", err)
+		}
+		playbook := "_hosts.yaml"
+		eventExplainer := &explain.DefaultEventExplainer{}
+		runner, explainer, err := ae.getAnsibleRunnerAndExplainer(eventExplainer, ansibleLogFile, runDirectory)
+		if err != nil {
+			return nil, err
+		}
+		eventStream, err := runner.StartPlaybook(ae.runContext(), playbook, inventory, *cc)
+		if err != nil {
+			return nil, fmt.Errorf("error running playbook to update hosts files on all nodes: %v", err)
+		}
+		go explainer.Explain(eventStream)
+		if err = runner.WaitPlaybook(); err != nil {
+			return nil, fmt.Errorf("error updating hosts files on all nodes: %v", err)
+		}
+	}
+	// The node is no longer part of the cluster, so its certificate should not be trusted
+	util.PrintHeader(ae.stdout, "Removing Certificate Of Node", '=')
+	if err := ae.pki.RemoveNodeCertificate(node); err != nil {
+		return nil, fmt.Errorf("error removing certificate of node %q: %v", node.Host, err)
+	}
+	util.PrettyPrintOk(ae.stdout, "Removed key and certificate of node %q", node.Host)
+	return &updatedPlan, nil
+}
+
+// removes the node from all the node groups it belongs to
+func removeNodeFromPlan(plan Plan, node Node) Plan {
+	plan.Worker.Nodes, plan.Worker.ExpectedCount = removeNodeFromGroup(plan.Worker.Nodes, plan.Worker.ExpectedCount, node)
+	plan.Ingress.Nodes, plan.Ingress.ExpectedCount = removeNodeFromGroup(plan.Ingress.Nodes, plan.Ingress.ExpectedCount, node)
+	plan.Storage.Nodes, plan.Storage.ExpectedCount = removeNodeFromGroup(plan.Storage.Nodes, plan.Storage.ExpectedCount, node)
+	return plan
+}
+
+func removeNodeFromGroup(nodes []Node, expectedCount int, node Node) ([]Node, int) {
+	remaining := []Node{}
+	for _, n := range nodes {
+		if n.Host == node.Host {
+			expectedCount--
+			continue
+		}
+		remaining = append(remaining, n)
+	}
+	return remaining, expectedCount
+}
+
+// ensure the node can be removed from the cluster
+func checkRemoveNodePrereqs(plan Plan, node Node) error {
+	for _, n := range plan.Etcd.Nodes {
+		if n.Host == node.Host {
+			return fmt.Errorf("node %q is an etcd node, only worker, ingress and storage nodes can be removed", node.Host)
+		}
+	}
+	for _, n := range plan.Master.Nodes {
+		if n.Host == node.Host {
+			return fmt.Errorf("node %q is a master node, only worker, ingress and storage nodes can be removed", node.Host)
+		}
+	}
+	found := false
+	for _, nodes := range [][]Node{plan.Worker.Nodes, plan.Ingress.Nodes, plan.Storage.Nodes} {
+		for _, n := range nodes {
+			if n.Host == node.Host {
+				found = true
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("node %q was not found in the plan", node.Host)
+	}
+	if len(plan.Worker.Nodes) == 1 && plan.Worker.Nodes[0].Host == node.Host {
+		return fmt.Errorf("node %q is the only worker node, the cluster requires at least one worker", node.Host)
+	}
+	return nil
+}
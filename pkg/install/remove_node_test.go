@@ -0,0 +1,121 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestRemoveNodeFromPlan(t *testing.T) {
+	p := testPlan()
+	worker02 := Node{Host: "worker02", IP: "192.168.205.13"}
+	p.Worker.ExpectedCount = 2
+	p.Worker.Nodes = append(p.Worker.Nodes, worker02)
+	p.Ingress.ExpectedCount = 2
+	p.Ingress.Nodes = append(p.Ingress.Nodes, worker02)
+	updated := removeNodeFromPlan(*p, worker02)
+	if updated.Worker.ExpectedCount != 1 || !reflect.DeepEqual(updated.Worker.Nodes, validPlan.Worker.Nodes) {
+		t.Errorf("expected worker02 to be removed from workers, but got %+v", updated.Worker)
+	}
+	if updated.Ingress.ExpectedCount != 1 || !reflect.DeepEqual(updated.Ingress.Nodes, validPlan.Ingress.Nodes) {
+		t.Errorf("expected worker02 to be removed from ingress, but got %+v", updated.Ingress)
+	}
+	// The original plan must not be modified
+	if len(p.Worker.Nodes) != 2 || len(p.Ingress.Nodes) != 2 {
+		t.Errorf("original plan was modified")
+	}
+}
+
+func TestRemoveNodePrereqs(t *testing.T) {
+	tests := []struct {
+		host  string
+		valid bool
+	}{
+		{"worker01", true},
+		{"worker02", true},
+		{"etcd01", false},
+		{"master01", false},
+		{"notInPlan", false},
+	}
+	p := testPlan()
+	p.Worker.Nodes = append(p.Worker.Nodes, Node{Host: "worker02", IP: "192.168.205.13"})
+	for _, test := range tests {
+		err := checkRemoveNodePrereqs(*p, Node{Host: test.host})
+		if test.valid && err != nil {
+			t.Errorf("expected node %q to be removable, but got error: %v", test.host, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("expected an error removing node %q, but didn't get one", test.host)
+		}
+	}
+}
+
+func TestRemoveNodeLastWorker(t *testing.T) {
+	if err := checkRemoveNodePrereqs(*testPlan(), Node{Host: "worker01"}); err == nil {
+		t.Error("expected an error removing the last worker, but didn't get one")
+	}
+}
+
+func TestRemoveNode(t *testing.T) {
+	tests := []struct {
+		updateHostsFiles  bool
+		expectedPlaybooks []string
+	}{
+		{false, nil},
+		{true, []string{"_hosts.yaml"}},
+	}
+	for _, test := range tests {
+		runner := &fakeRunner{}
+		pki := &fakePKI{}
+		e := ansibleExecutor{
+			certsDir:               mustGetTempDir(t),
+			options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+			stdout:                 ioutil.Discard,
+			consoleOutputFormat:    ansible.RawFormat,
+			pki:                    pki,
+			runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+		}
+		p := testPlan()
+		p.Worker.Nodes = append(p.Worker.Nodes, Node{Host: "worker02", IP: "192.168.205.13"})
+		p.Cluster.Networking.UpdateHostsFiles = test.updateHostsFiles
+		updated, err := e.RemoveNode(p, Node{Host: "worker01"})
+		if err != nil {
+			t.Fatalf("unexpected error removing node: %v", err)
+		}
+		if !reflect.DeepEqual(runner.nodes, []string{"worker01"}) {
+			t.Errorf("expected the remove playbook to run on worker01, but ran on %v", runner.nodes)
+		}
+		if !reflect.DeepEqual(runner.allNodesPlaybooks, test.expectedPlaybooks) {
+			t.Errorf("expected playbooks %v to run on all nodes, but got %v", test.expectedPlaybooks, runner.allNodesPlaybooks)
+		}
+		if !pki.removeNodeCertCalled {
+			t.Errorf("expected the node's certificate to be removed")
+		}
+		if len(updated.Worker.Nodes) != 1 || updated.Worker.Nodes[0].Host != "worker02" {
+			t.Errorf("expected updated plan to only contain worker02, but got %v", updated.Worker.Nodes)
+		}
+	}
+}
+
+func TestRemoveNodePlaybookFailure(t *testing.T) {
+	pki := &fakePKI{}
+	e := ansibleExecutor{
+		certsDir:               mustGetTempDir(t),
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		pki:                    pki,
+		runnerExplainerFactory: fakeRunnerExplainer(errors.New("exec error")),
+	}
+	p := testPlan()
+	p.Worker.Nodes = append(p.Worker.Nodes, Node{Host: "worker02", IP: "192.168.205.13"})
+	if _, err := e.RemoveNode(p, Node{Host: "worker01"}); err == nil {
+		t.Fatal("expected an error, but didn't get one")
+	}
+	if pki.removeNodeCertCalled {
+		t.Errorf("the node's certificate was removed even though the node was not removed from the cluster")
+	}
+}
@@ -0,0 +1,78 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/install/explain"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// Reset removes everything that was installed by kismatic from the nodes in
+// the plan. The services are stopped, the data of the etcd clusters, calico and
+// kubernetes is deleted, and the iptables rules are flushed. If limit is not
+// empty, only the nodes with the given hostnames are reset.
+func (ae *ansibleExecutor) Reset(p *Plan, limit []string) error {
+	if err := checkResetLimit(p, limit); err != nil {
+		return err
+	}
+	runDirectory, err := ae.createRunDirectory("reset")
+	if err != nil {
+		return fmt.Errorf("error creating working directory for reset: %v", err)
+	}
+	fp := FilePlanner{
+		File: filepath.Join(runDirectory, "kismatic-cluster.yaml"),
+	}
+	if err = fp.Write(p); err != nil {
+		return fmt.Errorf("error recording plan file to %s: %v", fp.File, err)
+	}
+	inventory := buildInventoryFromPlan(p)
+	cc, err := ae.buildInstallExtraVars(p)
+	if err != nil {
+		return err
+	}
+	ansibleLogFilename := filepath.Join(runDirectory, "ansible.log")
+	ansibleLogFile, err := os.Create(ansibleLogFilename)
+	if err != nil {
+		return fmt.Errorf("error creating ansible log file %q: %v", ansibleLogFilename, err)
+	}
+	playbook := "reset.yaml"
+	eventExplainer := &explain.DefaultEventExplainer{}
+	if len(limit) == 0 {
+		util.PrintHeader(ae.stdout, "Resetting All Nodes", '=')
+		if err = ae.runPlaybookWithExplainer(playbook, eventExplainer, inventory, *cc, ansibleLogFile, runDirectory); err != nil {
+			return fmt.Errorf("error resetting nodes: %v", err)
+		}
+		return nil
+	}
+	util.PrintHeader(ae.stdout, fmt.Sprintf("Resetting Nodes %s", strings.Join(limit, ", ")), '=')
+	runner, explainer, err := ae.getAnsibleRunnerAndExplainer(eventExplainer, ansibleLogFile, runDirectory)
+	if err != nil {
+		return err
+	}
+	eventStream, err := runner.StartPlaybookOnNode(ae.runContext(), playbook, inventory, *cc, strings.Join(limit, ","))
+	if err != nil {
+		return fmt.Errorf("error running ansible playbook: %v", err)
+	}
+	go explainer.Explain(eventStream)
+	// Wait until ansible exits
+	if err = runner.WaitPlaybook(); err != nil {
+		return fmt.Errorf("error resetting nodes: %v", err)
+	}
+	return nil
+}
+
+func checkResetLimit(p *Plan, limit []string) error {
+	hosts := []string{}
+	for _, n := range p.getAllNodes() {
+		hosts = append(hosts, n.Host)
+	}
+	for _, l := range limit {
+		if !util.Subset([]string{l}, hosts) {
+			return fmt.Errorf("node %q was not found in the plan", l)
+		}
+	}
+	return nil
+}
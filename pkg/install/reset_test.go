@@ -0,0 +1,87 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestResetAllNodes(t *testing.T) {
+	runner := &fakeRunner{}
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		pki:                    &fakePKI{},
+		certsDir:               mustGetTempDir(t),
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+	}
+	if err := e.Reset(testPlan(), nil); err != nil {
+		t.Fatalf("unexpected error resetting nodes: %v", err)
+	}
+	if !reflect.DeepEqual(runner.allNodesPlaybooks, []string{"reset.yaml"}) {
+		t.Errorf("expected reset.yaml to run on all nodes, but got %v", runner.allNodesPlaybooks)
+	}
+	if len(runner.nodes) != 0 {
+		t.Errorf("expected no limited playbook runs, but got %v", runner.nodes)
+	}
+}
+
+func TestResetLimit(t *testing.T) {
+	runner := &fakeRunner{}
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		pki:                    &fakePKI{},
+		certsDir:               mustGetTempDir(t),
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+	}
+	if err := e.Reset(testPlan(), []string{"master01", "worker01"}); err != nil {
+		t.Fatalf("unexpected error resetting nodes: %v", err)
+	}
+	if !reflect.DeepEqual(runner.nodes, []string{"master01,worker01"}) {
+		t.Errorf("expected reset to be limited to master01 and worker01, but got %v", runner.nodes)
+	}
+	if !reflect.DeepEqual(runner.nodePlaybooks, []string{"reset.yaml"}) {
+		t.Errorf("expected reset.yaml to run, but got %v", runner.nodePlaybooks)
+	}
+	if len(runner.allNodesPlaybooks) != 0 {
+		t.Errorf("expected no playbooks to run on all nodes, but got %v", runner.allNodesPlaybooks)
+	}
+}
+
+func TestResetLimitNodeNotInPlan(t *testing.T) {
+	runner := &fakeRunner{}
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		pki:                    &fakePKI{},
+		certsDir:               mustGetTempDir(t),
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+	}
+	if err := e.Reset(testPlan(), []string{"worker01", "notInPlan"}); err == nil {
+		t.Error("expected an error resetting a node that is not in the plan, but didn't get one")
+	}
+	if len(runner.nodePlaybooks) != 0 || len(runner.allNodesPlaybooks) != 0 {
+		t.Error("expected no playbooks to run")
+	}
+}
+
+func TestResetPlaybookFailure(t *testing.T) {
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		pki:                    &fakePKI{},
+		certsDir:               mustGetTempDir(t),
+		runnerExplainerFactory: fakeRunnerExplainer(errors.New("exec error")),
+	}
+	if err := e.Reset(testPlan(), nil); err == nil {
+		t.Error("expected an error, but didn't get one")
+	}
+}
@@ -0,0 +1,389 @@
+package install
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+	"github.com/apprenda/kismatic/pkg/util"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	runProgressFile = "progress.json"
+	// playbook generated in the run directory when resuming an installation
+	resumePlaybook = "_resume-kubernetes.yaml"
+	// contains the remaining plays of a partially completed include
+	resumePartialPlaybook = "_resume-kubernetes-partial.yaml"
+)
+
+// RunProgress is the progress of a playbook run, as recorded in the run directory
+type RunProgress struct {
+	// Playbook is the playbook that was run
+	Playbook string `json:"playbook"`
+	// CompletedPlays is the number of plays of the playbook that completed successfully
+	CompletedPlays int `json:"completedPlays"`
+	// CurrentPlay is the play that was running when the progress was recorded
+	CurrentPlay string `json:"currentPlay,omitempty"`
+	// FailedTask is the task that failed, if any
+	FailedTask string `json:"failedTask,omitempty"`
+	// Complete is true when all plays of the playbook completed successfully
+	Complete bool `json:"complete"`
+}
+
+// ReadRunProgress returns the progress recorded in the run directory
+func ReadRunProgress(runDirectory string) (*RunProgress, error) {
+	b, err := ioutil.ReadFile(filepath.Join(runDirectory, runProgressFile))
+	if err != nil {
+		return nil, err
+	}
+	rp := &RunProgress{}
+	if err = json.Unmarshal(b, rp); err != nil {
+		return nil, fmt.Errorf("error reading run progress: %v", err)
+	}
+	return rp, nil
+}
+
+// progressTracker records the progress of a playbook run to the run directory,
+// as the events of the run are consumed
+type progressTracker struct {
+	sync.Mutex
+	file     string
+	progress RunProgress
+	done     bool
+}
+
+func newProgressTracker(runDirectory string, progress RunProgress) *progressTracker {
+	return &progressTracker{
+		file:     filepath.Join(runDirectory, runProgressFile),
+		progress: progress,
+	}
+}
+
+// track returns a stream with the incoming events, after they have been
+// recorded by the tracker
+func (pt *progressTracker) track(in <-chan ansible.Event) <-chan ansible.Event {
+	out := make(chan ansible.Event)
+	go func() {
+		playRunning := false
+		failed := false
+		currentTask := ""
+		for e := range in {
+			switch event := e.(type) {
+			case *ansible.PlayStartEvent:
+				pt.update(func(rp *RunProgress) {
+					if playRunning && !failed {
+						rp.CompletedPlays++
+					}
+					rp.CurrentPlay = event.Name
+				})
+				playRunning = true
+			case *ansible.TaskStartEvent:
+				currentTask = event.Name
+			case *ansible.HandlerTaskStartEvent:
+				currentTask = event.Name
+			case *ansible.RunnerFailedEvent:
+				if !event.IgnoreErrors && !failed {
+					failed = true
+					pt.update(func(rp *RunProgress) { rp.FailedTask = currentTask })
+				}
+			case *ansible.RunnerUnreachableEvent:
+				if !failed {
+					failed = true
+					pt.update(func(rp *RunProgress) { rp.FailedTask = currentTask })
+				}
+			case *ansible.PlaybookEndEvent:
+				// The playbook end event is also sent when the playbook fails
+				if playRunning && !failed {
+					pt.update(func(rp *RunProgress) {
+						rp.CompletedPlays++
+						rp.CurrentPlay = ""
+						rp.Complete = true
+					})
+					playRunning = false
+				}
+			}
+			out <- e
+		}
+		close(out)
+	}()
+	return out
+}
+
+// complete records the playbook run as complete. Events consumed afterwards
+// are not recorded.
+func (pt *progressTracker) complete() error {
+	pt.Lock()
+	defer pt.Unlock()
+	pt.done = true
+	pt.progress.CurrentPlay = ""
+	pt.progress.FailedTask = ""
+	pt.progress.Complete = true
+	return pt.write()
+}
+
+func (pt *progressTracker) update(f func(*RunProgress)) {
+	pt.Lock()
+	defer pt.Unlock()
+	if pt.done {
+		return
+	}
+	f(&pt.progress)
+	// Failing to record progress should not fail the installation
+	pt.write()
+}
+
+func (pt *progressTracker) write() error {
+	b, err := json.MarshalIndent(pt.progress, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling run progress: %v", err)
+	}
+	if err = ioutil.WriteFile(pt.file, b, 0644); err != nil {
+		return fmt.Errorf("error writing run progress to %q: %v", pt.file, err)
+	}
+	return nil
+}
+
+func (ae *ansibleExecutor) runPlaybookWithProgress(playbook string, tracker *progressTracker, eventExplainer explain.AnsibleEventExplainer, inv ansible.Inventory, cc ansible.ClusterCatalog, ansibleLog io.Writer, runDirectory string) error {
+	if err := tracker.write(); err != nil {
+		return err
+	}
+	runner, explainer, err := ae.getAnsibleRunnerAndExplainer(eventExplainer, ansibleLog, runDirectory)
+	if err != nil {
+		return err
+	}
+	eventStream, err := runner.StartPlaybook(ae.runContext(), playbook, inv, cc)
+	if err != nil {
+		return fmt.Errorf("error running ansible playbook: %v", err)
+	}
+	go explainer.Explain(tracker.track(eventStream))
+	if err = runner.WaitPlaybook(); err != nil {
+		return fmt.Errorf("error running playbook: %v", err)
+	}
+	return tracker.complete()
+}
+
+// ResumeInstall resumes the last installation run from the first play that did
+// not complete, using the plan and cluster catalog recorded in the run. An error
+// is returned if the plan has changed since the installation run.
+func (ae *ansibleExecutor) ResumeInstall(p *Plan) error {
+	lastRun, err := lastRunDirectory(filepath.Join(ae.options.RunsDirectory, "install"))
+	if err != nil {
+		return err
+	}
+	progress, err := ReadRunProgress(lastRun)
+	if err != nil {
+		return fmt.Errorf("cannot resume installation run %q: %v", lastRun, err)
+	}
+	if progress.Complete {
+		return fmt.Errorf("installation run %q completed successfully, there is nothing to resume", lastRun)
+	}
+	runPlanner := FilePlanner{File: filepath.Join(lastRun, "kismatic-cluster.yaml")}
+	runPlan, err := runPlanner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file of installation run %q: %v", lastRun, err)
+	}
+	changed, err := plansDiffer(p, runPlan)
+	if err != nil {
+		return err
+	}
+	if changed {
+		return fmt.Errorf("the plan file has changed since installation run %q, cannot resume", lastRun)
+	}
+	ccBytes, err := ioutil.ReadFile(filepath.Join(lastRun, "clustercatalog.yaml"))
+	if err != nil {
+		return fmt.Errorf("error reading cluster catalog of installation run %q: %v", lastRun, err)
+	}
+	cc := ansible.ClusterCatalog{}
+	if err = yaml.Unmarshal(ccBytes, &cc); err != nil {
+		return fmt.Errorf("error reading cluster catalog of installation run %q: %v", lastRun, err)
+	}
+	playbooksDir := filepath.Join(ae.ansibleDir, "playbooks")
+	includes, partial, totalPlays, err := resumePlays(playbooksDir, progress.Playbook, progress.CompletedPlays)
+	if err != nil {
+		return err
+	}
+
+	runDirectory, err := ae.createRunDirectory("install")
+	if err != nil {
+		return fmt.Errorf("error creating working directory for installation: %v", err)
+	}
+	playbook, err := writeResumePlaybook(runDirectory, playbooksDir, includes, partial)
+	if err != nil {
+		return err
+	}
+	fp := FilePlanner{
+		File: filepath.Join(runDirectory, "kismatic-cluster.yaml"),
+	}
+	if err = fp.Write(runPlan); err != nil {
+		return fmt.Errorf("error recording plan file to %s: %v", fp.File, err)
+	}
+	inventory := buildInventoryFromPlan(runPlan)
+	ansibleLogFilename := filepath.Join(runDirectory, "ansible.log")
+	ansibleLogFile, err := os.Create(ansibleLogFilename)
+	if err != nil {
+		return fmt.Errorf("error creating ansible log file %q: %v", ansibleLogFilename, err)
+	}
+	util.PrintHeader(ae.stdout, fmt.Sprintf("Resuming Installation From Play %d/%d", progress.CompletedPlays+1, totalPlays), '=')
+	// Plays are counted from the beginning of the original playbook, so that
+	// this run can also be resumed
+	tracker := newProgressTracker(runDirectory, RunProgress{
+		Playbook:       progress.Playbook,
+		CompletedPlays: progress.CompletedPlays,
+	})
+	eventExplainer := &explain.DefaultEventExplainer{}
+	return ae.runPlaybookWithProgress(playbook, tracker, eventExplainer, inventory, cc, ansibleLogFile, runDirectory)
+}
+
+// returns the most recent run directory in the given directory
+func lastRunDirectory(dir string) (string, error) {
+	// Runs are named after their timestamp, and ReadDir sorts them by name
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("no runs found in %q", dir)
+		}
+		return "", fmt.Errorf("error reading runs directory: %v", err)
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		if files[i].IsDir() {
+			return filepath.Join(dir, files[i].Name()), nil
+		}
+	}
+	return "", fmt.Errorf("no runs found in %q", dir)
+}
+
+// compares the plans as they would be written to the plan file
+func plansDiffer(p1, p2 *Plan) (bool, error) {
+	b1, err := yaml.Marshal(p1)
+	if err != nil {
+		return false, fmt.Errorf("error marshalling plan to yaml: %v", err)
+	}
+	b2, err := yaml.Marshal(p2)
+	if err != nil {
+		return false, fmt.Errorf("error marshalling plan to yaml: %v", err)
+	}
+	return !bytes.Equal(b1, b2), nil
+}
+
+type playbookInclude struct {
+	Include string `yaml:"include"`
+	When    string `yaml:"when,omitempty"`
+}
+
+// resumePlays returns the includes of the given playbook that have plays left to run after
+// the first completed plays, and the remaining plays of the include that completed partially,
+// if any. The playbook must only consist of includes. Returns the total number of plays in the playbook.
+func resumePlays(playbooksDir, playbook string, completedPlays int) ([]playbookInclude, []yaml.MapSlice, int, error) {
+	includes := []playbookInclude{}
+	if err := readYAMLFile(filepath.Join(playbooksDir, playbook), &includes); err != nil {
+		return nil, nil, 0, err
+	}
+	totalPlays := 0
+	resume := []playbookInclude{}
+	var partial []yaml.MapSlice
+	for _, inc := range includes {
+		if inc.Include == "" {
+			return nil, nil, 0, fmt.Errorf("playbook %q cannot be resumed, it must only consist of includes", playbook)
+		}
+		plays := []yaml.MapSlice{}
+		if err := readYAMLFile(filepath.Join(playbooksDir, inc.Include), &plays); err != nil {
+			return nil, nil, 0, err
+		}
+		start := totalPlays
+		totalPlays += len(plays)
+		switch {
+		case totalPlays <= completedPlays:
+			// All the plays of the include completed
+		case start >= completedPlays:
+			resume = append(resume, inc)
+		default:
+			// The include completed partially, only run the remaining plays
+			partial = plays[completedPlays-start:]
+			resume = append(resume, playbookInclude{Include: resumePartialPlaybook, When: inc.When})
+		}
+	}
+	if completedPlays >= totalPlays {
+		return nil, nil, 0, fmt.Errorf("all the plays of playbook %q completed, there is nothing to resume", playbook)
+	}
+	return resume, partial, totalPlays, nil
+}
+
+// writeResumePlaybook writes the playbook that runs the includes and the partial plays to dir,
+// and returns its absolute path. The includes point to the playbooks directory. The partial plays
+// find the roles and variables of the playbooks directory through symbolic links in dir.
+func writeResumePlaybook(dir, playbooksDir string, includes []playbookInclude, partial []yaml.MapSlice) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("error getting absolute path of run directory: %v", err)
+	}
+	playbooksDir, err = filepath.Abs(playbooksDir)
+	if err != nil {
+		return "", fmt.Errorf("error getting absolute path of playbooks directory: %v", err)
+	}
+	for _, name := range []string{"group_vars", "roles"} {
+		target := filepath.Join(playbooksDir, name)
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			return "", fmt.Errorf("error linking %q to the run directory: %v", target, err)
+		}
+	}
+	resume := []playbookInclude{}
+	for _, inc := range includes {
+		if inc.Include == resumePartialPlaybook {
+			inc.Include = filepath.Join(dir, resumePartialPlaybook)
+		} else {
+			inc.Include = filepath.Join(playbooksDir, inc.Include)
+		}
+		resume = append(resume, inc)
+	}
+	if partial != nil {
+		// Plays can include other playbooks
+		for _, play := range partial {
+			for i, item := range play {
+				if inc, ok := item.Value.(string); ok && item.Key == "include" && !filepath.IsAbs(inc) {
+					play[i].Value = filepath.Join(playbooksDir, inc)
+				}
+			}
+		}
+		if err := writeYAMLFile(filepath.Join(dir, resumePartialPlaybook), partial); err != nil {
+			return "", err
+		}
+	}
+	playbook := filepath.Join(dir, resumePlaybook)
+	if err := writeYAMLFile(playbook, resume); err != nil {
+		return "", err
+	}
+	return playbook, nil
+}
+
+func readYAMLFile(file string, out interface{}) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("error reading %q: %v", file, err)
+	}
+	if err = yaml.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("error unmarshalling %q: %v", file, err)
+	}
+	return nil
+}
+
+func writeYAMLFile(file string, in interface{}) error {
+	b, err := yaml.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("error marshalling %q: %v", file, err)
+	}
+	if err = ioutil.WriteFile(file, b, 0644); err != nil {
+		return fmt.Errorf("error writing %q: %v", file, err)
+	}
+	return nil
+}
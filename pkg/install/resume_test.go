@@ -0,0 +1,306 @@
+package install
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func trackEvents(t *testing.T, jsonLines string) *RunProgress {
+	runDir := mustGetTempDir(t)
+	tracker := newProgressTracker(runDir, RunProgress{Playbook: "kubernetes.yaml"})
+	for range tracker.track(ansible.EventStream(bytes.NewBufferString(jsonLines))) {
+	}
+	rp, err := ReadRunProgress(runDir)
+	if err != nil {
+		t.Fatalf("unexpected error reading run progress: %v", err)
+	}
+	return rp
+}
+
+func TestProgressTrackerFailedPlay(t *testing.T) {
+	rp := trackEvents(t, `{"eventType":"PLAYBOOK_START", "eventData": {"name":"kubernetes.yaml", "count": 3}}
+{"eventType":"PLAY_START", "eventData": {"name":"play1"}}
+{"eventType":"TASK_START", "eventData": {"name":"task1"}}
+{"eventType":"RUNNER_OK", "eventData": {"host":"node1"}}
+{"eventType":"PLAY_START", "eventData": {"name":"play2"}}
+{"eventType":"TASK_START", "eventData": {"name":"task2"}}
+{"eventType":"RUNNER_FAILED", "eventData": {"host":"node1", "ignoreErrors": true}}
+{"eventType":"TASK_START", "eventData": {"name":"task3"}}
+{"eventType":"RUNNER_FAILED", "eventData": {"host":"node1"}}
+{"eventType":"PLAYBOOK_END", "eventData": {"name":"kubernetes.yaml"}}
+`)
+	expected := RunProgress{
+		Playbook:       "kubernetes.yaml",
+		CompletedPlays: 1,
+		CurrentPlay:    "play2",
+		FailedTask:     "task3",
+	}
+	if !reflect.DeepEqual(*rp, expected) {
+		t.Errorf("expected progress %+v, but got %+v", expected, *rp)
+	}
+}
+
+func TestProgressTrackerCompletePlaybook(t *testing.T) {
+	rp := trackEvents(t, `{"eventType":"PLAYBOOK_START", "eventData": {"name":"kubernetes.yaml", "count": 2}}
+{"eventType":"PLAY_START", "eventData": {"name":"play1"}}
+{"eventType":"PLAY_START", "eventData": {"name":"play2"}}
+{"eventType":"PLAYBOOK_END", "eventData": {"name":"kubernetes.yaml"}}
+`)
+	if !rp.Complete || rp.CompletedPlays != 2 {
+		t.Errorf("expected playbook to be complete with 2 plays, but got %+v", *rp)
+	}
+}
+
+func writeTestPlaybooks(t *testing.T) string {
+	dir := mustGetTempDir(t)
+	files := map[string]string{
+		"kubernetes.yaml": `---
+  - include: _one.yaml
+  - include: _two.yaml
+    when: some_condition|bool == true
+  - include: _three.yaml
+`,
+		"_one.yaml": `---
+  - hosts: all
+    name: "One"
+`,
+		"_two.yaml": `---
+  - hosts: all
+    name: "Two A"
+  - hosts: all
+    name: "Two B"
+`,
+		"_three.yaml": `---
+  - hosts: all
+    name: "Three"
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("error writing test playbook: %v", err)
+		}
+	}
+	return dir
+}
+
+func readTestIncludes(t *testing.T, file string) []playbookInclude {
+	includes := []playbookInclude{}
+	if err := readYAMLFile(file, &includes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return includes
+}
+
+func TestWriteResumePlaybook(t *testing.T) {
+	tests := []struct {
+		completedPlays   int
+		expectedIncludes []playbookInclude
+		partialPlays     []string
+	}{
+		{
+			completedPlays: 0,
+			expectedIncludes: []playbookInclude{
+				{Include: "_one.yaml"},
+				{Include: "_two.yaml", When: "some_condition|bool == true"},
+				{Include: "_three.yaml"},
+			},
+		},
+		{
+			completedPlays: 1,
+			expectedIncludes: []playbookInclude{
+				{Include: "_two.yaml", When: "some_condition|bool == true"},
+				{Include: "_three.yaml"},
+			},
+		},
+		{
+			completedPlays: 2,
+			expectedIncludes: []playbookInclude{
+				{Include: resumePartialPlaybook, When: "some_condition|bool == true"},
+				{Include: "_three.yaml"},
+			},
+			partialPlays: []string{"Two B"},
+		},
+		{
+			completedPlays: 3,
+			expectedIncludes: []playbookInclude{
+				{Include: "_three.yaml"},
+			},
+		},
+	}
+	for _, test := range tests {
+		playbooksDir := writeTestPlaybooks(t)
+		if err := os.Mkdir(filepath.Join(playbooksDir, "roles"), 0755); err != nil {
+			t.Fatalf("error creating roles directory: %v", err)
+		}
+		includes, partial, total, err := resumePlays(playbooksDir, "kubernetes.yaml", test.completedPlays)
+		if err != nil {
+			t.Errorf("%d completed plays: unexpected error: %v", test.completedPlays, err)
+			continue
+		}
+		if total != 4 {
+			t.Errorf("%d completed plays: expected 4 plays in total, but got %d", test.completedPlays, total)
+		}
+		dir := mustGetTempDir(t)
+		playbook, err := writeResumePlaybook(dir, playbooksDir, includes, partial)
+		if err != nil {
+			t.Errorf("%d completed plays: unexpected error writing playbook: %v", test.completedPlays, err)
+			continue
+		}
+		if playbook != filepath.Join(dir, resumePlaybook) {
+			t.Errorf("%d completed plays: expected playbook %q, but got %q", test.completedPlays, filepath.Join(dir, resumePlaybook), playbook)
+		}
+		// The includes are absolute paths, the partial playbook is in the same directory
+		for i, inc := range test.expectedIncludes {
+			if inc.Include == resumePartialPlaybook {
+				test.expectedIncludes[i].Include = filepath.Join(dir, inc.Include)
+			} else {
+				test.expectedIncludes[i].Include = filepath.Join(playbooksDir, inc.Include)
+			}
+		}
+		includes = readTestIncludes(t, playbook)
+		if !reflect.DeepEqual(includes, test.expectedIncludes) {
+			t.Errorf("%d completed plays: expected includes %v, but got %v", test.completedPlays, test.expectedIncludes, includes)
+		}
+		if target, err := os.Readlink(filepath.Join(dir, "roles")); err != nil || target != filepath.Join(playbooksDir, "roles") {
+			t.Errorf("%d completed plays: expected roles to be linked to %q, but got %q (%v)", test.completedPlays, filepath.Join(playbooksDir, "roles"), target, err)
+		}
+		if test.partialPlays == nil {
+			continue
+		}
+		plays := []struct {
+			Name string `yaml:"name"`
+		}{}
+		if err := readYAMLFile(filepath.Join(dir, resumePartialPlaybook), &plays); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names := []string{}
+		for _, p := range plays {
+			names = append(names, p.Name)
+		}
+		if !reflect.DeepEqual(names, test.partialPlays) {
+			t.Errorf("%d completed plays: expected partial plays %v, but got %v", test.completedPlays, test.partialPlays, names)
+		}
+	}
+}
+
+func TestResumePlaysAllPlaysComplete(t *testing.T) {
+	dir := writeTestPlaybooks(t)
+	if _, _, _, err := resumePlays(dir, "kubernetes.yaml", 4); err == nil {
+		t.Error("expected an error when all plays completed, but didn't get one")
+	}
+}
+
+// writes an installation run of the plan with the given progress to the runs directory
+func mustWriteInstallRun(t *testing.T, runsDir string, p *Plan, progress RunProgress) {
+	runDir := filepath.Join(runsDir, "install", "2017-01-01-00-00-00")
+	if err := os.MkdirAll(runDir, 0777); err != nil {
+		t.Fatalf("error creating run directory: %v", err)
+	}
+	fp := FilePlanner{File: filepath.Join(runDir, "kismatic-cluster.yaml")}
+	if err := fp.Write(p); err != nil {
+		t.Fatalf("error writing plan: %v", err)
+	}
+	cc, err := yaml.Marshal(ansible.ClusterCatalog{ClusterName: "resumed"})
+	if err != nil {
+		t.Fatalf("error marshalling cluster catalog: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(runDir, "clustercatalog.yaml"), cc, 0644); err != nil {
+		t.Fatalf("error writing cluster catalog: %v", err)
+	}
+	if err := newProgressTracker(runDir, progress).write(); err != nil {
+		t.Fatalf("error writing progress: %v", err)
+	}
+}
+
+func TestResumeInstall(t *testing.T) {
+	var cc ansible.ClusterCatalog
+	runner := &fakeRunner{
+		onStartPlaybook: func(playbook string, catalog ansible.ClusterCatalog) { cc = catalog },
+	}
+	ansibleDir := mustGetTempDir(t)
+	if err := os.Rename(writeTestPlaybooks(t), filepath.Join(ansibleDir, "playbooks")); err != nil {
+		t.Fatalf("error moving test playbooks: %v", err)
+	}
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		ansibleDir:             ansibleDir,
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+	}
+	p := testPlan()
+	mustWriteInstallRun(t, e.options.RunsDirectory, p, RunProgress{Playbook: "kubernetes.yaml", CompletedPlays: 3})
+	if err := e.ResumeInstall(p); err != nil {
+		t.Fatalf("unexpected error resuming installation: %v", err)
+	}
+	if cc.ClusterName != "resumed" {
+		t.Errorf("expected cluster catalog of the installation run to be used, but got %+v", cc)
+	}
+	// The resumed run is recorded as the last installation run
+	lastRun, err := lastRunDirectory(filepath.Join(e.options.RunsDirectory, "install"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The resume playbook is written to the run directory
+	if !reflect.DeepEqual(runner.allNodesPlaybooks, []string{filepath.Join(lastRun, resumePlaybook)}) {
+		t.Errorf("expected resume playbook of run %q to run, but got %v", lastRun, runner.allNodesPlaybooks)
+	}
+	if _, err := os.Stat(filepath.Join(e.ansibleDir, "playbooks", resumePlaybook)); !os.IsNotExist(err) {
+		t.Errorf("expected no resume playbook in the playbooks directory")
+	}
+	rp, err := ReadRunProgress(lastRun)
+	if err != nil {
+		t.Fatalf("unexpected error reading run progress: %v", err)
+	}
+	if !rp.Complete {
+		t.Errorf("expected resumed run to be complete, but got %+v", *rp)
+	}
+}
+
+func TestResumeInstallPlanChanged(t *testing.T) {
+	runner := &fakeRunner{}
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+	}
+	mustWriteInstallRun(t, e.options.RunsDirectory, testPlan(), RunProgress{Playbook: "kubernetes.yaml", CompletedPlays: 1})
+	p := testPlan()
+	p.Worker.Nodes = append(p.Worker.Nodes, Node{Host: "worker02"})
+	if err := e.ResumeInstall(p); err == nil {
+		t.Error("expected an error resuming with a changed plan, but didn't get one")
+	}
+	if len(runner.allNodesPlaybooks) != 0 {
+		t.Errorf("expected no playbooks to run, but got %v", runner.allNodesPlaybooks)
+	}
+}
+
+func TestResumeInstallRunComplete(t *testing.T) {
+	e := ansibleExecutor{
+		options: ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:  ioutil.Discard,
+	}
+	p := testPlan()
+	mustWriteInstallRun(t, e.options.RunsDirectory, p, RunProgress{Playbook: "kubernetes.yaml", CompletedPlays: 4, Complete: true})
+	if err := e.ResumeInstall(p); err == nil {
+		t.Error("expected an error resuming a complete installation, but didn't get one")
+	}
+}
+
+func TestResumeInstallNoRuns(t *testing.T) {
+	e := ansibleExecutor{
+		options: ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:  ioutil.Discard,
+	}
+	if err := e.ResumeInstall(testPlan()); err == nil {
+		t.Error("expected an error when there are no installation runs, but didn't get one")
+	}
+}
@@ -0,0 +1,125 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/install/explain"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// CertificateRotation are the certificates to be re-issued
+type CertificateRotation struct {
+	// Nodes whose certificates are re-issued
+	Nodes []Node
+	// Users whose certificates are re-issued
+	Users []string
+	// ServiceAccount is true if the key used for signing service account
+	// tokens is re-issued
+	ServiceAccount bool
+}
+
+// RotateCertificates re-issues the certificates using the existing cluster CA,
+// and distributes them to the nodes. The components that use the certificates
+// are restarted in order: etcd one member at a time, then the API servers,
+// then the kubelets. Only the nodes whose certificates were re-issued are
+// affected, unless the service account key is re-issued, in which case the
+// key is distributed to all nodes.
+func (ae *ansibleExecutor) RotateCertificates(p *Plan, r CertificateRotation) error {
+	pki, err := ae.planPKI(p)
+	if err != nil {
+		return err
+	}
+	ca, err := pki.GetClusterCA()
+	if err != nil {
+		return err
+	}
+	util.PrintHeader(ae.stdout, "Rotating Certificates", '=')
+	for _, n := range r.Nodes {
+		if err = pki.RotateNodeCertificate(p, n, ca); err != nil {
+			return fmt.Errorf("error rotating certificate of node %q: %v", n.Host, err)
+		}
+	}
+	for _, u := range r.Users {
+		// The users whose credentials were created are re-issued with their recorded groups
+		rotated, err := ae.rotateUserCredentials(p, pki, ca, u)
+		if err != nil {
+			return fmt.Errorf("error rotating credentials of user %q: %v", u, err)
+		}
+		if rotated {
+			continue
+		}
+		if err = pki.RotateUserCertificate(p, u, ca); err != nil {
+			return fmt.Errorf("error rotating certificate of user %q: %v", u, err)
+		}
+	}
+	if r.ServiceAccount {
+		if err = pki.RotateServiceAccountCertificate(p, ca); err != nil {
+			return fmt.Errorf("error rotating service account certificate: %v", err)
+		}
+	}
+	limit := []string{}
+	if r.ServiceAccount {
+		for _, n := range p.getAllNodes() {
+			if !util.Subset([]string{n.Host}, limit) {
+				limit = append(limit, n.Host)
+			}
+		}
+	} else {
+		for _, n := range r.Nodes {
+			limit = append(limit, n.Host)
+		}
+	}
+	// User certificates are not deployed to the nodes
+	if len(limit) == 0 {
+		return nil
+	}
+
+	runDirectory, err := ae.createRunDirectory("rotate-certificates")
+	if err != nil {
+		return fmt.Errorf("error creating working directory for certificate rotation: %v", err)
+	}
+	fp := FilePlanner{
+		File: filepath.Join(runDirectory, "kismatic-cluster.yaml"),
+	}
+	if err = fp.Write(p); err != nil {
+		return fmt.Errorf("error recording plan file to %s: %v", fp.File, err)
+	}
+	inventory := buildInventoryFromPlan(p)
+	cc, err := ae.buildInstallExtraVars(p)
+	if err != nil {
+		return err
+	}
+	// Restart the components so that they pick up the new certificates
+	cc.ForceEtcdRestart = true
+	cc.ForceAPIServerRestart = true
+	cc.ForceControllerManagerRestart = true
+	cc.ForceSchedulerRestart = true
+	cc.ForceKubeletRestart = true
+	cc.ForceProxyRestart = true
+	cc.ReissueServiceAccountTokens = r.ServiceAccount
+	ansibleLogFilename := filepath.Join(runDirectory, "ansible.log")
+	ansibleLogFile, err := os.Create(ansibleLogFilename)
+	if err != nil {
+		return fmt.Errorf("error creating ansible log file %q: %v", ansibleLogFilename, err)
+	}
+	util.PrintHeader(ae.stdout, fmt.Sprintf("Distributing Certificates To Nodes %s", strings.Join(limit, ", ")), '=')
+	playbook := "rotate-certificates.yaml"
+	eventExplainer := &explain.DefaultEventExplainer{}
+	runner, explainer, err := ae.getAnsibleRunnerAndExplainer(eventExplainer, ansibleLogFile, runDirectory)
+	if err != nil {
+		return err
+	}
+	eventStream, err := runner.StartPlaybookOnNode(ae.runContext(), playbook, inventory, *cc, strings.Join(limit, ","))
+	if err != nil {
+		return fmt.Errorf("error running ansible playbook: %v", err)
+	}
+	go explainer.Explain(eventStream)
+	// Wait until ansible exits
+	if err = runner.WaitPlaybook(); err != nil {
+		return fmt.Errorf("error distributing certificates: %v", err)
+	}
+	return nil
+}
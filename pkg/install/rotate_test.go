@@ -0,0 +1,125 @@
+package install
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+func TestRotateCertificates(t *testing.T) {
+	tests := []struct {
+		rotation      CertificateRotation
+		expectedCerts []string
+		expectedLimit []string
+	}{
+		{
+			rotation:      CertificateRotation{Nodes: []Node{{Host: "worker01"}}},
+			expectedCerts: []string{"worker01"},
+			expectedLimit: []string{"worker01"},
+		},
+		{
+			rotation:      CertificateRotation{Users: []string{"admin"}},
+			expectedCerts: []string{"admin"},
+		},
+		{
+			// The service account key is distributed to all nodes
+			rotation:      CertificateRotation{Nodes: []Node{{Host: "etcd01"}}, ServiceAccount: true},
+			expectedCerts: []string{"etcd01", "service-account"},
+			expectedLimit: []string{"etcd01,master01,worker01"},
+		},
+	}
+	for i, test := range tests {
+		pki := &fakePKI{}
+		runner := &fakeRunner{}
+		e := ansibleExecutor{
+			options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+			stdout:                 ioutil.Discard,
+			consoleOutputFormat:    ansible.RawFormat,
+			pki:                    pki,
+			certsDir:               mustGetTempDir(t),
+			runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+		}
+		if err := e.RotateCertificates(testPlan(), test.rotation); err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(pki.rotatedCerts, test.expectedCerts) {
+			t.Errorf("test %d: expected rotated certificates %v, but got %v", i, test.expectedCerts, pki.rotatedCerts)
+		}
+		if !reflect.DeepEqual(runner.nodes, test.expectedLimit) {
+			t.Errorf("test %d: expected playbook to be limited to %v, but got %v", i, test.expectedLimit, runner.nodes)
+		}
+		if test.expectedLimit != nil && !reflect.DeepEqual(runner.nodePlaybooks, []string{"rotate-certificates.yaml"}) {
+			t.Errorf("test %d: expected rotation playbook to run, but got %v", i, runner.nodePlaybooks)
+		}
+		if runner.incomingCatalog.ReissueServiceAccountTokens != test.rotation.ServiceAccount {
+			t.Errorf("test %d: expected service account tokens to be reissued only when the service account key is rotated", i)
+		}
+	}
+}
+
+func TestRotateNodeCertificateKeepsPreviousCertificate(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	p := getPlan()
+	ca, err := pki.GenerateClusterCA(p)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	node := p.Master.Nodes[0]
+	if err = pki.GenerateNodeCertificate(p, node, ca); err != nil {
+		t.Fatalf("error generating node certificate: %v", err)
+	}
+	original := mustReadCertFile(pki.GeneratedCertsDirectory+"/master.pem", t)
+	if err = pki.RotateNodeCertificate(p, node, ca); err != nil {
+		t.Fatalf("unexpected error rotating node certificate: %v", err)
+	}
+	rotated := mustReadCertFile(pki.GeneratedCertsDirectory+"/master.pem", t)
+	if rotated.SerialNumber.Cmp(original.SerialNumber) == 0 {
+		t.Errorf("expected a new certificate to be issued")
+	}
+	if rotated.Subject.CommonName != original.Subject.CommonName {
+		t.Errorf("expected CN %q, but got %q", original.Subject.CommonName, rotated.Subject.CommonName)
+	}
+	dirs, err := ioutil.ReadDir(pki.GeneratedCertsDirectory + "/rotated")
+	if err != nil || len(dirs) != 1 {
+		t.Fatalf("expected a rotated certificates directory, but got %v (error: %v)", dirs, err)
+	}
+	previous := mustReadCertFile(pki.GeneratedCertsDirectory+"/rotated/"+dirs[0].Name()+"/master.pem", t)
+	if previous.SerialNumber.Cmp(original.SerialNumber) != 0 {
+		t.Errorf("expected the previous certificate to be kept")
+	}
+}
+
+func TestRotateServiceAccountCertificateTrustsPreviousCertificate(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	p := getPlan()
+	ca, err := pki.GenerateClusterCA(p)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	if err = pki.generateServiceAccountCert(p, ca); err != nil {
+		t.Fatalf("error generating service account certificate: %v", err)
+	}
+	original := mustReadCertFile(pki.GeneratedCertsDirectory+"/service-account.pem", t)
+	if err = pki.RotateServiceAccountCertificate(p, ca); err != nil {
+		t.Fatalf("unexpected error rotating service account certificate: %v", err)
+	}
+	rotated := mustReadCertFile(pki.GeneratedCertsDirectory+"/service-account.pem", t)
+	trustedPEM, err := ioutil.ReadFile(pki.GeneratedCertsDirectory + "/" + serviceAccountTrustedCertsFile)
+	if err != nil {
+		t.Fatalf("error reading trusted service account certificates: %v", err)
+	}
+	trusted, err := helpers.ParseCertificatesPEM(trustedPEM)
+	if err != nil {
+		t.Fatalf("error parsing trusted service account certificates: %v", err)
+	}
+	// The tokens signed with the previous key are still verified by the API servers
+	if len(trusted) != 2 || trusted[0].SerialNumber.Cmp(rotated.SerialNumber) != 0 || trusted[1].SerialNumber.Cmp(original.SerialNumber) != 0 {
+		t.Errorf("expected the new and the previous service account certificates to be trusted, but got %d certificates", len(trusted))
+	}
+}
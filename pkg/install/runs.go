@@ -0,0 +1,379 @@
+package install
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+)
+
+// The outcomes of a run
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	// RunIncomplete is the outcome of a run that was interrupted, or is still running
+	RunIncomplete = "incomplete"
+	// RunUnknown is the outcome of a run that did not record an ansible log
+	RunUnknown = "unknown"
+)
+
+// RunRecordedFiles are the files recorded in a run directory that describe what was run
+var RunRecordedFiles = []string{"kismatic-cluster.yaml", "inventory.ini", "clustercatalog.yaml"}
+
+// Run is a run of kismatic, as recorded in the runs directory
+type Run struct {
+	// ID is the operation and timestamp of the run, e.g. "install/2017-03-01-10-00-00"
+	ID        string    `json:"id"`
+	Operation string    `json:"operation"`
+	Directory string    `json:"directory"`
+	Start     time.Time `json:"start"`
+	// End is the time of the last line of the ansible log
+	End         *time.Time `json:"end,omitempty"`
+	Outcome     string     `json:"outcome"`
+	FailedTask  string     `json:"failedTask,omitempty"`
+	FailedHosts []string   `json:"failedHosts,omitempty"`
+}
+
+// Duration returns the duration of the run, or 0 if its end is unknown
+func (r Run) Duration() time.Duration {
+	if r.End == nil || r.End.Before(r.Start) {
+		return 0
+	}
+	return r.End.Sub(r.Start)
+}
+
+// ListRuns returns the runs in the runs directory, from the oldest to the most recent
+func ListRuns(runsDir string) ([]Run, error) {
+	runs := []Run{}
+	ops, err := ioutil.ReadDir(runsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return runs, nil
+		}
+		return nil, fmt.Errorf("error reading runs directory: %v", err)
+	}
+	for _, op := range ops {
+		if !op.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(runsDir, op.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading runs directory: %v", err)
+		}
+		for _, f := range files {
+			if !f.IsDir() {
+				continue
+			}
+			r, err := ReadRun(filepath.Join(runsDir, op.Name(), f.Name()))
+			if err != nil {
+				// Directories that are not named after a timestamp are not runs
+				continue
+			}
+			runs = append(runs, *r)
+		}
+	}
+	sort.Sort(runsByStart(runs))
+	return runs, nil
+}
+
+type runsByStart []Run
+
+func (r runsByStart) Len() int      { return len(r) }
+func (r runsByStart) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r runsByStart) Less(i, j int) bool {
+	if r[i].Start.Equal(r[j].Start) {
+		return r[i].Operation < r[j].Operation
+	}
+	return r[i].Start.Before(r[j].Start)
+}
+
+// FindRun returns the run with the given ID in the runs directory, or the run in the
+// given directory. The most recent run is returned if the ID is empty.
+func FindRun(runsDir, id string) (*Run, error) {
+	if id == "" {
+		runs, err := ListRuns(runsDir)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) == 0 {
+			return nil, fmt.Errorf("no runs found in %q", runsDir)
+		}
+		return &runs[len(runs)-1], nil
+	}
+	dir := filepath.Join(runsDir, id)
+	if fi, err := os.Stat(id); err == nil && fi.IsDir() {
+		dir = id
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("run %q not found in %q", id, runsDir)
+	}
+	return ReadRun(dir)
+}
+
+// ReadRun returns the run recorded in the run directory. The outcome of the run is
+// derived from its recorded progress, or from the play recaps of its ansible log and
+// the playbooks of its recorded events.
+func ReadRun(runDir string) (*Run, error) {
+	timestamp := filepath.Base(runDir)
+	// Run directories are named after the local time at which they were created
+	start, err := time.ParseInLocation("2006-01-02-15-04-05", timestamp, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a run directory", runDir)
+	}
+	op := filepath.Base(filepath.Dir(runDir))
+	r := &Run{
+		ID:        op + "/" + timestamp,
+		Operation: op,
+		Directory: runDir,
+		Start:     start,
+		Outcome:   RunUnknown,
+	}
+	logFile := filepath.Join(runDir, "ansible.log")
+	if fi, err := os.Stat(logFile); err == nil {
+		summary, err := readAnsibleLog(logFile)
+		if err != nil {
+			return nil, err
+		}
+		r.Outcome = summary.outcome
+		r.FailedTask = summary.failedTask
+		r.FailedHosts = summary.failedHosts
+		r.End = summary.end
+		if r.End == nil {
+			end := fi.ModTime()
+			r.End = &end
+		}
+	}
+	// Operations run several playbooks that log to the same file, so the recaps
+	// of the playbooks that completed don't tell whether the last one did
+	if r.Outcome == RunSucceeded {
+		started, ended, err := countPlaybooks(filepath.Join(runDir, ansible.EventsFile))
+		if err != nil {
+			return nil, err
+		}
+		if started > ended {
+			r.Outcome = RunIncomplete
+		}
+	}
+	// Installation runs record their progress, which is more accurate than the log
+	if progress, err := ReadRunProgress(runDir); err == nil {
+		switch {
+		case progress.Complete:
+			r.Outcome = RunSucceeded
+			r.FailedTask = ""
+			r.FailedHosts = nil
+		case progress.FailedTask != "":
+			r.Outcome = RunFailed
+			r.FailedTask = progress.FailedTask
+		case r.Outcome == RunSucceeded:
+			// Not all the plays of the playbook completed
+			r.Outcome = RunIncomplete
+		}
+	}
+	return r, nil
+}
+
+// ReadRunFile returns the file recorded in the run directory, with the values
+// of settings that look like secrets redacted
+func ReadRunFile(runDir, name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filepath.Join(runDir, name))
+	if err != nil {
+		return nil, err
+	}
+	return redactSecrets(b, nil), nil
+}
+
+// ReplayRun explains the events recorded in the run directory, as they
+// were explained while the run was performed
+func ReplayRun(runDir string, explainer *explain.AnsibleEventStreamExplainer) error {
+	f, err := os.Open(filepath.Join(runDir, ansible.EventsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("the events of run %q were not recorded", runDir)
+		}
+		return fmt.Errorf("error reading events of run %q: %v", runDir, err)
+	}
+	defer f.Close()
+	return explainer.Explain(ansible.EventStream(f))
+}
+
+// the outcome of a run, as recorded in its ansible log
+type ansibleLogSummary struct {
+	outcome     string
+	failedTask  string
+	failedHosts []string
+	end         *time.Time
+}
+
+var (
+	ansibleTaskPattern    = regexp.MustCompile(`^(?:TASK|RUNNING HANDLER):? \[(.*)\]`)
+	ansibleFailurePattern = regexp.MustCompile(`^(?:fatal|failed): \[([^\]]+)\]`)
+	ansibleRecapPattern   = regexp.MustCompile(`^\S+\s+:\s+ok=\d+\s+changed=\d+\s+unreachable=(\d+)\s+failed=(\d+)`)
+)
+
+// reads the tasks, failures and play recaps of the ansible log, whose lines
+// are prefixed with their timestamp
+func readAnsibleLog(file string) (*ansibleLogSummary, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ansible log: %v", err)
+	}
+	defer f.Close()
+	summary := &ansibleLogSummary{outcome: RunIncomplete}
+	recaps, failedRecaps := 0, 0
+	inRecap := false
+	currentTask, failedTask := "", ""
+	failedHosts := []string{}
+	// The lines of a verbose log can be longer than a scanner's buffer
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading ansible log: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if parts := strings.SplitN(line, " - ", 2); len(parts) == 2 {
+			if t, err := time.Parse("2006-01-02 15:04:05.000-0700", parts[0]); err == nil {
+				summary.end = &t
+				line = parts[1]
+			}
+		}
+		switch {
+		case strings.HasPrefix(line, "PLAY RECAP"):
+			inRecap = true
+			recaps++
+		case inRecap && ansibleRecapPattern.MatchString(line):
+			m := ansibleRecapPattern.FindStringSubmatch(line)
+			unreachable, _ := strconv.Atoi(m[1])
+			failed, _ := strconv.Atoi(m[2])
+			if unreachable > 0 || failed > 0 {
+				failedRecaps++
+			}
+		case ansibleTaskPattern.MatchString(line):
+			inRecap = false
+			currentTask = ansibleTaskPattern.FindStringSubmatch(line)[1]
+		case strings.HasPrefix(line, "...ignoring") && len(failedHosts) > 0 && failedTask == currentTask:
+			// The last failure was ignored
+			failedHosts = failedHosts[:len(failedHosts)-1]
+			if len(failedHosts) == 0 {
+				failedTask = ""
+			}
+		case ansibleFailurePattern.MatchString(line):
+			if failedTask == "" || failedTask == currentTask {
+				failedTask = currentTask
+				failedHosts = append(failedHosts, ansibleFailurePattern.FindStringSubmatch(line)[1])
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	switch {
+	case failedRecaps > 0:
+		summary.outcome = RunFailed
+	case recaps > 0:
+		summary.outcome = RunSucceeded
+	}
+	if summary.outcome == RunFailed || summary.outcome == RunIncomplete {
+		summary.failedTask = failedTask
+		if len(failedHosts) > 0 {
+			summary.failedHosts = failedHosts
+		}
+	}
+	return summary, nil
+}
+
+// returns the number of playbooks that started and ended in the recorded events,
+// which are both 0 if the events were not recorded
+func countPlaybooks(file string) (started, ended int, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("error reading events: %v", err)
+	}
+	defer f.Close()
+	for e := range ansible.EventStream(f) {
+		switch e.(type) {
+		case *ansible.PlaybookStartEvent:
+			started++
+		case *ansible.PlaybookEndEvent:
+			ended++
+		}
+	}
+	return started, ended, nil
+}
+
+// PruneRunsOptions select the runs that are pruned
+type PruneRunsOptions struct {
+	// OlderThan prunes the runs that started before this duration ago
+	OlderThan time.Duration
+	// Keep prunes the runs that are not among the most recent ones
+	Keep int
+	// DryRun returns the runs that would be pruned, without removing them
+	DryRun bool
+}
+
+// PruneRuns removes the runs selected by the options from the runs directory, and returns
+// them. The last successful installation, the last installation run, which may be resumed,
+// and the run that recorded the plan that was last applied to the cluster are always kept.
+func PruneRuns(runsDir string, opts PruneRunsOptions, now time.Time) ([]Run, error) {
+	if opts.OlderThan <= 0 && opts.Keep <= 0 {
+		return nil, errors.New("the runs to prune must be selected by age or count")
+	}
+	runs, err := ListRuns(runsDir)
+	if err != nil {
+		return nil, err
+	}
+	kept := map[string]bool{}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Operation == "install" {
+			kept[runs[i].Directory] = true
+			break
+		}
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Operation == "install" && runs[i].Outcome == RunSucceeded {
+			kept[runs[i].Directory] = true
+			break
+		}
+	}
+	_, applied, err := LastAppliedPlan(runsDir)
+	if err != nil {
+		return nil, err
+	}
+	if applied != "" {
+		kept[applied] = true
+	}
+	pruned := []Run{}
+	for i, r := range runs {
+		if kept[r.Directory] {
+			continue
+		}
+		tooOld := opts.OlderThan > 0 && r.Start.Before(now.Add(-opts.OlderThan))
+		tooMany := opts.Keep > 0 && i < len(runs)-opts.Keep
+		if !tooOld && !tooMany {
+			continue
+		}
+		if !opts.DryRun {
+			if err := os.RemoveAll(r.Directory); err != nil {
+				return pruned, fmt.Errorf("error removing run %q: %v", r.ID, err)
+			}
+			// The directory of the operation is only removed if it is empty
+			os.Remove(filepath.Dir(r.Directory))
+		}
+		pruned = append(pruned, r)
+	}
+	return pruned, nil
+}
@@ -0,0 +1,233 @@
+package install
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+)
+
+// returns a runs directory with runs of several operations and outcomes
+func mustWriteTestRuns(t *testing.T) string {
+	runsDir := mustGetTempDir(t)
+	logs := map[string]string{
+		"install/2017-01-01-10-00-00": `2017-01-01 10:00:01.000+0000 - TASK [packages : install docker] ****
+2017-01-01 10:00:02.000+0000 - ok: [worker]
+2017-01-01 10:00:03.000+0000 - PLAY RECAP *********
+2017-01-01 10:30:00.000+0000 - worker                     : ok=10   changed=2    unreachable=0    failed=0
+`,
+		"install/2017-02-01-10-00-00": `2017-02-01 10:00:01.000+0000 - TASK [etcd : start etcd] ****
+2017-02-01 10:00:02.000+0000 - fatal: [etcd]: FAILED! => {"changed": false}
+2017-02-01 10:00:03.000+0000 - PLAY RECAP *********
+2017-02-01 10:00:04.000+0000 - etcd                       : ok=3    changed=0    unreachable=0    failed=1
+`,
+		"add-worker/2017-03-01-10-00-00": `2017-03-01 10:00:01.000+0000 - TASK [check something] ****
+2017-03-01 10:00:02.000+0000 - fatal: [worker2]: FAILED! => {"changed": false}
+2017-03-01 10:00:02.000+0000 - ...ignoring
+2017-03-01 10:00:03.000+0000 - TASK [kubelet : start kubelet] ****
+2017-03-01 10:00:04.000+0000 - fatal: [worker2]: UNREACHABLE! => {"changed": false}
+2017-03-01 10:00:05.000+0000 - PLAY RECAP *********
+2017-03-01 10:00:06.000+0000 - worker2                    : ok=3    changed=0    unreachable=1    failed=0
+`,
+		"preflight/2017-04-01-10-00-00": `2017-04-01 10:00:01.000+0000 - PLAY RECAP *********
+2017-04-01 10:00:02.000+0000 - worker                     : ok=3    changed=0    unreachable=0    failed=0
+`,
+		"reset/2017-05-01-10-00-00": `2017-05-01 10:00:01.000+0000 - TASK [stop kubelet] ****
+`,
+	}
+	for id, log := range logs {
+		mustWriteFile(t, filepath.Join(runsDir, id, "ansible.log"), log)
+	}
+	if err := newProgressTracker(filepath.Join(runsDir, "install", "2017-01-01-10-00-00"), RunProgress{Complete: true}).write(); err != nil {
+		t.Fatalf("error writing progress: %v", err)
+	}
+	if err := newProgressTracker(filepath.Join(runsDir, "install", "2017-02-01-10-00-00"), RunProgress{FailedTask: "start etcd"}).write(); err != nil {
+		t.Fatalf("error writing progress: %v", err)
+	}
+	fp := FilePlanner{File: filepath.Join(runsDir, "install", "2017-01-01-10-00-00", "kismatic-cluster.yaml")}
+	if err := fp.Write(getPlan()); err != nil {
+		t.Fatalf("error writing plan: %v", err)
+	}
+	// Runs that did not record a log, and directories that are not runs
+	for _, dir := range []string{"backup/2017-06-01-10-00-00", "backup/not-a-run"} {
+		if err := os.MkdirAll(filepath.Join(runsDir, dir), 0755); err != nil {
+			t.Fatalf("error creating run directory: %v", err)
+		}
+	}
+	return runsDir
+}
+
+func TestListRuns(t *testing.T) {
+	runsDir := mustWriteTestRuns(t)
+	defer os.RemoveAll(runsDir)
+
+	runs, err := ListRuns(runsDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []struct {
+		id, outcome, failedTask, failedHosts string
+	}{
+		{id: "install/2017-01-01-10-00-00", outcome: RunSucceeded},
+		{id: "install/2017-02-01-10-00-00", outcome: RunFailed, failedTask: "start etcd", failedHosts: "etcd"},
+		{id: "add-worker/2017-03-01-10-00-00", outcome: RunFailed, failedTask: "kubelet : start kubelet", failedHosts: "worker2"},
+		{id: "preflight/2017-04-01-10-00-00", outcome: RunSucceeded},
+		{id: "reset/2017-05-01-10-00-00", outcome: RunIncomplete},
+		{id: "backup/2017-06-01-10-00-00", outcome: RunUnknown},
+	}
+	if len(runs) != len(expected) {
+		t.Fatalf("expected %d runs, but got %+v", len(expected), runs)
+	}
+	for i, e := range expected {
+		r := runs[i]
+		if r.ID != e.id || r.Outcome != e.outcome || r.FailedTask != e.failedTask || strings.Join(r.FailedHosts, ",") != e.failedHosts {
+			t.Errorf("expected run %+v, but got %+v", e, r)
+		}
+	}
+	expectedEnd := time.Date(2017, 1, 1, 10, 30, 0, 0, time.UTC)
+	if runs[0].End == nil || !runs[0].End.Equal(expectedEnd) {
+		t.Errorf("expected the run to end at %v, but got %v", expectedEnd, runs[0].End)
+	}
+	if runs[5].End != nil || runs[5].Duration() != 0 {
+		t.Errorf("expected the end of the run without a log to be unknown, but got %v", runs[5].End)
+	}
+}
+
+func TestReadRunPlaybookNotEnded(t *testing.T) {
+	runsDir := mustGetTempDir(t)
+	defer os.RemoveAll(runsDir)
+	runDir := filepath.Join(runsDir, "add-worker", "2017-03-01-10-00-00")
+	mustWriteFile(t, filepath.Join(runDir, "ansible.log"), `2017-03-01 10:00:01.000+0000 - PLAY RECAP *********
+2017-03-01 10:00:02.000+0000 - worker2                    : ok=3    changed=0    unreachable=0    failed=0
+2017-03-01 10:00:03.000+0000 - TASK [update hosts files] ****
+`)
+	// The second playbook was interrupted
+	mustWriteFile(t, filepath.Join(runDir, ansible.EventsFile), `{"eventType":"PLAYBOOK_START", "eventData": {"name":"kubernetes-worker.yaml", "count": 1}}
+{"eventType":"PLAYBOOK_END", "eventData": {"name":"kubernetes-worker.yaml"}}
+{"eventType":"PLAYBOOK_START", "eventData": {"name":"hosts.yaml", "count": 1}}
+`)
+
+	r, err := ReadRun(runDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Outcome != RunIncomplete {
+		t.Errorf("expected the run to be incomplete, but got %q", r.Outcome)
+	}
+}
+
+func TestFindRun(t *testing.T) {
+	runsDir := mustWriteTestRuns(t)
+	defer os.RemoveAll(runsDir)
+
+	r, err := FindRun(runsDir, "")
+	if err != nil || r.ID != "backup/2017-06-01-10-00-00" {
+		t.Errorf("expected the most recent run, but got %+v %v", r, err)
+	}
+	r, err = FindRun(runsDir, "install/2017-01-01-10-00-00")
+	if err != nil || r.Outcome != RunSucceeded {
+		t.Errorf("expected the successful installation run, but got %+v %v", r, err)
+	}
+	if _, err = FindRun(runsDir, "install/2017-09-01-10-00-00"); err == nil {
+		t.Errorf("expected an error finding a run that does not exist")
+	}
+}
+
+func TestPruneRuns(t *testing.T) {
+	tests := []struct {
+		opts   PruneRunsOptions
+		pruned []string
+	}{
+		// The last installation and the last successful installation are always kept
+		{
+			opts:   PruneRunsOptions{Keep: 1},
+			pruned: []string{"add-worker/2017-03-01-10-00-00", "preflight/2017-04-01-10-00-00", "reset/2017-05-01-10-00-00"},
+		},
+		{
+			opts:   PruneRunsOptions{OlderThan: 30 * 24 * time.Hour},
+			pruned: []string{"add-worker/2017-03-01-10-00-00"},
+		},
+		{
+			opts:   PruneRunsOptions{OlderThan: 365 * 24 * time.Hour},
+			pruned: []string{},
+		},
+	}
+	now := time.Date(2017, 4, 15, 0, 0, 0, 0, time.Local)
+	for _, test := range tests {
+		runsDir := mustWriteTestRuns(t)
+		defer os.RemoveAll(runsDir)
+
+		dryRun := test.opts
+		dryRun.DryRun = true
+		pruned, err := PruneRuns(runsDir, dryRun, now)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := runIDs(pruned); got != strings.Join(test.pruned, ",") {
+			t.Errorf("%+v: expected to prune %v, but pruned %s", test.opts, test.pruned, got)
+		}
+		runs, _ := ListRuns(runsDir)
+		if len(runs) != 6 {
+			t.Errorf("%+v: expected the dry run to keep all runs, but got %s", test.opts, runIDs(runs))
+		}
+
+		if _, err = PruneRuns(runsDir, test.opts, now); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		runs, _ = ListRuns(runsDir)
+		if len(runs) != 6-len(test.pruned) {
+			t.Errorf("%+v: expected %d runs to be kept, but got %s", test.opts, 6-len(test.pruned), runIDs(runs))
+		}
+		for _, r := range runs {
+			for _, p := range test.pruned {
+				if r.ID == p {
+					t.Errorf("%+v: expected run %s to be pruned", test.opts, p)
+				}
+			}
+		}
+	}
+	if _, err := PruneRuns(mustGetTempDir(t), PruneRunsOptions{}, now); err == nil {
+		t.Errorf("expected an error when no runs are selected")
+	}
+}
+
+func TestReplayRun(t *testing.T) {
+	runsDir := mustWriteTestRuns(t)
+	defer os.RemoveAll(runsDir)
+	runDir := filepath.Join(runsDir, "install", "2017-02-01-10-00-00")
+	events := `{"eventType":"PLAYBOOK_START", "eventData": {"name":"kubernetes.yaml", "count": 1}}
+{"eventType":"PLAY_START", "eventData": {"name":"Start etcd"}}
+{"eventType":"TASK_START", "eventData": {"name":"start etcd"}}
+{"eventType":"RUNNER_FAILED", "eventData": {"host":"etcd", "result": {"msg":"etcd did not start"}}}
+{"eventType":"PLAYBOOK_END", "eventData": {"name":"kubernetes.yaml"}}
+`
+	mustWriteFile(t, filepath.Join(runDir, ansible.EventsFile), events)
+
+	out := &bytes.Buffer{}
+	explainer := &explain.AnsibleEventStreamExplainer{Out: out, EventExplainer: &explain.DefaultEventExplainer{}}
+	if err := ReplayRun(runDir, explainer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range []string{"Start etcd", "start etcd", "etcd did not start"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %q in the replayed output, but got:\n%s", s, out.String())
+		}
+	}
+
+	if err := ReplayRun(filepath.Join(runsDir, "reset", "2017-05-01-10-00-00"), explainer); err == nil {
+		t.Errorf("expected an error replaying a run without recorded events")
+	}
+}
+
+func runIDs(runs []Run) string {
+	ids := []string{}
+	for _, r := range runs {
+		ids = append(ids, r.ID)
+	}
+	return strings.Join(ids, ",")
+}
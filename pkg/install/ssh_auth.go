@@ -0,0 +1,87 @@
+package install
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
+
+// PrepareSSHAuth prepares the authentication of the SSH connections to the nodes
+// and to the bastion, and returns a description of the mechanisms that are used.
+// The passphrase of an encrypted key is prompted if no SSH agent is available.
+func PrepareSSHAuth(p *Plan) (string, error) {
+	// The keys of the nodes are prepared in the order in which they are first used
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, n := range p.getAllNodes() {
+		if k := p.GetNodeSSHConfig(n).Key; !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		keys = append(keys, p.Cluster.SSH.Key)
+		seen[p.Cluster.SSH.Key] = true
+	}
+	descriptions := []string{}
+	for _, k := range keys {
+		m, err := ssh.PrepareAuth(k)
+		if err != nil {
+			return "", fmt.Errorf("error preparing authentication with SSH key %q: %v", k, err)
+		}
+		if len(keys) == 1 {
+			descriptions = append(descriptions, string(m))
+		} else {
+			descriptions = append(descriptions, fmt.Sprintf("%s for %q", m, k))
+		}
+	}
+	mechanisms := strings.Join(descriptions, ", ")
+	bastion := p.Cluster.SSH.GetBastion()
+	if bastion != nil && !seen[bastion.Key] {
+		bm, err := ssh.PrepareAuth(bastion.Key)
+		if err != nil {
+			return "", fmt.Errorf("error preparing authentication with SSH bastion key %q: %v", bastion.Key, err)
+		}
+		mechanisms = fmt.Sprintf("%s, and %s for the bastion", mechanisms, bm)
+	}
+	return mechanisms, nil
+}
+
+// sshAuthRunner prepares the authentication with the SSH keys of the inventory
+// before running a playbook, so that Ansible can use the keys held by an SSH agent
+type sshAuthRunner struct {
+	ansible.Runner
+}
+
+func (r sshAuthRunner) StartPlaybook(ctx context.Context, playbookFile string, inv ansible.Inventory, cc ansible.ClusterCatalog) (<-chan ansible.Event, error) {
+	if err := prepareInventorySSHAuth(inv); err != nil {
+		return nil, err
+	}
+	return r.Runner.StartPlaybook(ctx, playbookFile, inv, cc)
+}
+
+func (r sshAuthRunner) StartPlaybookOnNode(ctx context.Context, playbookFile string, inv ansible.Inventory, cc ansible.ClusterCatalog, node string) (<-chan ansible.Event, error) {
+	if err := prepareInventorySSHAuth(inv); err != nil {
+		return nil, err
+	}
+	return r.Runner.StartPlaybookOnNode(ctx, playbookFile, inv, cc, node)
+}
+
+func prepareInventorySSHAuth(inv ansible.Inventory) error {
+	for _, role := range inv.Roles {
+		for _, n := range role.Nodes {
+			for _, key := range []string{n.SSHPrivateKey, n.SSHProxyPrivateKey} {
+				if key == "" {
+					continue
+				}
+				if _, err := ssh.PrepareAuth(key); err != nil {
+					return fmt.Errorf("error preparing authentication with SSH key %q: %v", key, err)
+				}
+			}
+		}
+	}
+	return nil
+}
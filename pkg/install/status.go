@@ -0,0 +1,436 @@
+package install
+
+import (
+	"context"
+	cryptotls "crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/tls"
+)
+
+const statusAPITimeout = 10 * time.Second
+
+// ClusterStatus is the status of the cluster and its nodes
+type ClusterStatus struct {
+	Cluster           string            `json:"cluster"`
+	Healthy           bool              `json:"healthy"`
+	Nodes             []NodeStatus      `json:"nodes"`
+	ComponentStatuses []ComponentStatus `json:"componentStatuses"`
+	// APIError is set when the status could not be retrieved from the API server
+	APIError string `json:"apiError,omitempty"`
+}
+
+// NodeStatus is the status of a node of the cluster
+type NodeStatus struct {
+	Host         string          `json:"host"`
+	IP           string          `json:"ip"`
+	Roles        []string        `json:"roles"`
+	SSHReachable bool            `json:"sshReachable"`
+	SSHError     string          `json:"sshError,omitempty"`
+	Services     []ServiceStatus `json:"services,omitempty"`
+	Etcd         []EtcdStatus    `json:"etcd,omitempty"`
+	// Ready is the status of the Ready condition of the Kubernetes node,
+	// empty if the node is not a Kubernetes node
+	Ready             string     `json:"ready,omitempty"`
+	CertificateExpiry *time.Time `json:"certificateExpiry,omitempty"`
+	CertificateError  string     `json:"certificateError,omitempty"`
+}
+
+// ServiceStatus is the state of a systemd service, as reported by systemctl
+type ServiceStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// EtcdStatus is the health of the etcd member running on a node
+type EtcdStatus struct {
+	Cluster string `json:"cluster"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ComponentStatus is the health of a Kubernetes component, as reported by the API server
+type ComponentStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// the etcd clusters deployed on the etcd nodes
+var statusEtcdClusters = []struct {
+	name       string
+	service    string
+	port       int
+	installDir string
+}{
+	{name: "kubernetes", service: "etcd_k8s", port: 2379, installDir: "/etc/etcd_k8s"},
+	{name: "networking", service: "etcd_networking", port: 6666, installDir: "/etc/etcd_networking"},
+}
+
+// the services that run on all Kubernetes nodes
+var statusKubernetesServices = []string{"docker", "kubelet", "kube-proxy", "calico-node"}
+
+// statusChecker gets the status of the cluster
+type statusChecker struct {
+	plan     *Plan
+	certsDir string
+	// runs the command on the node, and returns its output
+	runCommand func(node Node, command string) (string, error)
+	// gets the resource at the path of the API server, and unmarshals it into out
+	apiGet func(path string, out interface{}) error
+}
+
+// GetClusterStatus returns the status of the cluster, as reported by the nodes over SSH
+// and by the Kubernetes API server. The cluster CA and admin certificate in the
+// generated assets directory are used to access the API server. The commands run on
+// the nodes are aborted when the context is canceled.
+func GetClusterStatus(ctx context.Context, p *Plan, generatedAssetsDir string) *ClusterStatus {
+	certsDir := filepath.Join(generatedAssetsDir, "keys")
+	clients := newSSHClients(ctx, p)
+	defer clients.close()
+	checker := statusChecker{
+		plan:       p,
+		certsDir:   certsDir,
+		runCommand: clients.output,
+		apiGet: func(path string, out interface{}) error {
+			return apiGet(p, certsDir, path, out)
+		},
+	}
+	return checker.status()
+}
+
+// sshClients opens a single SSH client per node, which runs the commands on the node
+// until the clients are closed. The clients are closed when the context is canceled,
+// aborting the commands that are running.
+type sshClients struct {
+	sync.Mutex
+	ctx     context.Context
+	plan    *Plan
+	clients map[string]ssh.Client
+	stop    func()
+}
+
+func newSSHClients(ctx context.Context, p *Plan) *sshClients {
+	c := &sshClients{ctx: ctx, plan: p, clients: map[string]ssh.Client{}}
+	c.stop = onCancel(ctx, c.closeClients)
+	return c
+}
+
+// output runs the command on the node, and returns its output
+func (c *sshClients) output(node Node, command string) (string, error) {
+	client, err := c.client(node)
+	if err != nil {
+		return "", err
+	}
+	return client.Output(command)
+}
+
+func (c *sshClients) client(node Node) (ssh.Client, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if client, ok := c.clients[node.Host]; ok {
+		return client, nil
+	}
+	s := c.plan.GetNodeSSHConfig(node)
+	client, err := ssh.OpenConnection(node.IP, s.Port, s.User, s.Key, s.GetBastion())
+	if err != nil {
+		return nil, err
+	}
+	c.clients[node.Host] = client
+	return client, nil
+}
+
+func (c *sshClients) close() {
+	c.stop()
+	c.closeClients()
+}
+
+func (c *sshClients) closeClients() {
+	c.Lock()
+	defer c.Unlock()
+	for host, client := range c.clients {
+		client.Close()
+		delete(c.clients, host)
+	}
+}
+
+func (sc statusChecker) status() *ClusterStatus {
+	cs := &ClusterStatus{
+		Cluster:           sc.plan.Cluster.Name,
+		Nodes:             statusNodes(sc.plan),
+		ComponentStatuses: []ComponentStatus{},
+	}
+	var wg sync.WaitGroup
+	for i := range cs.Nodes {
+		wg.Add(1)
+		go func(ns *NodeStatus) {
+			defer wg.Done()
+			sc.nodeStatus(ns)
+		}(&cs.Nodes[i])
+	}
+	ready, componentStatuses, err := sc.apiStatus()
+	wg.Wait()
+	if err != nil {
+		cs.APIError = err.Error()
+	}
+	cs.ComponentStatuses = componentStatuses
+	for i, n := range cs.Nodes {
+		if isKubernetesNode(n.Roles) {
+			cs.Nodes[i].Ready = "Unknown"
+			if r, ok := ready[strings.ToLower(n.Host)]; ok {
+				cs.Nodes[i].Ready = r
+			}
+		}
+	}
+	cs.Healthy = cs.healthy()
+	return cs
+}
+
+// returns a status for each node of the plan, with the roles of the node
+func statusNodes(p *Plan) []NodeStatus {
+	nodes := []NodeStatus{}
+	index := map[string]int{}
+	groups := []struct {
+		role  string
+		nodes []Node
+	}{
+		{"etcd", p.Etcd.Nodes},
+		{"master", p.Master.Nodes},
+		{"worker", p.Worker.Nodes},
+		{"ingress", p.Ingress.Nodes},
+		{"storage", p.Storage.Nodes},
+	}
+	for _, g := range groups {
+		for _, n := range g.nodes {
+			i, ok := index[n.Host]
+			if !ok {
+				i = len(nodes)
+				index[n.Host] = i
+				nodes = append(nodes, NodeStatus{Host: n.Host, IP: n.IP})
+			}
+			nodes[i].Roles = append(nodes[i].Roles, g.role)
+		}
+	}
+	return nodes
+}
+
+func isKubernetesNode(roles []string) bool {
+	for _, r := range roles {
+		if r != "etcd" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (sc statusChecker) nodeStatus(ns *NodeStatus) {
+	cert, err := tls.ReadCert(ns.Host, sc.certsDir)
+	if err != nil {
+		ns.CertificateError = err.Error()
+	} else {
+		ns.CertificateExpiry = &cert.NotAfter
+	}
+
+	node := Node{Host: ns.Host, IP: ns.IP}
+	services := []string{}
+	if hasRole(ns.Roles, "etcd") {
+		for _, c := range statusEtcdClusters {
+			services = append(services, c.service)
+		}
+	}
+	if isKubernetesNode(ns.Roles) {
+		services = append(services, statusKubernetesServices...)
+	}
+	// systemctl exits with a non-zero status when a service is not active
+	out, err := sc.runCommand(node, fmt.Sprintf("systemctl is-active %s || true", strings.Join(services, " ")))
+	if err != nil {
+		ns.SSHError = err.Error()
+		return
+	}
+	ns.SSHReachable = true
+	states := strings.Fields(out)
+	for i, s := range services {
+		state := "unknown"
+		if i < len(states) {
+			state = states[i]
+		}
+		ns.Services = append(ns.Services, ServiceStatus{Name: s, State: state})
+	}
+
+	if !hasRole(ns.Roles, "etcd") {
+		return
+	}
+	for _, c := range statusEtcdClusters {
+		cmd := fmt.Sprintf("sudo curl -s --cacert %[1]s/ca.pem --cert %[1]s/etcd.pem --key %[1]s/etcd-key.pem https://127.0.0.1:%d/health", c.installDir, c.port)
+		es := EtcdStatus{Cluster: c.name}
+		out, err := sc.runCommand(node, cmd)
+		if err != nil {
+			es.Error = err.Error()
+		} else {
+			es.Healthy, es.Error = etcdHealth(out)
+		}
+		ns.Etcd = append(ns.Etcd, es)
+	}
+}
+
+// parses the response of the etcd health endpoint
+func etcdHealth(out string) (bool, string) {
+	health := struct {
+		Health string `json:"health"`
+	}{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &health); err != nil {
+		return false, fmt.Sprintf("unexpected response from health endpoint: %q", strings.TrimSpace(out))
+	}
+	if health.Health != "true" {
+		return false, "member is unhealthy"
+	}
+	return true, ""
+}
+
+type apiCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Error   string `json:"error"`
+}
+
+type apiObjectList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Status struct {
+			Conditions []apiCondition `json:"conditions"`
+		} `json:"status"`
+		// component statuses have their conditions at the top level
+		Conditions []apiCondition `json:"conditions"`
+	} `json:"items"`
+}
+
+// returns the status of the Ready condition of the Kubernetes nodes, by lower-cased
+// node name, and the status of the Kubernetes components
+func (sc statusChecker) apiStatus() (map[string]string, []ComponentStatus, error) {
+	nodes := apiObjectList{}
+	if err := sc.apiGet("/api/v1/nodes", &nodes); err != nil {
+		return nil, []ComponentStatus{}, fmt.Errorf("error getting nodes from the API server: %v", err)
+	}
+	ready := map[string]string{}
+	for _, n := range nodes.Items {
+		for _, c := range n.Status.Conditions {
+			if c.Type == "Ready" {
+				ready[strings.ToLower(n.Metadata.Name)] = c.Status
+			}
+		}
+	}
+	components := apiObjectList{}
+	if err := sc.apiGet("/api/v1/componentstatuses", &components); err != nil {
+		return ready, []ComponentStatus{}, fmt.Errorf("error getting component statuses from the API server: %v", err)
+	}
+	statuses := []ComponentStatus{}
+	for _, c := range components.Items {
+		cs := ComponentStatus{Name: c.Metadata.Name}
+		for _, cond := range c.Conditions {
+			if cond.Type != "Healthy" {
+				continue
+			}
+			cs.Healthy = cond.Status == "True"
+			cs.Message = cond.Message
+			if cond.Error != "" {
+				cs.Message = cond.Error
+			}
+		}
+		statuses = append(statuses, cs)
+	}
+	return ready, statuses, nil
+}
+
+func (cs ClusterStatus) healthy() bool {
+	if cs.APIError != "" {
+		return false
+	}
+	for _, c := range cs.ComponentStatuses {
+		if !c.Healthy {
+			return false
+		}
+	}
+	for _, n := range cs.Nodes {
+		if !n.SSHReachable || n.CertificateError != "" {
+			return false
+		}
+		if n.Ready != "" && n.Ready != "True" {
+			return false
+		}
+		for _, s := range n.Services {
+			if s.State != "active" {
+				return false
+			}
+		}
+		for _, e := range n.Etcd {
+			if !e.Healthy {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// gets the resource at the path of the API server, authenticating as the admin user
+func apiGet(p *Plan, certsDir, path string, out interface{}) error {
+	if p.Master.LoadBalancedFQDN == "" {
+		return fmt.Errorf("load balanced FQDN is not provided")
+	}
+	caCert, err := ioutil.ReadFile(filepath.Join(certsDir, "ca.pem"))
+	if err != nil {
+		return fmt.Errorf("error reading cluster CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return fmt.Errorf("error parsing cluster CA")
+	}
+	clientCert, err := cryptotls.LoadX509KeyPair(filepath.Join(certsDir, "admin.pem"), filepath.Join(certsDir, "admin-key.pem"))
+	if err != nil {
+		return fmt.Errorf("error reading admin certificate: %v", err)
+	}
+	client := http.Client{
+		Timeout: statusAPITimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &cryptotls.Config{
+				RootCAs:      pool,
+				Certificates: []cryptotls.Certificate{clientCert},
+			},
+		},
+	}
+	resp, err := client.Get(fmt.Sprintf("https://%s:6443%s", p.Master.LoadBalancedFQDN, path))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got HTTP status code %d", resp.StatusCode)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package install
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// returns a checker for a cluster where all services are active and all API objects are healthy
+func healthyStatusChecker(t *testing.T) statusChecker {
+	// The etcd node plays no kubernetes role
+	p := testPlan()
+	p.Ingress = OptionalNodeGroup{}
+	return statusChecker{
+		plan:     p,
+		certsDir: mustGetTempDir(t),
+		runCommand: func(node Node, command string) (string, error) {
+			if strings.HasPrefix(command, "systemctl is-active") {
+				return strings.Repeat("active\n", len(strings.Fields(command))-4), nil
+			}
+			return `{"health": "true"}`, nil
+		},
+		apiGet: func(path string, out interface{}) error {
+			resp := ""
+			switch path {
+			case "/api/v1/nodes":
+				resp = `{"items": [
+					{"metadata": {"name": "master01"}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}},
+					{"metadata": {"name": "WORKER01"}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}}
+				]}`
+			case "/api/v1/componentstatuses":
+				resp = `{"items": [{"metadata": {"name": "scheduler"}, "conditions": [{"type": "Healthy", "status": "True", "message": "ok"}]}]}`
+			}
+			return json.Unmarshal([]byte(resp), out)
+		},
+	}
+}
+
+func TestStatusNodesMergesRoles(t *testing.T) {
+	nodes := statusNodes(testPlan())
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 unique nodes, but got %+v", nodes)
+	}
+	if !reflect.DeepEqual(nodes[0].Roles, []string{"etcd", "ingress"}) {
+		t.Errorf("expected etcd node to have etcd and ingress roles, but got %v", nodes[0].Roles)
+	}
+}
+
+func TestClusterStatus(t *testing.T) {
+	sc := healthyStatusChecker(t)
+	cs := sc.status()
+	// Node certificates are missing from the certificates directory
+	if cs.Healthy {
+		t.Errorf("expected cluster with missing certificates to be unhealthy")
+	}
+	for _, n := range cs.Nodes {
+		if n.CertificateError == "" {
+			t.Errorf("expected certificate error for node %q", n.Host)
+		}
+		if !n.SSHReachable {
+			t.Errorf("expected node %q to be reachable", n.Host)
+		}
+	}
+	etcd := cs.Nodes[0]
+	if len(etcd.Etcd) != 2 || !etcd.Etcd[0].Healthy || !etcd.Etcd[1].Healthy {
+		t.Errorf("expected both etcd members to be healthy, but got %+v", etcd.Etcd)
+	}
+	if etcd.Ready != "" {
+		t.Errorf("expected no Ready condition for etcd node, but got %q", etcd.Ready)
+	}
+	if len(etcd.Services) != 2 || etcd.Services[0].Name != "etcd_k8s" {
+		t.Errorf("expected etcd services on etcd node, but got %+v", etcd.Services)
+	}
+	worker := cs.Nodes[2]
+	if worker.Ready != "True" {
+		t.Errorf("expected worker to be ready, but got %q", worker.Ready)
+	}
+	if len(worker.Services) != len(statusKubernetesServices) || worker.Services[3].State != "active" {
+		t.Errorf("expected kubernetes services to be active on worker, but got %+v", worker.Services)
+	}
+	if len(cs.ComponentStatuses) != 1 || !cs.ComponentStatuses[0].Healthy {
+		t.Errorf("expected healthy scheduler, but got %+v", cs.ComponentStatuses)
+	}
+}
+
+func TestClusterStatusUnhealthy(t *testing.T) {
+	sc := healthyStatusChecker(t)
+	sc.runCommand = func(node Node, command string) (string, error) {
+		if node.Host == "worker01" {
+			return "", errors.New("connection refused")
+		}
+		if strings.HasPrefix(command, "systemctl is-active") {
+			return "active\ninactive\n", nil
+		}
+		return "", nil
+	}
+	sc.apiGet = func(path string, out interface{}) error {
+		return errors.New("connection refused")
+	}
+	cs := sc.status()
+	if cs.APIError == "" {
+		t.Errorf("expected API error")
+	}
+	worker := cs.Nodes[2]
+	if worker.SSHReachable || worker.SSHError == "" || worker.Ready != "Unknown" {
+		t.Errorf("expected unreachable worker with unknown Ready condition, but got %+v", worker)
+	}
+	etcd := cs.Nodes[0]
+	if etcd.Services[1].State != "inactive" {
+		t.Errorf("expected inactive service, but got %+v", etcd.Services)
+	}
+	if etcd.Etcd[0].Healthy || etcd.Etcd[0].Error == "" {
+		t.Errorf("expected etcd member with unexpected response to be unhealthy, but got %+v", etcd.Etcd[0])
+	}
+	master := cs.Nodes[1]
+	if master.Services[2].State != "unknown" {
+		t.Errorf("expected unknown state for missing service, but got %+v", master.Services)
+	}
+}
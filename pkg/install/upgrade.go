@@ -0,0 +1,113 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/install/explain"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// Upgrade the nodes of the cluster that are running an older version of
+// Kismatic. Nodes are upgraded one at a time, in the following order: etcd,
+// master, worker, ingress and storage. Worker nodes are drained before being
+// upgraded. The upgrade stops on the first node that fails to upgrade. Nodes
+// that were upgraded successfully record the new version, so running the
+// upgrade again resumes from the node that failed. The upgrade is refused if
+// any node is running a newer version than the CLI.
+func (ae *ansibleExecutor) Upgrade(p *Plan) error {
+	if kismaticVersion == (Version{}) {
+		return fmt.Errorf("the version of this Kismatic CLI is unknown, cannot upgrade")
+	}
+	util.PrintHeader(ae.stdout, "Detecting Node Versions", '=')
+	listVersions := ListVersions
+	if ae.versionLister != nil {
+		listVersions = ae.versionLister
+	}
+	versions, err := listVersions(p)
+	if err != nil {
+		return fmt.Errorf("error listing node versions: %v", err)
+	}
+	toUpgrade := []NodeVersion{}
+	newer := []string{}
+	for _, nv := range versions {
+		if kismaticVersion.OlderThan(nv.Version) {
+			util.PrettyPrintErr(ae.stdout, "%s %s (%s)", nv.Node.Host, versionString(nv.Version), strings.Join(nv.Roles, ","))
+			newer = append(newer, nv.Node.Host)
+			continue
+		}
+		if nv.NeedsUpgrade() {
+			util.PrettyPrintWarn(ae.stdout, "%s %s (%s)", nv.Node.Host, versionString(nv.Version), strings.Join(nv.Roles, ","))
+			toUpgrade = append(toUpgrade, nv)
+			continue
+		}
+		util.PrettyPrintOk(ae.stdout, "%s %s (%s)", nv.Node.Host, versionString(nv.Version), strings.Join(nv.Roles, ","))
+	}
+	if len(newer) > 0 {
+		return fmt.Errorf("nodes %s are running a newer version than %s, downgrades are not supported", strings.Join(newer, ", "), kismaticVersion)
+	}
+	if len(toUpgrade) == 0 {
+		fmt.Fprintf(ae.stdout, "All nodes are running %s, there is nothing to upgrade\n", kismaticVersion)
+		return nil
+	}
+
+	runDirectory, err := ae.createRunDirectory("upgrade")
+	if err != nil {
+		return fmt.Errorf("error creating working directory for upgrade: %v", err)
+	}
+	fp := FilePlanner{
+		File: filepath.Join(runDirectory, "kismatic-cluster.yaml"),
+	}
+	if err = fp.Write(p); err != nil {
+		return fmt.Errorf("error recording plan file to %s: %v", fp.File, err)
+	}
+	inventory := buildInventoryFromPlan(p)
+	cc, err := ae.buildInstallExtraVars(p)
+	if err != nil {
+		return err
+	}
+	// New binaries are only picked up after a restart
+	cc.EnableRestart()
+	ansibleLogFilename := filepath.Join(runDirectory, "ansible.log")
+	ansibleLogFile, err := os.Create(ansibleLogFilename)
+	if err != nil {
+		return fmt.Errorf("error creating ansible log file %q: %v", ansibleLogFilename, err)
+	}
+
+	for i, nv := range toUpgrade {
+		util.PrintHeader(ae.stdout, fmt.Sprintf("Upgrading Node %q (%d/%d)", nv.Node.Host, i+1, len(toUpgrade)), '=')
+		playbook := "upgrade-node.yaml"
+		eventExplainer := &explain.DefaultEventExplainer{}
+		runner, explainer, err := ae.getAnsibleRunnerAndExplainer(eventExplainer, ansibleLogFile, runDirectory)
+		if err != nil {
+			return err
+		}
+		eventStream, err := runner.StartPlaybookOnNode(ae.runContext(), playbook, inventory, *cc, nv.Node.Host)
+		if err != nil {
+			return fmt.Errorf("error running ansible playbook: %v", err)
+		}
+		go explainer.Explain(eventStream)
+		if err = runner.WaitPlaybook(); err != nil {
+			return fmt.Errorf("error upgrading node %q: %v\n%d of %d nodes were upgraded. Run the upgrade again to resume from node %q",
+				nv.Node.Host, err, i, len(toUpgrade), nv.Node.Host)
+		}
+	}
+
+	// Cluster services are upgraded once all nodes are running the new version
+	util.PrintHeader(ae.stdout, "Upgrading Cluster Services", '=')
+	playbook := "upgrade-cluster-services.yaml"
+	eventExplainer := &explain.DefaultEventExplainer{}
+	if err = ae.runPlaybookWithExplainer(playbook, eventExplainer, inventory, *cc, ansibleLogFile, runDirectory); err != nil {
+		return fmt.Errorf("error upgrading cluster services: %v", err)
+	}
+	return nil
+}
+
+func versionString(v Version) string {
+	if v == (Version{}) {
+		return "unknown version"
+	}
+	return v.String()
+}
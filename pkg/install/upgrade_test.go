@@ -0,0 +1,225 @@
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected Version
+		valid    bool
+	}{
+		{"v1.2.3", Version{1, 2, 3}, true},
+		{"1.2.3", Version{1, 2, 3}, true},
+		{"v1.2.0-12-gabcdef", Version{1, 2, 0}, true},
+		{"v1.2.0+build", Version{1, 2, 0}, true},
+		{" v1.10.0\n", Version{1, 10, 0}, true},
+		{"", Version{}, false},
+		{"v1.2", Version{}, false},
+		{"v1.a.3", Version{}, false},
+		{"v1.-2.3", Version{}, false},
+	}
+	for _, test := range tests {
+		v, err := ParseVersion(test.version)
+		if test.valid && err != nil {
+			t.Errorf("expected %q to be valid, but got error: %v", test.version, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("expected an error parsing %q, but didn't get one", test.version)
+		}
+		if v != test.expected {
+			t.Errorf("expected %q to be parsed as %v, but got %v", test.version, test.expected, v)
+		}
+	}
+}
+
+func TestVersionOlderThan(t *testing.T) {
+	tests := []struct {
+		v     Version
+		other Version
+		older bool
+	}{
+		{Version{1, 0, 0}, Version{1, 0, 0}, false},
+		{Version{1, 0, 0}, Version{1, 0, 1}, true},
+		{Version{1, 0, 9}, Version{1, 1, 0}, true},
+		{Version{1, 9, 9}, Version{2, 0, 0}, true},
+		{Version{2, 0, 0}, Version{1, 9, 9}, false},
+		{Version{}, Version{1, 0, 0}, true},
+	}
+	for _, test := range tests {
+		if older := test.v.OlderThan(test.other); older != test.older {
+			t.Errorf("expected %v.OlderThan(%v) to be %v, but got %v", test.v, test.other, test.older, older)
+		}
+	}
+}
+
+func TestNodesInUpgradeOrder(t *testing.T) {
+	p := &Plan{
+		Etcd:    NodeGroup{Nodes: []Node{{Host: "etcd"}}},
+		Master:  MasterNodeGroup{Nodes: []Node{{Host: "master"}}},
+		Worker:  NodeGroup{Nodes: []Node{{Host: "worker"}, {Host: "master"}}},
+		Ingress: OptionalNodeGroup{Nodes: []Node{{Host: "worker"}}},
+		Storage: OptionalNodeGroup{Nodes: []Node{{Host: "storage"}}},
+	}
+	nodes := p.nodesInUpgradeOrder()
+	hosts := []string{}
+	for _, n := range nodes {
+		hosts = append(hosts, n.Node.Host)
+	}
+	expectedHosts := []string{"etcd", "master", "worker", "storage"}
+	if !reflect.DeepEqual(hosts, expectedHosts) {
+		t.Errorf("expected nodes %v, but got %v", expectedHosts, hosts)
+	}
+	expectedRoles := [][]string{{"etcd"}, {"master", "worker"}, {"worker", "ingress"}, {"storage"}}
+	for i, n := range nodes {
+		if !reflect.DeepEqual(n.Roles, expectedRoles[i]) {
+			t.Errorf("expected node %q to have roles %v, but got %v", n.Node.Host, expectedRoles[i], n.Roles)
+		}
+	}
+}
+
+// returns a version lister that reports the given versions of the nodes
+func fakeVersionLister(versions map[string]Version) func(*Plan) ([]NodeVersion, error) {
+	return func(p *Plan) ([]NodeVersion, error) {
+		nodes := p.nodesInUpgradeOrder()
+		for i := range nodes {
+			nodes[i].Version = versions[nodes[i].Node.Host]
+		}
+		return nodes, nil
+	}
+}
+
+func TestUpgradeSkipsUpToDateNodes(t *testing.T) {
+	defer func(v Version) { kismaticVersion = v }(kismaticVersion)
+	kismaticVersion = Version{1, 2, 0}
+
+	runner := &fakeRunner{}
+	versions := map[string]Version{
+		"etcd01":   {1, 2, 0},
+		"master01": {1, 1, 0},
+	}
+	e := ansibleExecutor{
+		certsDir:               mustGetTempDir(t),
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+		versionLister:          fakeVersionLister(versions),
+	}
+	if err := e.Upgrade(testPlan()); err != nil {
+		t.Fatalf("unexpected error upgrading cluster: %v", err)
+	}
+	expectedNodes := []string{"master01", "worker01"}
+	if !reflect.DeepEqual(runner.nodes, expectedNodes) {
+		t.Errorf("expected nodes %v to be upgraded, but got %v", expectedNodes, runner.nodes)
+	}
+	if !runner.incomingCatalog.ForceKubeletRestart {
+		t.Errorf("expected services to be restarted during upgrade")
+	}
+	expectedPlaybooks := []string{"upgrade-cluster-services.yaml"}
+	if !reflect.DeepEqual(runner.allNodesPlaybooks, expectedPlaybooks) {
+		t.Errorf("expected playbooks %v to be run on all nodes, but got %v", expectedPlaybooks, runner.allNodesPlaybooks)
+	}
+}
+
+func TestUpgradeStopsOnFailedNode(t *testing.T) {
+	defer func(v Version) { kismaticVersion = v }(kismaticVersion)
+	kismaticVersion = Version{1, 2, 0}
+
+	runner := &fakeRunner{err: errors.New("exec error")}
+	e := ansibleExecutor{
+		certsDir:               mustGetTempDir(t),
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+		versionLister:          fakeVersionLister(map[string]Version{}),
+	}
+	if err := e.Upgrade(testPlan()); err == nil {
+		t.Fatal("expected an error, but didn't get one")
+	}
+	expectedNodes := []string{"etcd01"}
+	if !reflect.DeepEqual(runner.nodes, expectedNodes) {
+		t.Errorf("expected upgrade to stop after node %v, but got %v", expectedNodes, runner.nodes)
+	}
+	if len(runner.allNodesPlaybooks) != 0 {
+		t.Errorf("expected cluster services not to be upgraded, but ran %v", runner.allNodesPlaybooks)
+	}
+}
+
+func TestUpgradeUnknownVersion(t *testing.T) {
+	defer func(v Version) { kismaticVersion = v }(kismaticVersion)
+	kismaticVersion = Version{}
+
+	runner := &fakeRunner{}
+	e := ansibleExecutor{
+		certsDir:               mustGetTempDir(t),
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+		versionLister:          fakeVersionLister(map[string]Version{}),
+	}
+	if err := e.Upgrade(testPlan()); err == nil {
+		t.Error("expected an error when the Kismatic version is unknown, but didn't get one")
+	}
+}
+
+func TestUpgradeRejectsDowngrade(t *testing.T) {
+	defer func(v Version) { kismaticVersion = v }(kismaticVersion)
+	kismaticVersion = Version{1, 2, 0}
+
+	runner := &fakeRunner{}
+	versions := map[string]Version{
+		"etcd01":   {1, 2, 0},
+		"master01": {1, 3, 0},
+	}
+	e := ansibleExecutor{
+		certsDir:               mustGetTempDir(t),
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+		versionLister:          fakeVersionLister(versions),
+	}
+	if err := e.Upgrade(testPlan()); err == nil || !strings.Contains(err.Error(), "master01") {
+		t.Errorf("expected an error when a node is running a newer version, but got %v", err)
+	}
+	if len(runner.nodes) != 0 || len(runner.allNodesPlaybooks) != 0 {
+		t.Errorf("expected no playbooks to run, but ran on %v and %v", runner.nodes, runner.allNodesPlaybooks)
+	}
+}
+
+func TestUpgradeNodesUpToDate(t *testing.T) {
+	defer func(v Version) { kismaticVersion = v }(kismaticVersion)
+	kismaticVersion = Version{1, 2, 0}
+
+	runner := &fakeRunner{}
+	versions := map[string]Version{
+		"etcd01":   {1, 2, 0},
+		"master01": {1, 2, 0},
+		"worker01": {1, 2, 0},
+	}
+	e := ansibleExecutor{
+		certsDir:               mustGetTempDir(t),
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(runner),
+		versionLister:          fakeVersionLister(versions),
+	}
+	if err := e.Upgrade(testPlan()); err != nil {
+		t.Fatalf("unexpected error upgrading cluster: %v", err)
+	}
+	// Cluster services are not upgraded when no node was upgraded
+	if len(runner.nodes) != 0 || len(runner.allNodesPlaybooks) != 0 {
+		t.Errorf("expected no playbooks to run, but ran on %v and %v", runner.nodes, runner.allNodesPlaybooks)
+	}
+}
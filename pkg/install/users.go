@@ -0,0 +1,204 @@
+package install
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/tls"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// the users whose credentials are managed with the cluster's certificates
+var reservedUsers = []string{"admin"}
+
+var userNameRE = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._@-]*$`)
+
+// UserIdentity is a user for whom a client certificate and kubeconfig were issued
+type UserIdentity struct {
+	Name   string   `json:"name"`
+	Groups []string `json:"groups"`
+	// Serial is the serial number of the certificate, in hexadecimal
+	Serial     string    `json:"serial"`
+	Issued     time.Time `json:"issued"`
+	NotAfter   time.Time `json:"notAfter"`
+	Kubeconfig string    `json:"kubeconfig"`
+	// Discarded is the time at which the local credentials were discarded. The
+	// certificate is not revoked, it remains valid until it expires.
+	Discarded *time.Time `json:"discarded,omitempty"`
+}
+
+// the file where the issued identities are recorded
+func userIdentitiesFile(generatedAssetsDir string) string {
+	return filepath.Join(generatedAssetsDir, "users.json")
+}
+
+// the directory where the user certificates are stored
+func userCertsDirectory(generatedAssetsDir string) string {
+	return filepath.Join(generatedAssetsDir, "keys", "users")
+}
+
+// the kubeconfig file of the user
+func userKubeconfigFile(generatedAssetsDir, user string) string {
+	return filepath.Join(generatedAssetsDir, "kubeconfigs", user)
+}
+
+// CreateUserCredentials issues a client certificate for the user, who is a member of the
+// groups, and writes a kubeconfig file for it. The identity is recorded in the generated
+// assets directory.
+func (ae *ansibleExecutor) CreateUserCredentials(p *Plan, user string, groups []string) (*UserIdentity, error) {
+	if !userNameRE.MatchString(user) {
+		return nil, fmt.Errorf("user name %q is not valid", user)
+	}
+	if util.Subset([]string{user}, reservedUsers) {
+		return nil, fmt.Errorf("the credentials of user %q are managed with the cluster certificates", user)
+	}
+	identities, err := ListUserIdentities(ae.options.GeneratedAssetsDirectory)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range identities {
+		if id.Name == user && id.Discarded == nil {
+			return nil, fmt.Errorf("credentials for user %q already exist, they must be discarded before creating new ones", user)
+		}
+	}
+	// Vault drops the organizations of the subject, which are the groups of the user
+	if len(groups) > 0 && p.Cluster.Certificates.Signer.Type == "vault" {
+		return nil, errors.New("groups can't be set on the certificates issued by the Vault signer")
+	}
+	pki, err := ae.planPKI(p)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := pki.GetClusterCA()
+	if err != nil {
+		return nil, err
+	}
+	certsDir := userCertsDirectory(ae.options.GeneratedAssetsDirectory)
+	cert, err := pki.IssueUserCertificate(p, user, groups, ca, certsDir)
+	if err != nil {
+		return nil, err
+	}
+	kubeconfig := userKubeconfigFile(ae.options.GeneratedAssetsDirectory, user)
+	if err = os.MkdirAll(filepath.Dir(kubeconfig), 0700); err != nil {
+		return nil, fmt.Errorf("error creating directory for kubeconfig file: %v", err)
+	}
+	if err = writeKubeconfig(p, ae.certsDir, certsDir, user, kubeconfig, 0600); err != nil {
+		return nil, err
+	}
+	if groups == nil {
+		groups = []string{}
+	}
+	id := UserIdentity{
+		Name:       user,
+		Groups:     groups,
+		Serial:     fmt.Sprintf("%x", cert.SerialNumber),
+		Issued:     time.Now().UTC(),
+		NotAfter:   cert.NotAfter,
+		Kubeconfig: kubeconfig,
+	}
+	identities = append(identities, id)
+	if err = writeUserIdentities(ae.options.GeneratedAssetsDirectory, identities); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// rotateUserCredentials re-issues the certificate of the user's recorded identity, with
+// the groups it was issued with, and rewrites its kubeconfig file. False is returned if
+// no credentials were created for the user.
+func (ae *ansibleExecutor) rotateUserCredentials(p *Plan, pki PKI, ca *tls.CA, user string) (bool, error) {
+	identities, err := ListUserIdentities(ae.options.GeneratedAssetsDirectory)
+	if err != nil {
+		return false, err
+	}
+	for i := range identities {
+		id := &identities[i]
+		if id.Name != user || id.Discarded != nil {
+			continue
+		}
+		certsDir := userCertsDirectory(ae.options.GeneratedAssetsDirectory)
+		cert, err := pki.IssueUserCertificate(p, user, id.Groups, ca, certsDir)
+		if err != nil {
+			return false, err
+		}
+		if err = writeKubeconfig(p, ae.certsDir, certsDir, user, id.Kubeconfig, 0600); err != nil {
+			return false, err
+		}
+		id.Serial = fmt.Sprintf("%x", cert.SerialNumber)
+		id.Issued = time.Now().UTC()
+		id.NotAfter = cert.NotAfter
+		if err = writeUserIdentities(ae.options.GeneratedAssetsDirectory, identities); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// ListUserIdentities returns the identities that were issued, including the discarded identities
+func ListUserIdentities(generatedAssetsDir string) ([]UserIdentity, error) {
+	identities := []UserIdentity{}
+	b, err := ioutil.ReadFile(userIdentitiesFile(generatedAssetsDir))
+	if os.IsNotExist(err) {
+		return identities, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading user identities: %v", err)
+	}
+	if err = json.Unmarshal(b, &identities); err != nil {
+		return nil, fmt.Errorf("error decoding user identities: %v", err)
+	}
+	return identities, nil
+}
+
+// DiscardUserCredentials removes the user's certificate, key and kubeconfig file from the
+// generated assets directory, and records the credentials as discarded. This does not
+// revoke the certificate: the API server does not check certificate revocation, so the
+// certificate remains valid until it expires, or until the cluster CA is replaced.
+func DiscardUserCredentials(generatedAssetsDir, user string) (*UserIdentity, error) {
+	identities, err := ListUserIdentities(generatedAssetsDir)
+	if err != nil {
+		return nil, err
+	}
+	for i := range identities {
+		id := &identities[i]
+		if id.Name != user || id.Discarded != nil {
+			continue
+		}
+		if err = tls.DeleteCert(user, userCertsDirectory(generatedAssetsDir)); err != nil {
+			return nil, err
+		}
+		if err = os.Remove(id.Kubeconfig); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error removing kubeconfig file: %v", err)
+		}
+		now := time.Now().UTC()
+		id.Discarded = &now
+		if err = writeUserIdentities(generatedAssetsDir, identities); err != nil {
+			return nil, err
+		}
+		return id, nil
+	}
+	return nil, fmt.Errorf("no credentials were found for user %q", user)
+}
+
+func writeUserIdentities(generatedAssetsDir string, identities []UserIdentity) error {
+	b, err := json.MarshalIndent(identities, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding user identities: %v", err)
+	}
+	file := userIdentitiesFile(generatedAssetsDir)
+	if err = ioutil.WriteFile(file, b, 0600); err != nil {
+		return fmt.Errorf("error writing user identities: %v", err)
+	}
+	// The file may have been created with broader permissions
+	if err = os.Chmod(file, 0600); err != nil {
+		return fmt.Errorf("error setting permissions of user identities file: %v", err)
+	}
+	return nil
+}
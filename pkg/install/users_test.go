@@ -0,0 +1,171 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestCreateAndDiscardUserCredentials(t *testing.T) {
+	pki := &fakePKI{}
+	generatedDir := mustGetTempDir(t)
+	e := ansibleExecutor{
+		options:  ExecutorOptions{GeneratedAssetsDirectory: generatedDir},
+		stdout:   ioutil.Discard,
+		certsDir: filepath.Join(generatedDir, "keys"),
+		pki:      pki,
+	}
+	mustWriteCA(t, e.certsDir)
+	id, err := e.CreateUserCredentials(testPlan(), "alice", []string{"dev", "ops"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(pki.issuedUsers, []string{"alice"}) {
+		t.Errorf("expected a certificate to be issued for alice, but got %v", pki.issuedUsers)
+	}
+	info, err := os.Stat(id.Kubeconfig)
+	if err != nil {
+		t.Fatalf("expected kubeconfig file to be written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected kubeconfig file to be readable by the owner only, but got %v", info.Mode())
+	}
+	if info, err = os.Stat(filepath.Dir(id.Kubeconfig)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("expected kubeconfig directory to be accessible by the owner only, but got %v %v", info, err)
+	}
+	// The credentials must be discarded before new ones are created
+	if _, err = e.CreateUserCredentials(testPlan(), "alice", nil); err == nil {
+		t.Errorf("expected an error when the user already has credentials")
+	}
+
+	discarded, err := DiscardUserCredentials(generatedDir, "alice")
+	if err != nil {
+		t.Fatalf("unexpected error discarding credentials: %v", err)
+	}
+	if discarded.Discarded == nil || discarded.Serial != id.Serial {
+		t.Errorf("expected the identity to be recorded as discarded, but got %+v", discarded)
+	}
+	if _, err = os.Stat(id.Kubeconfig); !os.IsNotExist(err) {
+		t.Errorf("expected kubeconfig file to be removed")
+	}
+	if _, err = DiscardUserCredentials(generatedDir, "alice"); err == nil {
+		t.Errorf("expected an error when the credentials were already discarded")
+	}
+
+	if _, err = e.CreateUserCredentials(testPlan(), "alice", nil); err != nil {
+		t.Fatalf("unexpected error creating new credentials: %v", err)
+	}
+	identities, err := ListUserIdentities(generatedDir)
+	if err != nil {
+		t.Fatalf("unexpected error listing identities: %v", err)
+	}
+	if len(identities) != 2 || identities[0].Discarded == nil || identities[1].Discarded != nil {
+		t.Errorf("expected the discarded and the new identity, but got %+v", identities)
+	}
+	if !reflect.DeepEqual(identities[0].Groups, []string{"dev", "ops"}) || !reflect.DeepEqual(identities[1].Groups, []string{}) {
+		t.Errorf("unexpected groups: %v and %v", identities[0].Groups, identities[1].Groups)
+	}
+}
+
+func TestCreateUserCredentialsVaultSignerGroups(t *testing.T) {
+	pki := &fakePKI{}
+	generatedDir := mustGetTempDir(t)
+	e := ansibleExecutor{
+		options:  ExecutorOptions{GeneratedAssetsDirectory: generatedDir},
+		stdout:   ioutil.Discard,
+		certsDir: filepath.Join(generatedDir, "keys"),
+		pki:      pki,
+	}
+	p := testPlan()
+	p.Cluster.Certificates.Signer.Type = "vault"
+	if _, err := e.CreateUserCredentials(p, "alice", []string{"dev"}); err == nil {
+		t.Errorf("expected an error when setting groups with the Vault signer")
+	}
+	if len(pki.issuedUsers) != 0 {
+		t.Errorf("expected no certificate to be issued, but got %v", pki.issuedUsers)
+	}
+}
+
+func TestRotateCertificatesKeepsUserGroups(t *testing.T) {
+	pki := &fakePKI{}
+	generatedDir := mustGetTempDir(t)
+	e := ansibleExecutor{
+		options:                ExecutorOptions{GeneratedAssetsDirectory: generatedDir, RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		certsDir:               filepath.Join(generatedDir, "keys"),
+		pki:                    pki,
+		runnerExplainerFactory: fakeRunnerExplainerWithRunner(&fakeRunner{}),
+	}
+	mustWriteCA(t, e.certsDir)
+	id, err := e.CreateUserCredentials(testPlan(), "alice", []string{"dev", "ops"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = e.RotateCertificates(testPlan(), CertificateRotation{Users: []string{"alice", "admin"}}); err != nil {
+		t.Fatalf("unexpected error rotating certificates: %v", err)
+	}
+	// alice is re-issued from its recorded identity, admin with the cluster certificates
+	if !reflect.DeepEqual(pki.issuedGroups, [][]string{{"dev", "ops"}, {"dev", "ops"}}) {
+		t.Errorf("expected the certificate of alice to be re-issued with its groups, but got %v", pki.issuedGroups)
+	}
+	if !reflect.DeepEqual(pki.rotatedCerts, []string{"admin"}) {
+		t.Errorf("expected the certificate of admin to be rotated, but got %v", pki.rotatedCerts)
+	}
+	identities, err := ListUserIdentities(e.options.GeneratedAssetsDirectory)
+	if err != nil {
+		t.Fatalf("unexpected error listing identities: %v", err)
+	}
+	if len(identities) != 1 || identities[0].Serial == id.Serial {
+		t.Errorf("expected the serial of the identity to be updated, but got %+v", identities)
+	}
+	info, err := os.Stat(filepath.Join(e.options.GeneratedAssetsDirectory, "users.json"))
+	if err != nil {
+		t.Fatalf("error reading identities file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected identities file to be readable by the owner only, but got %v", info.Mode())
+	}
+}
+
+func TestCreateUserCredentialsInvalidUser(t *testing.T) {
+	pki := &fakePKI{}
+	generatedDir := mustGetTempDir(t)
+	e := ansibleExecutor{
+		options:  ExecutorOptions{GeneratedAssetsDirectory: generatedDir},
+		stdout:   ioutil.Discard,
+		certsDir: filepath.Join(generatedDir, "keys"),
+		pki:      pki,
+	}
+	mustWriteCA(t, e.certsDir)
+	for _, user := range []string{"admin", "", "../alice"} {
+		if _, err := e.CreateUserCredentials(testPlan(), user, nil); err == nil {
+			t.Errorf("expected an error creating credentials for user %q", user)
+		}
+	}
+	if len(pki.issuedUsers) != 0 {
+		t.Errorf("expected no certificates to be issued, but got %v", pki.issuedUsers)
+	}
+}
+
+func TestIssueUserCertificateGroups(t *testing.T) {
+	pki := getPKI(t)
+	defer cleanup(pki.GeneratedCertsDirectory, t)
+	p := getPlan()
+	ca, err := pki.GenerateClusterCA(p)
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	dir := filepath.Join(pki.GeneratedCertsDirectory, "users")
+	if _, err = pki.IssueUserCertificate(p, "alice", []string{"dev", "ops"}, ca, dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert := mustReadCertFile(filepath.Join(dir, "alice.pem"), t)
+	if cert.Subject.CommonName != "alice" || !reflect.DeepEqual(cert.Subject.Organization, []string{"dev", "ops"}) {
+		t.Errorf("expected CN alice with organizations dev and ops, but got %v", cert.Subject)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/tls"
 )
 
 // TODO: There is need to run validation against anything that is validatable.
@@ -39,9 +40,32 @@ func ValidateNode(node *Node) (bool, []error) {
 func ValidatePlanSSHConnections(p *Plan) (bool, []error) {
 	v := newValidator()
 
-	s := sshConnectionSet{p.Cluster.SSH, p.GetUniqueNodeIPs()}
+	// Nodes are validated in sets that share the same SSH configuration
+	sets := []*sshConnectionSet{}
+	seen := map[string]bool{}
+	for _, n := range p.getAllNodes() {
+		if seen[n.IP] {
+			continue
+		}
+		seen[n.IP] = true
+		s := p.GetNodeSSHConfig(n)
+		var set *sshConnectionSet
+		for _, cs := range sets {
+			if cs.SSHConfig == s {
+				set = cs
+				break
+			}
+		}
+		if set == nil {
+			set = &sshConnectionSet{SSHConfig: s}
+			sets = append(sets, set)
+		}
+		set.IPs = append(set.IPs, n.IP)
+	}
 
-	v.validateWithErrPrefix("Node Connnection", s)
+	for _, s := range sets {
+		v.validateWithErrPrefix("Node Connnection", *s)
+	}
 
 	return v.valid()
 }
@@ -184,6 +208,43 @@ func (c *CertsConfig) validate() (bool, []error) {
 	if _, err := time.ParseDuration(c.Expiry); err != nil {
 		v.addError(fmt.Errorf("Invalid certificate expiry %q provided: %v", c.Expiry, err))
 	}
+	if c.CACert != "" && c.CAKey == "" {
+		v.addError(errors.New("CA key field is required when a CA certificate is provided"))
+	}
+	if c.CAKey != "" && c.CACert == "" {
+		v.addError(errors.New("CA certificate field is required when a CA key is provided"))
+	}
+	if c.CAChain != "" && c.CACert == "" {
+		v.addError(errors.New("CA certificate field is required when a CA chain is provided"))
+	}
+	for _, a := range []string{c.CAKeyAlgorithm, c.KeyAlgorithm} {
+		if _, err := tls.NewKeyRequest(a); err != nil {
+			v.addError(fmt.Errorf("Invalid certificate key algorithm provided: %v", err))
+		}
+	}
+	switch c.Signer.Type {
+	case "", "local":
+	case "vault":
+		if c.CACert != "" {
+			v.addError(errors.New("A CA certificate cannot be provided when an external signer is used"))
+		}
+		if c.Signer.Address == "" {
+			v.addError(errors.New("Signer address field is required"))
+		}
+		if c.Signer.Mount == "" {
+			v.addError(errors.New("Signer mount field is required"))
+		}
+		if c.Signer.Role == "" {
+			v.addError(errors.New("Signer role field is required"))
+		}
+	default:
+		v.addError(fmt.Errorf("Signer type %q is not supported, options are \"local\" and \"vault\"", c.Signer.Type))
+	}
+	for _, f := range []string{c.CACert, c.CAKey, c.CAChain, c.Signer.TLSCAFile} {
+		if _, err := os.Stat(f); f != "" && os.IsNotExist(err) {
+			v.addError(fmt.Errorf("Certificate file was not found at %q", f))
+		}
+	}
 	return v.valid()
 }
 
@@ -204,6 +265,44 @@ func (s *SSHConfig) validate() (bool, []error) {
 	if s.Port < 1 || s.Port > 65535 {
 		v.addError(fmt.Errorf("SSH port %d is invalid. Port must be in the range 1-65535", s.Port))
 	}
+	if s.Bastion != (SSHBastion{}) {
+		v.validate(&s.Bastion)
+	}
+	return v.valid()
+}
+
+func (s *NodeSSHConfig) validate() (bool, []error) {
+	v := newValidator()
+	if s.Key != "" {
+		if _, err := os.Stat(s.Key); os.IsNotExist(err) {
+			v.addError(fmt.Errorf("SSH Key file was not found at %q", s.Key))
+		}
+		if !filepath.IsAbs(s.Key) {
+			v.addError(errors.New("SSH Key field must be an absolute path"))
+		}
+	}
+	if s.Port < 0 || s.Port > 65535 {
+		v.addError(fmt.Errorf("SSH port %d is invalid. Port must be in the range 1-65535", s.Port))
+	}
+	return v.valid()
+}
+
+func (b *SSHBastion) validate() (bool, []error) {
+	v := newValidator()
+	if b.Address == "" {
+		v.addError(errors.New("SSH bastion address field is required"))
+	}
+	if b.Port < 0 || b.Port > 65535 {
+		v.addError(fmt.Errorf("SSH bastion port %d is invalid. Port must be in the range 1-65535", b.Port))
+	}
+	if b.Key != "" {
+		if _, err := os.Stat(b.Key); os.IsNotExist(err) {
+			v.addError(fmt.Errorf("SSH bastion key file was not found at %q", b.Key))
+		}
+		if !filepath.IsAbs(b.Key) {
+			v.addError(errors.New("SSH bastion key field must be an absolute path"))
+		}
+	}
 	return v.valid()
 }
 
@@ -211,10 +310,18 @@ func (s *SSHConfig) validate() (bool, []error) {
 func (s sshConnectionSet) validate() (bool, []error) {
 	v := newValidator()
 
-	err := ssh.ValidUnencryptedPrivateKey(s.SSHConfig.Key)
+	_, err := ssh.PrepareAuth(s.SSHConfig.Key)
 	if err != nil {
 		v.addError(fmt.Errorf("error parsing SSH key: %v", err))
-	} else {
+	}
+	bastion := s.SSHConfig.GetBastion()
+	if bastion != nil && bastion.Key != s.SSHConfig.Key {
+		if _, bastionErr := ssh.PrepareAuth(bastion.Key); bastionErr != nil {
+			v.addError(fmt.Errorf("error parsing SSH bastion key: %v", bastionErr))
+			err = bastionErr
+		}
+	}
+	if err == nil {
 		var wg sync.WaitGroup
 		errQueue := make(chan error, len(s.IPs))
 		// number of nodes
@@ -222,7 +329,7 @@ func (s sshConnectionSet) validate() (bool, []error) {
 		for _, ipa := range s.IPs {
 			go func(ip string) {
 				defer wg.Done()
-				sshErr := ssh.TestConnection(ip, s.SSHConfig.Port, s.SSHConfig.User, s.SSHConfig.Key)
+				sshErr := ssh.TestConnection(ip, s.SSHConfig.Port, s.SSHConfig.User, s.SSHConfig.Key, bastion)
 				// Need to send something the buffered channel
 				if sshErr != nil {
 					errQueue <- fmt.Errorf("SSH connectivity validation failed for %q: %v", ip, sshErr)
@@ -260,6 +367,7 @@ func (ng *NodeGroup) validate() (bool, []error) {
 	if len(ng.Nodes) != ng.ExpectedCount && (len(ng.Nodes) > 0 && ng.ExpectedCount > 0) {
 		v.addError(fmt.Errorf("Expected node count (%d) does not match the number of nodes provided (%d)", ng.ExpectedCount, len(ng.Nodes)))
 	}
+	v.validate(&ng.SSH)
 	for i, n := range ng.Nodes {
 		v.validateWithErrPrefix(fmt.Sprintf("Node #%d", i+1), &n)
 	}
@@ -297,6 +405,7 @@ func (mng *MasterNodeGroup) validate() (bool, []error) {
 	if len(mng.Nodes) != mng.ExpectedCount && (len(mng.Nodes) > 0 && mng.ExpectedCount > 0) {
 		v.addError(fmt.Errorf("Expected node count (%d) does not match the number of nodes provided (%d)", mng.ExpectedCount, len(mng.Nodes)))
 	}
+	v.validate(&mng.SSH)
 	for i, n := range mng.Nodes {
 		v.validateWithErrPrefix(fmt.Sprintf("Node #%d", i+1), &n)
 	}
@@ -326,6 +435,7 @@ func (n *Node) validate() (bool, []error) {
 	if ip := net.ParseIP(n.InternalIP); n.InternalIP != "" && ip == nil {
 		v.addError(fmt.Errorf("Invalid InternalIP provided"))
 	}
+	v.validate(&n.SSH)
 	return v.valid()
 }
 
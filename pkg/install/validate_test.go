@@ -71,6 +71,19 @@ var validPlan = Plan{
 	},
 }
 
+// testPlan returns a copy of validPlan that tests can modify
+// without affecting each other
+func testPlan() *Plan {
+	p := validPlan
+	p.Etcd.Nodes = append([]Node(nil), validPlan.Etcd.Nodes...)
+	p.Master.Nodes = append([]Node(nil), validPlan.Master.Nodes...)
+	p.Worker.Nodes = append([]Node(nil), validPlan.Worker.Nodes...)
+	p.Ingress.Nodes = append([]Node(nil), validPlan.Ingress.Nodes...)
+	p.Storage.Nodes = append([]Node(nil), validPlan.Storage.Nodes...)
+	p.NFS.Volumes = append([]NFSVolume(nil), validPlan.NFS.Volumes...)
+	return &p
+}
+
 func assertInvalidPlan(t *testing.T, p Plan) {
 	valid, _ := ValidatePlan(&p)
 	if valid {
@@ -140,6 +153,37 @@ func TestValidatePlanInvalidCertExpiry(t *testing.T) {
 	assertInvalidPlan(t, p)
 }
 
+func TestValidatePlanCACertWithoutKey(t *testing.T) {
+	p := validPlan
+	p.Cluster.Certificates.CACert = "/bin/sh"
+	assertInvalidPlan(t, p)
+}
+
+func TestValidatePlanCAChainWithoutCert(t *testing.T) {
+	p := validPlan
+	p.Cluster.Certificates.CAChain = "/bin/sh"
+	assertInvalidPlan(t, p)
+}
+
+func TestValidatePlanCACertNotFound(t *testing.T) {
+	p := validPlan
+	p.Cluster.Certificates.CACert = "/foo/ca.pem"
+	p.Cluster.Certificates.CAKey = "/bin/sh"
+	assertInvalidPlan(t, p)
+}
+
+func TestValidatePlanVaultSignerMissingRole(t *testing.T) {
+	p := validPlan
+	p.Cluster.Certificates.Signer = SignerConfig{Type: "vault", Address: "https://vault:8200", Mount: "pki"}
+	assertInvalidPlan(t, p)
+}
+
+func TestValidatePlanUnsupportedSigner(t *testing.T) {
+	p := validPlan
+	p.Cluster.Certificates.Signer = SignerConfig{Type: "foo"}
+	assertInvalidPlan(t, p)
+}
+
 func TestValidatePlanEmptySSHUser(t *testing.T) {
 	p := validPlan
 	p.Cluster.SSH.User = ""
@@ -164,6 +208,114 @@ func TestValidatePlanNegativeSSHPort(t *testing.T) {
 	assertInvalidPlan(t, p)
 }
 
+func TestValidatePlanSSHBastion(t *testing.T) {
+	p := validPlan
+	p.Cluster.SSH.Bastion = SSHBastion{Address: "10.0.0.1"}
+	if valid, errs := ValidatePlan(&p); !valid {
+		t.Errorf("expected valid, but got invalid: %v", errs)
+	}
+}
+
+func TestValidatePlanSSHBastionEmptyAddress(t *testing.T) {
+	p := validPlan
+	p.Cluster.SSH.Bastion = SSHBastion{User: "jump"}
+	assertInvalidPlan(t, p)
+}
+
+func TestValidatePlanSSHBastionNonExistentKey(t *testing.T) {
+	p := validPlan
+	p.Cluster.SSH.Bastion = SSHBastion{Address: "10.0.0.1", Key: "/foo"}
+	assertInvalidPlan(t, p)
+}
+
+func TestSSHConfigGetBastionDefaults(t *testing.T) {
+	s := SSHConfig{User: "alice", Key: "/keys/id_rsa", Port: 2222}
+	if b := s.GetBastion(); b != nil {
+		t.Errorf("expected no bastion, but got %+v", b)
+	}
+	s.Bastion = SSHBastion{Address: "10.0.0.1"}
+	b := s.GetBastion()
+	if b == nil || b.Port != 22 || b.User != "alice" || b.Key != "/keys/id_rsa" {
+		t.Errorf("expected the bastion to default to port 22 and the cluster's SSH user and key, but got %+v", b)
+	}
+}
+
+func TestValidatePlanNodeSSHOverrides(t *testing.T) {
+	p := validPlan
+	p.Worker.SSH = NodeSSHConfig{User: "centos", Port: 2222}
+	p.Master.Nodes = []Node{{Host: "master01", IP: "192.168.205.11", SSH: NodeSSHConfig{Key: "/bin/bash"}}}
+	if valid, errs := ValidatePlan(&p); !valid {
+		t.Errorf("expected valid, but got invalid: %v", errs)
+	}
+}
+
+func TestValidatePlanNodeSSHNonExistentKey(t *testing.T) {
+	p := validPlan
+	p.Worker.Nodes = []Node{{Host: "worker01", IP: "192.168.205.12", SSH: NodeSSHConfig{Key: "/foo"}}}
+	assertInvalidPlan(t, p)
+}
+
+func TestValidatePlanNodeSSHRelativeKey(t *testing.T) {
+	p := validPlan
+	p.Etcd.SSH = NodeSSHConfig{Key: "id_rsa"}
+	assertInvalidPlan(t, p)
+}
+
+func TestValidatePlanNodeSSHInvalidPort(t *testing.T) {
+	p := validPlan
+	p.Master.SSH = NodeSSHConfig{Port: 70000}
+	assertInvalidPlan(t, p)
+}
+
+func TestGetNodeSSHConfigPrecedence(t *testing.T) {
+	p := validPlan
+	p.Cluster.SSH.Bastion = SSHBastion{Address: "10.0.0.1"}
+	p.Worker.SSH = NodeSSHConfig{User: "centos", Port: 2222}
+	p.Worker.Nodes = []Node{
+		{Host: "worker01", IP: "192.168.205.12"},
+		{Host: "worker02", IP: "192.168.205.13", SSH: NodeSSHConfig{User: "ubuntu", Key: "/keys/ubuntu"}},
+	}
+	p.Ingress.SSH = NodeSSHConfig{User: "ignored"}
+
+	tests := []struct {
+		node Node
+		user string
+		key  string
+		port int
+	}{
+		{node: p.Master.Nodes[0], user: "root", key: "/bin/sh", port: 22},
+		{node: p.Worker.Nodes[0], user: "centos", key: "/bin/sh", port: 2222},
+		{node: p.Worker.Nodes[1], user: "ubuntu", key: "/keys/ubuntu", port: 2222},
+		// etcd01 is also an ingress node, the settings of the etcd group are used
+		{node: p.Ingress.Nodes[0], user: "root", key: "/bin/sh", port: 22},
+		// nodes that are not in the plan use the cluster's settings
+		{node: Node{Host: "new", SSH: NodeSSHConfig{Port: 23}}, user: "root", key: "/bin/sh", port: 23},
+	}
+	for _, test := range tests {
+		s := p.GetNodeSSHConfig(test.node)
+		if s.User != test.user || s.Key != test.key || s.Port != test.port {
+			t.Errorf("%s: expected user %q, key %q and port %d, but got %+v", test.node.Host, test.user, test.key, test.port, s)
+		}
+		// the bastion keeps the cluster's defaults
+		b := s.GetBastion()
+		if b == nil || b.User != "root" || b.Key != "/bin/sh" || b.Port != 22 {
+			t.Errorf("%s: expected the bastion to use the cluster's SSH settings, but got %+v", test.node.Host, b)
+		}
+	}
+
+	con, err := p.GetSSHConnection("worker02")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if con.SSHConfig.User != "ubuntu" || con.SSHConfig.Port != 2222 {
+		t.Errorf("expected the SSH connection to use the node's settings, but got %+v", con.SSHConfig)
+	}
+
+	if s := p.GetRoleSSHConfig("ingress", p.Ingress.Nodes[0]); s.User != "ignored" {
+		t.Errorf("expected the ingress group's user, but got %q", s.User)
+	}
+}
+
 func TestValidatePlanEmptyLoadBalancedFQDN(t *testing.T) {
 	p := validPlan
 	p.Master.LoadBalancedFQDN = ""
@@ -543,3 +695,9 @@ func TestValidatePlanMissingSomeCerts(t *testing.T) {
 		fmt.Println(errs)
 	}
 }
+
+func TestValidatePlanInvalidKeyAlgorithm(t *testing.T) {
+	p := validPlan
+	p.Cluster.Certificates.KeyAlgorithm = "dsa"
+	assertInvalidPlan(t, p)
+}
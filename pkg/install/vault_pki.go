@@ -0,0 +1,90 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/apprenda/kismatic/pkg/tls"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// VaultPKI is a PKI that obtains the certificates from an external signer that
+// implements the API of the HashiCorp Vault PKI secrets engine. The private key of
+// the CA is never held locally. The CA certificate, and the issued certificates and
+// their private keys, are stored in the generated certs directory.
+// The sign endpoint of Vault only keeps the common name and the SANs of the CSR:
+// the organizations of the subject, which hold the groups of the users, are dropped.
+type VaultPKI struct {
+	LocalPKI
+	signer *tls.VaultSigner
+}
+
+// NewVaultPKI returns a PKI that uses the signer described in the configuration,
+// authenticating with the given token. The certificates are requested with the
+// expiry as their TTL, which is capped by the max TTL of the Vault role.
+func NewVaultPKI(config SignerConfig, expiry, token string, generatedCertsDirectory string, log io.Writer) (*VaultPKI, error) {
+	if token == "" {
+		return nil, errors.New("the VAULT_TOKEN environment variable must be set when using the vault signer")
+	}
+	signer, err := tls.NewVaultSigner(config.Address, config.Mount, config.Role, token, expiry, config.TLSCAFile)
+	if err != nil {
+		return nil, err
+	}
+	return &VaultPKI{
+		LocalPKI: LocalPKI{
+			GeneratedCertsDirectory: generatedCertsDirectory,
+			Log:                     log,
+			signer:                  signer,
+		},
+		signer: signer,
+	}, nil
+}
+
+// CertificateAuthorityExists returns true if the CA certificate has been
+// retrieved from the signer
+func (vp *VaultPKI) CertificateAuthorityExists() (bool, error) {
+	_, err := os.Stat(filepath.Join(vp.GeneratedCertsDirectory, "ca.pem"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetClusterCA returns the cluster CA, which only contains the CA certificate
+func (vp *VaultPKI) GetClusterCA() (*tls.CA, error) {
+	cert, err := ioutil.ReadFile(filepath.Join(vp.GeneratedCertsDirectory, "ca.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA certificate: %v", err)
+	}
+	return &tls.CA{Cert: cert}, nil
+}
+
+// GenerateClusterCA retrieves the CA certificate and its chain from the signer
+func (vp *VaultPKI) GenerateClusterCA(p *Plan) (*tls.CA, error) {
+	exists, err := vp.CertificateAuthorityExists()
+	if err != nil {
+		return nil, fmt.Errorf("error verifying CA certificate: %v", err)
+	}
+	if exists {
+		return vp.GetClusterCA()
+	}
+	util.PrettyPrintOk(vp.Log, "Retrieving Certificate Authority from %q", vp.signer.Address)
+	cert, err := vp.signer.CACert()
+	if err != nil {
+		return nil, err
+	}
+	if err = util.CreateDir(vp.GeneratedCertsDirectory, 0744); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(vp.GeneratedCertsDirectory, "ca.pem"), cert, 0644); err != nil {
+		return nil, fmt.Errorf("error writing CA certificate: %v", err)
+	}
+	return &tls.CA{Cert: cert}, nil
+}
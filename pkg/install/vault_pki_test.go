@@ -0,0 +1,82 @@
+package install
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/tls"
+	"github.com/cloudflare/cfssl/csr"
+)
+
+func TestVaultPKIGenerateClusterCertificates(t *testing.T) {
+	// The stub server issues the certificates with a CA that is not stored in the certs directory.
+	// For simplicity, it does not use the key of the CSR, which is not verified by the PKI.
+	caDir := mustGetTempDir(t)
+	caPKI := getPKI(t)
+	caPKI.GeneratedCertsDirectory = caDir
+	stubCA, err := caPKI.GenerateClusterCA(getPlan())
+	if err != nil {
+		t.Fatalf("error generating CA: %v", err)
+	}
+	ttls := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cert := string(stubCA.Cert)
+		if r.URL.Path == "/v1/pki/sign/kismatic" {
+			req := struct {
+				CSR        string `json:"csr"`
+				CommonName string `json:"common_name"`
+				TTL        string `json:"ttl"`
+			}{}
+			json.NewDecoder(r.Body).Decode(&req)
+			ttls = append(ttls, req.TTL)
+			_, signed, err := tls.NewCert(stubCA, csr.CertificateRequest{CN: req.CommonName, KeyRequest: &csr.BasicKeyRequest{A: "rsa", S: 2048}})
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			cert = string(signed)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"certificate": cert}})
+	}))
+	defer server.Close()
+
+	certsDir := mustGetTempDir(t)
+	config := SignerConfig{Type: "vault", Address: server.URL, Mount: "pki", Role: "kismatic"}
+	if _, err = NewVaultPKI(config, "17520h", "", certsDir, ioutil.Discard); err == nil {
+		t.Errorf("expected an error when the token is not set")
+	}
+	p := getPlan()
+	pki, err := NewVaultPKI(config, p.Cluster.Certificates.Expiry, "token", certsDir, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ca, err := pki.GenerateClusterCA(p)
+	if err != nil {
+		t.Fatalf("unexpected error getting CA: %v", err)
+	}
+	if err = pki.GenerateClusterCertificates(p, ca, []string{"admin"}); err != nil {
+		t.Fatalf("unexpected error generating certificates: %v", err)
+	}
+	if exists, _ := pki.CertificateAuthorityExists(); !exists {
+		t.Errorf("expected the CA certificate to be stored")
+	}
+	if exists, _ := tls.CertKeyPairExists("ca", certsDir); exists {
+		t.Errorf("expected the CA private key not to be stored")
+	}
+	if len(ttls) == 0 {
+		t.Errorf("expected certificates to be signed")
+	}
+	for _, ttl := range ttls {
+		if ttl != p.Cluster.Certificates.Expiry {
+			t.Errorf("expected the certificates to be requested with TTL %q, but got %q", p.Cluster.Certificates.Expiry, ttl)
+		}
+	}
+	cert := mustReadCertFile(filepath.Join(certsDir, "worker.pem"), t)
+	if cert.Subject.CommonName != "worker" || cert.Issuer.CommonName != "someName" {
+		t.Errorf("expected certificate for worker issued by the stub CA, but got %v issued by %v", cert.Subject, cert.Issuer)
+	}
+}
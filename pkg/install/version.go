@@ -0,0 +1,161 @@
+package install
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
+
+// kismaticVersionFile is the file on each node that records the version of
+// Kismatic that was last applied to it
+const kismaticVersionFile = "/etc/kismatic-version"
+
+// kismaticVersion is the version of the running Kismatic CLI
+var kismaticVersion Version
+
+// SetVersion sets the version of the running Kismatic CLI. Nodes that
+// report an older version are candidates for an upgrade.
+func SetVersion(v string) error {
+	parsed, err := ParseVersion(v)
+	if err != nil {
+		return err
+	}
+	kismaticVersion = parsed
+	return nil
+}
+
+// Version is a Kismatic release version
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseVersion parses versions of the form vX.Y.Z. Any pre-release or build
+// information (e.g. v1.2.0-12-gabcdef) is ignored.
+func ParseVersion(v string) (Version, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("%q is not a valid version", v)
+	}
+	nums := make([]int, 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("%q is not a valid version", v)
+		}
+		nums[i] = n
+	}
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// OlderThan returns true if this version precedes the other version
+func (v Version) OlderThan(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// NodeVersion is the version of Kismatic that was last applied to a node
+type NodeVersion struct {
+	Node  Node
+	Roles []string
+	// Version is the zero value when the node does not report a version,
+	// which is the case for nodes installed before versions were recorded.
+	Version Version
+}
+
+// NeedsUpgrade returns true if the node is behind the running Kismatic version
+func (nv NodeVersion) NeedsUpgrade() bool {
+	return nv.Version.OlderThan(kismaticVersion)
+}
+
+// ListVersions connects to every node in the plan and returns the version of
+// Kismatic installed on each of them. Nodes are returned in the order in which
+// they must be upgraded: etcd, master, worker, ingress and storage.
+func ListVersions(p *Plan) ([]NodeVersion, error) {
+	nodes := p.nodesInUpgradeOrder()
+	versions := make([]NodeVersion, len(nodes))
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i, nv := range nodes {
+		wg.Add(1)
+		go func(i int, nv NodeVersion) {
+			defer wg.Done()
+			v, err := getNodeVersion(nv.Node, p.GetNodeSSHConfig(nv.Node))
+			if err != nil {
+				errs[i] = fmt.Errorf("error getting version of node %q: %v", nv.Node.Host, err)
+				return
+			}
+			nv.Version = v
+			versions[i] = nv
+		}(i, nv)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+func getNodeVersion(n Node, s SSHConfig) (Version, error) {
+	client, err := ssh.OpenConnection(n.IP, s.Port, s.User, s.Key, s.GetBastion())
+	if err != nil {
+		return Version{}, fmt.Errorf("error creating SSH client: %v", err)
+	}
+	defer client.Close()
+	// A missing file is not an error, the node predates version tracking
+	out, err := client.Output(fmt.Sprintf("cat %s 2>/dev/null || true", kismaticVersionFile))
+	if err != nil {
+		return Version{}, err
+	}
+	if strings.TrimSpace(out) == "" {
+		return Version{}, nil
+	}
+	return ParseVersion(out)
+}
+
+// returns the unique nodes of the cluster, along with the roles they play,
+// in the order in which they must be upgraded
+func (p *Plan) nodesInUpgradeOrder() []NodeVersion {
+	groups := []struct {
+		role  string
+		nodes []Node
+	}{
+		{"etcd", p.Etcd.Nodes},
+		{"master", p.Master.Nodes},
+		{"worker", p.Worker.Nodes},
+		{"ingress", p.Ingress.Nodes},
+		{"storage", p.Storage.Nodes},
+	}
+	nodes := []NodeVersion{}
+	seen := map[string]int{}
+	for _, g := range groups {
+		for _, n := range g.nodes {
+			if i, ok := seen[n.Host]; ok {
+				nodes[i].Roles = append(nodes[i].Roles, g.role)
+				continue
+			}
+			seen[n.Host] = len(nodes)
+			nodes = append(nodes, NodeVersion{Node: n, Roles: []string{g.role}})
+		}
+	}
+	return nodes
+}
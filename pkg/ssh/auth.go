@@ -0,0 +1,333 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// AuthMechanism is the mechanism used for authenticating the SSH connections
+// made with a private key
+type AuthMechanism string
+
+const (
+	// KeyAuth uses the unencrypted private key
+	KeyAuth AuthMechanism = "private key"
+	// AgentAuth uses the keys of the SSH agent listening on SSH_AUTH_SOCK
+	AgentAuth AuthMechanism = "SSH agent"
+	// PassphraseAuth uses the private key decrypted with the passphrase entered by the user.
+	// The decrypted key is only held in memory, by an SSH agent started by kismatic.
+	PassphraseAuth AuthMechanism = "private key decrypted with passphrase"
+)
+
+// PassphrasePrompt reads the passphrase of the encrypted private key.
+// The passphrase is read from the terminal by default.
+var PassphrasePrompt = promptPassphrase
+
+var auth = struct {
+	sync.Mutex
+	mechanisms map[string]AuthMechanism
+	agent      *localAgent
+}{mechanisms: map[string]AuthMechanism{}}
+
+// PrepareAuth returns the mechanism used for authenticating with the private key, and
+// prepares it for use by the Go SSH connections and by Ansible. Unencrypted keys are used
+// as they are. Encrypted keys are used through the SSH agent listening on SSH_AUTH_SOCK,
+// if it holds the key. Otherwise, the passphrase is prompted once, and the decrypted key is
+// served by an SSH agent started by kismatic, whose socket is exported in SSH_AUTH_SOCK.
+func PrepareAuth(key string) (AuthMechanism, error) {
+	auth.Lock()
+	defer auth.Unlock()
+	if m, ok := auth.mechanisms[key]; ok {
+		return m, nil
+	}
+	m, err := prepareAuth(key)
+	if err != nil {
+		return "", err
+	}
+	auth.mechanisms[key] = m
+	return m, nil
+}
+
+func prepareAuth(key string) (AuthMechanism, error) {
+	buffer, err := ioutil.ReadFile(key)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := isEncrypted(buffer)
+	if err != nil {
+		return "", err
+	}
+	if !encrypted {
+		_, err = ssh.ParsePrivateKey(buffer)
+		if err == nil {
+			return KeyAuth, nil
+		}
+		// Encrypted keys in the OpenSSH format can only be used through an SSH agent
+		if !isOpenSSHKey(buffer) {
+			return "", fmt.Errorf("Parse SSH key error: %v", err)
+		}
+	}
+	// An agent started by kismatic is already listening on SSH_AUTH_SOCK
+	if auth.agent != nil {
+		if err = auth.agent.addKey(key, buffer); err != nil {
+			return "", err
+		}
+		return PassphraseAuth, nil
+	}
+	if a, err := dialAgent(); err == nil {
+		hasKey := agentHasKey(agent.NewClient(a), key, buffer)
+		a.Close()
+		if hasKey {
+			return AgentAuth, nil
+		}
+		// The agent listening on SSH_AUTH_SOCK, which may be unrelated to kismatic,
+		// does not hold the key: the passphrase is prompted
+	}
+	a, err := startLocalAgent()
+	if err != nil {
+		return "", err
+	}
+	if err = a.addKey(key, buffer); err != nil {
+		a.close()
+		return "", err
+	}
+	auth.agent = a
+	os.Setenv("SSH_AUTH_SOCK", a.socket)
+	return PassphraseAuth, nil
+}
+
+// StopAgent stops the SSH agent started by kismatic, if any
+func StopAgent() {
+	auth.Lock()
+	defer auth.Unlock()
+	if auth.agent != nil {
+		auth.agent.close()
+		auth.agent = nil
+	}
+}
+
+// returns the configuration for connecting as user with the key. The returned
+// function releases the connection to the SSH agent once the connection is established.
+func clientConfig(user, key string) (*ssh.ClientConfig, func(), error) {
+	m, err := PrepareAuth(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	config := &ssh.ClientConfig{
+		User: user,
+		// Host keys are not verified, in the same way as the connections to the nodes
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error { return nil },
+	}
+	if m == KeyAuth {
+		buffer, err := ioutil.ReadFile(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading SSH key: %v", err)
+		}
+		signer, err := ssh.ParsePrivateKey(buffer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Parse SSH key error: %v", err)
+		}
+		config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+		return config, func() {}, nil
+	}
+	conn, err := dialAgent()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to SSH agent: %v", err)
+	}
+	config.Auth = []ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(conn).Signers)}
+	return config, func() { conn.Close() }, nil
+}
+
+// connects to the SSH agent listening on SSH_AUTH_SOCK
+func dialAgent() (net.Conn, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+	return net.Dial("unix", socket)
+}
+
+// returns true if the agent holds the key. The agent is only trusted if the public key is known,
+// from the ".pub" file next to the private key, or from the private key in the OpenSSH format.
+func agentHasKey(a agent.Agent, key string, buffer []byte) bool {
+	pub := publicKey(key, buffer)
+	if pub == nil {
+		return false
+	}
+	keys, err := a.List()
+	if err != nil {
+		return false
+	}
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), pub.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the public key of the encrypted private key, or nil if it is unknown
+func publicKey(key string, buffer []byte) ssh.PublicKey {
+	if pubBuffer, err := ioutil.ReadFile(key + ".pub"); err == nil {
+		if pub, _, _, _, err := ssh.ParseAuthorizedKey(pubBuffer); err == nil {
+			return pub
+		}
+	}
+	if !isOpenSSHKey(buffer) {
+		return nil
+	}
+	pub, err := openSSHPublicKey(buffer)
+	if err != nil {
+		return nil
+	}
+	return pub
+}
+
+// returns the public key stored unencrypted in a private key in the OpenSSH format
+func openSSHPublicKey(buffer []byte) (ssh.PublicKey, error) {
+	block, _ := pem.Decode(buffer)
+	const magic = "openssh-key-v1\x00"
+	if block == nil || !bytes.HasPrefix(block.Bytes, []byte(magic)) {
+		return nil, errors.New("invalid OpenSSH private key")
+	}
+	var header struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(magic):], &header); err != nil {
+		return nil, fmt.Errorf("invalid OpenSSH private key: %v", err)
+	}
+	if header.NumKeys != 1 {
+		return nil, errors.New("OpenSSH private keys with several keys are not supported")
+	}
+	return ssh.ParsePublicKey(header.PubKey)
+}
+
+func promptPassphrase(key string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, fmt.Errorf("the SSH key %q is encrypted, and no SSH agent listening on SSH_AUTH_SOCK holds it. Add the key and its public key file to an SSH agent, or run kismatic in a terminal to enter its passphrase", key)
+	}
+	fmt.Fprintf(os.Stderr, "Enter passphrase for SSH key %q: ", key)
+	passphrase, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("error reading passphrase: %v", err)
+	}
+	return passphrase, nil
+}
+
+// returns true if the private key is in the OpenSSH format
+func isOpenSSHKey(buffer []byte) bool {
+	block, _ := pem.Decode(buffer)
+	return block != nil && block.Type == "OPENSSH PRIVATE KEY"
+}
+
+// returns the encrypted PEM block of the private key, which can be decrypted with a passphrase
+func encryptedPEMBlock(buffer []byte) (*pem.Block, error) {
+	block, _ := pem.Decode(buffer)
+	if block == nil {
+		return nil, fmt.Errorf("Parse SSH key error")
+	}
+	if !x509.IsEncryptedPEMBlock(block) {
+		return nil, errors.New("only SSH keys in the PEM format can be decrypted with a passphrase, add the key to an SSH agent")
+	}
+	return block, nil
+}
+
+// decrypts the PEM encoded private key with the passphrase
+func decryptPrivateKey(buffer, passphrase []byte) (interface{}, error) {
+	block, err := encryptedPEMBlock(buffer)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.DecryptPEMBlock(block, passphrase)
+	if err == x509.IncorrectPasswordError {
+		return nil, errors.New("incorrect passphrase for SSH key")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting SSH key: %v", err)
+	}
+	return ssh.ParseRawPrivateKey(pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}))
+}
+
+// localAgent is an SSH agent that holds the decrypted keys in memory,
+// and listens on a socket that is only accessible by the current user
+type localAgent struct {
+	keyring  agent.Agent
+	listener net.Listener
+	dir      string
+	socket   string
+}
+
+func startLocalAgent() (*localAgent, error) {
+	dir, err := ioutil.TempDir("", "kismatic-ssh-agent")
+	if err != nil {
+		return nil, fmt.Errorf("error creating directory for SSH agent: %v", err)
+	}
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("error starting SSH agent: %v", err)
+	}
+	a := &localAgent{
+		keyring:  agent.NewKeyring(),
+		listener: l,
+		dir:      dir,
+		socket:   socket,
+	}
+	go a.serve()
+	return a, nil
+}
+
+func (a *localAgent) serve() {
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(c net.Conn) {
+			agent.ServeAgent(a.keyring, c)
+			c.Close()
+		}(conn)
+	}
+}
+
+// prompts for the passphrase of the key, and adds the decrypted key to the agent
+func (a *localAgent) addKey(key string, buffer []byte) error {
+	// The passphrase is not prompted for keys that can't be decrypted with it
+	if _, err := encryptedPEMBlock(buffer); err != nil {
+		return err
+	}
+	passphrase, err := PassphrasePrompt(key)
+	if err != nil {
+		return err
+	}
+	privateKey, err := decryptPrivateKey(buffer, passphrase)
+	if err != nil {
+		return err
+	}
+	return a.keyring.Add(agent.AddedKey{PrivateKey: privateKey, Comment: key})
+}
+
+func (a *localAgent) close() {
+	a.listener.Close()
+	os.RemoveAll(a.dir)
+}
@@ -0,0 +1,272 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// writes a new private key encrypted with the passphrase to a file,
+// and returns the file, the private key and the public key
+func mustWriteEncryptedKey(t *testing.T, dir, passphrase string) (string, *rsa.PrivateKey, ssh.PublicKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), []byte(passphrase), x509.PEMCipherAES128)
+	if err != nil {
+		t.Fatalf("error encrypting key: %v", err)
+	}
+	file := filepath.Join(dir, "id_rsa_encrypted")
+	if err = ioutil.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("error writing key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	return file, key, signer.PublicKey()
+}
+
+// writes the public key to the ".pub" file next to the private key
+func mustWritePublicKey(t *testing.T, key string, pub ssh.PublicKey) {
+	if err := ioutil.WriteFile(key+".pub", ssh.MarshalAuthorizedKey(pub), 0644); err != nil {
+		t.Fatalf("error writing public key: %v", err)
+	}
+}
+
+// starts an SSH agent holding the private key, and exports its socket in SSH_AUTH_SOCK.
+// The returned function stops the agent.
+func startTestAgent(t *testing.T, dir string, privateKey *rsa.PrivateKey) func() {
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: privateKey}); err != nil {
+		t.Fatalf("error adding key to agent: %v", err)
+	}
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	os.Setenv("SSH_AUTH_SOCK", socket)
+	return func() { l.Close() }
+}
+
+// resets the prepared authentication and the SSH_AUTH_SOCK variable after the test
+func resetAuth(t *testing.T) func() {
+	sock, sockSet := os.LookupEnv("SSH_AUTH_SOCK")
+	os.Unsetenv("SSH_AUTH_SOCK")
+	prompt := PassphrasePrompt
+	return func() {
+		StopAgent()
+		auth.Lock()
+		auth.mechanisms = map[string]AuthMechanism{}
+		auth.Unlock()
+		PassphrasePrompt = prompt
+		if sockSet {
+			os.Setenv("SSH_AUTH_SOCK", sock)
+		} else {
+			os.Unsetenv("SSH_AUTH_SOCK")
+		}
+	}
+}
+
+func TestPrepareAuthUnencryptedKey(t *testing.T) {
+	defer resetAuth(t)()
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	key, _ := mustWriteKey(t, dir)
+	m, err := PrepareAuth(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m != KeyAuth {
+		t.Errorf("expected %q, but got %q", KeyAuth, m)
+	}
+}
+
+func TestPrepareAuthEncryptedKeyWithAgent(t *testing.T) {
+	defer resetAuth(t)()
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	key, privateKey, pub := mustWriteEncryptedKey(t, dir, "secret")
+
+	mustWritePublicKey(t, key, pub)
+	// Start an agent that holds the key
+	defer startTestAgent(t, dir, privateKey)()
+	PassphrasePrompt = func(string) ([]byte, error) {
+		return nil, errors.New("the passphrase should not be prompted")
+	}
+
+	m, err := PrepareAuth(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m != AgentAuth {
+		t.Errorf("expected %q, but got %q", AgentAuth, m)
+	}
+
+	node := startTestSSHServer(t, "alice", pub)
+	defer node.close()
+	host, port := node.hostPort(t)
+	client, err := OpenConnection(host, port, "alice", key, nil)
+	if err != nil {
+		t.Fatalf("unexpected error opening connection: %v", err)
+	}
+	defer client.Close()
+	if out, err := client.Output("hostname"); err != nil || out != "ran hostname" {
+		t.Errorf("expected output %q, but got %q and error %v", "ran hostname", out, err)
+	}
+}
+
+func TestPrepareAuthEncryptedKeyWithPassphrase(t *testing.T) {
+	defer resetAuth(t)()
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	key, _, pub := mustWriteEncryptedKey(t, dir, "secret")
+	prompts := 0
+	PassphrasePrompt = func(string) ([]byte, error) {
+		prompts++
+		return []byte("secret"), nil
+	}
+
+	for i := 0; i < 2; i++ {
+		m, err := PrepareAuth(key)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if m != PassphraseAuth {
+			t.Errorf("expected %q, but got %q", PassphraseAuth, m)
+		}
+	}
+	if prompts != 1 {
+		t.Errorf("expected the passphrase to be prompted once, but was prompted %d times", prompts)
+	}
+	// The agent holding the decrypted key is exported for Ansible
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		t.Errorf("expected SSH_AUTH_SOCK to be set")
+	}
+
+	node := startTestSSHServer(t, "alice", pub)
+	defer node.close()
+	host, port := node.hostPort(t)
+	if err := TestConnection(host, port, "alice", key, nil); err != nil {
+		t.Errorf("unexpected error testing connection: %v", err)
+	}
+}
+
+func TestPrepareAuthIncorrectPassphrase(t *testing.T) {
+	defer resetAuth(t)()
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	key, _, _ := mustWriteEncryptedKey(t, dir, "secret")
+	PassphrasePrompt = func(string) ([]byte, error) {
+		return []byte("wrong"), nil
+	}
+	if _, err := PrepareAuth(key); err == nil {
+		t.Errorf("expected an error with an incorrect passphrase")
+	}
+}
+
+func TestPrepareAuthEncryptedKeyAgentWithoutKey(t *testing.T) {
+	defer resetAuth(t)()
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	key, _, pub := mustWriteEncryptedKey(t, dir, "secret")
+	mustWritePublicKey(t, key, pub)
+	// The agent listening on SSH_AUTH_SOCK holds another key
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	defer startTestAgent(t, dir, other)()
+	prompts := 0
+	PassphrasePrompt = func(string) ([]byte, error) {
+		prompts++
+		return []byte("secret"), nil
+	}
+
+	m, err := PrepareAuth(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m != PassphraseAuth {
+		t.Errorf("expected %q, but got %q", PassphraseAuth, m)
+	}
+	if prompts != 1 {
+		t.Errorf("expected the passphrase to be prompted once, but was prompted %d times", prompts)
+	}
+}
+
+func TestPrepareAuthEncryptedKeyWithoutPublicKey(t *testing.T) {
+	defer resetAuth(t)()
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	key, privateKey, pub := mustWriteEncryptedKey(t, dir, "secret")
+	// Without the public key, the agent can't be trusted to hold the key
+	defer startTestAgent(t, dir, privateKey)()
+	prompts := 0
+	PassphrasePrompt = func(string) ([]byte, error) {
+		prompts++
+		return []byte("secret"), nil
+	}
+
+	m, err := PrepareAuth(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m != PassphraseAuth {
+		t.Errorf("expected %q, but got %q", PassphraseAuth, m)
+	}
+	if prompts != 1 {
+		t.Errorf("expected the passphrase to be prompted once, but was prompted %d times", prompts)
+	}
+
+	node := startTestSSHServer(t, "alice", pub)
+	defer node.close()
+	host, port := node.hostPort(t)
+	if err := TestConnection(host, port, "alice", key, nil); err != nil {
+		t.Errorf("unexpected error testing connection: %v", err)
+	}
+}
+
+func TestPrepareAuthEncryptedOpenSSHKeyWithoutAgent(t *testing.T) {
+	defer resetAuth(t)()
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "id_ed25519")
+	buffer := pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: []byte("openssh-key-v1\x00")})
+	if err := ioutil.WriteFile(key, buffer, 0600); err != nil {
+		t.Fatalf("error writing key: %v", err)
+	}
+	prompts := 0
+	PassphrasePrompt = func(string) ([]byte, error) {
+		prompts++
+		return []byte("secret"), nil
+	}
+
+	if _, err := PrepareAuth(key); err == nil {
+		t.Errorf("expected an error with an OpenSSH key that no SSH agent holds")
+	}
+	if prompts != 0 {
+		t.Errorf("expected the passphrase not to be prompted, but was prompted %d times", prompts)
+	}
+}
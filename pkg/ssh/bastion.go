@@ -0,0 +1,56 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Bastion is a host through which the SSH connections to the nodes are tunneled,
+// when the nodes are not directly reachable
+type Bastion struct {
+	// Address is the IP or hostname of the bastion
+	Address string
+	Port    int
+	User    string
+	// Key is the path to the private key used for logging into the bastion
+	Key string
+}
+
+// ProxyCommand returns the command used by the OpenSSH client to tunnel connections
+// through the bastion, for use as the value of the ProxyCommand option. The path of the
+// key is quoted for the shell that runs the command.
+func (b Bastion) ProxyCommand() string {
+	return fmt.Sprintf("ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -i %s -p %d -W %%h:%%p %s@%s", shellQuote(b.Key), b.Port, b.User, b.Address)
+}
+
+// A Dialer opens network connections from the bastion
+type Dialer struct {
+	client *ssh.Client
+}
+
+// NewDialer logs into the bastion, and returns a dialer that opens connections from it
+func NewDialer(b Bastion) (*Dialer, error) {
+	config, release, err := clientConfig(b.User, b.Key)
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(b.Address, strconv.Itoa(b.Port)), config)
+	release()
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to bastion %q: %v", b.Address, err)
+	}
+	return &Dialer{client: client}, nil
+}
+
+// Dial opens a connection to the address from the bastion
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.client.Dial(network, addr)
+}
+
+// Close the connection to the bastion
+func (d *Dialer) Close() error {
+	return d.client.Close()
+}
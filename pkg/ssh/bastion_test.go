@@ -0,0 +1,330 @@
+package ssh
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHServer is an SSH server that echoes the commands it is asked to run,
+// and forwards TCP connections like a bastion
+type testSSHServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	mu        sync.Mutex
+	forwarded []string
+}
+
+func startTestSSHServer(t *testing.T, user string, authorizedKey ssh.PublicKey) *testSSHServer {
+	hostKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("error creating host key signer: %v", err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() == user && string(key.Marshal()) == string(authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unauthorized user %q", c.User())
+		},
+	}
+	config.AddHostKey(hostSigner)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	s := &testSSHServer{listener: l, config: config}
+	go s.serve()
+	return s
+}
+
+func (s *testSSHServer) hostPort(t *testing.T) (string, int) {
+	host, portStr, err := net.SplitHostPort(s.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("error parsing server address: %v", err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+func (s *testSSHServer) forwardedAddresses() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.forwarded...)
+}
+
+func (s *testSSHServer) close() { s.listener.Close() }
+
+func (s *testSSHServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testSSHServer) handle(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "direct-tcpip":
+			go s.forward(newChannel)
+		case "session":
+			go s.session(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+func (s *testSSHServer) forward(newChannel ssh.NewChannel) {
+	var target struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	addr := net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port)))
+	s.mu.Lock()
+	s.forwarded = append(s.forwarded, addr)
+	s.mu.Unlock()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		io.Copy(channel, conn)
+		channel.Close()
+	}()
+	io.Copy(conn, channel)
+	conn.Close()
+}
+
+func (s *testSSHServer) session(newChannel ssh.NewChannel) {
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		ssh.Unmarshal(req.Payload, &payload)
+		req.Reply(true, nil)
+		fmt.Fprintf(channel, "ran %s", payload.Command)
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+		return
+	}
+}
+
+// writes a new private key to a file, and returns the file and the public key
+func mustWriteKey(t *testing.T, dir string) (string, ssh.PublicKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	file := filepath.Join(dir, "id_rsa")
+	b := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err = ioutil.WriteFile(file, b, 0600); err != nil {
+		t.Fatalf("error writing key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	return file, signer.PublicKey()
+}
+
+func mustGetTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ssh-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	return dir
+}
+
+func TestOpenConnectionThroughBastion(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	key, pub := mustWriteKey(t, dir)
+	bastion := startTestSSHServer(t, "jump", pub)
+	defer bastion.close()
+	node := startTestSSHServer(t, "alice", pub)
+	defer node.close()
+
+	bastionHost, bastionPort := bastion.hostPort(t)
+	nodeHost, nodePort := node.hostPort(t)
+	b := &Bastion{Address: bastionHost, Port: bastionPort, User: "jump", Key: key}
+
+	client, err := OpenConnection(nodeHost, nodePort, "alice", key, b)
+	if err != nil {
+		t.Fatalf("unexpected error opening connection: %v", err)
+	}
+	defer client.Close()
+	// The commands share the connection to the node
+	for i := 0; i < 2; i++ {
+		out, err := client.Output("hostname")
+		if err != nil {
+			t.Fatalf("unexpected error running command: %v", err)
+		}
+		if out != "ran hostname" {
+			t.Errorf("expected output %q, but got %q", "ran hostname", out)
+		}
+	}
+	forwarded := bastion.forwardedAddresses()
+	if len(forwarded) != 1 || forwarded[0] != net.JoinHostPort(nodeHost, strconv.Itoa(nodePort)) {
+		t.Errorf("expected the connection to the node to be forwarded by the bastion once, but got %v", forwarded)
+	}
+	if err = TestConnection(nodeHost, nodePort, "alice", key, b); err != nil {
+		t.Errorf("unexpected error testing connection: %v", err)
+	}
+}
+
+func TestStartThroughBastion(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	key, pub := mustWriteKey(t, dir)
+	bastion := startTestSSHServer(t, "jump", pub)
+	defer bastion.close()
+	node := startTestSSHServer(t, "alice", pub)
+	defer node.close()
+
+	bastionHost, bastionPort := bastion.hostPort(t)
+	nodeHost, nodePort := node.hostPort(t)
+	client, err := OpenConnection(nodeHost, nodePort, "alice", key, &Bastion{Address: bastionHost, Port: bastionPort, User: "jump", Key: key})
+	if err != nil {
+		t.Fatalf("unexpected error opening connection: %v", err)
+	}
+	stdout, _, err := client.Start("uptime")
+	if err != nil {
+		t.Fatalf("unexpected error starting command: %v", err)
+	}
+	out, err := ioutil.ReadAll(stdout)
+	if err != nil {
+		t.Fatalf("unexpected error reading output: %v", err)
+	}
+	if err = client.Wait(); err != nil {
+		t.Errorf("unexpected error waiting for command: %v", err)
+	}
+	if string(out) != "ran uptime" {
+		t.Errorf("expected output %q, but got %q", "ran uptime", string(out))
+	}
+}
+
+func TestConnectionThroughBastionFailures(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	key, pub := mustWriteKey(t, dir)
+	bastion := startTestSSHServer(t, "jump", pub)
+	defer bastion.close()
+	node := startTestSSHServer(t, "alice", pub)
+	bastionHost, bastionPort := bastion.hostPort(t)
+	nodeHost, nodePort := node.hostPort(t)
+
+	// The bastion rejects unknown users
+	b := &Bastion{Address: bastionHost, Port: bastionPort, User: "bob", Key: key}
+	if err := TestConnection(nodeHost, nodePort, "alice", key, b); err == nil {
+		t.Errorf("expected an error when the bastion rejects the user")
+	}
+
+	// The node is unreachable from the bastion
+	node.close()
+	b.User = "jump"
+	if err := TestConnection(nodeHost, nodePort, "alice", key, b); err == nil {
+		t.Errorf("expected an error when the node is unreachable")
+	}
+}
+
+func TestDialerThroughBastion(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	key, pub := mustWriteKey(t, dir)
+	bastion := startTestSSHServer(t, "jump", pub)
+	defer bastion.close()
+
+	// Echo server that is reached through the bastion
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				io.Copy(c, c)
+				c.Close()
+			}(conn)
+		}
+	}()
+
+	bastionHost, bastionPort := bastion.hostPort(t)
+	d, err := NewDialer(Bastion{Address: bastionHost, Port: bastionPort, User: "jump", Key: key})
+	if err != nil {
+		t.Fatalf("unexpected error creating dialer: %v", err)
+	}
+	defer d.Close()
+	conn, err := d.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error dialing: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "ECHO\n")
+	resp, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("unexpected error reading response: %v", err)
+	}
+	if resp != "ECHO\n" {
+		t.Errorf("expected echo response, but got %q", resp)
+	}
+}
+
+func TestBastionProxyCommand(t *testing.T) {
+	b := Bastion{Address: "10.0.0.1", Port: 2222, User: "jump", Key: "/keys/jump's key"}
+	expected := `ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -i '/keys/jump'\''s key' -p 2222 -W %h:%p jump@10.0.0.1`
+	if cmd := b.ProxyCommand(); cmd != expected {
+		t.Errorf("expected %q, but got %q", expected, cmd)
+	}
+}
@@ -0,0 +1,243 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// nativeClient runs commands on a node using the Go SSH client. It is used when
+// the connection is tunneled through a bastion, or is authenticated by an SSH agent.
+type nativeClient struct {
+	addr    string
+	user    string
+	key     string
+	bastion *Bastion
+	// the connections and session of the command started with Start
+	dialer  *Dialer
+	client  *ssh.Client
+	session *ssh.Session
+	// the connections shared by the commands run with Output and the file transfers,
+	// until the client is closed
+	sharedMu     sync.Mutex
+	sharedDialer *Dialer
+	sharedClient *ssh.Client
+	closed       bool
+}
+
+func newNativeClient(ip string, port int, user, key string, bastion *Bastion) *nativeClient {
+	return &nativeClient{
+		addr:    net.JoinHostPort(ip, strconv.Itoa(port)),
+		user:    user,
+		key:     key,
+		bastion: bastion,
+	}
+}
+
+// connects to the node, through the bastion if set. The returned dialer is nil
+// if the node is connected to directly.
+func (c *nativeClient) connect() (*Dialer, *ssh.Client, error) {
+	config, release, err := clientConfig(c.user, c.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	if c.bastion == nil {
+		client, err := ssh.Dial("tcp", c.addr, config)
+		return nil, client, err
+	}
+	d, err := NewDialer(*c.bastion)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := d.Dial("tcp", c.addr)
+	if err != nil {
+		d.Close()
+		return nil, nil, fmt.Errorf("error connecting to %q through bastion %q: %v", c.addr, c.bastion.Address, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.addr, config)
+	if err != nil {
+		conn.Close()
+		d.Close()
+		return nil, nil, err
+	}
+	return d, ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// opens a session on the node. The returned function closes the session and the connections.
+func (c *nativeClient) openSession() (*ssh.Session, func(), error) {
+	d, client, err := c.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+	closeConns := func() {
+		client.Close()
+		if d != nil {
+			d.Close()
+		}
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		closeConns()
+		return nil, nil, err
+	}
+	return session, func() {
+		session.Close()
+		closeConns()
+	}, nil
+}
+
+// opens a session on the shared connections, which are opened by the first command
+func (c *nativeClient) openSharedSession() (*ssh.Session, error) {
+	c.sharedMu.Lock()
+	defer c.sharedMu.Unlock()
+	if c.closed {
+		return nil, errors.New("the SSH client is closed")
+	}
+	if c.sharedClient == nil {
+		d, client, err := c.connect()
+		if err != nil {
+			return nil, err
+		}
+		c.sharedDialer, c.sharedClient = d, client
+	}
+	session, err := c.sharedClient.NewSession()
+	if err != nil {
+		// The connection may have been lost, the next command reconnects
+		c.closeShared()
+		return nil, err
+	}
+	return session, nil
+}
+
+func (c *nativeClient) Output(command string) (string, error) {
+	session, err := c.openSharedSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	out, err := session.CombinedOutput(command)
+	return string(out), err
+}
+
+func (c *nativeClient) Shell(args ...string) error {
+	session, closeSession, err := c.openSession()
+	if err != nil {
+		return err
+	}
+	defer closeSession()
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	command := strings.TrimSpace(strings.Join(args, " "))
+	if command != "" {
+		return session.Run(command)
+	}
+
+	// Start an interactive shell when no command is given
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		oldState, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer terminal.Restore(fd, oldState)
+		width, height, err := terminal.GetSize(fd)
+		if err != nil {
+			width, height = 80, 40
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err = session.RequestPty("xterm", height, width, modes); err != nil {
+			return err
+		}
+	}
+	if err = session.Shell(); err != nil {
+		return err
+	}
+	return session.Wait()
+}
+
+func (c *nativeClient) Start(command string) (io.ReadCloser, io.ReadCloser, error) {
+	d, client, err := c.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.dialer, c.client = d, client
+	session, err := client.NewSession()
+	if err != nil {
+		c.close()
+		return nil, nil, err
+	}
+	c.session = session
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		c.close()
+		return nil, nil, err
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		c.close()
+		return nil, nil, err
+	}
+	if err = session.Start(command); err != nil {
+		c.close()
+		return nil, nil, err
+	}
+	return ioutil.NopCloser(stdout), ioutil.NopCloser(stderr), nil
+}
+
+func (c *nativeClient) Wait() error {
+	if c.session == nil {
+		return fmt.Errorf("no command was started")
+	}
+	defer c.close()
+	return c.session.Wait()
+}
+
+// Close closes the shared connections, and the connections of the command started with Start
+func (c *nativeClient) Close() error {
+	c.sharedMu.Lock()
+	c.closed = true
+	c.closeShared()
+	c.sharedMu.Unlock()
+	c.close()
+	return nil
+}
+
+func (c *nativeClient) closeShared() {
+	if c.sharedClient != nil {
+		c.sharedClient.Close()
+	}
+	if c.sharedDialer != nil {
+		c.sharedDialer.Close()
+	}
+	c.sharedDialer, c.sharedClient = nil, nil
+}
+
+// closes the session and connections of the command started with Start
+func (c *nativeClient) close() {
+	if c.session != nil {
+		c.session.Close()
+	}
+	if c.client != nil {
+		c.client.Close()
+	}
+	if c.dialer != nil {
+		c.dialer.Close()
+	}
+	c.dialer, c.client, c.session = nil, nil, nil
+}
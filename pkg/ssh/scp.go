@@ -0,0 +1,321 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileTransfer copies files between the local machine and a node.
+// Files are copied with the SCP protocol, which requires scp to be installed on the node.
+// The permissions and modification times of the files are preserved.
+type FileTransfer interface {
+	// Upload copies the local file or directory to the remote path. Directories are
+	// only copied when recursive is true. If the remote path is an existing directory,
+	// the file or directory is copied into it.
+	Upload(localPath, remotePath string, recursive bool) error
+	// Download copies the remote file or directory to the local path. Directories are
+	// only copied when recursive is true. If the local path is an existing directory,
+	// the file or directory is copied into it.
+	Download(remotePath, localPath string, recursive bool) error
+	// Close closes the connections of the file transfer, aborting the copies in progress
+	Close() error
+}
+
+// OpenFileTransfer returns a FileTransfer for copying files to and from ip:port as user with key.
+// The connections are tunneled through the bastion, if not nil. The file transfer must be
+// closed once the files are copied.
+func OpenFileTransfer(ip string, port int, user, key string, bastion *Bastion) (FileTransfer, error) {
+	if _, err := PrepareAuth(key); err != nil {
+		return nil, err
+	}
+	return newNativeClient(ip, port, user, key, bastion), nil
+}
+
+func (c *nativeClient) Upload(localPath, remotePath string, recursive bool) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && !recursive {
+		return fmt.Errorf("%q is a directory, it can only be copied recursively", localPath)
+	}
+	return c.runSCP("-t", remotePath, recursive, func(w io.Writer, r *bufio.Reader) error {
+		return scpSend(w, r, localPath, info)
+	})
+}
+
+func (c *nativeClient) Download(remotePath, localPath string, recursive bool) error {
+	return c.runSCP("-f", remotePath, recursive, func(w io.Writer, r *bufio.Reader) error {
+		return scpReceive(w, r, localPath)
+	})
+}
+
+// runs scp on the node in the mode given by the flag, "-t" for receiving files and "-f" for
+// sending them, and transfers the files with the local end of the protocol
+func (c *nativeClient) runSCP(flag, remotePath string, recursive bool, transfer func(w io.Writer, r *bufio.Reader) error) error {
+	session, err := c.openSharedSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr := &bytes.Buffer{}
+	session.Stderr = stderr
+	command := "scp -p " + flag
+	if recursive {
+		command += " -r"
+	}
+	if err = session.Start(command + " -- " + shellQuote(remotePath)); err != nil {
+		return err
+	}
+	err = transfer(stdin, bufio.NewReader(stdout))
+	stdin.Close()
+	waitErr := session.Wait()
+	if err == nil {
+		err = waitErr
+	}
+	if err != nil && strings.TrimSpace(stderr.String()) != "" {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// sends the file or directory to an SCP sink
+func scpSend(w io.Writer, r *bufio.Reader, path string, info os.FileInfo) error {
+	if err := scpReadAck(r); err != nil {
+		return err
+	}
+	return scpSendEntry(w, r, path, info)
+}
+
+func scpSendEntry(w io.Writer, r *bufio.Reader, path string, info os.FileInfo) error {
+	mtime := info.ModTime().Unix()
+	if err := scpWriteCommand(w, r, fmt.Sprintf("T%d 0 %d 0\n", mtime, mtime)); err != nil {
+		return err
+	}
+	mode := info.Mode().Perm()
+	if info.IsDir() {
+		if err := scpWriteCommand(w, r, fmt.Sprintf("D%04o 0 %s\n", mode, info.Name())); err != nil {
+			return err
+		}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			entryPath := filepath.Join(path, e.Name())
+			// Symbolic links are followed, in the same way as scp does
+			if e.Mode()&os.ModeSymlink != 0 {
+				if e, err = os.Stat(entryPath); err != nil {
+					return err
+				}
+			}
+			if err = scpSendEntry(w, r, entryPath, e); err != nil {
+				return err
+			}
+		}
+		return scpWriteCommand(w, r, "E\n")
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%q is not a regular file", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = scpWriteCommand(w, r, fmt.Sprintf("C%04o %d %s\n", mode, info.Size(), info.Name())); err != nil {
+		return err
+	}
+	if _, err = io.CopyN(w, f, info.Size()); err != nil {
+		return fmt.Errorf("error sending %q: %v", path, err)
+	}
+	return scpWriteCommand(w, r, "\x00")
+}
+
+// receives the files sent by an SCP source into the target
+func scpReceive(w io.Writer, r *bufio.Reader, target string) error {
+	ack := func() error {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	if err := ack(); err != nil {
+		return err
+	}
+	// the directories being received, and the times to set on them once they are complete
+	type receivingDir struct {
+		path         string
+		mtime, atime time.Time
+	}
+	dirs := []receivingDir{}
+	var mtime, atime time.Time
+	timesSet := false
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF && line == "" && len(dirs) == 0 {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading SCP command: %v", err)
+		}
+		switch line[0] {
+		case 1, 2:
+			return errors.New(strings.TrimSpace(line[1:]))
+		case 'T':
+			var m, a int64
+			if _, err = fmt.Sscanf(line, "T%d 0 %d 0\n", &m, &a); err != nil {
+				return fmt.Errorf("invalid SCP command %q", line)
+			}
+			mtime, atime, timesSet = time.Unix(m, 0), time.Unix(a, 0), true
+			if err = ack(); err != nil {
+				return err
+			}
+		case 'C', 'D':
+			mode, size, name, err := parseSCPEntry(line)
+			if err != nil {
+				return err
+			}
+			dest := target
+			if len(dirs) > 0 {
+				dest = filepath.Join(dirs[len(dirs)-1].path, name)
+			} else if info, err := os.Stat(target); err == nil && info.IsDir() {
+				dest = filepath.Join(target, name)
+			}
+			if line[0] == 'D' {
+				if err = os.Mkdir(dest, mode); err != nil && !os.IsExist(err) {
+					return err
+				}
+				if err = os.Chmod(dest, mode); err != nil {
+					return err
+				}
+				d := receivingDir{path: dest}
+				if timesSet {
+					d.mtime, d.atime = mtime, atime
+				}
+				dirs = append(dirs, d)
+				timesSet = false
+				if err = ack(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = ack(); err != nil {
+				return err
+			}
+			if err = scpReceiveFile(r, dest, mode, size); err != nil {
+				return err
+			}
+			if timesSet {
+				if err = os.Chtimes(dest, atime, mtime); err != nil {
+					return err
+				}
+				timesSet = false
+			}
+			if err = scpReadAck(r); err != nil {
+				return err
+			}
+			if err = ack(); err != nil {
+				return err
+			}
+		case 'E':
+			if len(dirs) == 0 {
+				return errors.New("unexpected end of directory in SCP transfer")
+			}
+			d := dirs[len(dirs)-1]
+			dirs = dirs[:len(dirs)-1]
+			if !d.mtime.IsZero() {
+				if err = os.Chtimes(d.path, d.atime, d.mtime); err != nil {
+					return err
+				}
+			}
+			if err = ack(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid SCP command %q", line)
+		}
+	}
+}
+
+func scpReceiveFile(r io.Reader, dest string, mode os.FileMode, size int64) error {
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.CopyN(f, r, size); err != nil {
+		f.Close()
+		return fmt.Errorf("error receiving %q: %v", dest, err)
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	// The mode of existing files is not changed by OpenFile
+	return os.Chmod(dest, mode)
+}
+
+// parses the mode, size and name of a "C" or "D" SCP command
+func parseSCPEntry(line string) (os.FileMode, int64, string, error) {
+	parts := strings.SplitN(strings.TrimSuffix(line[1:], "\n"), " ", 3)
+	if len(parts) != 3 {
+		return 0, 0, "", fmt.Errorf("invalid SCP command %q", line)
+	}
+	mode, err := strconv.ParseUint(parts[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid mode in SCP command %q", line)
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, "", fmt.Errorf("invalid size in SCP command %q", line)
+	}
+	name := parts[2]
+	// The name must not escape the target directory
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, '/') {
+		return 0, 0, "", fmt.Errorf("invalid file name in SCP command %q", line)
+	}
+	return os.FileMode(mode).Perm(), size, name, nil
+}
+
+func scpWriteCommand(w io.Writer, r *bufio.Reader, command string) error {
+	if _, err := io.WriteString(w, command); err != nil {
+		return err
+	}
+	return scpReadAck(r)
+}
+
+// reads the response of the other end, which is a zero byte on success,
+// or 1 (warning) or 2 (error) followed by a message
+func scpReadAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("error reading SCP response: %v", err)
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := r.ReadString('\n')
+	if b == 1 || b == 2 {
+		return errors.New(strings.TrimSpace(msg))
+	}
+	return fmt.Errorf("unexpected SCP response %q", string(b)+msg)
+}
+
+// quotes the argument for the remote shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,149 @@
+package ssh
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// transfers the file or directory from an SCP source to an SCP sink receiving into the target
+func scpTransfer(t *testing.T, source, target string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		t.Fatalf("error reading source: %v", err)
+	}
+	sourceR, sinkW := io.Pipe()
+	sinkR, sourceW := io.Pipe()
+	sendErr := make(chan error, 1)
+	go func() {
+		err := scpSend(sourceW, bufio.NewReader(sourceR), source, info)
+		sourceW.Close()
+		sendErr <- err
+	}()
+	err = scpReceive(sinkW, bufio.NewReader(sinkR), target)
+	sinkW.Close()
+	if err != nil {
+		return err
+	}
+	return <-sendErr
+}
+
+func mustWriteFile(t *testing.T, path, content string, mode os.FileMode) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatalf("error changing mode: %v", err)
+	}
+}
+
+func assertFile(t *testing.T, path, content string, mode os.FileMode) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("error reading %q: %v", path, err)
+		return
+	}
+	if string(b) != content {
+		t.Errorf("expected %q to contain %q, but got %q", path, content, string(b))
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != mode {
+		t.Errorf("expected %q to have mode %o, but got %o", path, mode, info.Mode().Perm())
+	}
+}
+
+func TestSCPTransferFile(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source", "script.sh")
+	mustWriteFile(t, source, "#!/bin/sh\necho hello\n", 0750)
+	mtime := time.Unix(1500000000, 0)
+	if err := os.Chtimes(source, mtime, mtime); err != nil {
+		t.Fatalf("error changing times: %v", err)
+	}
+
+	// Copied to a new file
+	target := filepath.Join(dir, "copy.sh")
+	if err := scpTransfer(t, source, target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertFile(t, target, "#!/bin/sh\necho hello\n", 0750)
+	if info, _ := os.Stat(target); !info.ModTime().Equal(mtime) {
+		t.Errorf("expected modification time %v, but got %v", mtime, info.ModTime())
+	}
+
+	// Copied into an existing directory
+	targetDir := filepath.Join(dir, "target")
+	if err := os.Mkdir(targetDir, 0755); err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	if err := scpTransfer(t, source, targetDir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertFile(t, filepath.Join(targetDir, "script.sh"), "#!/bin/sh\necho hello\n", 0750)
+}
+
+func TestSCPTransferDirectory(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "logs")
+	mustWriteFile(t, filepath.Join(source, "kubelet.log"), "kubelet", 0644)
+	mustWriteFile(t, filepath.Join(source, "etcd", "etcd.log"), "etcd", 0600)
+	mustWriteFile(t, filepath.Join(source, "empty"), "", 0644)
+	if err := os.Chmod(filepath.Join(source, "etcd"), 0700); err != nil {
+		t.Fatalf("error changing mode: %v", err)
+	}
+
+	// Copied to a new directory
+	target := filepath.Join(dir, "collected")
+	if err := scpTransfer(t, source, target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertFile(t, filepath.Join(target, "kubelet.log"), "kubelet", 0644)
+	assertFile(t, filepath.Join(target, "etcd", "etcd.log"), "etcd", 0600)
+	assertFile(t, filepath.Join(target, "empty"), "", 0644)
+	if info, err := os.Stat(filepath.Join(target, "etcd")); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("expected the etcd directory to have mode 700, but got %v (%v)", info, err)
+	}
+
+	// Copied into an existing directory
+	if err := scpTransfer(t, source, target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertFile(t, filepath.Join(target, "logs", "etcd", "etcd.log"), "etcd", 0600)
+}
+
+func TestSCPReceiveErrors(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		stream string
+		err    string
+	}{
+		{stream: "\x01scp: /var/log/foo: No such file or directory\n", err: "No such file or directory"},
+		{stream: "C0644 5 ../escape\n", err: "invalid file name"},
+		{stream: "C0644 five file\n", err: "invalid size"},
+		{stream: "X\n", err: "invalid SCP command"},
+		{stream: "D0755 0 dir\n", err: "error reading SCP command"},
+	}
+	for _, test := range tests {
+		err := scpReceive(ioutil.Discard, bufio.NewReader(strings.NewReader(test.stream)), filepath.Join(dir, "target"))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected error containing %q, but got %v", test.stream, test.err, err)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if q := shellQuote("/tmp/it's here"); q != `'/tmp/it'\''s here'` {
+		t.Errorf("unexpected quoting %s", q)
+	}
+}
@@ -4,7 +4,8 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
-	"io/ioutil"
+	"os/exec"
+	"syscall"
 
 	libmachine "github.com/docker/machine/libmachine/ssh"
 	"golang.org/x/crypto/ssh"
@@ -12,51 +13,67 @@ import (
 
 type Client interface {
 	libmachine.Client
+	// Close closes the connections of the client, which can't run commands afterwards
+	Close() error
 }
 
+// libmachineClient runs each command with a connection of its own,
+// so there is no connection to close
+type libmachineClient struct {
+	libmachine.Client
+}
+
+func (libmachineClient) Close() error { return nil }
+
 // Connects to ip:port as user with key and immediately exits.
-func TestConnection(ip string, port int, user, key string) error {
-	client, error := libmachine.NewClient(user, ip, port,
-		&libmachine.Auth{
-			Keys: []string{key},
-		})
+// The connection is tunneled through the bastion, if not nil.
+func TestConnection(ip string, port int, user, key string, bastion *Bastion) error {
+	client, error := OpenConnection(ip, port, user, key, bastion)
 	if error != nil {
 		return error
 	}
+	defer client.Close()
 
 	return client.Shell("exit")
 }
 
-func OpenConnection(ip string, port int, user, key string) (Client, error) {
+// OpenConnection returns a client for running commands on ip:port as user with key.
+// The connections are tunneled through the bastion, if not nil. The client must be
+// closed once the commands have run.
+func OpenConnection(ip string, port int, user, key string, bastion *Bastion) (Client, error) {
+	m, err := PrepareAuth(key)
+	if err != nil {
+		return nil, err
+	}
+	if bastion != nil || m != KeyAuth {
+		return newNativeClient(ip, port, user, key, bastion), nil
+	}
 	client, error := libmachine.NewClient(user, ip, port,
 		&libmachine.Auth{
 			Keys: []string{key},
 		})
-	return client, error
-}
-
-// ValidUnecryptedPrivateKey parses SSH private key
-func ValidUnencryptedPrivateKey(file string) error {
-	buffer, err := ioutil.ReadFile(file)
-	if err != nil {
-		return err
-	}
-
-	isEncrypted, err := isEncrypted(buffer)
-	if err != nil {
-		return fmt.Errorf("Parse SSH key error")
-	}
-
-	if isEncrypted {
-		return fmt.Errorf("Encrypted SSH key is not permitted")
+	if error != nil {
+		return nil, error
 	}
+	return libmachineClient{client}, nil
+}
 
-	_, err = ssh.ParsePrivateKey(buffer)
-	if err != nil {
-		return fmt.Errorf("Parse SSH key error: %v", err)
+// ExitStatus returns the exit status of the remote command, given the error returned
+// by the client that ran it. The second value is false if the error is not caused by
+// the exit status of the command, for example when the connection failed.
+func ExitStatus(err error) (int, bool) {
+	switch e := err.(type) {
+	case nil:
+		return 0, true
+	case *ssh.ExitError:
+		return e.ExitStatus(), true
+	case *exec.ExitError:
+		// The ssh binary exits with 255 when the connection fails
+		if ws, ok := e.Sys().(syscall.WaitStatus); ok && ws.ExitStatus() != 255 {
+			return ws.ExitStatus(), true
+		}
 	}
-
-	return nil
+	return 0, false
 }
 
 func isEncrypted(buffer []byte) (bool, error) {
@@ -1,6 +1,10 @@
 package ssh
 
-import "testing"
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
 
 func TestIsEncrypted(t *testing.T) {
 	for _, data := range testData {
@@ -14,6 +18,25 @@ func TestIsEncrypted(t *testing.T) {
 	}
 }
 
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		err       error
+		status    int
+		completed bool
+	}{
+		{err: nil, status: 0, completed: true},
+		{err: exec.Command("sh", "-c", "exit 3").Run(), status: 3, completed: true},
+		{err: exec.Command("sh", "-c", "exit 255").Run(), status: 0, completed: false},
+		{err: errors.New("connection refused"), status: 0, completed: false},
+	}
+	for i, test := range tests {
+		status, completed := ExitStatus(test.err)
+		if status != test.status || completed != test.completed {
+			t.Errorf("test %d: expected (%d, %t), but got (%d, %t)", i, test.status, test.completed, status, completed)
+		}
+	}
+}
+
 var testData = []struct {
 	encrypted bool
 	pemData   []byte
@@ -1,6 +1,8 @@
 package tls
 
 import (
+	"bytes"
+	cryptotls "crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -8,6 +10,7 @@ import (
 	"path/filepath"
 
 	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/initca"
 	"github.com/cloudflare/cfssl/log"
 )
@@ -26,7 +29,8 @@ type Subject struct {
 }
 
 // NewCACert creates a new Certificate Authority and returns it's private key and public certificate.
-func NewCACert(csrFile string, commonName string, subject Subject) (key, cert []byte, err error) {
+// The key algorithm of the CSR file is used if keyAlgorithm is empty.
+func NewCACert(csrFile string, commonName string, subject Subject, keyAlgorithm string) (key, cert []byte, err error) {
 	// Open CSR file
 	f, err := os.Open(csrFile)
 	if os.IsNotExist(err) {
@@ -52,6 +56,11 @@ func NewCACert(csrFile string, commonName string, subject Subject) (key, cert []
 		OU: subject.OrganizationalUnit,
 	}
 	caCSR.Names = []csr.Name{name}
+	if keyAlgorithm != "" {
+		if caCSR.KeyRequest, err = NewKeyRequest(keyAlgorithm); err != nil {
+			return nil, nil, err
+		}
+	}
 	caCSR.CN = commonName
 	// Generate CA Cert according to CSR
 	cert, _, key, err = initca.New(caCSR)
@@ -75,3 +84,43 @@ func ReadCACert(name, dir string) (key, cert []byte, err error) {
 	}
 	return key, cert, nil
 }
+
+// ReadExistingCACert reads an existing Certificate Authority and returns its private key
+// and public certificate. If the CA is an intermediate CA, the certificates in the chain file
+// are appended to the CA certificate, so that the certificate returned is the full chain.
+func ReadExistingCACert(certFile, keyFile, chainFile string) (key, cert []byte, err error) {
+	cert, err = ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading CA certificate: %v", err)
+	}
+	key, err = ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading CA private key: %v", err)
+	}
+	// verifies that the key matches the certificate
+	if _, err = cryptotls.X509KeyPair(cert, key); err != nil {
+		return nil, nil, fmt.Errorf("error verifying CA certificate and private key: %v", err)
+	}
+	caCert, err := helpers.ParseCertificatePEM(cert)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing CA certificate: %v", err)
+	}
+	if !caCert.IsCA {
+		return nil, nil, fmt.Errorf("certificate %q is not a CA certificate", certFile)
+	}
+	if chainFile == "" {
+		return key, cert, nil
+	}
+	chain, err := ioutil.ReadFile(chainFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading CA chain: %v", err)
+	}
+	if _, err = helpers.ParseCertificatesPEM(chain); err != nil {
+		return nil, nil, fmt.Errorf("error parsing CA chain: %v", err)
+	}
+	bundle := bytes.TrimSpace(cert)
+	bundle = append(bundle, '\n')
+	bundle = append(bundle, bytes.TrimSpace(chain)...)
+	bundle = append(bundle, '\n')
+	return key, bundle, nil
+}
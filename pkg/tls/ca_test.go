@@ -1,6 +1,9 @@
 package tls
 
 import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -13,7 +16,7 @@ func TestNewCACert(t *testing.T) {
 		Organization:       "someOrg",
 		OrganizationalUnit: "someOrgUnit",
 	}
-	_, cert, err := NewCACert("test/ca-csr.json", "someCommonName", subject)
+	_, cert, err := NewCACert("test/ca-csr.json", "someCommonName", subject, "")
 	if err != nil {
 		t.Fatalf("error creating CA cert: %v", err)
 	}
@@ -61,3 +64,91 @@ func TestNewCACert(t *testing.T) {
 		t.Errorf("expected expiration date %q, got %q", expectedExpiration, parsedCert.NotAfter)
 	}
 }
+
+func TestReadExistingCACert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "existing-ca-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer cleanup(dir, t)
+	// The root CA is the chain of the intermediate CA
+	rootKey, rootCert, err := NewCACert("test/ca-csr.json", "root", Subject{Organization: "someOrg"}, "")
+	if err != nil {
+		t.Fatalf("error creating root CA: %v", err)
+	}
+	key, cert, err := NewCACert("test/ca-csr.json", "intermediate", Subject{Organization: "someOrg"}, "")
+	if err != nil {
+		t.Fatalf("error creating intermediate CA: %v", err)
+	}
+	if err = WriteCert(rootKey, rootCert, "root", dir); err != nil {
+		t.Fatalf("error writing root CA: %v", err)
+	}
+	if err = WriteCert(key, cert, "intermediate", dir); err != nil {
+		t.Fatalf("error writing intermediate CA: %v", err)
+	}
+	certFile := filepath.Join(dir, "intermediate.pem")
+	keyFile := filepath.Join(dir, "intermediate-key.pem")
+	chainFile := filepath.Join(dir, "root.pem")
+
+	// the private key of the root CA does not match the intermediate certificate
+	if _, _, err = ReadExistingCACert(certFile, filepath.Join(dir, "root-key.pem"), ""); err == nil {
+		t.Errorf("expected an error when the private key does not match the certificate")
+	}
+
+	readKey, bundle, err := ReadExistingCACert(certFile, keyFile, chainFile)
+	if err != nil {
+		t.Fatalf("unexpected error reading CA: %v", err)
+	}
+	if !bytes.Equal(readKey, key) {
+		t.Errorf("expected the CA private key to be returned")
+	}
+	certs, err := helpers.ParseCertificatesPEM(bundle)
+	if err != nil {
+		t.Fatalf("error parsing CA bundle: %v", err)
+	}
+	if len(certs) != 2 || certs[0].Subject.CommonName != "intermediate" || certs[1].Subject.CommonName != "root" {
+		t.Fatalf("expected the bundle to contain the intermediate and root CAs, but got %d certificates", len(certs))
+	}
+
+	// Certificates are signed by the first CA of the bundle
+	ca := &CA{
+		Key:        readKey,
+		Cert:       bundle,
+		ConfigFile: "test/ca-config.json",
+		Profile:    "kubernetes",
+	}
+	_, signed, err := NewCert(ca, *buildReq("node", []string{"node"}))
+	if err != nil {
+		t.Fatalf("error signing certificate with CA bundle: %v", err)
+	}
+	parsed, err := helpers.ParseCertificatePEM(signed)
+	if err != nil {
+		t.Fatalf("error parsing signed certificate: %v", err)
+	}
+	if parsed.Issuer.CommonName != "intermediate" {
+		t.Errorf("expected certificate to be issued by the intermediate CA, but got %q", parsed.Issuer.CommonName)
+	}
+}
+
+func TestReadExistingCACertNotCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "existing-ca-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer cleanup(dir, t)
+	caKey, caCert, err := NewCACert("test/ca-csr.json", "ca", Subject{}, "")
+	if err != nil {
+		t.Fatalf("error creating CA: %v", err)
+	}
+	ca := &CA{Key: caKey, Cert: caCert, ConfigFile: "test/ca-config.json", Profile: "kubernetes"}
+	key, cert, err := NewCert(ca, *buildReq("node", []string{"node"}))
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	if err = WriteCert(key, cert, "node", dir); err != nil {
+		t.Fatalf("error writing certificate: %v", err)
+	}
+	if _, _, err = ReadExistingCACert(filepath.Join(dir, "node.pem"), filepath.Join(dir, "node-key.pem"), ""); err == nil {
+		t.Errorf("expected an error when the certificate is not a CA")
+	}
+}
@@ -1,6 +1,8 @@
 package tls
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -32,18 +34,17 @@ type CA struct {
 
 // NewCert creates a new certificate/key pair using the CertificateAuthority provided
 func NewCert(ca *CA, req csr.CertificateRequest) (key, cert []byte, err error) {
-	g := &csr.Generator{Validator: genkey.Validator}
-	csrBytes, key, err := g.ProcessRequest(&req)
+	csrBytes, key, err := newCSR(req)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error processing CSR: %v", err)
+		return nil, nil, err
 	}
 	// Get CA private key
 	caPriv, err := helpers.ParsePrivateKeyPEMWithPassword(ca.Key, []byte(ca.Password))
 	if err != nil {
 		return nil, nil, fmt.Errorf("error parsing privte key: %v", err)
 	}
-	// Parse CA Cert
-	caCert, err := helpers.ParseCertificatePEM(ca.Cert)
+	// Parse CA Cert, the first certificate of the chain is the signing CA
+	caCert, err := parseFirstCertificatePEM(ca.Cert)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error parsing CA cert: %v", err)
 	}
@@ -70,6 +71,16 @@ func NewCert(ca *CA, req csr.CertificateRequest) (key, cert []byte, err error) {
 	return key, cert, nil
 }
 
+// returns a new private key and a certificate signing request for it
+func newCSR(req csr.CertificateRequest) (csrBytes, key []byte, err error) {
+	g := &csr.Generator{Validator: genkey.Validator}
+	csrBytes, key, err = g.ProcessRequest(&req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error processing CSR: %v", err)
+	}
+	return csrBytes, key, nil
+}
+
 // WriteCert writes cert and key files
 func WriteCert(key, cert []byte, name, dir string) error {
 	// Create destination dir if it doesn't exist
@@ -90,6 +101,42 @@ func WriteCert(key, cert []byte, name, dir string) error {
 	return nil
 }
 
+// DeleteCert removes the key and certificate with the given name from the directory.
+// It is not an error if the files do not exist.
+func DeleteCert(name, dir string) error {
+	for _, f := range []string{keyName(name), certName(name)} {
+		if err := os.Remove(filepath.Join(dir, f)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %q: %v", f, err)
+		}
+	}
+	return nil
+}
+
+// ReadCert reads and parses the certificate with the given name
+func ReadCert(name, dir string) (*x509.Certificate, error) {
+	certBytes, err := ioutil.ReadFile(filepath.Join(dir, certName(name)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificate %s: %v", name, err)
+	}
+	cert, err := parseFirstCertificatePEM(certBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate %s: %v", name, err)
+	}
+	return cert, nil
+}
+
+// parses the first certificate of a PEM encoded certificate chain
+func parseFirstCertificatePEM(certPEM []byte) (*x509.Certificate, error) {
+	certs, err := helpers.ParseCertificatesPEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs[0], nil
+}
+
 // CertKeyPairExists returns true if a key and matching certificate exist.
 // Matching is defined as having the expected file names. No validation
 // is performed on the actual bytes of the cert/key
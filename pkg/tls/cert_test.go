@@ -24,7 +24,7 @@ func TestGenerateNewCertificate(t *testing.T) {
 		Organization:       "someOrganization",
 		OrganizationalUnit: "someOrgUnit",
 	}
-	key, caCert, err := NewCACert("test/ca-csr.json", "someCN", subject)
+	key, caCert, err := NewCACert("test/ca-csr.json", "someCN", subject, "")
 	if err != nil {
 		t.Fatalf("error creating CA: %v", err)
 	}
@@ -282,7 +282,7 @@ func TestCertValid(t *testing.T) {
 		Organization:       "someOrganization",
 		OrganizationalUnit: "someOrgUnit",
 	}
-	key, caCert, err := NewCACert("test/ca-csr.json", "someCN", subject)
+	key, caCert, err := NewCACert("test/ca-csr.json", "someCN", subject, "")
 	if err != nil {
 		t.Fatalf("error creating CA: %v", err)
 	}
@@ -350,3 +350,28 @@ func cleanup(dir string, t *testing.T) {
 		t.Fatalf("failed cleaning up temp directory: %v", err)
 	}
 }
+
+func TestDeleteCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delete-cert-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer cleanup(dir, t)
+	if err := WriteCert([]byte("key"), []byte("cert"), "node", dir); err != nil {
+		t.Fatalf("error writing cert: %v", err)
+	}
+	if err := DeleteCert("node", dir); err != nil {
+		t.Fatalf("error deleting cert: %v", err)
+	}
+	exists, err := CertKeyPairExists("node", dir)
+	if err != nil {
+		t.Fatalf("error checking if cert exists: %v", err)
+	}
+	if exists {
+		t.Errorf("expected cert to be deleted, but it exists")
+	}
+	// Deleting a cert that does not exist is not an error
+	if err := DeleteCert("node", dir); err != nil {
+		t.Errorf("unexpected error deleting cert that does not exist: %v", err)
+	}
+}
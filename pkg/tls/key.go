@@ -0,0 +1,48 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/cloudflare/cfssl/csr"
+)
+
+// KeyAlgorithms are the supported algorithms of the generated private keys
+var KeyAlgorithms = []string{"rsa-2048", "rsa-3072", "rsa-4096", "ecdsa-p256", "ecdsa-p384"}
+
+// DefaultKeyAlgorithm is the algorithm used when none is set
+const DefaultKeyAlgorithm = "rsa-2048"
+
+// NewKeyRequest returns the request for generating a private key with the
+// given algorithm, e.g. "ecdsa-p256". The default algorithm is used if empty.
+func NewKeyRequest(algorithm string) (*csr.BasicKeyRequest, error) {
+	switch algorithm {
+	case "", "rsa-2048":
+		return &csr.BasicKeyRequest{A: "rsa", S: 2048}, nil
+	case "rsa-3072":
+		return &csr.BasicKeyRequest{A: "rsa", S: 3072}, nil
+	case "rsa-4096":
+		return &csr.BasicKeyRequest{A: "rsa", S: 4096}, nil
+	case "ecdsa-p256":
+		return &csr.BasicKeyRequest{A: "ecdsa", S: 256}, nil
+	case "ecdsa-p384":
+		return &csr.BasicKeyRequest{A: "ecdsa", S: 384}, nil
+	default:
+		return nil, fmt.Errorf("key algorithm %q is not supported, options are %v", algorithm, KeyAlgorithms)
+	}
+}
+
+// KeyAlgorithm returns the algorithm of the certificate's public key, in the
+// format accepted by NewKeyRequest
+func KeyAlgorithm(cert *x509.Certificate) string {
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("rsa-%d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ecdsa-p%d", k.Curve.Params().BitSize)
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,50 @@
+package tls
+
+import (
+	"testing"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+func TestNewKeyRequest(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		algo      string
+		size      int
+		valid     bool
+	}{
+		{"", "rsa", 2048, true},
+		{"rsa-3072", "rsa", 3072, true},
+		{"rsa-4096", "rsa", 4096, true},
+		{"ecdsa-p256", "ecdsa", 256, true},
+		{"ecdsa-p384", "ecdsa", 384, true},
+		{"rsa-1024", "", 0, false},
+		{"ecdsa", "", 0, false},
+	}
+	for _, test := range tests {
+		kr, err := NewKeyRequest(test.algorithm)
+		if test.valid != (err == nil) {
+			t.Errorf("%q: expected valid to be %t, but got error %v", test.algorithm, test.valid, err)
+			continue
+		}
+		if test.valid && (kr.A != test.algo || kr.S != test.size) {
+			t.Errorf("%q: expected %s %d, but got %s %d", test.algorithm, test.algo, test.size, kr.A, kr.S)
+		}
+	}
+}
+
+func TestKeyAlgorithm(t *testing.T) {
+	for _, algorithm := range []string{"rsa-3072", "ecdsa-p256", "ecdsa-p384"} {
+		_, cert, err := NewCACert("test/ca-csr.json", "someCN", Subject{}, algorithm)
+		if err != nil {
+			t.Fatalf("%s: error creating CA: %v", algorithm, err)
+		}
+		parsed, err := helpers.ParseCertificatePEM(cert)
+		if err != nil {
+			t.Fatalf("%s: error parsing CA: %v", algorithm, err)
+		}
+		if actual := KeyAlgorithm(parsed); actual != algorithm {
+			t.Errorf("expected key algorithm %q, but got %q", algorithm, actual)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package tls
+
+import (
+	"bytes"
+	cryptotls "crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+const vaultRequestTimeout = 30 * time.Second
+
+// VaultSigner issues certificates using the PKI secrets engine of a HashiCorp Vault server.
+// The private keys are generated locally, and only the certificate signing requests are
+// submitted to Vault, which holds the private key of the CA.
+type VaultSigner struct {
+	// Address of the Vault server, e.g. https://vault:8200
+	Address string
+	// Mount is the path where the PKI secrets engine is mounted
+	Mount string
+	// Role is the Vault role used for signing the certificates
+	Role string
+	// Token used to authenticate with Vault
+	Token string
+	// TTL of the issued certificates. The TTL of the role is used if empty.
+	TTL    string
+	client *http.Client
+}
+
+// NewVaultSigner returns a signer for the Vault server. If caFile is not empty,
+// the server certificate is verified with the CA certificates in the file.
+func NewVaultSigner(address, mount, role, token, ttl, caFile string) (*VaultSigner, error) {
+	transport := &http.Transport{}
+	if caFile != "" {
+		caBytes, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading Vault CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no certificates found in %q", caFile)
+		}
+		transport.TLSClientConfig = &cryptotls.Config{RootCAs: pool}
+	}
+	return &VaultSigner{
+		Address: strings.TrimSuffix(address, "/"),
+		Mount:   strings.Trim(mount, "/"),
+		Role:    role,
+		Token:   token,
+		TTL:     ttl,
+		client:  &http.Client{Transport: transport, Timeout: vaultRequestTimeout},
+	}, nil
+}
+
+type vaultSignRequest struct {
+	CSR        string `json:"csr"`
+	CommonName string `json:"common_name"`
+	AltNames   string `json:"alt_names,omitempty"`
+	IPSANs     string `json:"ip_sans,omitempty"`
+	TTL        string `json:"ttl,omitempty"`
+	Format     string `json:"format"`
+}
+
+type vaultResponse struct {
+	Data struct {
+		Certificate string `json:"certificate"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// Sign generates a private key, and submits a certificate signing request for it to Vault.
+// It returns the private key and the certificate issued by Vault.
+func (v *VaultSigner) Sign(req csr.CertificateRequest) (key, cert []byte, err error) {
+	csrBytes, key, err := newCSR(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	signReq := vaultSignRequest{
+		CSR:        string(csrBytes),
+		CommonName: req.CN,
+		TTL:        v.TTL,
+		Format:     "pem",
+	}
+	altNames := []string{}
+	ipSANs := []string{}
+	for _, h := range req.Hosts {
+		if net.ParseIP(h) != nil {
+			ipSANs = append(ipSANs, h)
+		} else {
+			altNames = append(altNames, h)
+		}
+	}
+	signReq.AltNames = strings.Join(altNames, ",")
+	signReq.IPSANs = strings.Join(ipSANs, ",")
+	body, err := json.Marshal(signReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding sign request: %v", err)
+	}
+	resp, err := v.do("POST", fmt.Sprintf("/v1/%s/sign/%s", v.Mount, v.Role), body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error signing certificate %q: %v", req.CN, err)
+	}
+	if _, err = helpers.ParseCertificatePEM([]byte(resp.Data.Certificate)); err != nil {
+		return nil, nil, fmt.Errorf("error parsing certificate %q issued by Vault: %v", req.CN, err)
+	}
+	return key, []byte(resp.Data.Certificate + "\n"), nil
+}
+
+// CACert returns the certificate of the CA that issues the certificates, followed by
+// the certificates that chain it to the root CA
+func (v *VaultSigner) CACert() ([]byte, error) {
+	resp, err := v.do("GET", fmt.Sprintf("/v1/%s/cert/ca", v.Mount), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error getting CA certificate: %v", err)
+	}
+	ca, err := helpers.ParseCertificatePEM([]byte(resp.Data.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CA certificate: %v", err)
+	}
+	bundle := []byte(strings.TrimSpace(resp.Data.Certificate) + "\n")
+	resp, err = v.do("GET", fmt.Sprintf("/v1/%s/cert/ca_chain", v.Mount), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error getting CA chain: %v", err)
+	}
+	if strings.TrimSpace(resp.Data.Certificate) == "" {
+		return bundle, nil
+	}
+	chain, err := helpers.ParseCertificatesPEM([]byte(resp.Data.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CA chain: %v", err)
+	}
+	for _, c := range chain {
+		// The chain can include the issuing CA
+		if bytes.Equal(c.Raw, ca.Raw) {
+			continue
+		}
+		bundle = append(bundle, helpers.EncodeCertificatePEM(c)...)
+	}
+	return bundle, nil
+}
+
+// sends the request to Vault, and decodes the response
+func (v *VaultSigner) do(method, path string, body []byte) (*vaultResponse, error) {
+	req, err := http.NewRequest(method, v.Address+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	vr := &vaultResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(vr); err != nil {
+		return nil, fmt.Errorf("error decoding response from Vault (status %s): %v", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Vault returned status %s: %s", resp.Status, strings.Join(vr.Errors, "; "))
+	}
+	return vr, nil
+}
@@ -0,0 +1,183 @@
+package tls
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// returns a server that implements the endpoints of the Vault PKI secrets engine used by the signer,
+// and signs certificates with a CA whose chain is the given PEM encoded certificates
+func vaultStubServer(t *testing.T, token, chain string) (*httptest.Server, *x509.Certificate) {
+	caKeyPEM, caCertPEM, err := NewCACert("test/ca-csr.json", "vault-ca", Subject{Organization: "someOrg"}, "")
+	if err != nil {
+		t.Fatalf("error creating CA: %v", err)
+	}
+	caKey, err := helpers.ParsePrivateKeyPEM(caKeyPEM)
+	if err != nil {
+		t.Fatalf("error parsing CA key: %v", err)
+	}
+	caCert, err := helpers.ParseCertificatePEM(caCertPEM)
+	if err != nil {
+		t.Fatalf("error parsing CA certificate: %v", err)
+	}
+	respond := func(w http.ResponseWriter, status int, cert string, errs ...string) {
+		w.WriteHeader(status)
+		resp := map[string]interface{}{"data": map[string]string{"certificate": cert}}
+		if errs != nil {
+			resp = map[string]interface{}{"errors": errs}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			respond(w, http.StatusForbidden, "", "permission denied")
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/pki/cert/ca":
+			respond(w, http.StatusOK, string(caCertPEM))
+		case "/v1/pki/cert/ca_chain":
+			respond(w, http.StatusOK, string(caCertPEM)+chain)
+		case "/v1/pki/sign/kismatic":
+			req := vaultSignRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respond(w, http.StatusBadRequest, "", err.Error())
+				return
+			}
+			block, _ := pem.Decode([]byte(req.CSR))
+			csr, err := x509.ParseCertificateRequest(block.Bytes)
+			if err != nil {
+				respond(w, http.StatusBadRequest, "", err.Error())
+				return
+			}
+			// The TTL of the role is one hour
+			ttl := time.Hour
+			if req.TTL != "" {
+				if ttl, err = time.ParseDuration(req.TTL); err != nil {
+					respond(w, http.StatusBadRequest, "", err.Error())
+					return
+				}
+			}
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(time.Now().UnixNano()),
+				Subject:      pkix.Name{CommonName: req.CommonName},
+				NotBefore:    time.Now(),
+				NotAfter:     time.Now().Add(ttl),
+			}
+			if req.AltNames != "" {
+				template.DNSNames = strings.Split(req.AltNames, ",")
+			}
+			if req.IPSANs != "" {
+				for _, ip := range strings.Split(req.IPSANs, ",") {
+					template.IPAddresses = append(template.IPAddresses, net.ParseIP(ip))
+				}
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template, caCert, csr.PublicKey, caKey)
+			if err != nil {
+				respond(w, http.StatusInternalServerError, "", err.Error())
+				return
+			}
+			respond(w, http.StatusOK, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+		default:
+			respond(w, http.StatusNotFound, "", fmt.Sprintf("no handler for route %q", r.URL.Path))
+		}
+	}))
+	return server, caCert
+}
+
+func TestVaultSignerSign(t *testing.T) {
+	server, caCert := vaultStubServer(t, "token", "")
+	defer server.Close()
+	signer, err := NewVaultSigner(server.URL, "/pki/", "kismatic", "token", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key, cert, err := signer.Sign(*buildReq("node01", []string{"node01", "10.0.0.1"}))
+	if err != nil {
+		t.Fatalf("unexpected error signing certificate: %v", err)
+	}
+	if _, err = helpers.ParsePrivateKeyPEM(key); err != nil {
+		t.Errorf("expected the private key to be generated locally: %v", err)
+	}
+	parsed, err := helpers.ParseCertificatePEM(cert)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	if err = parsed.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("expected certificate to be signed by the Vault CA: %v", err)
+	}
+	if parsed.Subject.CommonName != "node01" || len(parsed.DNSNames) != 1 || parsed.DNSNames[0] != "node01" || len(parsed.IPAddresses) != 1 || parsed.IPAddresses[0].String() != "10.0.0.1" {
+		t.Errorf("unexpected subject or SANs: %v %v %v", parsed.Subject, parsed.DNSNames, parsed.IPAddresses)
+	}
+}
+
+func TestVaultSignerSignWithTTL(t *testing.T) {
+	server, _ := vaultStubServer(t, "token", "")
+	defer server.Close()
+	signer, err := NewVaultSigner(server.URL, "pki", "kismatic", "token", "17520h", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, cert, err := signer.Sign(*buildReq("node01", []string{"node01"}))
+	if err != nil {
+		t.Fatalf("unexpected error signing certificate: %v", err)
+	}
+	parsed, err := helpers.ParseCertificatePEM(cert)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	if expiry := time.Now().Add(17519 * time.Hour); parsed.NotAfter.Before(expiry) {
+		t.Errorf("expected the certificate to expire after %v, but expires at %v", expiry, parsed.NotAfter)
+	}
+}
+
+func TestVaultSignerPermissionDenied(t *testing.T) {
+	server, _ := vaultStubServer(t, "token", "")
+	defer server.Close()
+	signer, err := NewVaultSigner(server.URL, "pki", "kismatic", "wrong", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _, err = signer.Sign(*buildReq("node01", []string{"node01"}))
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected a permission denied error, but got %v", err)
+	}
+}
+
+func TestVaultSignerCACertIncludesChain(t *testing.T) {
+	_, root, err := NewCACert("test/ca-csr.json", "root", Subject{Organization: "someOrg"}, "")
+	if err != nil {
+		t.Fatalf("error creating root CA: %v", err)
+	}
+	// The chain returned by the server includes the issuing CA, which is not repeated
+	server, caCert := vaultStubServer(t, "token", string(root))
+	defer server.Close()
+	signer, err := NewVaultSigner(server.URL, "pki", "kismatic", "token", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bundle, err := signer.CACert()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	certs, err := helpers.ParseCertificatesPEM(bundle)
+	if err != nil {
+		t.Fatalf("error parsing CA bundle: %v", err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(caCert) || certs[1].Subject.CommonName != "root" {
+		t.Errorf("expected the issuing CA followed by the root CA, but got %d certificates", len(certs))
+	}
+}